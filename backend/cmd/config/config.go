@@ -1,32 +1,432 @@
 package config
 
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"gopkg.in/yaml.v3"
+)
+
+// DBConfig is the database snapshots are recorded in
+//
+// Driver is one of "postgres" (at Connection_String), "sqlite" (the file SQLitePath) or "memory". sqlite and memory
+// need no database server and are meant for development; memory loses every snapshot on restart. With AutoMigrate
+// the server applies pending Postgres migrations on startup, otherwise they are applied with `migrate up`.
+//
+// Postgres needs a password, either in Password (usually from CENSYS_DB_PASSWORD) or in Connection_String. There is
+// no default password.
 type DBConfig struct {
-	Connection_String string
+	Driver            string `yaml:"driver" toml:"driver"`
+	Connection_String string `yaml:"connection_string" toml:"connection_string"`
+	Password          string `yaml:"password" toml:"password"`
+	SQLitePath        string `yaml:"sqlite_path" toml:"sqlite_path"`
+	AutoMigrate       bool   `yaml:"auto_migrate" toml:"auto_migrate"`
+}
+
+// PostgresConnectionString is Connection_String with Password set in it, replacing any password it already has
+func (db DBConfig) PostgresConnectionString() string {
+	if db.Password == "" {
+		return db.Connection_String
+	}
+	if parsed, err := url.Parse(db.Connection_String); err == nil && parsed.Scheme != "" {
+		username := ""
+		if parsed.User != nil {
+			username = parsed.User.Username()
+		}
+		parsed.User = url.UserPassword(username, db.Password)
+		return parsed.String()
+	}
+	quoted := "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(db.Password) + "'"
+	return strings.TrimSpace(passwordSettingPattern.ReplaceAllString(db.Connection_String, "")) + " password=" + quoted
+}
+
+// hasPassword reports whether a key=value or URL Postgres connection string sets a password
+func hasPassword(connection string) bool {
+	if parsed, err := url.Parse(connection); err == nil && parsed.Scheme != "" && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			return true
+		}
+	}
+	return passwordPattern.MatchString(connection)
 }
 
 type HostFileConfig struct {
-	MaxSize  int
-	Location string
+	MaxSize int `yaml:"max_size" toml:"max_size"`
+	// MaxRequestSize limits one upload request, including the decompressed contents of archives
+	MaxRequestSize int    `yaml:"max_request_size" toml:"max_request_size"`
+	Location       string `yaml:"location" toml:"location"`
+}
+
+// BlobStoreConfig selects where snapshot contents are stored
+//
+// Driver is one of "filesystem" (under HostFileConfig.Location), "memory" (with the memory database only) or "s3".
+// Compression is the codec new snapshots are stored with, one of "none", "gzip" or "zstd".
+type BlobStoreConfig struct {
+	Driver      string   `yaml:"driver" toml:"driver"`
+	Compression string   `yaml:"compression" toml:"compression"`
+	S3          S3Config `yaml:"s3" toml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	Region          string `yaml:"region" toml:"region"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
+	Prefix          string `yaml:"prefix" toml:"prefix"`
+}
+
+// RetentionConfig is the retention policy applied by the prune command and the background prune job
+//
+// Every snapshot is kept for KeepAllDays, then the latest of each day until KeepDailyDays, then the latest of each
+// week. The first and latest snapshot of each host are always kept. Snapshots deleted through the API can be
+// restored for PurgeDeletedAfterDays, and are then purged. PruneInterval runs pruning in the background of the
+// server, and 0 disables it.
+type RetentionConfig struct {
+	KeepAllDays           int           `yaml:"keep_all_days" toml:"keep_all_days"`
+	KeepDailyDays         int           `yaml:"keep_daily_days" toml:"keep_daily_days"`
+	PurgeDeletedAfterDays int           `yaml:"purge_deleted_after_days" toml:"purge_deleted_after_days"`
+	PruneInterval         time.Duration `yaml:"prune_interval" toml:"prune_interval"`
+}
+
+// CORSConfig lists the origins browsers may call the API from, e.g. the frontend's "http://localhost:3000"
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
 }
 
 type ServerConfigurations struct {
-	DBConfig       DBConfig
-	HostFileConfig HostFileConfig
-	Port           string
+	DBConfig        DBConfig        `yaml:"db" toml:"db"`
+	HostFileConfig  HostFileConfig  `yaml:"host_file" toml:"host_file"`
+	BlobStoreConfig BlobStoreConfig `yaml:"blob_store" toml:"blob_store"`
+	RetentionConfig RetentionConfig `yaml:"retention" toml:"retention"`
+	CORSConfig      CORSConfig      `yaml:"cors" toml:"cors"`
+	Port            string          `yaml:"port" toml:"port"`
 }
 
-func Load() ServerConfigurations {
+// envPrefix starts the name of every environment variable read by Load
+const envPrefix = "CENSYS_"
+
+// redacted replaces secrets in the printed config
+const redacted = "REDACTED"
+
+// Defaults is the configuration before any file, environment variable or flag is applied
+func Defaults() ServerConfigurations {
 	db := DBConfig{
-		Connection_String: "host=localhost user=backend password=backendpassword dbname=censys2025 port=5432 sslmode=disable TimeZone=UTC",
+		Driver:            "postgres",
+		SQLitePath:        "censys.db",
+		Connection_String: "host=localhost user=backend dbname=censys2025 port=5432 sslmode=disable TimeZone=UTC",
 	}
 	host := HostFileConfig{
-		MaxSize:  (25 << 20),
-		Location: "./backend/snapshots",
+		MaxSize:        (25 << 20),
+		MaxRequestSize: (250 << 20),
+		Location:       "./backend/snapshots",
+	}
+
+	blobStore := BlobStoreConfig{
+		Driver:      "filesystem",
+		Compression: "zstd",
+	}
+
+	retention := RetentionConfig{
+		KeepAllDays:           30,
+		KeepDailyDays:         180,
+		PurgeDeletedAfterDays: 7,
+	}
+
+	cors := CORSConfig{
+		AllowedOrigins: []string{"http://localhost:3000", "http://127.0.0.1:3000"},
 	}
 
 	return ServerConfigurations{
-		DBConfig:       db,
-		HostFileConfig: host,
-		Port:           ":8080",
+		DBConfig:        db,
+		HostFileConfig:  host,
+		BlobStoreConfig: blobStore,
+		RetentionConfig: retention,
+		CORSConfig:      cors,
+		Port:            ":8080",
+	}
+}
+
+// Load builds the configuration from the defaults, then the config file, then environment variables, then flags,
+// each overriding the one before, and validates it
+//
+// Summary: The config file is set with --config or CENSYS_CONFIG, and is YAML (.yaml, .yml) or TOML (.toml) with
+// the keys of the yaml/toml struct tags. Each setting also has a flag and an environment variable named after its
+// file key, e.g. blob_store.s3.bucket is --blob-store-s3-bucket and CENSYS_BLOB_STORE_S3_BUCKET. Lists are comma
+// separated in flags and environment variables.
+//
+// Params:
+//   - args: the command line without the program name. Flags are read up to the first non-flag argument.
+//   - lookupEnv: looks up environment variables, usually os.LookupEnv
+//
+// Responses:
+//   - ServerConfigurations: the effective configuration
+//   - []string: the arguments after the flags, i.e. the subcommand and its arguments
+//   - error: flag.ErrHelp if -h was given, or error if a source cannot be read or the result is invalid {nil | error}
+func Load(args []string, lookupEnv func(string) (string, bool)) (ServerConfigurations, []string, error) {
+	// The flags are parsed once to find the config file, and again on top of the file and environment
+	var configPath string
+	scratch := Defaults()
+	preview := newFlagSet(&scratch, &configPath)
+	preview.SetOutput(io.Discard)
+	if err := preview.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			newFlagSet(&scratch, &configPath).Usage()
+		}
+		return ServerConfigurations{}, nil, err
+	}
+	if configPath == "" {
+		configPath, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+
+	serverConfig := Defaults()
+	if configPath != "" {
+		if err := loadFile(configPath, &serverConfig); err != nil {
+			return ServerConfigurations{}, nil, err
+		}
+	}
+
+	flags := newFlagSet(&serverConfig, &configPath)
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		name := envName(f.Name)
+		if value, ok := lookupEnv(name); ok {
+			if err := flags.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("Invalid %s: %v", name, err))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return ServerConfigurations{}, nil, err
+	}
+	if err := flags.Parse(args); err != nil {
+		return ServerConfigurations{}, nil, err
+	}
+
+	if err := serverConfig.Validate(); err != nil {
+		return ServerConfigurations{}, nil, err
+	}
+	return serverConfig, flags.Args(), nil
+}
+
+// newFlagSet registers a flag for every setting, bound to the fields of serverConfig
+func newFlagSet(serverConfig *ServerConfigurations, configPath *string) *flag.FlagSet {
+	flags := flag.NewFlagSet("backend", flag.ContinueOnError)
+	flags.StringVar(configPath, "config", *configPath, "YAML or TOML config file (env "+envPrefix+"CONFIG)")
+
+	db := &serverConfig.DBConfig
+	flags.StringVar(&db.Driver, "db-driver", db.Driver, "database: postgres, sqlite or memory")
+	flags.StringVar(&db.Connection_String, "db-connection-string", db.Connection_String, "Postgres connection string")
+	flags.StringVar(&db.Password, "db-password", db.Password, "Postgres password, if not in the connection string")
+	flags.StringVar(&db.SQLitePath, "db-sqlite-path", db.SQLitePath, "SQLite database file")
+	flags.BoolVar(&db.AutoMigrate, "db-auto-migrate", db.AutoMigrate, "apply pending migrations on startup")
+
+	host := &serverConfig.HostFileConfig
+	flags.IntVar(&host.MaxSize, "host-file-max-size", host.MaxSize, "largest snapshot file accepted, in bytes")
+	flags.IntVar(&host.MaxRequestSize, "host-file-max-request-size", host.MaxRequestSize, "largest upload request accepted, in bytes")
+	flags.StringVar(&host.Location, "host-file-location", host.Location, "directory of the filesystem blob store")
+
+	blobStore := &serverConfig.BlobStoreConfig
+	flags.StringVar(&blobStore.Driver, "blob-store-driver", blobStore.Driver, "blob store: filesystem, memory or s3")
+	flags.StringVar(&blobStore.Compression, "blob-store-compression", blobStore.Compression, "codec new snapshots are stored with: none, gzip or zstd")
+	s3 := &blobStore.S3
+	flags.StringVar(&s3.Endpoint, "blob-store-s3-endpoint", s3.Endpoint, "S3 endpoint URL")
+	flags.StringVar(&s3.Region, "blob-store-s3-region", s3.Region, "S3 region")
+	flags.StringVar(&s3.Bucket, "blob-store-s3-bucket", s3.Bucket, "S3 bucket")
+	flags.StringVar(&s3.AccessKeyID, "blob-store-s3-access-key-id", s3.AccessKeyID, "S3 access key id")
+	flags.StringVar(&s3.SecretAccessKey, "blob-store-s3-secret-access-key", s3.SecretAccessKey, "S3 secret access key")
+	flags.StringVar(&s3.Prefix, "blob-store-s3-prefix", s3.Prefix, "prefix of every S3 key")
+
+	retention := &serverConfig.RetentionConfig
+	flags.IntVar(&retention.KeepAllDays, "retention-keep-all-days", retention.KeepAllDays, "keep every snapshot younger than this many days")
+	flags.IntVar(&retention.KeepDailyDays, "retention-keep-daily-days", retention.KeepDailyDays, "keep the latest snapshot of each day until this many days")
+	flags.IntVar(&retention.PurgeDeletedAfterDays, "retention-purge-deleted-after-days", retention.PurgeDeletedAfterDays, "purge snapshots deleted this many days ago")
+	flags.DurationVar(&retention.PruneInterval, "retention-prune-interval", retention.PruneInterval, "prune in the background this often, 0 disables")
+
+	flags.Var((*stringList)(&serverConfig.CORSConfig.AllowedOrigins), "cors-allowed-origins", "comma separated origins allowed to call the API")
+	flags.StringVar(&serverConfig.Port, "port", serverConfig.Port, "address to listen on")
+	return flags
+}
+
+// envName is the environment variable of a flag, e.g. CENSYS_BLOB_STORE_S3_BUCKET for blob-store-s3-bucket
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func loadFile(path string, serverConfig *ServerConfigurations) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read config file: %v", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(serverConfig); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("Failed to parse config file %s: %v", path, err)
+		}
+	case ".toml":
+		metadata, err := toml.NewDecoder(file).Decode(serverConfig)
+		if err != nil {
+			return fmt.Errorf("Failed to parse config file %s: %v", path, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("Failed to parse config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("Unknown config file format %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	return nil
+}
+
+// Validate checks every setting and reports all of the problems found
+func (serverConfig ServerConfigurations) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("Invalid config: "+format, args...))
+	}
+
+	db := serverConfig.DBConfig
+	switch db.Driver {
+	case "", "postgres":
+		if db.Connection_String == "" {
+			invalid("db.connection_string must be set for the postgres database")
+		} else if db.Password == "" && !hasPassword(db.Connection_String) {
+			invalid("db.password must be set for the postgres database, e.g. with %sDB_PASSWORD", envPrefix)
+		}
+	case "sqlite":
+		if db.SQLitePath == "" {
+			invalid("db.sqlite_path must be set for the sqlite database")
+		}
+	case "memory":
+	default:
+		invalid("unknown db.driver %q, expected postgres, sqlite or memory", db.Driver)
+	}
+
+	host := serverConfig.HostFileConfig
+	if host.MaxSize <= 0 {
+		invalid("host_file.max_size must be positive")
+	}
+	if host.MaxRequestSize < host.MaxSize {
+		invalid("host_file.max_request_size (%d) must not be smaller than host_file.max_size (%d)", host.MaxRequestSize, host.MaxSize)
+	}
+
+	blobStore := serverConfig.BlobStoreConfig
+	switch blobStore.Driver {
+	case "", "filesystem":
+		if host.Location == "" {
+			invalid("host_file.location must be set for the filesystem blob store")
+		}
+	case "memory":
+		// Rows of a database that outlives the process would point at blobs lost on restart
+		if db.Driver != "memory" {
+			invalid("blob_store.driver memory needs db.driver memory, the blobs of other databases would be lost on restart")
+		}
+	case "s3":
+		if blobStore.S3.Endpoint == "" || blobStore.S3.Bucket == "" {
+			invalid("blob_store.s3.endpoint and blob_store.s3.bucket must be set for the s3 blob store")
+		}
+	default:
+		invalid("unknown blob_store.driver %q, expected filesystem, memory or s3", blobStore.Driver)
+	}
+	if _, err := compression.Parse(blobStore.Compression); err != nil {
+		invalid("blob_store.compression: %v", err)
+	}
+
+	retention := serverConfig.RetentionConfig
+	if retention.KeepAllDays < 0 || retention.PurgeDeletedAfterDays < 0 || retention.PruneInterval < 0 {
+		invalid("retention settings must not be negative")
+	}
+	if retention.KeepDailyDays < retention.KeepAllDays {
+		invalid("retention.keep_daily_days (%d) must not be shorter than retention.keep_all_days (%d)", retention.KeepDailyDays, retention.KeepAllDays)
+	}
+
+	for _, origin := range serverConfig.CORSConfig.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+			invalid("cors.allowed_origins entry %q must be * or a scheme and host, e.g. https://example.com", origin)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(serverConfig.Port); err != nil {
+		invalid("port %q must be an address such as :8080: %v", serverConfig.Port, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with passwords and secret keys replaced, safe to print or log
+func (serverConfig ServerConfigurations) Redacted() ServerConfigurations {
+	serverConfig.DBConfig.Connection_String = redactConnectionString(serverConfig.DBConfig.Connection_String)
+	if serverConfig.DBConfig.Password != "" {
+		serverConfig.DBConfig.Password = redacted
+	}
+	if serverConfig.BlobStoreConfig.S3.SecretAccessKey != "" {
+		serverConfig.BlobStoreConfig.S3.SecretAccessKey = redacted
+	}
+	serverConfig.CORSConfig.AllowedOrigins = append([]string{}, serverConfig.CORSConfig.AllowedOrigins...)
+	return serverConfig
+}
+
+// String is the redacted configuration as YAML, in the same format as a config file
+func (serverConfig ServerConfigurations) String() string {
+	out, err := yaml.Marshal(serverConfig.Redacted())
+	if err != nil {
+		return fmt.Sprintf("unprintable config: %v", err)
+	}
+	return string(out)
+}
+
+var passwordPattern = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// passwordSettingPattern matches a password setting with the whitespace before it, to remove it
+var passwordSettingPattern = regexp.MustCompile(`\s*` + passwordPattern.String())
+
+// redactConnectionString hides the password of a key=value or URL Postgres connection string
+func redactConnectionString(connection string) string {
+	if parsed, err := url.Parse(connection); err == nil && parsed.Scheme != "" && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+		}
+		connection = parsed.String()
+	}
+	return passwordPattern.ReplaceAllString(connection, "${1}"+redacted)
+}
+
+// stringList is a comma separated flag. Setting it replaces the list rather than appending to it.
+type stringList []string
+
+func (list *stringList) String() string {
+	if list == nil {
+		return ""
+	}
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*list = append(*list, item)
+		}
 	}
+	return nil
 }
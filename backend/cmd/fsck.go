@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/endingwithali/2025censys/cmd/config"
+	"github.com/endingwithali/2025censys/internal/service"
+)
+
+// runFsck handles `fsck [--repair]`
+//
+// Summary: Reports orphaned blobs, dangling and pending rows, hash mismatches and unparseable blobs. With --repair
+// the issues are fixed, see service.FsckService.Repair.
+//
+// Exit codes:
+//   - 0: no issues, or every issue was repaired
+//   - 1: issues were found (without --repair) or could not be repaired
+//   - 2: the check could not run
+func runFsck(serverConfig config.ServerConfigurations, args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "re-index orphan blobs, quarantine broken blobs and remove dangling rows")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	snapshotRepo, differenceRepo, serviceIndex, err := openRepos(context.Background(), serverConfig)
+	if err != nil {
+		log.Printf("fsck: %v", err)
+		return 2
+	}
+	blobStore, err := newBlobStore(serverConfig)
+	if err != nil {
+		log.Printf("fsck: Failed to set up blob store: %v", err)
+		return 2
+	}
+	snapshotService, err := newSnapshotService(serverConfig, snapshotRepo, differenceRepo, serviceIndex, blobStore)
+	if err != nil {
+		log.Printf("fsck: Failed to set up snapshot service: %v", err)
+		return 2
+	}
+	fsckService := service.NewFsckService(snapshotRepo, blobStore, snapshotService)
+
+	return fsck(context.Background(), fsckService, *repair, os.Stdout)
+}
+
+func fsck(ctx context.Context, fsckService *service.FsckService, repair bool, out io.Writer) int {
+	report, err := fsckService.Check(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "fsck failed: %v\n", err)
+		return 2
+	}
+	for _, issue := range report.Issues {
+		fmt.Fprintln(out, formatIssue(issue))
+	}
+	fmt.Fprintf(out, "checked %d rows and %d blobs, found %d issues\n", report.RowsChecked, report.BlobsChecked, len(report.Issues))
+	if len(report.Issues) == 0 {
+		return 0
+	}
+	if !repair {
+		fmt.Fprintln(out, "run with --repair to fix")
+		return 1
+	}
+
+	failed := 0
+	for _, result := range fsckService.Repair(ctx, report) {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(out, "FAILED %s %s: %v\n", result.Issue.Kind, result.Issue.Key, result.Err)
+			continue
+		}
+		fmt.Fprintf(out, "REPAIRED %s %s: %s\n", result.Issue.Kind, result.Issue.Key, result.Action)
+	}
+	fmt.Fprintf(out, "repaired %d of %d issues\n", len(report.Issues)-failed, len(report.Issues))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func formatIssue(issue service.FsckIssue) string {
+	line := fmt.Sprintf("%s %s", issue.Kind, issue.Key)
+	for _, snapshot := range issue.Snapshots {
+		line += fmt.Sprintf(" [%s %s]", snapshot.Host_IP, snapshot.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+	return line + ": " + issue.Detail
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/endingwithali/2025censys/cmd/config"
+	"github.com/endingwithali/2025censys/internal/service"
+)
+
+// runImport handles `import [--concurrency N] <directory|glob>...` and `import --legacy`
+//
+// Summary: Ingests every .json file in the directories (recursively) and glob patterns given, printing one line per
+// file as it finishes followed by a summary. Already imported snapshots are skipped, so an import can be re-run
+// after fixing failures. With --legacy, the snapshot rows written before snapshots were stored by content are
+// converted instead, see service.ConvertLegacySnapshot.
+//
+// Exit codes:
+//   - 0: every file was imported or was a duplicate
+//   - 1: at least one file was invalid or failed
+//   - 2: the import could not run
+func runImport(serverConfig config.ServerConfigurations, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	concurrency := flags.Int("concurrency", 4, "maximum number of files imported at once")
+	legacy := flags.Bool("legacy", false, "convert snapshot rows stored before content addressing instead of importing files")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (flags.NArg() == 0) != *legacy {
+		fmt.Fprintln(os.Stderr, "usage: import [--concurrency N] <directory|glob>... | import --legacy")
+		return 2
+	}
+
+	var paths []string
+	if !*legacy {
+		var err error
+		if paths, err = service.ExpandImportPaths(flags.Args()); err != nil {
+			log.Printf("import: %v", err)
+			return 2
+		}
+	}
+
+	snapshotRepo, differenceRepo, serviceIndex, err := openRepos(context.Background(), serverConfig)
+	if err != nil {
+		log.Printf("import: %v", err)
+		return 2
+	}
+	blobStore, err := newBlobStore(serverConfig)
+	if err != nil {
+		log.Printf("import: Failed to set up blob store: %v", err)
+		return 2
+	}
+	snapshotService, err := newSnapshotService(serverConfig, snapshotRepo, differenceRepo, serviceIndex, blobStore)
+	if err != nil {
+		log.Printf("import: Failed to set up snapshot service: %v", err)
+		return 2
+	}
+	importService := service.NewImportService(snapshotService, serverConfig.HostFileConfig.MaxSize)
+
+	// Ctrl-C lets the files being imported finish and reports the rest as failed, so the import can be re-run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *legacy {
+		return importLegacy(ctx, importService, os.Stdout)
+	}
+	return importFiles(ctx, importService, paths, *concurrency, os.Stdout)
+}
+
+func importLegacy(ctx context.Context, importService *service.ImportService, out io.Writer) int {
+	results, err := importService.ImportLegacy(ctx, func(result service.ImportResult) {
+		if result.Err != nil {
+			fmt.Fprintf(out, "%-9s %s: %v\n", result.Status, result.Path, result.Err)
+			return
+		}
+		fmt.Fprintf(out, "%-9s %s\n", result.Status, result.Path)
+	})
+	if err != nil {
+		fmt.Fprintf(out, "import failed: %v\n", err)
+		return 2
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	fmt.Fprintf(out, "%d legacy snapshots: %d converted, %d failed\n", len(results), len(results)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func importFiles(ctx context.Context, importService *service.ImportService, paths []string, concurrency int, out io.Writer) int {
+	results := importService.Import(ctx, paths, concurrency, func(result service.ImportResult) {
+		if result.Err != nil && result.Status != service.ImportDuplicate {
+			fmt.Fprintf(out, "%-9s %s: %v\n", result.Status, result.Path, result.Err)
+			return
+		}
+		fmt.Fprintf(out, "%-9s %s\n", result.Status, result.Path)
+	})
+
+	counts := map[service.ImportStatus]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	fmt.Fprintf(out, "%d files: %d imported, %d duplicate, %d invalid, %d failed\n", len(results),
+		counts[service.ImportImported], counts[service.ImportDuplicate], counts[service.ImportInvalid], counts[service.ImportFailed])
+	if counts[service.ImportInvalid]+counts[service.ImportFailed] > 0 {
+		return 1
+	}
+	return 0
+}
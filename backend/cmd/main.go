@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/endingwithali/2025censys/cmd/config"
 	"github.com/endingwithali/2025censys/internal/api"
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
 	"github.com/endingwithali/2025censys/internal/repo"
 	"github.com/endingwithali/2025censys/internal/service"
 	"gorm.io/driver/postgres"
@@ -16,23 +25,177 @@ import (
 // 	DB *gorm.DB
 // }
 
+// commands are the subcommands of the backend binary. With no subcommand the API server is started.
+var commands = map[string]func(serverConfig config.ServerConfigurations, args []string) int{
+	"config":  runConfig,
+	"fsck":    runFsck,
+	"import":  runImport,
+	"migrate": runMigrate,
+	"prune":   runPrune,
+	"reindex": runReindex,
+}
+
 func main() {
 
-	serverConfig := config.Load()
+	serverConfig, args, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Printf("Failed to load config: %v", err)
+		os.Exit(2)
+	}
+
+	if len(args) > 0 {
+		command, ok := commands[args[0]]
+		if !ok {
+			log.Fatalf("Unknown command %q, expected one of: %s", args[0], strings.Join(commandNames(), ", "))
+		}
+		os.Exit(command(serverConfig, args[1:]))
+	}
+	log.Printf("Config:\n%s", serverConfig)
+
+	snapshotRepo, differenceRepo, serviceIndex, err := openRepos(context.Background(), serverConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	db, err := gorm.Open(postgres.Open(serverConfig.DBConfig.Connection_String), &gorm.Config{})
+	blobStore, err := newBlobStore(serverConfig)
 	if err != nil {
-		log.Fatalf("Failed to open db: %v", err)
+		log.Fatalf("Failed to set up blob store: %v", err)
 	}
 
 	// Setting up layers
-	snapshotRepo := repo.NewSnapshotRepo(db)
-	snapshotService := service.NewSnapshotService(snapshotRepo, serverConfig.HostFileConfig.Location)
-	differenceSerive := service.NewDifferencesServicet()
-	router := api.New(snapshotService, differenceSerive, serverConfig.HostFileConfig.MaxSize)
+	snapshotService, err := newSnapshotService(serverConfig, snapshotRepo, differenceRepo, serviceIndex, blobStore)
+	if err != nil {
+		log.Fatalf("Failed to set up snapshot service: %v", err)
+	}
+	differenceSerive := service.NewDifferencesServicet(differenceRepo, blobStore)
+	router := api.New(snapshotService, differenceSerive, serverConfig.HostFileConfig.MaxSize, serverConfig.HostFileConfig.MaxRequestSize, serverConfig.CORSConfig.AllowedOrigins)
+
+	if interval := serverConfig.RetentionConfig.PruneInterval; interval > 0 {
+		policy := retentionPolicy(serverConfig.RetentionConfig.KeepAllDays, serverConfig.RetentionConfig.KeepDailyDays, serverConfig.RetentionConfig.PurgeDeletedAfterDays)
+		if err := policy.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		pruneService := service.NewPruneService(snapshotRepo, snapshotService, policy)
+		log.Printf("Pruning snapshots every %s", interval)
+		go pruneService.Run(context.Background(), interval)
+	}
 
 	log.Printf("Listening on Port %s", serverConfig.Port)
 	if err = http.ListenAndServe(serverConfig.Port, router); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// runConfig handles `config`, printing the effective configuration with secrets redacted. Invalid configurations
+// never get here, Load rejects them.
+func runConfig(serverConfig config.ServerConfigurations, args []string) int {
+	if len(args) > 0 {
+		log.Printf("config: Unexpected arguments %v", args)
+		return 2
+	}
+	fmt.Print(serverConfig)
+	return 0
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func openDB(serverConfig config.ServerConfigurations) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(serverConfig.DBConfig.PostgresConnectionString()), &gorm.Config{})
+}
+
+// openRepos opens the configured database. A Postgres database has its migrations checked, see checkMigrations.
+// The memory database has no DifferenceRepo, so differences are recomputed on every request.
+func openRepos(ctx context.Context, serverConfig config.ServerConfigurations) (repo.SnapshotRepo, repo.DifferenceRepo, repo.ServiceIndexRepo, error) {
+	switch serverConfig.DBConfig.Driver {
+	case "", "postgres":
+		db, err := openDB(serverConfig)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to open db: %v", err)
+		}
+		if err := checkMigrations(ctx, db, serverConfig.DBConfig.AutoMigrate); err != nil {
+			return nil, nil, nil, err
+		}
+		return repo.NewSnapshotRepo(db), repo.NewDifferenceRepo(db), repo.NewServiceIndexRepo(db), nil
+	case "sqlite":
+		db, err := repo.OpenSQLite(serverConfig.DBConfig.SQLitePath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to open db: %v", err)
+		}
+		return repo.NewSnapshotRepo(db), repo.NewDifferenceRepo(db), repo.NewServiceIndexRepo(db), nil
+	case "memory":
+		snapshotRepo := repo.NewMemorySnapshotRepo()
+		return snapshotRepo, nil, repo.NewMemoryServiceIndexRepo(snapshotRepo), nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown db driver %q", serverConfig.DBConfig.Driver)
+	}
+}
+
+// checkMigrations applies pending migrations if autoMigrate is set, and otherwise warns about them
+func checkMigrations(ctx context.Context, db *gorm.DB, autoMigrate bool) error {
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	if autoMigrate {
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			log.Printf("Applied migration %s", formatMigration(migration.Version, migration.Name))
+		}
+		return err
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to check migrations: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			log.Printf("Migration %s is pending, run migrate up or set DBConfig.AutoMigrate", formatMigration(status.Version, status.Name))
+		}
+	}
+	return nil
+}
+
+// newSnapshotService creates the snapshot service, storing new snapshots with the configured compression and
+// indexing their services in serviceIndex
+func newSnapshotService(serverConfig config.ServerConfigurations, snapshotRepo repo.SnapshotRepo, differenceRepo repo.DifferenceRepo, serviceIndex repo.ServiceIndexRepo, blobStore blobstore.BlobStore) (*service.SnapshotService, error) {
+	codec, err := compression.Parse(serverConfig.BlobStoreConfig.Compression)
+	if err != nil {
+		return nil, err
+	}
+	snapshotService := service.NewSnapshotService(snapshotRepo, blobStore)
+	snapshotService.Compression = codec
+	snapshotService.ServiceIndex = serviceIndex
+	snapshotService.DifferenceRepo = differenceRepo
+	return snapshotService, nil
+}
+
+func newBlobStore(serverConfig config.ServerConfigurations) (blobstore.BlobStore, error) {
+	switch serverConfig.BlobStoreConfig.Driver {
+	case "", "filesystem":
+		return blobstore.NewFileSystemStore(serverConfig.HostFileConfig.Location), nil
+	case "memory":
+		return blobstore.NewMemoryStore(), nil
+	case "s3":
+		s3 := serverConfig.BlobStoreConfig.S3
+		return blobstore.NewS3Store(blobstore.S3Config{
+			Endpoint:        s3.Endpoint,
+			Region:          s3.Region,
+			Bucket:          s3.Bucket,
+			AccessKeyID:     s3.AccessKeyID,
+			SecretAccessKey: s3.SecretAccessKey,
+			Prefix:          s3.Prefix,
+		}, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store driver %q", serverConfig.BlobStoreConfig.Driver)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/endingwithali/2025censys/cmd/config"
+	"github.com/endingwithali/2025censys/internal/repo/migrations"
+	"gorm.io/gorm"
+)
+
+// runMigrate handles `migrate up`, `migrate down [--steps N]` and `migrate status`
+//
+// Summary: Applies or reverts the database migrations built into the binary, see package migrations. up applies
+// every pending migration, down reverts the latest N (default 1), and status lists each migration and when it was
+// applied.
+//
+// Exit codes:
+//   - 0: the migrations were applied or reverted, or status found none pending
+//   - 1: a migration failed, or status found pending migrations
+//   - 2: migrating could not run
+func runMigrate(serverConfig config.ServerConfigurations, args []string) int {
+	if len(args) == 0 {
+		log.Printf("migrate: expected one of: up, down, status")
+		return 2
+	}
+	action, args := args[0], args[1:]
+	flags := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	steps := 1
+	if action == "down" {
+		flags.IntVar(&steps, "steps", 1, "number of migrations to revert")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if driver := serverConfig.DBConfig.Driver; driver != "" && driver != "postgres" {
+		log.Printf("migrate: Only postgres databases have migrations, the %s database is created when opened", driver)
+		return 2
+	}
+	db, err := openDB(serverConfig)
+	if err != nil {
+		log.Printf("migrate: Failed to open db: %v", err)
+		return 2
+	}
+	migrator, err := newMigrator(db)
+	if err != nil {
+		log.Printf("migrate: %v", err)
+		return 2
+	}
+
+	ctx := context.Background()
+	switch action {
+	case "up":
+		return migrateUp(ctx, migrator, os.Stdout)
+	case "down":
+		return migrateDown(ctx, migrator, steps, os.Stdout)
+	case "status":
+		return migrateStatus(ctx, migrator, os.Stdout)
+	default:
+		log.Printf("migrate: Unknown action %q, expected one of: up, down, status", action)
+		return 2
+	}
+}
+
+func newMigrator(db *gorm.DB) (*migrations.Migrator, error) {
+	embedded, err := migrations.Embedded()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load migrations: %v", err)
+	}
+	return migrations.NewMigrator(db, embedded), nil
+}
+
+func migrateUp(ctx context.Context, migrator *migrations.Migrator, out io.Writer) int {
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		fmt.Fprintf(out, "applied %s\n", formatMigration(migration.Version, migration.Name))
+	}
+	if err != nil {
+		fmt.Fprintf(out, "migrate up failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "applied %d migrations\n", len(applied))
+	return 0
+}
+
+func migrateDown(ctx context.Context, migrator *migrations.Migrator, steps int, out io.Writer) int {
+	reverted, err := migrator.Down(ctx, steps)
+	for _, migration := range reverted {
+		fmt.Fprintf(out, "reverted %s\n", formatMigration(migration.Version, migration.Name))
+	}
+	if err != nil {
+		fmt.Fprintf(out, "migrate down failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "reverted %d migrations\n", len(reverted))
+	return 0
+}
+
+func migrateStatus(ctx context.Context, migrator *migrations.Migrator, out io.Writer) int {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "migrate status failed: %v\n", err)
+		return 2
+	}
+	pending := 0
+	for _, status := range statuses {
+		switch {
+		case status.AppliedAt == nil:
+			pending++
+			fmt.Fprintf(out, "pending  %s\n", formatMigration(status.Version, status.Name))
+		case status.Name == "":
+			fmt.Fprintf(out, "unknown  %04d (applied %s, newer than this binary)\n", status.Version, status.AppliedAt.UTC().Format(time.RFC3339))
+		default:
+			fmt.Fprintf(out, "applied  %s (%s)\n", formatMigration(status.Version, status.Name), status.AppliedAt.UTC().Format(time.RFC3339))
+		}
+	}
+	if pending > 0 {
+		fmt.Fprintf(out, "%d migrations pending, run migrate up to apply\n", pending)
+		return 1
+	}
+	return 0
+}
+
+func formatMigration(version int, name string) string {
+	return fmt.Sprintf("%04d_%s", version, name)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/endingwithali/2025censys/cmd/config"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/service"
+)
+
+// runPrune handles `prune [--dry-run] [--keep-all-days N] [--keep-daily-days N] [--purge-deleted-after-days N]`
+//
+// Summary: Applies the retention policy from RetentionConfig and purges soft deleted snapshots past their grace
+// period, see service.RetentionPolicy. The flags override the configured policy for this run. With --dry-run the
+// snapshots that would be removed are listed and nothing is removed.
+//
+// Blobs are only protected from uploads within one process, so a server taking uploads should prune itself with
+// RetentionConfig.PruneInterval rather than this command.
+//
+// Exit codes:
+//   - 0: every snapshot outside the policy was removed, or listed with --dry-run
+//   - 1: some snapshots could not be removed
+//   - 2: pruning could not run
+func runPrune(serverConfig config.ServerConfigurations, args []string) int {
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the snapshots that would be removed without removing them")
+	keepAllDays := flags.Int("keep-all-days", serverConfig.RetentionConfig.KeepAllDays, "keep every snapshot younger than this many days")
+	keepDailyDays := flags.Int("keep-daily-days", serverConfig.RetentionConfig.KeepDailyDays, "keep the latest snapshot of each day until this many days, then the latest of each week")
+	purgeDeletedAfterDays := flags.Int("purge-deleted-after-days", serverConfig.RetentionConfig.PurgeDeletedAfterDays, "purge snapshots deleted this many days ago")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	policy := retentionPolicy(*keepAllDays, *keepDailyDays, *purgeDeletedAfterDays)
+	if err := policy.Validate(); err != nil {
+		log.Printf("prune: %v", err)
+		return 2
+	}
+
+	snapshotRepo, differenceRepo, serviceIndex, err := openRepos(context.Background(), serverConfig)
+	if err != nil {
+		log.Printf("prune: %v", err)
+		return 2
+	}
+	blobStore, err := newBlobStore(serverConfig)
+	if err != nil {
+		log.Printf("prune: Failed to set up blob store: %v", err)
+		return 2
+	}
+	snapshotService, err := newSnapshotService(serverConfig, snapshotRepo, differenceRepo, serviceIndex, blobStore)
+	if err != nil {
+		log.Printf("prune: Failed to set up snapshot service: %v", err)
+		return 2
+	}
+	pruneService := service.NewPruneService(snapshotRepo, snapshotService, policy)
+
+	return prune(context.Background(), pruneService, *dryRun, time.Now(), os.Stdout)
+}
+
+func retentionPolicy(keepAllDays int, keepDailyDays int, purgeDeletedAfterDays int) service.RetentionPolicy {
+	day := 24 * time.Hour
+	return service.RetentionPolicy{
+		KeepAll:           time.Duration(keepAllDays) * day,
+		KeepDaily:         time.Duration(keepDailyDays) * day,
+		PurgeDeletedAfter: time.Duration(purgeDeletedAfterDays) * day,
+	}
+}
+
+func prune(ctx context.Context, pruneService *service.PruneService, dryRun bool, now time.Time, out io.Writer) int {
+	plan, err := pruneService.Plan(ctx, now)
+	if err != nil {
+		fmt.Fprintf(out, "prune failed: %v\n", err)
+		return 2
+	}
+	if dryRun {
+		for _, snapshot := range plan.Delete {
+			fmt.Fprintf(out, "would remove %s\n", formatSnapshot(snapshot))
+		}
+		for _, snapshot := range plan.Purge {
+			fmt.Fprintf(out, "would purge %s\n", formatSnapshot(snapshot))
+		}
+		fmt.Fprintf(out, "would remove %d snapshots, purge %d deleted snapshots, keep %d\n", len(plan.Delete), len(plan.Purge), plan.Kept)
+		return 0
+	}
+
+	failed := 0
+	for _, result := range pruneService.Prune(ctx, plan) {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(out, "FAILED %s: %v\n", formatSnapshot(result.Snapshot), result.Err)
+			continue
+		}
+		if result.Snapshot.Status == repo.StatusDeleted {
+			fmt.Fprintf(out, "purged %s\n", formatSnapshot(result.Snapshot))
+		} else {
+			fmt.Fprintf(out, "removed %s\n", formatSnapshot(result.Snapshot))
+		}
+	}
+	total := len(plan.Delete) + len(plan.Purge)
+	fmt.Fprintf(out, "removed %d of %d snapshots, kept %d\n", total-failed, total, plan.Kept)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func formatSnapshot(snapshot repo.Snapshot) string {
+	return fmt.Sprintf("%s %s", snapshot.Host_IP, snapshot.Timestamp.UTC().Format(time.RFC3339Nano))
+}
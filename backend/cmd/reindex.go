@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/endingwithali/2025censys/cmd/config"
+	"github.com/endingwithali/2025censys/internal/service"
+)
+
+// runReindex handles `reindex`
+//
+// Summary: Indexes the services of every stored snapshot again for GET /api/search, printing a line per snapshot
+// that could not be indexed followed by a summary. Snapshots stored before the service index existed are only
+// searchable once this has run. Uploads index their own snapshots, so it is safe to run with the server up.
+//
+// Exit codes:
+//   - 0: every snapshot was indexed
+//   - 1: some snapshots could not be indexed
+//   - 2: reindexing could not run
+func runReindex(serverConfig config.ServerConfigurations, args []string) int {
+	flags := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		log.Printf("reindex: Unexpected arguments %v", flags.Args())
+		return 2
+	}
+
+	snapshotRepo, differenceRepo, serviceIndex, err := openRepos(context.Background(), serverConfig)
+	if err != nil {
+		log.Printf("reindex: %v", err)
+		return 2
+	}
+	blobStore, err := newBlobStore(serverConfig)
+	if err != nil {
+		log.Printf("reindex: Failed to set up blob store: %v", err)
+		return 2
+	}
+	snapshotService, err := newSnapshotService(serverConfig, snapshotRepo, differenceRepo, serviceIndex, blobStore)
+	if err != nil {
+		log.Printf("reindex: Failed to set up snapshot service: %v", err)
+		return 2
+	}
+
+	return reindex(context.Background(), snapshotService, os.Stdout)
+}
+
+func reindex(ctx context.Context, snapshotService *service.SnapshotService, out io.Writer) int {
+	results, err := snapshotService.Reindex(ctx, func(result service.ReindexResult) {
+		if result.Err != nil {
+			fmt.Fprintf(out, "FAILED %s: %v\n", formatSnapshot(result.Snapshot), result.Err)
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(out, "reindex failed: %v\n", err)
+		return 2
+	}
+
+	failed, services := 0, 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+		services += result.Services
+	}
+	fmt.Fprintf(out, "indexed %d of %d snapshots, %d services\n", len(results)-failed, len(results), services)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
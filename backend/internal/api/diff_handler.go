@@ -1,36 +1,68 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/endingwithali/2025censys/internal/diff"
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/service"
 )
 
 type diffResponse struct {
 	DiffStatus  string
 	Differences string
+	Changes     []diff.Change
 }
 
+const (
+	diffFormatDefault    = "diff"
+	diffFormatJSONPatch  = "json-patch"
+	diffFormatMergePatch = "merge-patch"
+
+	jsonPatchContentType  = "application/json-patch+json"
+	mergePatchContentType = "application/merge-patch+json"
+)
+
 // GetSnapshotDiffs handles GET /api/snapshot/diff?ip={host}&t1={timestamp}&t2={timestamp}
 //
 // Summary: Get snapshots differences for a host.
 // Path Params:
 //   - host: string (IPv4/IPv6)
-//   - t1: string (timestamp of file 1)
-//   - t2: string (timestamp of file 2)
+//   - t1: string (timestamp of file 1, or "latest"|"earliest"|"previous")
+//   - t2: string (timestamp of file 2, or "latest"|"earliest"|"previous")
+//   - format: string (optional, "diff"|"json-patch"|"merge-patch", takes precedence over the Accept header)
+//
+// Headers:
+//   - Accept: application/json-patch+json returns an RFC 6902 JSON Patch,
+//     application/merge-patch+json returns an RFC 7396 JSON Merge Patch
 //
 // Example:
 // GET /api/snapshot/diff?ip=125.199.235.74&t1=2025-09-10T03:00:00Z&t2=2025-09-10T03:00:00Z
+// GET /api/snapshot/diff?ip=125.199.235.74&t1=2025-09-10T03:00:00Z&t2=2025-09-20T12:00:00Z&format=json-patch
+// GET /api/snapshot/diff?ip=125.199.235.74&t1=previous&t2=latest
+//
+// The Content-Location header has the URL of the diff by the exact timestamps of the snapshots compared.
 //
 // Responses:
-//   - 200: ListSnapshotsResponse
-//   - 204: APIError (Snapshot not found in DB or on disk)
-//   - 500: Internal Server Error (Unable to create difference)
+//   - 200: ListSnapshotsResponse | JSON Patch | JSON Merge Patch
+//   - 400: APIError (Unknown format | Invalid host ip or timestamp)
+//   - 404: APIError (No such snapshot)
+//   - 406: APIError (Missing host ip or timestamps)
+//   - 500: Internal Server Error (Unable to look up snapshots or create difference)
 //
 // Response Body:
 //
 //	{
 //	  "diffStatus": "FullMatch"|"SupersetMatch"|"NoMatch"|"FirstArgIsInvalidJson"|"SecondArgIsInvalidJson"|"BothArgsAreInvalidJson"|"Invalid"
 //	  "differences": {Color Coded Differences String}
+//	  "changes": [{"type": "service_added"|"service_removed"|"software_changed"|"tls_changed"|"vuln_added"|"vuln_removed"|"status_changed", "port": int, "protocol": string, "old": any, "new": any}]
 //	}
 func (server *Server) GetSnapshotDiffs(w http.ResponseWriter, r *http.Request) {
 	host_ip := r.URL.Query().Get("ip")
@@ -40,22 +72,153 @@ func (server *Server) GetSnapshotDiffs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error: No host ip or timestamps defined", http.StatusNotAcceptable)
 		return
 	}
+	format, ok := diffFormat(r)
+	if !ok {
+		http.Error(w, "Error: format must be one of diff, json-patch, merge-patch", http.StatusBadRequest)
+		return
+	}
 	ctx := r.Context()
 
 	// CHOICE: Don't optimize for case where t1 == t2.
 
-	file1Location, err := server.snapshotService.GetSnapshotByTimestamp(ctx, host_ip, t1)
+	snapshot1, err := server.snapshotService.FindSnapshot(ctx, host_ip, t1, "")
+	if err != nil {
+		http.Error(w, err.Error(), lookupErrorStatus(err))
+		return
+	}
+	snapshot2, err := server.snapshotService.FindSnapshot(ctx, host_ip, t2, "")
+	if err != nil {
+		http.Error(w, err.Error(), lookupErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Location", withQuery(r, url.Values{"t1": {formatTimestamp(snapshot1.Timestamp)}, "t2": {formatTimestamp(snapshot2.Timestamp)}}))
+
+	writeDifference(w, r, format, differ{
+		differences: server.differenceService.GetDifferences,
+		jsonPatch:   server.differenceService.GetJSONPatch,
+		mergePatch:  server.differenceService.GetMergePatch,
+	}, snapshot1, snapshot2)
+}
+
+// CompareSnapshots handles GET /api/snapshot/compare?ip1={host}&t1={timestamp}&ip2={host}&t2={timestamp}
+//
+// Summary: Compare snapshots of any two hosts, ignoring the fields that identify the host and when the snapshot was
+// taken ("ip" and "timestamp"), e.g. to check that the replicas in a pool are configured identically.
+// Query Params:
+//   - ip1, ip2: string (IPv4/IPv6, may be the same host)
+//   - t1, t2: string (optional, timestamp of each snapshot, or "latest"|"earliest"|"previous", default "latest")
+//   - mode: string (optional, "exact"|"before"|"after"|"nearest" as for GET /api/snapshot, applied to t1 and t2)
+//   - format: string (optional, "diff"|"json-patch"|"merge-patch", takes precedence over the Accept header)
+//
+// Headers:
+//   - Accept: as for GET /api/snapshot/diff
+//
+// Example:
+// GET /api/snapshot/compare?ip1=10.0.0.1&ip2=10.0.0.2
+// GET /api/snapshot/compare?ip1=10.0.0.1&t1=2025-09-10T03:00:00Z&ip2=10.0.0.2&t2=2025-09-10T03:00:00Z&mode=nearest
+//
+// The Content-Location header has the URL of the comparison by the exact timestamps of the snapshots compared.
+//
+// Responses:
+//   - 200: ListSnapshotsResponse | JSON Patch | JSON Merge Patch (diffStatus is "FullMatch" for identical hosts)
+//   - 400: APIError (Unknown format | Invalid host ip, timestamp or mode)
+//   - 404: APIError (No such snapshot)
+//   - 406: APIError (No host ips)
+//   - 500: Internal Server Error (Unable to create difference)
+//
+// Response Body: as for GET /api/snapshot/diff
+func (server *Server) CompareSnapshots(w http.ResponseWriter, r *http.Request) {
+	log.Println("CompareSnapshots: CALLED")
+
+	query := r.URL.Query()
+	ip1, ip2 := query.Get("ip1"), query.Get("ip2")
+	if ip1 == "" || ip2 == "" {
+		log.Println("CompareSnapshots: FAILED")
+		http.Error(w, "Error: No host ips defined", http.StatusNotAcceptable)
+		return
+	}
+	t1, t2 := query.Get("t1"), query.Get("t2")
+	if t1 == "" {
+		t1 = service.AtLatest
+	}
+	if t2 == "" {
+		t2 = service.AtLatest
+	}
+	format, ok := diffFormat(r)
+	if !ok {
+		http.Error(w, "Error: format must be one of diff, json-patch, merge-patch", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+
+	snapshot1, err := server.snapshotService.FindSnapshot(ctx, ip1, t1, query.Get("mode"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNoContent)
+		log.Printf("CompareSnapshots: FAILED %v", err)
+		http.Error(w, err.Error(), lookupErrorStatus(err))
 		return
 	}
-	file2Location, err := server.snapshotService.GetSnapshotByTimestamp(ctx, host_ip, t2)
+	snapshot2, err := server.snapshotService.FindSnapshot(ctx, ip2, t2, query.Get("mode"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNoContent)
+		log.Printf("CompareSnapshots: FAILED %v", err)
+		http.Error(w, err.Error(), lookupErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Location", withQuery(r, url.Values{"t1": {formatTimestamp(snapshot1.Timestamp)}, "t2": {formatTimestamp(snapshot2.Timestamp)}, "mode": {""}}))
+
+	writeDifference(w, r, format, differ{
+		differences: server.differenceService.CompareHosts,
+		jsonPatch:   server.differenceService.CompareHostsJSONPatch,
+		mergePatch:  server.differenceService.CompareHostsMergePatch,
+	}, snapshot1, snapshot2)
+	log.Println("CompareSnapshots: SUCCESS")
+}
+
+// lookupErrorStatus maps an error of SnapshotService.FindSnapshot to a response status
+func lookupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, hostip.ErrInvalid), errors.Is(err, service.ErrInvalidTimestamp), errors.Is(err, service.ErrInvalidMode):
+		return http.StatusBadRequest
+	case errors.Is(err, repo.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// differ makes a difference between two snapshots in each format
+type differ struct {
+	differences func(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) (string, string, []diff.Change, error)
+	jsonPatch   func(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) ([]diff.PatchOperation, error)
+	mergePatch  func(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) (json.RawMessage, error)
+}
+
+// writeDifference writes the difference between two snapshots in format
+func writeDifference(w http.ResponseWriter, r *http.Request, format string, differ differ, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) {
+	ctx := r.Context()
+	switch format {
+	case diffFormatJSONPatch:
+		patch, err := differ.jsonPatch(ctx, snapshot1, snapshot2)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", jsonPatchContentType)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(patch)
+		return
+	case diffFormatMergePatch:
+		patch, err := differ.mergePatch(ctx, snapshot1, snapshot2)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mergePatchContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(patch)
 		return
 	}
 
-	status, difference, err := server.differenceService.GetDifferences(file1Location, file2Location)
+	status, difference, changes, err := differ.differences(ctx, snapshot1, snapshot2)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -65,5 +228,48 @@ func (server *Server) GetSnapshotDiffs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(diffResponse{
 		DiffStatus:  status,
 		Differences: difference,
+		Changes:     changes,
 	})
 }
+
+// diffFormat picks the diff representation from the format query param, falling back to the Accept header
+//
+// Summary: From the Accept header, the patch type with the highest q-value is picked, JSON Patch on a tie, unless
+// application/json has a higher one. Media types with q=0 are not acceptable, and wildcards never pick a patch.
+//
+// Returns:
+//   - string: diffFormatDefault | diffFormatJSONPatch | diffFormatMergePatch
+//   - bool: false if the format query param is not a known format
+func diffFormat(r *http.Request) (string, bool) {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "":
+	case "diff", "json":
+		return diffFormatDefault, true
+	case "json-patch", "patch":
+		return diffFormatJSONPatch, true
+	case "merge-patch", "merge":
+		return diffFormatMergePatch, true
+	default:
+		return "", false
+	}
+
+	var jsonQ, jsonPatchQ, mergePatchQ float64
+	for _, entry := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(entry, ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			jsonQ = qValue(params)
+		case jsonPatchContentType:
+			jsonPatchQ = qValue(params)
+		case mergePatchContentType:
+			mergePatchQ = qValue(params)
+		}
+	}
+	switch {
+	case jsonPatchQ > 0 && jsonPatchQ >= mergePatchQ && jsonPatchQ >= jsonQ:
+		return diffFormatJSONPatch, true
+	case mergePatchQ > 0 && mergePatchQ >= jsonQ:
+		return diffFormatMergePatch, true
+	}
+	return diffFormatDefault, true
+}
@@ -2,34 +2,102 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/service"
 )
 
 // ListAllHosts handles GET /api/host/all
 //
-// Summary: Get all possible hosts.
+// Summary: Get a page of the hosts with snapshots, ordered by IP. When there are more hosts the Link header has
+// the URL of the next page, with rel="next".
+// Query Params:
+//   - cursor: string (optional, from the Link header of the previous page)
+//   - limit: int (optional, 1 to 1000, default 100)
+//   - sort: string (optional, "asc"|"desc", default "asc")
+//   - since, until: timestamp (optional, keep hosts with a snapshot in the range, inclusive)
+//   - prefix: string (optional, keep hosts whose IP starts with it, e.g. "10.0.")
 //
 // Example:
-// GET /api/host/all
+// GET /api/host/all?prefix=10.0.&limit=50
 //
 // Responses:
 //   - 200: ListSnapshotsResponse
+//   - 400: APIError (Invalid query params)
 //   - 500: Internal Server Error (Unable to get list of hosts)
 //
 // Response Body:
 //
 //	{
-//	  [List of all possible hosts IPs as strings]
+//	  [List of host IPs as strings]
 //	}
 func (server *Server) ListAllHosts(w http.ResponseWriter, r *http.Request) {
+	log.Println("ListAllHosts: CALLED")
 	ctx := r.Context()
-	hosts, err := server.snapshotService.GetAllHosts(ctx)
+	page, err := server.snapshotService.ListHosts(ctx, listOptions(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("ListAllHosts: FAILED %v", err)
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+	log.Printf("ListAllHosts: Found %d hosts", len(page.Items))
+	writePage(w, r, page)
+}
+
+// listOptions reads the pagination, sort and filter query params shared by the listings
+func listOptions(r *http.Request) service.ListOptions {
+	query := r.URL.Query()
+	return service.ListOptions{
+		Cursor: query.Get("cursor"),
+		Limit:  query.Get("limit"),
+		Sort:   query.Get("sort"),
+		Since:  query.Get("since"),
+		Until:  query.Get("until"),
+		Prefix: query.Get("prefix"),
 	}
-	log.Printf("ListAllHosts: Found a total of %d hosts", len(hosts))
+}
+
+func listErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidListOptions), errors.Is(err, hostip.ErrInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writePage writes the items of a page as a JSON list, and links the next page (RFC 8288) with the same query
+// params and the page's cursor
+func writePage(w http.ResponseWriter, r *http.Request, page service.Page) {
+	setNextLink(w, r, page.Next)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(hosts)
+	json.NewEncoder(w).Encode(page.Items)
+}
+
+// setNextLink sets the Link header to the request with its cursor replaced by next. No link is set if next is empty.
+func setNextLink(w http.ResponseWriter, r *http.Request, next string) {
+	if next == "" {
+		return
+	}
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, withQuery(r, url.Values{"cursor": {next}})))
+}
+
+// withQuery is the path and query of the request with the params in replace set, and those set to "" removed
+func withQuery(r *http.Request, replace url.Values) string {
+	query := r.URL.Query()
+	for key, values := range replace {
+		if len(values) == 0 || values[0] == "" {
+			query.Del(key)
+		} else {
+			query[key] = values
+		}
+	}
+	location := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return location.String()
 }
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/endingwithali/2025censys/internal/service"
+)
+
+// Search handles GET /api/search
+//
+// Summary: Find the hosts running matching services, ordered by IP. Each host is searched as of its latest snapshot,
+// or its latest at a point in time, and a host is returned with the services that match every filter given. When
+// there are more hosts the Link header has the URL of the next page, with rel="next".
+// Query Params:
+//   - port: int (optional)
+//   - protocol, vendor, product, tls_version: string (optional, compared case-insensitively)
+//   - version: string (optional, a version or range, e.g. "1.24", "<1.24" or ">=1.20,<1.24")
+//   - at: timestamp (optional, search as of this time instead of the latest snapshots)
+//   - cursor: string (optional, from the Link header of the previous page)
+//   - limit: int (optional, hosts in the page, 1 to 1000, default 100)
+//   - sort: string (optional, "asc"|"desc", default "asc")
+//   - prefix: string (optional, keep hosts whose IP starts with it, e.g. "10.0.")
+//
+// Example:
+// GET /api/search?product=nginx&version=%3C1.24
+// GET /api/search?port=22&at=2025-09-01T00:00:00Z
+//
+// Responses:
+//   - 200: List of SearchHit
+//   - 400: APIError (Invalid query params)
+//   - 500: API Error (Unable to search)
+//   - 501: API Error (No service index configured)
+//
+// Response Body:
+//
+//	[
+//	  {
+//	    "ip": "125.199.235.74",
+//	    "timestamp": "2025-09-15T08:49:45Z",
+//	    "services": [{"port": 80, "protocol": "HTTP", "vendor": "F5", "product": "nginx", "version": "1.18.0"}]
+//	  }
+//	]
+func (server *Server) Search(w http.ResponseWriter, r *http.Request) {
+	log.Println("Search: CALLED")
+
+	query := r.URL.Query()
+	options := service.SearchOptions{
+		ListOptions: listOptions(r),
+		Port:        query.Get("port"),
+		Protocol:    query.Get("protocol"),
+		Vendor:      query.Get("vendor"),
+		Product:     query.Get("product"),
+		Version:     query.Get("version"),
+		TLSVersion:  query.Get("tls_version"),
+		At:          query.Get("at"),
+	}
+
+	hits, next, err := server.snapshotService.Search(r.Context(), options)
+	if err != nil {
+		log.Printf("Search: FAILED %v", err)
+		status := listErrorStatus(err)
+		if errors.Is(err, service.ErrNoServiceIndex) {
+			status = http.StatusNotImplemented
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	log.Printf("Search: SUCCESS %d hosts", len(hits))
+	setNextLink(w, r, next)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hits)
+}
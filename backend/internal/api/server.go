@@ -12,23 +12,28 @@ import (
 type Server struct {
 	snapshotService   *service.SnapshotService
 	differenceService *service.DifferencesService
+	timelineService   *service.TimelineService
 	MaxFileSize       int
+	// MaxRequestSize limits one upload request. Values below MaxFileSize are raised to MaxFileSize.
+	MaxRequestSize int
 }
 
-func New(snapshotService *service.SnapshotService, differenceService *service.DifferencesService, maxFileSize int) http.Handler {
+func New(snapshotService *service.SnapshotService, differenceService *service.DifferencesService, maxFileSize int, maxRequestSize int, allowedOrigins []string) http.Handler {
 	server := &Server{
 		snapshotService:   snapshotService,
 		differenceService: differenceService,
+		timelineService:   service.NewTimelineService(snapshotService, differenceService),
 		MaxFileSize:       maxFileSize,
+		MaxRequestSize:    maxRequestSize,
 	}
 	router := chi.NewRouter()
 
 	// CORS middleware
 	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://127.0.0.1:3000"},
+		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "Content-Location"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -42,9 +47,16 @@ func New(snapshotService *service.SnapshotService, differenceService *service.Di
 		r.Get("/health", server.Get)
 		r.Get("/host/all", server.ListAllHosts)
 		r.Get("/host", server.GetAllSnapshotsForHost)
+		r.Get("/host/timeline", server.GetHostTimeline)
 		r.Get("/snapshot", server.GetSnapshotForHost)
+		r.Get("/snapshot/range", server.GetSnapshotRange)
 		r.Post("/snapshot", server.CreateSnapshot)
+		r.Delete("/snapshot", server.DeleteSnapshot)
+		r.Post("/snapshot/restore", server.RestoreSnapshot)
+		r.Post("/snapshots:stream", server.StreamSnapshots)
 		r.Get("/snapshot/diff", server.GetSnapshotDiffs)
+		r.Get("/snapshot/compare", server.CompareSnapshots)
+		r.Get("/search", server.Search)
 	})
 	return router
 }
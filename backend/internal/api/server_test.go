@@ -1,19 +1,29 @@
 package api
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/diff"
+	"github.com/endingwithali/2025censys/internal/model"
 	"github.com/endingwithali/2025censys/internal/repo"
 	"github.com/endingwithali/2025censys/internal/service"
 	"github.com/google/uuid"
@@ -27,8 +37,33 @@ type MockSnapshotRepo struct {
 	mock.Mock
 }
 
-func (m *MockSnapshotRepo) Insert(ctx context.Context, host_ip string, timestamp time.Time, file_pwd string, file_name string) error {
-	args := m.Called(ctx, host_ip, timestamp, file_pwd, file_name)
+func (m *MockSnapshotRepo) Insert(ctx context.Context, snapshot repo.Snapshot) error {
+	args := m.Called(ctx, snapshot)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) MarkCommitted(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) DeleteWithStatus(ctx context.Context, id uuid.UUID, status string) error {
+	args := m.Called(ctx, id, status)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	args := m.Called(ctx, id, deletedAt)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
@@ -37,11 +72,16 @@ func (m *MockSnapshotRepo) GetSnapshotByTimeStamp(ctx context.Context, host_ip s
 	return args.Get(0).(repo.Snapshot), args.Error(1)
 }
 
-func (m *MockSnapshotRepo) GetSnapshotByFileName(ctx context.Context, host_ip string, filename string) (repo.Snapshot, error) {
-	args := m.Called(ctx, host_ip, filename)
+func (m *MockSnapshotRepo) GetDeletedSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (repo.Snapshot, error) {
+	args := m.Called(ctx, host_ip, timestamp)
 	return args.Get(0).(repo.Snapshot), args.Error(1)
 }
 
+func (m *MockSnapshotRepo) UpdateBlob(ctx context.Context, snapshot repo.Snapshot) error {
+	args := m.Called(ctx, snapshot)
+	return args.Error(0)
+}
+
 func (m *MockSnapshotRepo) GetAllHosts(ctx context.Context) ([]string, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]string), args.Error(1)
@@ -52,10 +92,41 @@ func (m *MockSnapshotRepo) ListAllHostSnapshots(ctx context.Context, host_ip str
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m *MockSnapshotRepo) ListHosts(ctx context.Context, query repo.HostQuery) ([]string, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockSnapshotRepo) ListHostSnapshots(ctx context.Context, host_ip string, query repo.SnapshotQuery) ([]time.Time, error) {
+	args := m.Called(ctx, host_ip, query)
+	return args.Get(0).([]time.Time), args.Error(1)
+}
+
+func (m *MockSnapshotRepo) ListAll(ctx context.Context) ([]repo.Snapshot, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]repo.Snapshot), args.Error(1)
+}
+
+func (m *MockSnapshotRepo) CountBlobReferences(ctx context.Context, blobKey string) (int64, error) {
+	args := m.Called(ctx, blobKey)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// matchInsertedSnapshot matches an inserted snapshot by host, timestamp and upload filename
+func matchInsertedSnapshot(hostIP string, timestamp time.Time, filename string) any {
+	return mock.MatchedBy(func(snapshot repo.Snapshot) bool {
+		return snapshot.Host_IP == hostIP && snapshot.Timestamp.Equal(timestamp) && snapshot.File_Name == filename
+	})
+}
+
+// validSnapshotContent is a host snapshot body matching host_192.168.1.1_2025-01-01T12-00-00Z.json
+const validSnapshotContent = `{"timestamp": "2025-01-01T12:00:00Z", "ip": "192.168.1.1", "services": [{"port": 80, "protocol": "HTTP", "status": 200}], "service_count": 1}`
+
 // Helper function to create a server for testing
 func createTestServer(mockSnapshotRepo *MockSnapshotRepo, maxFileSize int) *Server {
-	snapshotService := service.NewSnapshotService(mockSnapshotRepo, "/tmp")
-	diffService := service.NewDifferencesServicet()
+	blobStore := blobstore.NewMemoryStore()
+	snapshotService := service.NewSnapshotService(mockSnapshotRepo, blobStore)
+	diffService := service.NewDifferencesServicet(nil, blobStore)
 
 	return &Server{
 		snapshotService:   snapshotService,
@@ -83,27 +154,68 @@ func TestServer_Get(t *testing.T) {
 func TestServer_ListAllHosts(t *testing.T) {
 	tests := []struct {
 		name           string
+		url            string
+		query          repo.HostQuery
 		hosts          []string
 		expectedStatus int
 		expectedBody   []string
+		expectedLink   string
 		repoError      error
 	}{
 		{
 			name:           "successful request",
-			hosts:          []string{"192.168.1.1", "10.0.0.1"},
+			url:            "/api/host/all",
+			query:          repo.HostQuery{Limit: service.DefaultPageSize + 1},
+			hosts:          []string{"10.0.0.1", "192.168.1.1"},
 			expectedStatus: http.StatusOK,
-			expectedBody:   []string{"192.168.1.1", "10.0.0.1"},
+			expectedBody:   []string{"10.0.0.1", "192.168.1.1"},
 			repoError:      nil,
 		},
 		{
 			name:           "empty hosts list",
+			url:            "/api/host/all",
+			query:          repo.HostQuery{Limit: service.DefaultPageSize + 1},
 			hosts:          []string{},
 			expectedStatus: http.StatusOK,
 			expectedBody:   []string{},
 			repoError:      nil,
 		},
+		{
+			name:           "first of several pages",
+			url:            "/api/host/all?limit=2&prefix=10.&sort=desc",
+			query:          repo.HostQuery{Prefix: "10.", Descending: true, Limit: 3},
+			hosts:          []string{"10.0.0.3", "10.0.0.2", "10.0.0.1"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   []string{"10.0.0.3", "10.0.0.2"},
+			expectedLink:   `</api/host/all?cursor=MTAuMC4wLjI&limit=2&prefix=10.&sort=desc>; rel="next"`,
+		},
+		{
+			name:           "next page",
+			url:            "/api/host/all?limit=2&prefix=10.&sort=desc&cursor=MTAuMC4wLjI",
+			query:          repo.HostQuery{Prefix: "10.", After: "10.0.0.2", Descending: true, Limit: 3},
+			hosts:          []string{"10.0.0.1"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   []string{"10.0.0.1"},
+		},
+		{
+			name:           "time range",
+			url:            "/api/host/all?since=2025-01-01T00:00:00Z&until=2025-01-02T00-00-00Z",
+			query:          repo.HostQuery{Since: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Limit: service.DefaultPageSize + 1},
+			hosts:          []string{"10.0.0.1"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   []string{"10.0.0.1"},
+		},
+		{name: "invalid limit", url: "/api/host/all?limit=0", expectedStatus: http.StatusBadRequest},
+		{name: "limit too large", url: "/api/host/all?limit=1001", expectedStatus: http.StatusBadRequest},
+		{name: "invalid sort", url: "/api/host/all?sort=up", expectedStatus: http.StatusBadRequest},
+		{name: "invalid cursor", url: "/api/host/all?cursor=!!", expectedStatus: http.StatusBadRequest},
+		{name: "invalid since", url: "/api/host/all?since=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "until before since", url: "/api/host/all?since=2025-01-02T00:00:00Z&until=2025-01-01T00:00:00Z", expectedStatus: http.StatusBadRequest},
+		{name: "invalid prefix", url: "/api/host/all?prefix=10%25", expectedStatus: http.StatusBadRequest},
 		{
 			name:           "repository error",
+			url:            "/api/host/all",
+			query:          repo.HostQuery{Limit: service.DefaultPageSize + 1},
 			hosts:          nil,
 			expectedStatus: http.StatusInternalServerError,
 			expectedBody:   nil,
@@ -117,10 +229,12 @@ func TestServer_ListAllHosts(t *testing.T) {
 			mockSnapshotRepo := &MockSnapshotRepo{}
 			server := createTestServer(mockSnapshotRepo, 1024*1024)
 
-			mockSnapshotRepo.On("GetAllHosts", mock.Anything).Return(tt.hosts, tt.repoError)
+			if tt.expectedStatus != http.StatusBadRequest {
+				mockSnapshotRepo.On("ListHosts", mock.Anything, tt.query).Return(tt.hosts, tt.repoError)
+			}
 
 			// Test
-			req := httptest.NewRequest("GET", "/api/host/all", nil)
+			req := httptest.NewRequest("GET", tt.url, nil)
 			w := httptest.NewRecorder()
 
 			server.ListAllHosts(w, req)
@@ -133,36 +247,62 @@ func TestServer_ListAllHosts(t *testing.T) {
 				require.NoError(t, err)
 				assert.Equal(t, tt.expectedBody, response)
 			}
+			assert.Equal(t, tt.expectedLink, w.Header().Get("Link"))
 			mockSnapshotRepo.AssertExpectations(t)
 		})
 	}
 }
 
 func TestServer_GetAllSnapshotsForHost(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	after := jan1.Add(500 * time.Millisecond)
 	tests := []struct {
 		name           string
-		ip             string
-		snapshots      []string
+		url            string
+		query          repo.SnapshotQuery
+		snapshots      []time.Time
 		expectedStatus int
+		expectedBody   []string
+		expectedLink   string
 		repoError      error
 	}{
 		{
 			name:           "successful request",
-			ip:             "192.168.1.1",
-			snapshots:      []string{"2025-01-01T12:00:00Z", "2025-01-02T12:00:00Z"},
+			url:            "/api/host?ip=192.168.1.1",
+			query:          repo.SnapshotQuery{Limit: service.DefaultPageSize + 1},
+			snapshots:      []time.Time{jan1, jan1.Add(24 * time.Hour)},
 			expectedStatus: http.StatusOK,
+			expectedBody:   []string{"2025-01-01T12:00:00Z", "2025-01-02T12:00:00Z"},
 			repoError:      nil,
 		},
+		{
+			name:           "first of several pages",
+			url:            "/api/host?ip=192.168.1.1&limit=1&since=2025-01-01T00:00:00Z",
+			query:          repo.SnapshotQuery{Since: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Limit: 2},
+			snapshots:      []time.Time{after, jan1.Add(24 * time.Hour)},
+			expectedStatus: http.StatusOK,
+			expectedBody:   []string{"2025-01-01T12:00:00.5Z"},
+			expectedLink:   `</api/host?cursor=MjAyNS0wMS0wMVQxMjowMDowMC41Wg&ip=192.168.1.1&limit=1&since=2025-01-01T00%3A00%3A00Z>; rel="next"`,
+		},
+		{
+			name:           "next page",
+			url:            "/api/host?ip=192.168.1.1&limit=1&sort=desc&cursor=MjAyNS0wMS0wMVQxMjowMDowMC41Wg",
+			query:          repo.SnapshotQuery{After: &after, Descending: true, Limit: 2},
+			snapshots:      []time.Time{jan1},
+			expectedStatus: http.StatusOK,
+			expectedBody:   []string{"2025-01-01T12:00:00Z"},
+		},
 		{
 			name:           "missing ip parameter",
-			ip:             "",
-			snapshots:      nil,
+			url:            "/api/host",
 			expectedStatus: http.StatusNotAcceptable,
-			repoError:      nil,
 		},
+		{name: "prefix is for hosts", url: "/api/host?ip=192.168.1.1&prefix=192.", expectedStatus: http.StatusBadRequest},
+		{name: "host cursor", url: "/api/host?ip=192.168.1.1&cursor=MTAuMC4wLjI", expectedStatus: http.StatusBadRequest},
 		{
 			name:           "repository error",
-			ip:             "192.168.1.1",
+			url:            "/api/host?ip=192.168.1.1",
+			query:          repo.SnapshotQuery{Limit: service.DefaultPageSize + 1},
 			snapshots:      nil,
 			expectedStatus: http.StatusInternalServerError,
 			repoError:      fmt.Errorf("database error"),
@@ -175,16 +315,12 @@ func TestServer_GetAllSnapshotsForHost(t *testing.T) {
 			mockSnapshotRepo := &MockSnapshotRepo{}
 			server := createTestServer(mockSnapshotRepo, 1024*1024)
 
-			if tt.ip != "" {
-				mockSnapshotRepo.On("ListAllHostSnapshots", mock.Anything, tt.ip).Return(tt.snapshots, tt.repoError)
+			if tt.expectedStatus == http.StatusOK || tt.repoError != nil {
+				mockSnapshotRepo.On("ListHostSnapshots", mock.Anything, "192.168.1.1", tt.query).Return(tt.snapshots, tt.repoError)
 			}
 
 			// Test
-			url := "/api/host"
-			if tt.ip != "" {
-				url += "?ip=" + tt.ip
-			}
-			req := httptest.NewRequest("GET", url, nil)
+			req := httptest.NewRequest("GET", tt.url, nil)
 			w := httptest.NewRecorder()
 
 			server.GetAllSnapshotsForHost(w, req)
@@ -195,8 +331,77 @@ func TestServer_GetAllSnapshotsForHost(t *testing.T) {
 				var response []string
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				require.NoError(t, err)
-				assert.Equal(t, tt.snapshots, response)
+				assert.Equal(t, tt.expectedBody, response)
 			}
+			assert.Equal(t, tt.expectedLink, w.Header().Get("Link"))
+			mockSnapshotRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServer_IPv6Hosts(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		handler        func(server *Server) http.HandlerFunc
+		setup          func(mockSnapshotRepo *MockSnapshotRepo, tempDir string)
+		expectedStatus int
+	}{
+		{
+			name:    "list snapshots with non canonical IPv6",
+			url:     "/api/host?ip=2001:DB8:0:0:0:0:0:1",
+			handler: func(server *Server) http.HandlerFunc { return server.GetAllSnapshotsForHost },
+			setup: func(mockSnapshotRepo *MockSnapshotRepo, tempDir string) {
+				mockSnapshotRepo.On("ListHostSnapshots", mock.Anything, "2001:db8::1", mock.Anything).Return([]time.Time{time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "list snapshots with invalid ip",
+			url:            "/api/host?ip=not-an-ip",
+			handler:        func(server *Server) http.HandlerFunc { return server.GetAllSnapshotsForHost },
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "get snapshot with IPv6",
+			url:     "/api/snapshot?ip=2001:db8::1&at=2025-01-01T12:00:00Z",
+			handler: func(server *Server) http.HandlerFunc { return server.GetSnapshotForHost },
+			setup: func(mockSnapshotRepo *MockSnapshotRepo, tempDir string) {
+				filePath := filepath.Join(tempDir, "host_2001-db8--1_2025-01-01T12-00-00Z.json")
+				os.WriteFile(filePath, []byte(`{}`), 0644)
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "2001:db8::1", time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)).Return(repo.Snapshot{File_PWD: "host_2001-db8--1_2025-01-01T12-00-00Z.json"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "diff with invalid ip",
+			url:            "/api/snapshot/diff?ip=fe80::1%25eth0&t1=2025-01-01T12:00:00Z&t2=2025-01-02T12:00:00Z",
+			handler:        func(server *Server) http.HandlerFunc { return server.GetSnapshotDiffs },
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			tempDir := t.TempDir()
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := &Server{
+				snapshotService:   service.NewSnapshotService(mockSnapshotRepo, blobstore.NewFileSystemStore(tempDir)),
+				differenceService: service.NewDifferencesServicet(nil, blobstore.NewFileSystemStore(tempDir)),
+				MaxFileSize:       1024 * 1024,
+			}
+			if tt.setup != nil {
+				tt.setup(mockSnapshotRepo, tempDir)
+			}
+
+			// Test
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			tt.handler(server)(w, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedStatus, w.Code)
 			mockSnapshotRepo.AssertExpectations(t)
 		})
 	}
@@ -239,12 +444,20 @@ func TestServer_GetSnapshotForHost(t *testing.T) {
 			repoError:      nil,
 			fileExists:     false,
 		},
+		{
+			name:           "snapshot not found",
+			ip:             "192.168.1.1",
+			timestamp:      "2025-01-01T12:00:00Z",
+			expectedStatus: http.StatusNotFound,
+			repoError:      repo.ErrNotFound,
+			fileExists:     false,
+		},
 		{
 			name:           "repository error",
 			ip:             "192.168.1.1",
 			timestamp:      "2025-01-01T12:00:00Z",
-			expectedStatus: http.StatusBadRequest,
-			repoError:      fmt.Errorf("snapshot not found"),
+			expectedStatus: http.StatusInternalServerError,
+			repoError:      fmt.Errorf("database error"),
 			fileExists:     false,
 		},
 		{
@@ -263,8 +476,8 @@ func TestServer_GetSnapshotForHost(t *testing.T) {
 			// Setup
 			tempDir := t.TempDir()
 			mockSnapshotRepo := &MockSnapshotRepo{}
-			snapshotService := service.NewSnapshotService(mockSnapshotRepo, tempDir)
-			diffService := service.NewDifferencesServicet()
+			snapshotService := service.NewSnapshotService(mockSnapshotRepo, blobstore.NewFileSystemStore(tempDir))
+			diffService := service.NewDifferencesServicet(nil, blobstore.NewFileSystemStore(tempDir))
 			server := &Server{
 				snapshotService:   snapshotService,
 				differenceService: diffService,
@@ -284,7 +497,7 @@ func TestServer_GetSnapshotForHost(t *testing.T) {
 					UUID:      uuid.New(),
 					Host_IP:   tt.ip,
 					Timestamp: parsedTime,
-					File_PWD:  testFilePath,
+					File_PWD:  "test.json",
 					File_Name: "test.json",
 				}
 
@@ -292,7 +505,7 @@ func TestServer_GetSnapshotForHost(t *testing.T) {
 			} else if tt.ip != "" && tt.timestamp != "" {
 				parsedTime, err := time.Parse(time.RFC3339, tt.timestamp)
 				require.NoError(t, err)
-				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, tt.ip, parsedTime).Return(repo.Snapshot{}, tt.repoError)
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, tt.ip, parsedTime).Return(repo.Snapshot{File_PWD: "nonexistent.json"}, tt.repoError)
 			}
 
 			// Test
@@ -329,7 +542,7 @@ func TestServer_CreateSnapshot(t *testing.T) {
 		{
 			name:           "successful upload",
 			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
-			fileContent:    `{"test": "data"}`,
+			fileContent:    validSnapshotContent,
 			expectedStatus: http.StatusOK,
 			repoError:      nil,
 			fileExists:     false,
@@ -338,7 +551,16 @@ func TestServer_CreateSnapshot(t *testing.T) {
 		{
 			name:           "invalid filename format",
 			filename:       "invalid.json",
-			fileContent:    `{"test": "data"}`,
+			fileContent:    validSnapshotContent,
+			expectedStatus: http.StatusBadRequest,
+			repoError:      nil,
+			fileExists:     false,
+			maxFileSize:    1024 * 1024,
+		},
+		{
+			name:           "invalid snapshot body",
+			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
+			fileContent:    `{"ip": "192.168.1.1", "services": [{"port": 0, "protocol": "HTTP"}]}`,
 			expectedStatus: http.StatusBadRequest,
 			repoError:      nil,
 			fileExists:     false,
@@ -347,7 +569,7 @@ func TestServer_CreateSnapshot(t *testing.T) {
 		{
 			name:           "duplicate file",
 			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
-			fileContent:    `{"test": "data"}`,
+			fileContent:    validSnapshotContent,
 			expectedStatus: http.StatusConflict,
 			repoError:      nil,
 			fileExists:     true,
@@ -356,7 +578,7 @@ func TestServer_CreateSnapshot(t *testing.T) {
 		{
 			name:           "repository error",
 			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
-			fileContent:    `{"test": "data"}`,
+			fileContent:    validSnapshotContent,
 			expectedStatus: http.StatusConflict,
 			repoError:      fmt.Errorf("database error"),
 			fileExists:     false,
@@ -378,27 +600,29 @@ func TestServer_CreateSnapshot(t *testing.T) {
 			// Setup
 			tempDir := t.TempDir()
 			mockSnapshotRepo := &MockSnapshotRepo{}
-			diffService := service.NewDifferencesServicet()
-			snapshotService := service.NewSnapshotService(mockSnapshotRepo, tempDir)
+			diffService := service.NewDifferencesServicet(nil, blobstore.NewFileSystemStore(tempDir))
+			snapshotService := service.NewSnapshotService(mockSnapshotRepo, blobstore.NewFileSystemStore(tempDir))
 			server := &Server{
 				snapshotService:   snapshotService,
 				differenceService: diffService,
 				MaxFileSize:       tt.maxFileSize,
 			}
 
-			// Create existing file if needed
+			parsedTime, err := time.Parse("2006-01-02T15-04-05Z", "2025-01-01T12-00-00Z")
+			require.NoError(t, err)
+
+			// Existing snapshot for the host and timestamp if needed
 			if tt.fileExists {
-				existingFilePath := filepath.Join(tempDir, tt.filename)
-				err := os.WriteFile(existingFilePath, []byte("existing content"), 0644)
-				require.NoError(t, err)
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "192.168.1.1", parsedTime).Return(repo.Snapshot{Host_IP: "192.168.1.1"}, nil)
 			}
 
 			// Setup mock expectations for cases that will call Insert
 			if tt.expectedStatus == http.StatusOK || (tt.expectedStatus == http.StatusConflict && tt.repoError != nil) {
-				parsedTime, err := time.Parse("2006-01-02T15-04-05Z", "2025-01-01T12-00-00Z")
-				require.NoError(t, err)
-				expectedFilePath := filepath.Join(tempDir, tt.filename)
-				mockSnapshotRepo.On("Insert", mock.Anything, "192.168.1.1", parsedTime, expectedFilePath, tt.filename).Return(tt.repoError)
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "192.168.1.1", parsedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+				mockSnapshotRepo.On("Insert", mock.Anything, matchInsertedSnapshot("192.168.1.1", parsedTime, tt.filename)).Return(tt.repoError)
+				if tt.repoError == nil {
+					mockSnapshotRepo.On("MarkCommitted", mock.Anything, mock.Anything).Return(nil)
+				}
 			}
 
 			// Test
@@ -425,6 +649,79 @@ func TestServer_CreateSnapshot(t *testing.T) {
 	}
 }
 
+func TestServer_CreateSnapshot_Metadata(t *testing.T) {
+	tests := []struct {
+		name           string
+		metadata       string
+		filename       string
+		fileContent    string
+		expectInsert   bool
+		expectedStatus int
+	}{
+		{
+			name:           "metadata from body accepts any filename",
+			metadata:       "body",
+			filename:       "scan-output.json",
+			fileContent:    validSnapshotContent,
+			expectInsert:   true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filename that does not match body is rejected",
+			metadata:       "filename",
+			filename:       "host_10.0.0.1_2025-01-01T12-00-00Z.json",
+			fileContent:    validSnapshotContent,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown metadata source",
+			metadata:       "header",
+			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
+			fileContent:    validSnapshotContent,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			tempDir := t.TempDir()
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := &Server{
+				snapshotService:   service.NewSnapshotService(mockSnapshotRepo, blobstore.NewFileSystemStore(tempDir)),
+				differenceService: service.NewDifferencesServicet(nil, blobstore.NewFileSystemStore(tempDir)),
+				MaxFileSize:       1024 * 1024,
+			}
+			if tt.expectInsert {
+				expectedFilename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+				expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+				mockSnapshotRepo.On("Insert", mock.Anything, matchInsertedSnapshot("192.168.1.1", expectedTime, expectedFilename)).Return(nil)
+				mockSnapshotRepo.On("MarkCommitted", mock.Anything, mock.Anything).Return(nil)
+			}
+
+			// Test
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, err := writer.CreateFormFile("file", tt.filename)
+			require.NoError(t, err)
+			_, err = part.Write([]byte(tt.fileContent))
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			req := httptest.NewRequest("POST", "/api/snapshot?metadata="+tt.metadata, body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			w := httptest.NewRecorder()
+
+			server.CreateSnapshot(w, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSnapshotRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestServer_GetSnapshotDiffs(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -437,6 +734,7 @@ func TestServer_GetSnapshotDiffs(t *testing.T) {
 		file2Content   string
 		diffStatus     string
 		diffContent    string
+		changeTypes    []diff.ChangeType
 		expectedStatus int
 		repoError      error
 		diffError      error
@@ -454,6 +752,22 @@ func TestServer_GetSnapshotDiffs(t *testing.T) {
 			diffContent: `{
     "key": [0;33m"value1" => "value2"[0m
 }`, // This is what the real service returns (with ANSI color codes)
+			changeTypes:    []diff.ChangeType{},
+			expectedStatus: http.StatusOK,
+			repoError:      nil,
+			diffError:      nil,
+		},
+		{
+			name:           "successful diff with service changes",
+			ip:             "192.168.1.1",
+			t1:             "2025-01-01T12:00:00Z",
+			t2:             "2025-01-02T12:00:00Z",
+			file1Path:      "/tmp/file1.json",
+			file2Path:      "/tmp/file2.json",
+			file1Content:   `{"ip": "192.168.1.1", "services": [{"port": 22, "protocol": "SSH", "vulnerabilities": ["CVE-2023-1"]}]}`,
+			file2Content:   `{"ip": "192.168.1.1", "services": [{"port": 22, "protocol": "SSH"}, {"port": 80, "protocol": "HTTP", "status": 200}]}`,
+			diffStatus:     "NoMatch",
+			changeTypes:    []diff.ChangeType{diff.VulnRemoved, diff.ServiceAdded},
 			expectedStatus: http.StatusOK,
 			repoError:      nil,
 			diffError:      nil,
@@ -490,8 +804,17 @@ func TestServer_GetSnapshotDiffs(t *testing.T) {
 			ip:             "192.168.1.1",
 			t1:             "2025-01-01T12:00:00Z",
 			t2:             "2025-01-02T12:00:00Z",
-			expectedStatus: http.StatusNoContent,
-			repoError:      fmt.Errorf("snapshot not found"),
+			expectedStatus: http.StatusNotFound,
+			repoError:      repo.ErrNotFound,
+			diffError:      nil,
+		},
+		{
+			name:           "repository error for t1",
+			ip:             "192.168.1.1",
+			t1:             "2025-01-01T12:00:00Z",
+			t2:             "2025-01-02T12:00:00Z",
+			expectedStatus: http.StatusInternalServerError,
+			repoError:      fmt.Errorf("database error"),
 			diffError:      nil,
 		},
 	}
@@ -501,8 +824,8 @@ func TestServer_GetSnapshotDiffs(t *testing.T) {
 			// Setup
 			tempDir := t.TempDir()
 			mockSnapshotRepo := &MockSnapshotRepo{}
-			snapshotService := service.NewSnapshotService(mockSnapshotRepo, tempDir)
-			diffService := service.NewDifferencesServicet()
+			snapshotService := service.NewSnapshotService(mockSnapshotRepo, blobstore.NewFileSystemStore(tempDir))
+			diffService := service.NewDifferencesServicet(nil, blobstore.NewFileSystemStore(tempDir))
 			server := &Server{
 				snapshotService:   snapshotService,
 				differenceService: diffService,
@@ -533,14 +856,14 @@ func TestServer_GetSnapshotDiffs(t *testing.T) {
 						UUID:      uuid.New(),
 						Host_IP:   tt.ip,
 						Timestamp: parsedTime1,
-						File_PWD:  filepath.Join(tempDir, "file1.json"),
+						File_PWD:  "file1.json",
 						File_Name: "file1.json",
 					}
 					mockSnapshot2 := repo.Snapshot{
 						UUID:      uuid.New(),
 						Host_IP:   tt.ip,
 						Timestamp: parsedTime2,
-						File_PWD:  filepath.Join(tempDir, "file2.json"),
+						File_PWD:  "file2.json",
 						File_Name: "file2.json",
 					}
 
@@ -574,6 +897,11 @@ func TestServer_GetSnapshotDiffs(t *testing.T) {
 				assert.Equal(t, tt.diffStatus, response.DiffStatus)
 				// Don't check exact diff content as it includes ANSI color codes
 				assert.NotEmpty(t, response.Differences)
+				changeTypes := []diff.ChangeType{}
+				for _, change := range response.Changes {
+					changeTypes = append(changeTypes, change.Type)
+				}
+				assert.Equal(t, tt.changeTypes, changeTypes)
 				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 			}
 			mockSnapshotRepo.AssertExpectations(t)
@@ -581,6 +909,124 @@ func TestServer_GetSnapshotDiffs(t *testing.T) {
 	}
 }
 
+func TestServer_GetSnapshotDiffs_PatchFormats(t *testing.T) {
+	tests := []struct {
+		name                string
+		format              string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "json patch from format param",
+			format:              "json-patch",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json-patch+json",
+			expectedBody:        `[{"op":"replace","path":"/key","value":"value2"}]`,
+		},
+		{
+			name:                "merge patch from accept header",
+			accept:              "application/merge-patch+json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/merge-patch+json",
+			expectedBody:        `{"key":"value2"}`,
+		},
+		{
+			name:                "q=0 is not acceptable",
+			accept:              "application/json, application/json-patch+json;q=0",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+		},
+		{
+			name:                "highest q-value wins",
+			accept:              "application/json-patch+json;q=0.5, application/merge-patch+json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/merge-patch+json",
+			expectedBody:        `{"key":"value2"}`,
+		},
+		{
+			name:                "json preferred over patch",
+			accept:              "application/merge-patch+json;q=0.5, application/json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+		},
+		{
+			name:                "patch on a tie with json",
+			accept:              "application/json, application/json-patch+json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json-patch+json",
+			expectedBody:        `[{"op":"replace","path":"/key","value":"value2"}]`,
+		},
+		{
+			name:                "wildcard",
+			accept:              "*/*",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+		},
+		{
+			name:                "format param takes precedence over accept header",
+			format:              "merge-patch",
+			accept:              "application/json-patch+json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/merge-patch+json",
+			expectedBody:        `{"key":"value2"}`,
+		},
+		{
+			name:           "unknown format",
+			format:         "xml",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			tempDir := t.TempDir()
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := &Server{
+				snapshotService:   service.NewSnapshotService(mockSnapshotRepo, blobstore.NewFileSystemStore(tempDir)),
+				differenceService: service.NewDifferencesServicet(nil, blobstore.NewFileSystemStore(tempDir)),
+				MaxFileSize:       1024 * 1024,
+			}
+			file1Path := filepath.Join(tempDir, "file1.json")
+			file2Path := filepath.Join(tempDir, "file2.json")
+			require.NoError(t, os.WriteFile(file1Path, []byte(`{"key": "value1"}`), 0644))
+			require.NoError(t, os.WriteFile(file2Path, []byte(`{"key": "value2"}`), 0644))
+
+			time1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			time2 := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+			if tt.expectedStatus == http.StatusOK {
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "192.168.1.1", time1).Return(repo.Snapshot{File_PWD: "file1.json"}, nil)
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "192.168.1.1", time2).Return(repo.Snapshot{File_PWD: "file2.json"}, nil)
+			}
+
+			// Test
+			url := "/api/snapshot/diff?ip=192.168.1.1&t1=2025-01-01T12:00:00Z&t2=2025-01-02T12:00:00Z"
+			if tt.format != "" {
+				url += "&format=" + tt.format
+			}
+			req := httptest.NewRequest("GET", url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			server.GetSnapshotDiffs(w, req)
+
+			// Assertions
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+				if tt.expectedBody != "" {
+					assert.JSONEq(t, tt.expectedBody, w.Body.String())
+				}
+			}
+			mockSnapshotRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestServer_NotFound(t *testing.T) {
 	// Setup
 	mockSnapshotRepo := &MockSnapshotRepo{}
@@ -634,6 +1080,16 @@ func TestServer_validateFileNameFormat(t *testing.T) {
 			filename: "host_192.168.1.1_2025-01-01T12-00-00+05-30.json",
 			valid:    true,
 		},
+		{
+			name:     "valid filename with IPv6",
+			filename: "host_2001-db8--1_2025-01-01T12-00-00Z.json",
+			valid:    true,
+		},
+		{
+			name:     "invalid filename - IPv6 with colons",
+			filename: "host_2001:db8::1_2025-01-01T12-00-00Z.json",
+			valid:    false,
+		},
 		{
 			name:     "invalid filename - wrong format",
 			filename: "invalid.json",
@@ -675,12 +1131,13 @@ func TestServer_validateFileNameFormat(t *testing.T) {
 func TestRouterSetup(t *testing.T) {
 	// Setup
 	mockSnapshotRepo := &MockSnapshotRepo{}
-	snapshotService := service.NewSnapshotService(mockSnapshotRepo, "/tmp")
-	diffService := service.NewDifferencesServicet()
-	router := New(snapshotService, diffService, 1024*1024)
+	blobStore := blobstore.NewMemoryStore()
+	snapshotService := service.NewSnapshotService(mockSnapshotRepo, blobStore)
+	diffService := service.NewDifferencesServicet(nil, blobStore)
+	router := New(snapshotService, diffService, 1024*1024, 10*1024*1024, []string{"http://localhost:3000"})
 
 	// Setup mock expectations for the host/all endpoint
-	mockSnapshotRepo.On("GetAllHosts", mock.Anything).Return([]string{}, fmt.Errorf("database error"))
+	mockSnapshotRepo.On("ListHosts", mock.Anything, mock.Anything).Return([]string{}, fmt.Errorf("database error"))
 
 	tests := []struct {
 		method string
@@ -692,6 +1149,9 @@ func TestRouterSetup(t *testing.T) {
 		{"GET", "/api/host", http.StatusNotAcceptable},
 		{"GET", "/api/snapshot", http.StatusNotAcceptable},
 		{"POST", "/api/snapshot", http.StatusBadRequest}, // Missing file
+		{"POST", "/api/snapshots:stream", http.StatusUnsupportedMediaType},
+		{"DELETE", "/api/snapshot", http.StatusNotAcceptable},
+		{"POST", "/api/snapshot/restore", http.StatusNotAcceptable},
 		{"GET", "/api/snapshot/diff", http.StatusNotAcceptable},
 		{"GET", "/nonexistent", http.StatusNotFound},
 		{"POST", "/api/health", http.StatusMethodNotAllowed},
@@ -710,3 +1170,850 @@ func TestRouterSetup(t *testing.T) {
 
 	mockSnapshotRepo.AssertExpectations(t)
 }
+
+func TestRouterSetup_CORS(t *testing.T) {
+	blobStore := blobstore.NewMemoryStore()
+	router := New(service.NewSnapshotService(&MockSnapshotRepo{}, blobStore), service.NewDifferencesServicet(nil, blobStore), 1024, 1024, []string{"https://censys.example.com"})
+
+	tests := []struct {
+		origin        string
+		expectedAllow string
+	}{
+		{"https://censys.example.com", "https://censys.example.com"},
+		{"http://localhost:3000", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/api/health", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedAllow, w.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+// uploadPart is one `file` part of a multipart upload
+type uploadPart struct {
+	name    string
+	content []byte
+}
+
+func multipartUpload(t *testing.T, parts ...uploadPart) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, part := range parts {
+		formFile, err := writer.CreateFormFile("file", part.name)
+		require.NoError(t, err)
+		_, err = formFile.Write(part.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return body, writer.FormDataContentType()
+}
+
+func tarGzArchive(t *testing.T, files map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	gz := gzip.NewWriter(buffer)
+	archive := tar.NewWriter(gz)
+	for _, name := range sortedKeys(files) {
+		require.NoError(t, archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}))
+		_, err := archive.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, gz.Close())
+	return buffer.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+	for _, name := range sortedKeys(files) {
+		entry, err := archive.Create(name)
+		require.NoError(t, err)
+		_, err = entry.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	return buffer.Bytes()
+}
+
+func sortedKeys(files map[string]string) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hostSnapshotContent(ip string) string {
+	return fmt.Sprintf(`{"timestamp": "2025-01-01T12:00:00Z", "ip": "%s", "services": [], "service_count": 0}`, ip)
+}
+
+func TestServer_CreateSnapshot_Batch(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	archiveFiles := map[string]string{
+		"scans/host_10.0.0.1_2025-01-01T12-00-00Z.json": hostSnapshotContent("10.0.0.1"),
+		"scans/host_10.0.0.2_2025-01-01T12-00-00Z.json": `{"ip": "10.0.0.2"}`,
+		"scans/notes.txt": "not a snapshot",
+		"scans/.host_10.0.0.3_2025-01-01T12-00-00Z.json": "hidden file is skipped",
+		"__MACOSX/scans/._host_10.0.0.1.json":            "resource fork is skipped",
+	}
+	expectedArchiveResults := func(archive string) []uploadResult {
+		return []uploadResult{
+			{File: archive + "/scans/host_10.0.0.1_2025-01-01T12-00-00Z.json", Status: uploadCreated},
+			{File: archive + "/scans/host_10.0.0.2_2025-01-01T12-00-00Z.json", Status: uploadInvalid},
+			{File: archive + "/scans/notes.txt", Status: uploadInvalid},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		parts           []uploadPart
+		maxFileSize     int
+		maxRequestSize  int
+		setup           func(mockSnapshotRepo *MockSnapshotRepo)
+		expectedResults []uploadResult
+	}{
+		{
+			name: "multiple files",
+			parts: []uploadPart{
+				{"host_10.0.0.1_2025-01-01T12-00-00Z.json", []byte(hostSnapshotContent("10.0.0.1"))},
+				{"host_10.0.0.9_2025-01-01T12-00-00Z.json", []byte(hostSnapshotContent("10.0.0.9"))},
+				{"badly-named.json", []byte(hostSnapshotContent("10.0.0.1"))},
+			},
+			setup: func(mockSnapshotRepo *MockSnapshotRepo) {
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "10.0.0.9", jan1).Return(repo.Snapshot{Host_IP: "10.0.0.9"}, nil)
+			},
+			expectedResults: []uploadResult{
+				{File: "host_10.0.0.1_2025-01-01T12-00-00Z.json", Status: uploadCreated},
+				{File: "host_10.0.0.9_2025-01-01T12-00-00Z.json", Status: uploadDuplicate},
+				{File: "badly-named.json", Status: uploadInvalid},
+			},
+		},
+		{
+			name:            "tar.gz archive",
+			parts:           []uploadPart{{"scans.tar.gz", tarGzArchive(t, archiveFiles)}},
+			expectedResults: expectedArchiveResults("scans.tar.gz"),
+		},
+		{
+			name:            "zip archive",
+			parts:           []uploadPart{{"scans.zip", zipArchive(t, archiveFiles)}},
+			expectedResults: expectedArchiveResults("scans.zip"),
+		},
+		{
+			name: "file size limit applies to each file, including archive entries",
+			parts: []uploadPart{
+				{"host_10.0.0.1_2025-01-01T12-00-00Z.json", []byte(hostSnapshotContent("10.0.0.1"))},
+				{"big.tgz", tarGzArchive(t, map[string]string{"host_10.0.0.5_2025-01-01T12-00-00Z.json": strings.Repeat(" ", 500) + hostSnapshotContent("10.0.0.5")})},
+			},
+			maxFileSize:    200,
+			maxRequestSize: 10 * 1024,
+			expectedResults: []uploadResult{
+				{File: "host_10.0.0.1_2025-01-01T12-00-00Z.json", Status: uploadCreated},
+				{File: "big.tgz/host_10.0.0.5_2025-01-01T12-00-00Z.json", Status: uploadInvalid},
+			},
+		},
+		{
+			name: "request size limit applies to decompressed archive contents",
+			parts: []uploadPart{
+				{"bomb.tar.gz", tarGzArchive(t, map[string]string{
+					"a/host_10.0.0.1_2025-01-01T12-00-00Z.json": hostSnapshotContent("10.0.0.1"),
+					"b/host_10.0.0.6_2025-01-01T12-00-00Z.json": strings.Repeat(" ", 4000),
+					"c/host_10.0.0.7_2025-01-01T12-00-00Z.json": hostSnapshotContent("10.0.0.7"),
+				})},
+			},
+			maxFileSize:    1024,
+			maxRequestSize: 2048,
+			expectedResults: []uploadResult{
+				{File: "bomb.tar.gz/a/host_10.0.0.1_2025-01-01T12-00-00Z.json", Status: uploadCreated},
+				{File: "bomb.tar.gz/b/host_10.0.0.6_2025-01-01T12-00-00Z.json", Status: uploadInvalid},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := createTestServer(mockSnapshotRepo, 1024*1024)
+			if tt.maxFileSize != 0 {
+				server.MaxFileSize = tt.maxFileSize
+				server.MaxRequestSize = tt.maxRequestSize
+			}
+			if tt.setup != nil {
+				tt.setup(mockSnapshotRepo)
+			}
+			mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, mock.Anything, jan1).Return(repo.Snapshot{}, repo.ErrNotFound)
+			mockSnapshotRepo.On("Insert", mock.Anything, mock.Anything).Return(nil)
+			mockSnapshotRepo.On("MarkCommitted", mock.Anything, mock.Anything).Return(nil)
+
+			body, contentType := multipartUpload(t, tt.parts...)
+			req := httptest.NewRequest("POST", "/api/snapshot", body)
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			server.CreateSnapshot(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var response uploadResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			actual := []uploadResult{}
+			for _, result := range response.Results {
+				if result.Status != uploadCreated {
+					assert.NotEmpty(t, result.Error, result.File)
+				}
+				actual = append(actual, uploadResult{File: result.File, Status: result.Status})
+			}
+			assert.Equal(t, tt.expectedResults, actual)
+		})
+	}
+}
+
+func TestServer_CreateSnapshot_BatchValidationFields(t *testing.T) {
+	mockSnapshotRepo := &MockSnapshotRepo{}
+	server := createTestServer(mockSnapshotRepo, 1024*1024)
+
+	body, contentType := multipartUpload(t,
+		uploadPart{"a.json", []byte(`{"timestamp": "2025-01-01T12:00:00Z", "ip": "10.0.0.1", "services": [{"port": 0, "protocol": "HTTP"}], "service_count": 1}`)},
+		uploadPart{"b.json", []byte(`not json`)},
+	)
+	req := httptest.NewRequest("POST", "/api/snapshot?metadata=body", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	server.CreateSnapshot(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response uploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, uploadInvalid, response.Results[0].Status)
+	assert.Equal(t, []model.FieldError{{Field: "services[0].port", Message: "0 is not between 1 and 65535"}}, response.Results[0].Fields)
+	assert.Equal(t, uploadInvalid, response.Results[1].Status)
+}
+
+func TestServer_CreateSnapshot_NoFiles(t *testing.T) {
+	server := createTestServer(&MockSnapshotRepo{}, 1024*1024)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("comment", "no files here"))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest("POST", "/api/snapshot", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	server.CreateSnapshot(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Missing File under form field 'file'")
+}
+
+func TestServer_StreamSnapshots(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		contentType     string
+		body            string
+		expectedStatus  int
+		expectedResults []streamResult
+	}{
+		{
+			name:        "each line is ingested",
+			contentType: "application/x-ndjson",
+			body: hostSnapshotContent("10.0.0.1") + "\n" +
+				"\n" +
+				hostSnapshotContent("10.0.0.9") + "\r\n" +
+				"not json\n" +
+				`{"timestamp": "2025-01-01T12:00:00Z", "ip": "10.0.0.2", "services": [{"port": 0, "protocol": "HTTP"}], "service_count": 1}` + "\n" +
+				`{"timestamp": "2025-01-01T12:00:00Z", "ip": "10.0.0.3", "services": [], "service_count": 0, "padding": "` + strings.Repeat("x", 300) + `"}` + "\n" +
+				hostSnapshotContent("10.0.0.4"),
+			expectedStatus: http.StatusOK,
+			expectedResults: []streamResult{
+				{Line: 1, Status: uploadCreated},
+				{Line: 3, Status: uploadDuplicate},
+				{Line: 4, Status: uploadInvalid, Fields: []model.FieldError{{Field: "$", Message: "invalid JSON at offset 2: invalid character 'o' in literal null (expecting 'u')"}}},
+				{Line: 5, Status: uploadInvalid, Fields: []model.FieldError{{Field: "services[0].port", Message: "0 is not between 1 and 65535"}}},
+				{Line: 6, Status: uploadInvalid},
+				{Line: 7, Status: uploadCreated},
+			},
+		},
+		{
+			name:            "content type with parameters",
+			contentType:     "application/x-ndjson; charset=utf-8",
+			body:            hostSnapshotContent("10.0.0.1") + "\n",
+			expectedStatus:  http.StatusOK,
+			expectedResults: []streamResult{{Line: 1, Status: uploadCreated}},
+		},
+		{
+			name:           "wrong content type",
+			contentType:    "application/json",
+			body:           hostSnapshotContent("10.0.0.1"),
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := createTestServer(mockSnapshotRepo, 200)
+			mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "10.0.0.9", jan1).Return(repo.Snapshot{Host_IP: "10.0.0.9"}, nil)
+			mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, mock.Anything, jan1).Return(repo.Snapshot{}, repo.ErrNotFound)
+			mockSnapshotRepo.On("Insert", mock.Anything, mock.Anything).Return(nil)
+			mockSnapshotRepo.On("MarkCommitted", mock.Anything, mock.Anything).Return(nil)
+
+			req := httptest.NewRequest("POST", "/api/snapshots:stream", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			server.StreamSnapshots(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+			actual := []streamResult{}
+			decoder := json.NewDecoder(w.Body)
+			for decoder.More() {
+				var result streamResult
+				require.NoError(t, decoder.Decode(&result))
+				if result.Status != uploadCreated {
+					assert.NotEmpty(t, result.Error, "line %d", result.Line)
+				}
+				result.Error = ""
+				actual = append(actual, result)
+			}
+			assert.Equal(t, tt.expectedResults, actual)
+		})
+	}
+}
+
+func TestServer_StreamSnapshots_RespondsWhileReading(t *testing.T) {
+	mockSnapshotRepo := &MockSnapshotRepo{}
+	blobStore := blobstore.NewMemoryStore()
+	router := New(service.NewSnapshotService(mockSnapshotRepo, blobStore), service.NewDifferencesServicet(nil, blobStore), 1024, 1024, nil)
+	mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, mock.Anything, mock.Anything).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockSnapshotRepo.On("Insert", mock.Anything, mock.Anything).Return(nil)
+	mockSnapshotRepo.On("MarkCommitted", mock.Anything, mock.Anything).Return(nil)
+	httpServer := httptest.NewServer(router)
+	defer httpServer.Close()
+
+	// The result of the first line must arrive before the rest of the request is sent
+	body, bodyWriter := io.Pipe()
+	req, err := http.NewRequest("POST", httpServer.URL+"/api/snapshots:stream", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	go bodyWriter.Write([]byte(hostSnapshotContent("10.0.0.1") + "\n"))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	decoder := json.NewDecoder(resp.Body)
+	var result streamResult
+	require.NoError(t, decoder.Decode(&result))
+	assert.Equal(t, streamResult{Line: 1, Status: uploadCreated}, result)
+
+	go func() {
+		bodyWriter.Write([]byte(hostSnapshotContent("10.0.0.2") + "\n"))
+		bodyWriter.Close()
+	}()
+	require.NoError(t, decoder.Decode(&result))
+	assert.Equal(t, streamResult{Line: 2, Status: uploadCreated}, result)
+	assert.False(t, decoder.More())
+}
+
+func TestReadNDJSONLine(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader("short\n"+strings.Repeat("x", 100)+"\nlast"), 16)
+
+	line, tooLarge, err := readNDJSONLine(reader, 10)
+	assert.Equal(t, "short", string(line))
+	assert.False(t, tooLarge)
+	assert.NoError(t, err)
+
+	line, tooLarge, err = readNDJSONLine(reader, 10)
+	assert.Empty(t, line)
+	assert.True(t, tooLarge)
+	assert.NoError(t, err)
+
+	line, tooLarge, err = readNDJSONLine(reader, 10)
+	assert.Equal(t, "last", string(line))
+	assert.False(t, tooLarge)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServer_GetSnapshotForHost_Compressed(t *testing.T) {
+	content := hostSnapshotContent("10.0.0.1")
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                    string
+		codec                   string
+		acceptEncoding          string
+		expectedContentEncoding string
+	}{
+		{name: "decompressed when encoding is not accepted", codec: compression.Zstd, acceptEncoding: "gzip"},
+		{name: "decompressed without Accept-Encoding", codec: compression.Gzip},
+		{name: "decompressed when encoding is refused", codec: compression.Gzip, acceptEncoding: "*, gzip;q=0"},
+		{name: "zstd passed through", codec: compression.Zstd, acceptEncoding: "gzip, deflate, br, zstd", expectedContentEncoding: "zstd"},
+		{name: "gzip passed through", codec: compression.Gzip, acceptEncoding: "gzip;q=0.5", expectedContentEncoding: "gzip"},
+		{name: "uncompressed snapshot is sent as stored", codec: compression.Identity, acceptEncoding: "gzip, zstd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := createTestServer(mockSnapshotRepo, 1024*1024)
+			stored, err := compression.Compress(tt.codec, []byte(content))
+			require.NoError(t, err)
+			key := "ab/snapshot.json" + compression.Extension(tt.codec)
+			require.NoError(t, server.snapshotService.BlobStore.Put(context.Background(), key, bytes.NewReader(stored)))
+			mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "10.0.0.1", jan1).Return(repo.Snapshot{Host_IP: "10.0.0.1", Timestamp: jan1, File_PWD: key, Content_Encoding: tt.codec}, nil)
+
+			req := httptest.NewRequest("GET", "/api/snapshot?ip=10.0.0.1&at=2025-01-01T12:00:00Z", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			server.GetSnapshotForHost(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			assert.Equal(t, tt.expectedContentEncoding, w.Header().Get("Content-Encoding"))
+			if tt.expectedContentEncoding != "" {
+				assert.Equal(t, stored, w.Body.Bytes())
+			} else {
+				assert.Equal(t, content, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		coding   string
+		expected bool
+	}{
+		{"", "gzip", false},
+		{"gzip", "gzip", true},
+		{"GZIP", "gzip", true},
+		{"deflate, gzip;q=1.0, *;q=0.5", "zstd", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.001", "gzip", true},
+		{"*", "zstd", true},
+		{"*, zstd;q=0", "zstd", false},
+		{"zstd, *;q=0", "zstd", true},
+		{"gzip;q=bad", "gzip", false},
+		{"br", "zstd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.header, tt.coding), func(t *testing.T) {
+			assert.Equal(t, tt.expected, acceptsEncoding(tt.header, tt.coding))
+		})
+	}
+}
+
+func TestServer_DeleteSnapshot(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := repo.Snapshot{UUID: uuid.New(), Host_IP: "10.0.0.1", Timestamp: jan1, Status: repo.StatusCommitted}
+
+	tests := []struct {
+		name           string
+		query          string
+		lookupError    error
+		deleteError    error
+		expectedStatus int
+	}{
+		{name: "deletes snapshot", query: "?ip=10.0.0.1&at=2025-01-01T12:00:00Z", expectedStatus: http.StatusOK},
+		{name: "missing timestamp", query: "?ip=10.0.0.1", expectedStatus: http.StatusNotAcceptable},
+		{name: "invalid ip", query: "?ip=not-an-ip&at=2025-01-01T12:00:00Z", expectedStatus: http.StatusBadRequest},
+		{name: "invalid timestamp", query: "?ip=10.0.0.1&at=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "snapshot not found", query: "?ip=10.0.0.1&at=2025-01-01T12:00:00Z", lookupError: repo.ErrNotFound, expectedStatus: http.StatusNotFound},
+		{name: "database error", query: "?ip=10.0.0.1&at=2025-01-01T12:00:00Z", deleteError: fmt.Errorf("database error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := createTestServer(mockSnapshotRepo, 1024*1024)
+			mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "10.0.0.1", jan1).Return(snapshot, tt.lookupError)
+			mockSnapshotRepo.On("SoftDelete", mock.Anything, snapshot.UUID, mock.AnythingOfType("time.Time")).Return(tt.deleteError)
+
+			req := httptest.NewRequest("DELETE", "/api/snapshot"+tt.query, nil)
+			w := httptest.NewRecorder()
+			server.DeleteSnapshot(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var response snapshotStateResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "10.0.0.1", response.IP)
+				assert.Equal(t, jan1, response.Timestamp)
+				assert.Equal(t, repo.StatusDeleted, response.Status)
+				assert.NotNil(t, response.DeletedAt)
+			}
+		})
+	}
+}
+
+func TestServer_RestoreSnapshot(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := jan1.Add(time.Hour)
+	deleted := repo.Snapshot{UUID: uuid.New(), Host_IP: "10.0.0.1", Timestamp: jan1, Status: repo.StatusDeleted, Deleted_At: &deletedAt}
+
+	tests := []struct {
+		name           string
+		query          string
+		deletedError   error
+		committed      bool
+		expectedStatus int
+	}{
+		{name: "restores snapshot", query: "?ip=10.0.0.1&at=2025-01-01T12:00:00Z", expectedStatus: http.StatusOK},
+		{name: "missing ip", query: "?at=2025-01-01T12:00:00Z", expectedStatus: http.StatusNotAcceptable},
+		{name: "no deleted snapshot", query: "?ip=10.0.0.1&at=2025-01-01T12:00:00Z", deletedError: repo.ErrNotFound, expectedStatus: http.StatusNotFound},
+		{name: "replaced by a new upload", query: "?ip=10.0.0.1&at=2025-01-01T12:00:00Z", committed: true, expectedStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSnapshotRepo := &MockSnapshotRepo{}
+			server := createTestServer(mockSnapshotRepo, 1024*1024)
+			mockSnapshotRepo.On("GetDeletedSnapshotByTimeStamp", mock.Anything, "10.0.0.1", jan1).Return(deleted, tt.deletedError)
+			if tt.committed {
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "10.0.0.1", jan1).Return(repo.Snapshot{UUID: uuid.New()}, nil)
+			} else {
+				mockSnapshotRepo.On("GetSnapshotByTimeStamp", mock.Anything, "10.0.0.1", jan1).Return(repo.Snapshot{}, repo.ErrNotFound)
+			}
+			mockSnapshotRepo.On("Restore", mock.Anything, deleted.UUID).Return(nil)
+
+			req := httptest.NewRequest("POST", "/api/snapshot/restore"+tt.query, nil)
+			w := httptest.NewRecorder()
+			server.RestoreSnapshot(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var response snapshotStateResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, repo.StatusCommitted, response.Status)
+				assert.Nil(t, response.DeletedAt)
+			}
+		})
+	}
+}
+
+// newSeededServer creates a server over in-memory stores with a snapshot of 192.168.1.1 at each timestamp
+func newSeededServer(t *testing.T, timestamps ...time.Time) http.Handler {
+	blobStore := blobstore.NewMemoryStore()
+	snapshotService := service.NewSnapshotService(repo.NewMemorySnapshotRepo(), blobStore)
+	for i, timestamp := range timestamps {
+		contents := fmt.Sprintf(`{"timestamp": %q, "ip": "192.168.1.1", "services": [{"port": 80, "protocol": "HTTP", "status": %d}], "service_count": 1}`, timestamp.Format(time.RFC3339), 200+i)
+		require.NoError(t, snapshotService.CreateSnapshotFromBody(context.Background(), strings.NewReader(contents)))
+	}
+	return New(snapshotService, service.NewDifferencesServicet(nil, blobStore), 1024*1024, 1024*1024, nil)
+}
+
+func TestServer_GetSnapshotForHost_Modes(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	router := newSeededServer(t, jan1, jan1.Add(24*time.Hour), jan1.Add(48*time.Hour))
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"exact", "at=2025-01-02T12:00:00Z", http.StatusOK, "/api/snapshot?at=2025-01-02T12%3A00%3A00Z&ip=192.168.1.1"},
+		{"before", "at=2025-01-02T18:00:00Z&mode=before", http.StatusOK, "/api/snapshot?at=2025-01-02T12%3A00%3A00Z&ip=192.168.1.1"},
+		{"after", "at=2025-01-02T18:00:00Z&mode=after", http.StatusOK, "/api/snapshot?at=2025-01-03T12%3A00%3A00Z&ip=192.168.1.1"},
+		{"nearest", "at=2025-01-02T18:00:00Z&mode=nearest", http.StatusOK, "/api/snapshot?at=2025-01-02T12%3A00%3A00Z&ip=192.168.1.1"},
+		{"latest", "at=latest", http.StatusOK, "/api/snapshot?at=2025-01-03T12%3A00%3A00Z&ip=192.168.1.1"},
+		{"earliest", "at=earliest", http.StatusOK, "/api/snapshot?at=2025-01-01T12%3A00%3A00Z&ip=192.168.1.1"},
+		{"previous", "at=previous", http.StatusOK, "/api/snapshot?at=2025-01-02T12%3A00%3A00Z&ip=192.168.1.1"},
+		{"unknown mode", "at=2025-01-02T18:00:00Z&mode=closest", http.StatusBadRequest, ""},
+		{"alias with mode", "at=latest&mode=after", http.StatusBadRequest, ""},
+		{"nothing after", "at=2025-02-01T00:00:00Z&mode=after", http.StatusNotFound, ""},
+		{"invalid timestamp", "at=yesterday", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/snapshot?ip=192.168.1.1&"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Content-Location"))
+			if tt.expectedStatus == http.StatusOK {
+				var snapshot model.HostSnapshot
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+			}
+		})
+	}
+}
+
+func TestServer_GetSnapshotDiffs_Aliases(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	router := newSeededServer(t, jan1, jan1.Add(24*time.Hour), jan1.Add(48*time.Hour))
+
+	req := httptest.NewRequest("GET", "/api/snapshot/diff?ip=192.168.1.1&t1=previous&t2=latest", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "/api/snapshot/diff?ip=192.168.1.1&t1=2025-01-02T12%3A00%3A00Z&t2=2025-01-03T12%3A00%3A00Z", w.Header().Get("Content-Location"))
+	var response diffResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Changes, "the status changed from 201 to 202")
+
+	req = httptest.NewRequest("GET", "/api/snapshot/diff?ip=192.168.1.1&t1=earliest&t2=next", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "next is not an alias")
+
+	req = httptest.NewRequest("GET", "/api/snapshot/diff?ip=192.168.1.1&t1=earliest&t2=2025-02-01T00:00:00Z", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_GetSnapshotRange(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	router := newSeededServer(t, jan1, jan1.Add(24*time.Hour), jan1.Add(48*time.Hour), jan1.Add(72*time.Hour))
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	timestamps := func(w *httptest.ResponseRecorder) []string {
+		var snapshots []model.HostSnapshot
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshots), w.Body.String())
+		result := []string{}
+		for _, snapshot := range snapshots {
+			result = append(result, snapshot.Timestamp.UTC().Format(time.RFC3339))
+		}
+		return result
+	}
+
+	w := get("/api/snapshot/range?ip=192.168.1.1&from=2025-01-02T00:00:00Z&to=2025-01-04T12:00:00Z&limit=2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"2025-01-02T12:00:00Z", "2025-01-03T12:00:00Z"}, timestamps(w))
+	link := w.Header().Get("Link")
+	require.True(t, strings.HasPrefix(link, "</api/snapshot/range?cursor="), link)
+
+	w = get(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"2025-01-04T12:00:00Z"}, timestamps(w))
+	assert.Empty(t, w.Header().Get("Link"))
+
+	w = get("/api/snapshot/range?ip=192.168.1.1&to=2025-01-01T00:00:00Z")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+
+	assert.Equal(t, http.StatusNotAcceptable, get("/api/snapshot/range?from=2025-01-01T00:00:00Z").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/snapshot/range?ip=192.168.1.1&from=tomorrow").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/snapshot/range?ip=not-an-ip").Code)
+}
+
+func TestServer_GetHostTimeline(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	router := newSeededServer(t, jan1, jan1.Add(24*time.Hour), jan1.Add(48*time.Hour))
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	events := func(w *httptest.ResponseRecorder) []string {
+		var timeline struct {
+			IP     string `json:"ip"`
+			Events []struct {
+				From time.Time `json:"from"`
+				To   time.Time `json:"to"`
+				Type string    `json:"type"`
+			} `json:"events"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &timeline), w.Body.String())
+		assert.Equal(t, "192.168.1.1", timeline.IP)
+		result := []string{}
+		for _, event := range timeline.Events {
+			result = append(result, fmt.Sprintf("%s %s %s", event.From.Format(time.RFC3339), event.To.Format(time.RFC3339), event.Type))
+		}
+		return result
+	}
+
+	// Each seeded snapshot has a different HTTP status
+	w := get("/api/host/timeline?ip=192.168.1.1&limit=2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"2025-01-01T12:00:00Z 2025-01-02T12:00:00Z status_changed"}, events(w))
+	link := w.Header().Get("Link")
+	require.True(t, strings.HasPrefix(link, "</api/host/timeline?cursor="), link)
+
+	w = get(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"2025-01-02T12:00:00Z 2025-01-03T12:00:00Z status_changed"}, events(w))
+	assert.Empty(t, w.Header().Get("Link"))
+
+	w = get("/api/host/timeline?ip=192.168.1.1&from=2025-01-02T00:00:00Z&sort=desc")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"2025-01-02T12:00:00Z 2025-01-03T12:00:00Z status_changed"}, events(w))
+
+	assert.Equal(t, http.StatusNotAcceptable, get("/api/host/timeline").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/host/timeline?ip=192.168.1.1&sort=sideways").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/host/timeline?ip=not-an-ip").Code)
+}
+
+func TestServer_CompareSnapshots(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	blobStore := blobstore.NewMemoryStore()
+	snapshotService := service.NewSnapshotService(repo.NewMemorySnapshotRepo(), blobStore)
+	seed := func(ip string, timestamp time.Time, status int) {
+		contents := fmt.Sprintf(`{"timestamp": %q, "ip": %q, "services": [{"port": 80, "protocol": "HTTP", "status": %d}], "service_count": 1}`, timestamp.Format(time.RFC3339), ip, status)
+		require.NoError(t, snapshotService.CreateSnapshotFromBody(context.Background(), strings.NewReader(contents)))
+	}
+	seed("10.0.0.1", jan1, 200)
+	seed("10.0.0.1", jan1.Add(24*time.Hour), 200)
+	seed("10.0.0.2", jan1.Add(time.Minute), 200)
+	seed("10.0.0.3", jan1.Add(2*time.Minute), 503)
+	router := New(snapshotService, service.NewDifferencesServicet(nil, blobStore), 1024*1024, 1024*1024, nil)
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedDiff     string
+		expectedChanges  int
+		expectedLocation string
+	}{
+		{
+			name:             "replicas match",
+			query:            "ip1=10.0.0.1&ip2=10.0.0.2",
+			expectedStatus:   http.StatusOK,
+			expectedDiff:     "FullMatch",
+			expectedLocation: "/api/snapshot/compare?ip1=10.0.0.1&ip2=10.0.0.2&t1=2025-01-02T12%3A00%3A00Z&t2=2025-01-01T12%3A01%3A00Z",
+		},
+		{
+			name:             "replicas differ",
+			query:            "ip1=10.0.0.1&ip2=10.0.0.3",
+			expectedStatus:   http.StatusOK,
+			expectedDiff:     "NoMatch",
+			expectedChanges:  1,
+			expectedLocation: "/api/snapshot/compare?ip1=10.0.0.1&ip2=10.0.0.3&t1=2025-01-02T12%3A00%3A00Z&t2=2025-01-01T12%3A02%3A00Z",
+		},
+		{
+			name:             "nearest to a time",
+			query:            "ip1=10.0.0.1&t1=2025-01-01T12:00:30Z&ip2=10.0.0.2&t2=2025-01-01T12:00:30Z&mode=nearest",
+			expectedStatus:   http.StatusOK,
+			expectedDiff:     "FullMatch",
+			expectedLocation: "/api/snapshot/compare?ip1=10.0.0.1&ip2=10.0.0.2&t1=2025-01-01T12%3A00%3A00Z&t2=2025-01-01T12%3A01%3A00Z",
+		},
+		{name: "same host", query: "ip1=10.0.0.1&t1=earliest&ip2=10.0.0.1", expectedStatus: http.StatusOK, expectedDiff: "FullMatch", expectedLocation: "/api/snapshot/compare?ip1=10.0.0.1&ip2=10.0.0.1&t1=2025-01-01T12%3A00%3A00Z&t2=2025-01-02T12%3A00%3A00Z"},
+		{name: "missing host", query: "ip1=10.0.0.1", expectedStatus: http.StatusNotAcceptable},
+		{name: "invalid host", query: "ip1=10.0.0.1&ip2=not-an-ip", expectedStatus: http.StatusBadRequest},
+		{name: "invalid timestamp", query: "ip1=10.0.0.1&ip2=10.0.0.2&t1=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "unknown format", query: "ip1=10.0.0.1&ip2=10.0.0.2&format=xml", expectedStatus: http.StatusBadRequest},
+		{name: "no snapshot", query: "ip1=10.0.0.1&ip2=10.0.0.9", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/snapshot/compare?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var response diffResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedDiff, response.DiffStatus)
+			assert.Len(t, response.Changes, tt.expectedChanges)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Content-Location"))
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/api/snapshot/compare?ip1=10.0.0.1&ip2=10.0.0.2&format=json-patch", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jsonPatchContentType, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestServer_Search(t *testing.T) {
+	snapshotRepo := repo.NewMemorySnapshotRepo()
+	blobStore := blobstore.NewMemoryStore()
+	snapshotService := service.NewSnapshotService(snapshotRepo, blobStore)
+	snapshotService.ServiceIndex = repo.NewMemoryServiceIndexRepo(snapshotRepo)
+	seed := func(ip string, timestamp string, version string) {
+		contents := fmt.Sprintf(`{"timestamp": %q, "ip": %q, "services": [{"port": 443, "protocol": "HTTP", "software": {"vendor": "F5", "product": "nginx", "version": %q}}], "service_count": 1}`, timestamp, ip, version)
+		require.NoError(t, snapshotService.CreateSnapshotFromBody(context.Background(), strings.NewReader(contents)))
+	}
+	seed("10.0.0.1", "2025-01-01T12:00:00Z", "1.22.1")
+	seed("10.0.0.1", "2025-01-02T12:00:00Z", "1.24.0")
+	seed("10.0.0.2", "2025-01-01T12:00:00Z", "1.18.0")
+	seed("10.0.0.3", "2025-01-01T12:00:00Z", "1.25.3")
+	router := New(snapshotService, service.NewDifferencesServicet(nil, blobStore), 1024*1024, 1024*1024, nil)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	hosts := func(w *httptest.ResponseRecorder) []string {
+		var hits []struct {
+			IP       string `json:"ip"`
+			Services []struct {
+				Port    int    `json:"port"`
+				Version string `json:"version"`
+			} `json:"services"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hits), w.Body.String())
+		result := []string{}
+		for _, hit := range hits {
+			for _, service := range hit.Services {
+				result = append(result, fmt.Sprintf("%s:%d %s", hit.IP, service.Port, service.Version))
+			}
+		}
+		return result
+	}
+
+	w := get("/api/search?product=nginx&version=%3C1.24")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"10.0.0.2:443 1.18.0"}, hosts(w))
+
+	w = get("/api/search?product=NGINX&version=%3C1.24&at=2025-01-01T18:00:00Z")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"10.0.0.1:443 1.22.1", "10.0.0.2:443 1.18.0"}, hosts(w))
+
+	w = get("/api/search?port=443&limit=2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"10.0.0.1:443 1.24.0", "10.0.0.2:443 1.18.0"}, hosts(w))
+	link := w.Header().Get("Link")
+	require.True(t, strings.HasPrefix(link, "</api/search?cursor="), link)
+
+	w = get(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"10.0.0.3:443 1.25.3"}, hosts(w))
+	assert.Empty(t, w.Header().Get("Link"))
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/search?port=http").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/search?version=%3E%3D").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/search?since=2025-01-01T00:00:00Z").Code)
+
+	// Without a service index there is nothing to search
+	w = httptest.NewRecorder()
+	newSeededServer(t).ServeHTTP(w, httptest.NewRequest("GET", "/api/search", nil))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/service"
+)
+
+type snapshotStateResponse struct {
+	IP        string     `json:"ip"`
+	Timestamp time.Time  `json:"timestamp"`
+	Status    string     `json:"status"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// DeleteSnapshot handles DELETE /api/snapshot?ip={host}&at={timestamp}
+//
+// Summary: Soft delete the snapshot of a host at a timestamp. It is hidden from listings and diffs, and can be
+// restored until it is purged by the prune job. A corrected snapshot can be uploaded for the same host and timestamp
+// straight away.
+// Query Params:
+//   - ip: string (IPv4/IPv6)
+//   - at: string (timestamp of the snapshot)
+//
+// Example:
+// DELETE /api/snapshot?ip=125.199.235.74&at=2025-09-10T03:00:00Z
+//
+// Responses:
+//   - 200: SnapshotStateResponse
+//   - 400: API Error (Invalid host ip or timestamp)
+//   - 404: API Error (No snapshot for the host at the timestamp)
+//   - 406: API Error (Missing host ip or timestamp)
+//   - 500: Server Error (Unable to delete snapshot)
+//
+// Response Body:
+//
+//	{"ip": "125.199.235.74", "timestamp": "2025-09-10T03:00:00Z", "status": "deleted", "deleted_at": "2025-09-11T10:00:00Z"}
+func (server *Server) DeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeleteSnapshot: CALLED")
+
+	host_ip := r.URL.Query().Get("ip")
+	timestamp := r.URL.Query().Get("at")
+	if host_ip == "" || timestamp == "" {
+		log.Println("DeleteSnapshot: FAILED")
+		http.Error(w, "Error: No host ip or timestamp defined", http.StatusNotAcceptable)
+		return
+	}
+
+	snapshot, err := server.snapshotService.DeleteSnapshot(r.Context(), host_ip, timestamp)
+	if err != nil {
+		log.Println("DeleteSnapshot: FAILED")
+		http.Error(w, err.Error(), snapshotStateErrorStatus(err))
+		return
+	}
+	writeSnapshotState(w, snapshot)
+	log.Println("DeleteSnapshot: SUCCESS")
+}
+
+// RestoreSnapshot handles POST /api/snapshot/restore?ip={host}&at={timestamp}
+//
+// Summary: Restore the most recently deleted snapshot of a host at a timestamp, if it has not been purged.
+// Query Params:
+//   - ip: string (IPv4/IPv6)
+//   - at: string (timestamp of the snapshot)
+//
+// Example:
+// POST /api/snapshot/restore?ip=125.199.235.74&at=2025-09-10T03:00:00Z
+//
+// Responses:
+//   - 200: SnapshotStateResponse
+//   - 400: API Error (Invalid host ip or timestamp)
+//   - 404: API Error (No deleted snapshot for the host at the timestamp)
+//   - 406: API Error (Missing host ip or timestamp)
+//   - 409: API Error (Another snapshot has been uploaded for the host at the timestamp)
+//   - 500: Server Error (Unable to restore snapshot)
+//
+// Response Body:
+//
+//	{"ip": "125.199.235.74", "timestamp": "2025-09-10T03:00:00Z", "status": "committed"}
+func (server *Server) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	log.Println("RestoreSnapshot: CALLED")
+
+	host_ip := r.URL.Query().Get("ip")
+	timestamp := r.URL.Query().Get("at")
+	if host_ip == "" || timestamp == "" {
+		log.Println("RestoreSnapshot: FAILED")
+		http.Error(w, "Error: No host ip or timestamp defined", http.StatusNotAcceptable)
+		return
+	}
+
+	snapshot, err := server.snapshotService.RestoreSnapshot(r.Context(), host_ip, timestamp)
+	if err != nil {
+		log.Println("RestoreSnapshot: FAILED")
+		http.Error(w, err.Error(), snapshotStateErrorStatus(err))
+		return
+	}
+	writeSnapshotState(w, snapshot)
+	log.Println("RestoreSnapshot: SUCCESS")
+}
+
+func snapshotStateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, hostip.ErrInvalid), errors.Is(err, service.ErrInvalidTimestamp):
+		return http.StatusBadRequest
+	case errors.Is(err, repo.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrDuplicateSnapshot):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeSnapshotState(w http.ResponseWriter, snapshot repo.Snapshot) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(snapshotStateResponse{
+		IP:        snapshot.Host_IP,
+		Timestamp: snapshot.Timestamp.UTC(),
+		Status:    snapshot.Status,
+		DeletedAt: snapshot.Deleted_At,
+	})
+}
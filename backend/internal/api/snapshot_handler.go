@@ -1,29 +1,55 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"path/filepath"
-	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/model"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/service"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
 )
 
-// GetSnapshotForHost handles GET /api/snapshot?host={host}&at={timestamp}
+type validationErrorResponse struct {
+	Error  string             `json:"error"`
+	Fields []model.FieldError `json:"fields"`
+}
+
+// GetSnapshotForHost handles GET /api/snapshot?ip={host}&at={timestamp}
 //
-// Summary: Get snapshot at specific timestamp for a host.
-// Path Params:
-//   - host: string (IPv4/IPv6)
-//   - at: string (timestamp of file 1)
+// Summary: Get snapshot at specific timestamp for a host, or the closest to it with mode. The Content-Location header
+// has the URL of the snapshot returned, by its exact timestamp.
+// Query Params:
+//   - ip: string (IPv4/IPv6)
+//   - at: string (timestamp of the snapshot, or "latest"|"earliest"|"previous")
+//   - mode: string (optional, "exact"|"before"|"after"|"nearest", default "exact". before and after include at, and
+//     nearest picks the earlier snapshot on a tie. Not allowed with an alias.)
 //
 // Example:
-// GET /snapshots?host=125.199.235.74&at=2025-09-10T03:00:00Z
+// GET /api/snapshot?ip=125.199.235.74&at=2025-09-10T03:00:00Z
+// GET /api/snapshot?ip=125.199.235.74&at=2025-09-10T00:00:00Z&mode=nearest
+// GET /api/snapshot?ip=125.199.235.74&at=latest
+//
+// Snapshots stored compressed are sent as they are stored, with Content-Encoding set, when Accept-Encoding allows
+// their codec (gzip or zstd), and decompressed otherwise.
 //
 // Responses:
 //   - 200: ListSnapshotsResponse
-//   - 204: APIError (Snapshot not found in DB or on disk)
-//   - 500: API Error (Unable to create difference)
+//   - 400: APIError (Invalid host ip, timestamp or mode)
+//   - 404: APIError (No snapshot found, or snapshot not found in blob store)
+//   - 406: APIError (Missing host ip or timestamp)
+//   - 500: API Error (Unable to look up or read snapshot)
 //
 // Response Body:
 //
@@ -44,42 +70,203 @@ func (server *Server) GetSnapshotForHost(w http.ResponseWriter, r *http.Request)
 
 	log.Println("Getting Snapshots for Host", host_ip, timestamp)
 
-	snapshotPath, err := server.snapshotService.GetSnapshotByTimestamp(ctx, host_ip, timestamp)
+	snapshot, err := server.snapshotService.FindSnapshot(ctx, host_ip, timestamp, r.URL.Query().Get("mode"))
 	if err != nil {
 		log.Println("GetSnapshotForHost: FAILED")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), lookupErrorStatus(err))
+		return
+	}
+	file, codec, err := server.snapshotService.OpenStored(ctx, snapshot)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		log.Println("GetSnapshotForHost: FAILED")
+		http.Error(w, "Unable to read file from storage: "+err.Error(), http.StatusNotFound)
 		return
 	}
-	file, err := os.Open(snapshotPath)
 	if err != nil {
 		log.Println("GetSnapshotForHost: FAILED")
-		http.Error(w, "Unable to read file from disk: "+err.Error(), http.StatusNotFound)
+		http.Error(w, "Unable to read file from storage: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	defer file.Close()
+
+	var body io.Reader = file
+	w.Header().Set("Vary", "Accept-Encoding")
+	if codec != compression.Identity && acceptsEncoding(r.Header.Get("Accept-Encoding"), codec) {
+		w.Header().Set("Content-Encoding", codec)
+	} else {
+		decompressed, err := compression.NewReader(codec, file)
+		if err != nil {
+			log.Println("GetSnapshotForHost: FAILED")
+			http.Error(w, "Unable to decompress file from storage: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer decompressed.Close()
+		body = decompressed
+	}
+	w.Header().Set("Content-Location", withQuery(r, url.Values{"at": {formatTimestamp(snapshot.Timestamp)}, "mode": {""}}))
 	w.Header().Set("Content-Type", "application/json")
-	io.Copy(w, file)
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
 	log.Println("GetSnapshotForHost: SUCCESS")
 }
 
-// GetAllSnapshotsForHost handles GET /api/host?host={host}
+// GetSnapshotRange handles GET /api/snapshot/range?ip={host}&from={timestamp}&to={timestamp}
+//
+// Summary: Get a page of the snapshots of a host between two timestamps, ordered by time. When there are more
+// snapshots the Link header has the URL of the next page, with rel="next".
+// Query Params:
+//   - ip: string (IPv4/IPv6)
+//   - from, to: timestamp (optional, the range, inclusive. Unbounded if not given.)
+//   - cursor: string (optional, from the Link header of the previous page)
+//   - limit: int (optional, 1 to 1000, default 100)
+//   - sort: string (optional, "asc"|"desc", default "asc")
+//
+// Example:
+// GET /api/snapshot/range?ip=125.199.235.74&from=2025-09-01T00:00:00Z&to=2025-09-30T23:59:59Z
+//
+// The snapshots are streamed, so a snapshot that cannot be read after the response has started ends it early, and
+// the body is not valid JSON.
+//
+// Responses:
+//   - 200: List of snapshots
+//   - 400: APIError (Invalid host ip or query params)
+//   - 406: APIError (No host ip)
+//   - 500: API Error (Unable to list snapshots)
+//
+// Response Body:
+//
+//	[
+//		JSON contents of each snapshot file
+//	]
+func (server *Server) GetSnapshotRange(w http.ResponseWriter, r *http.Request) {
+	log.Println("GetSnapshotRange: CALLED")
+
+	query := r.URL.Query()
+	host_ip := query.Get("ip")
+	if host_ip == "" {
+		log.Println("GetSnapshotRange: FAILED")
+		http.Error(w, "Error: No host ip defined", http.StatusNotAcceptable)
+		return
+	}
+	options := service.ListOptions{
+		Cursor: query.Get("cursor"),
+		Limit:  query.Get("limit"),
+		Sort:   query.Get("sort"),
+		Since:  query.Get("from"),
+		Until:  query.Get("to"),
+	}
+	ctx := r.Context()
+
+	snapshots, next, err := server.snapshotService.SnapshotsInRange(ctx, host_ip, options)
+	if err != nil {
+		log.Printf("GetSnapshotRange: FAILED %v", err)
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+
+	setNextLink(w, r, next)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "[")
+	for i, snapshot := range snapshots {
+		if i > 0 {
+			io.WriteString(w, ",")
+		}
+		if err := server.copySnapshot(ctx, w, snapshot); err != nil {
+			log.Printf("GetSnapshotRange: FAILED to read snapshot %s at %s: %v", snapshot.Host_IP, formatTimestamp(snapshot.Timestamp), err)
+			return
+		}
+	}
+	io.WriteString(w, "]")
+	log.Printf("GetSnapshotRange: SUCCESS %d snapshots", len(snapshots))
+}
+
+// copySnapshot writes the decompressed contents of a snapshot to w
+func (server *Server) copySnapshot(ctx context.Context, w io.Writer, snapshot repo.Snapshot) error {
+	file, codec, err := server.snapshotService.OpenStored(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decompressed, err := compression.NewReader(codec, file)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+	_, err = io.Copy(w, decompressed)
+	return err
+}
+
+// formatTimestamp formats a snapshot timestamp for a response or URL
+func formatTimestamp(timestamp time.Time) string {
+	return timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows a content coding
 //
-// Summary: Get all timestamps of all snapshots available for a host.
-// Path Params:
-//   - host: string (IPv4/IPv6)
+// Summary: A coding is allowed if it is listed, or if "*" is listed and the coding is not, with a q-value above 0.
 //
 // Example:
-// GET /api/host?host=125.199.235.74
+// acceptsEncoding("gzip, zstd;q=0.5", "zstd") -> true
+// acceptsEncoding("*, zstd;q=0", "zstd") -> false
+func acceptsEncoding(header string, coding string) bool {
+	listed, listedAccepted, wildcardAccepted := false, false, false
+	for _, entry := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.TrimSpace(name)
+		accepted := qValue(params) > 0
+		switch {
+		case strings.EqualFold(name, coding):
+			listed, listedAccepted = true, accepted
+		case name == "*":
+			wildcardAccepted = accepted
+		}
+	}
+	if listed {
+		return listedAccepted
+	}
+	return wildcardAccepted
+}
+
+// qValue returns the q parameter of an Accept or Accept-Encoding entry, 1 if there is none and 0 if it is malformed
+func qValue(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(strings.TrimSpace(key), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return 0
+			}
+			return q
+		}
+	}
+	return 1
+}
+
+// GetAllSnapshotsForHost handles GET /api/host?ip={host}
+//
+// Summary: Get a page of the timestamps of the snapshots available for a host, ordered by time. When there are more
+// snapshots the Link header has the URL of the next page, with rel="next".
+// Query Params:
+//   - ip: string (IPv4/IPv6)
+//   - cursor: string (optional, from the Link header of the previous page)
+//   - limit: int (optional, 1 to 1000, default 100)
+//   - sort: string (optional, "asc"|"desc", default "asc")
+//   - since, until: timestamp (optional, keep snapshots in the range, inclusive)
+//
+// Example:
+// GET /api/host?ip=125.199.235.74&since=2025-09-01T00:00:00Z&sort=desc
 //
 // Responses:
 //   - 200: ListSnapshotsResponse
-//   - 204: APIError (Snapshot not found in DB or on disk)
-//   - 500: API Error (Unable to create difference)
+//   - 400: APIError (Invalid host ip or query params)
+//   - 406: APIError (No host ip)
+//   - 500: API Error (Unable to list snapshots)
 //
 // Response Body:
 //
 //	{
-//	 	[List of all timestamps for the snapshots available for a host as strings]
+//	 	[List of timestamps for the snapshots available for a host as strings]
 //	}
 func (server *Server) GetAllSnapshotsForHost(w http.ResponseWriter, r *http.Request) {
 	log.Println("GetAllSnapshotsForHost: CALLED")
@@ -94,26 +281,31 @@ func (server *Server) GetAllSnapshotsForHost(w http.ResponseWriter, r *http.Requ
 
 	ctx := r.Context()
 
-	availableSnapshots, err := server.snapshotService.ListAllSnapshotsForHost(ctx, host_ip)
+	page, err := server.snapshotService.ListSnapshotsForHost(ctx, host_ip, listOptions(r))
 	if err != nil {
 		log.Println("GetAllSnapshotsForHost: Failed")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), listErrorStatus(err))
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(availableSnapshots)
+	writePage(w, r, page)
 	log.Println("GetAllSnapshotsForHost: Success")
 }
 
 // CreateSnapshot handles Post /api/snapshot
 //
-// Summary: Create a snapshot for a host.
+// Summary: Create snapshots for hosts. The form may contain several `file` parts, and each part may be a snapshot or
+// a .tar.gz, .tgz or .zip archive of snapshots. Each snapshot is limited to MaxFileSize, and the whole request,
+// including the decompressed contents of archives, to MaxRequestSize.
+// Query Params:
+//   - metadata: string (optional, "filename"|"body". With "body" the host ip and timestamp are taken from the
+//     snapshot body and the file can have any name. Defaults to "filename", which must match the body.)
+//
 // Body Params:
-//   - file: string (JSON String of body of snapshot file)
+//   - file: string (JSON String of body of snapshot file, or archive of snapshot files. May be repeated.)
 //
 // Example:
 // POST /api/snapshot
+// POST /api/snapshot?metadata=body
 // Content-Type: multipart/form-data
 // Body:
 //
@@ -121,33 +313,105 @@ func (server *Server) GetAllSnapshotsForHost(w http.ResponseWriter, r *http.Requ
 //		 	file: (File)
 //	}
 //
-// Responses:
+// Responses for a single snapshot file:
 //   - 200: Success
 //   - 209: API Error (Snapshot failed to be created by DB)
-//   - 400: API Error (Invalid file format)
+//   - 400: API Error (Invalid file format) | ValidationErrorResponse (Invalid snapshot body)
 //   - 500: Server Error (Unable to create snapshot)
+//
+// Responses for several files or an archive:
+//   - 200: UploadResponse (status of each file, "created"|"duplicate"|"invalid"|"failed")
+//   - 400: API Error (No files, or unreadable form)
+//
+// Validation Error Response Body:
+//
+//	{
+//	  "error": "Invalid host snapshot: ...",
+//	  "fields": [{"field": "services[0].port", "message": "0 is not between 1 and 65535"}]
+//	}
+//
+// Upload Response Body:
+//
+//	{
+//	  "results": [
+//	    {"file": "host_125.199.235.74_2025-09-10T03-00-00Z.json", "status": "created"},
+//	    {"file": "scans.tar.gz/host_125.199.235.74_2025-09-10T03-00-00Z.json", "status": "duplicate", "error": "..."},
+//	    {"file": "scans.tar.gz/host_1.1.1.1_2025-09-10T03-00-00Z.json", "status": "invalid", "error": "...", "fields": [...]}
+//	  ]
+//	}
 func (server *Server) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	log.Println("CreateSnapshot: CALLED")
 
-	//Read the file from the http request
-	r.Body = http.MaxBytesReader(w, r.Body, int64(server.MaxFileSize))
+	metadata := r.URL.Query().Get("metadata")
+	if metadata != "" && metadata != "filename" && metadata != "body" {
+		log.Println("CreateSnapshot: FAILED")
+		http.Error(w, "Error: metadata must be one of filename, body", http.StatusBadRequest)
+		return
+	}
 
-	file, header, err := r.FormFile("file")
+	//Read the files from the http request as they arrive, rather than buffering the whole form
+	maxRequestSize := int64(server.maxRequestSize())
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	reader, err := r.MultipartReader()
 	if err != nil {
 		log.Println("CreateSnapshot: FAILED")
 		http.Error(w, "Missing File under form field 'file': "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	filename := filepath.Base(header.Filename)
-	if !server.validateFileNameFormat(filename) {
+	upload := &snapshotUpload{
+		ctx:             ctx,
+		snapshotService: server.snapshotService,
+		metadata:        metadata,
+		maxFileSize:     int64(server.MaxFileSize),
+		remaining:       maxRequestSize,
+	}
+	for !upload.exhausted {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(upload.results) == 0 {
+				log.Println("CreateSnapshot: FAILED")
+				http.Error(w, "Missing File under form field 'file': "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			upload.addResult("", requestError(err), false)
+			break
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			upload.ingestPart(filepath.Base(part.FileName()), part)
+		}
+		part.Close()
+	}
+
+	if len(upload.results) == 0 {
+		log.Println("CreateSnapshot: FAILED")
+		http.Error(w, "Missing File under form field 'file': http: no such file", http.StatusBadRequest)
+		return
+	}
+	if upload.isBatch() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(uploadResponse{Results: upload.results})
+		log.Println("CreateSnapshot: SUCCESS")
+		return
+	}
+
+	err = upload.results[0].err
+	var validationError *model.ValidationError
+	if errors.As(err, &validationError) {
 		log.Println("CreateSnapshot: FAILED")
-		http.Error(w, "expected host_<ip>_<YYYY-MM-DD>T<HH-MM-SS>[.fraction](Z|±HH-MM).json", http.StatusBadRequest)
+		writeValidationError(w, validationError)
+		return
+	}
+	if uploadStatus(err) == uploadInvalid {
+		log.Println("CreateSnapshot: FAILED")
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	err = server.snapshotService.CreateSnapshot(ctx, file, filename)
 	if err != nil {
 		log.Println("CreateSnapshot: FAILED")
 		http.Error(w, err.Error(), http.StatusConflict)
@@ -157,32 +421,33 @@ func (server *Server) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
 	log.Println("CreateSnapshot: SUCCESS")
 }
 
+// maxRequestSize is the limit on the size of one upload request, which is at least one file
+func (server *Server) maxRequestSize() int {
+	if server.MaxRequestSize < server.MaxFileSize {
+		return server.MaxFileSize
+	}
+	return server.MaxRequestSize
+}
+
 // validateFileNameFormat validates the filename format to the expected format
 //
-// Summary: Validate the filename format
-// Expected Format:
-//
-//	host_<ip>_<YYYY-MM-DD>T<HH-MM-SS>[.fraction](Z|±HH-MM).json
-//	- Timestamp will be ISO 8601 format
+// Summary: Validate the filename format, see snapshotname.Parse for the expected format
 //
 // Example:
-// validateFileNameFormat("host_125.199.235.74_2025-09-10T03-00-00.json")
+// validateFileNameFormat("host_125.199.235.74_2025-09-10T03-00-00Z.json")
 //
 // Returns:
 //   - bool: true if the filename format is valid, false otherwise
 func (server *Server) validateFileNameFormat(filename string) bool {
-	fileNameRegex := regexp.MustCompile(
-		`^host_` +
-			`((?:\d{1,3}\.){3}\d{1,3})_` + // IPv4
-			`(\d{4}-\d{2}-\d{2})T` + // date
-			`(\d{2})-(\d{2})-(\d{2})` + // time HH-MM-SS (dashes instead of colons)
-			`(\.\d+)?` + // optional fractional seconds
-			`(Z|[+\-]\d{2}-\d{2})` + // Z or ±HH-MM (dash instead of colon)
-			`\.json$`,
-	)
-	matches := fileNameRegex.FindStringSubmatch(filename)
-	if matches == nil {
-		return false
-	}
-	return true
+	return snapshotname.Match(filename)
+}
+
+// writeValidationError writes a 400 listing each invalid field of an uploaded snapshot
+func writeValidationError(w http.ResponseWriter, validationError *model.ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(validationErrorResponse{
+		Error:  validationError.Error(),
+		Fields: validationError.Fields,
+	})
 }
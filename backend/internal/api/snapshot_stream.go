@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/endingwithali/2025censys/internal/model"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// streamResult is the outcome of one line of an NDJSON upload
+type streamResult struct {
+	Line   int                `json:"line"`
+	Status string             `json:"status"`
+	Error  string             `json:"error,omitempty"`
+	Fields []model.FieldError `json:"fields,omitempty"`
+}
+
+// StreamSnapshots handles POST /api/snapshots:stream
+//
+// Summary: Create snapshots from newline delimited JSON, one host snapshot per line. The host ip and timestamp are
+// taken from each snapshot body. A result is written for each line as soon as it is stored, so the response is
+// streamed while the request is still being read. Each line is limited to MaxFileSize, and there is no limit on the
+// number of lines. Blank lines are skipped.
+//
+// Example:
+// POST /api/snapshots:stream
+// Content-Type: application/x-ndjson
+// Body:
+//
+//	{"timestamp": "2025-09-10T03:00:00Z", "ip": "125.199.235.74", "services": [], "service_count": 0}
+//	{"timestamp": "2025-09-10T03:00:00Z", "ip": "1.1.1.1", "services": [], "service_count": 0}
+//
+// Responses:
+//   - 200: StreamResult per line, as NDJSON (status "created"|"duplicate"|"invalid"|"failed")
+//   - 415: API Error (Content-Type is not application/x-ndjson)
+//
+// Response Body:
+//
+//	{"line": 1, "status": "created"}
+//	{"line": 2, "status": "invalid", "error": "Invalid host snapshot: ...", "fields": [...]}
+func (server *Server) StreamSnapshots(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log.Println("StreamSnapshots: CALLED")
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != ndjsonContentType {
+		log.Println("StreamSnapshots: FAILED")
+		http.Error(w, "Error: Content-Type must be "+ndjsonContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Results are written while the body is still being read, which HTTP/1.x only allows in full duplex mode.
+	// Recorders and HTTP/2 do not support or need it.
+	controller := http.NewResponseController(w)
+	controller.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	reader := bufio.NewReader(r.Body)
+	maxLineSize := server.MaxFileSize
+	counts := map[string]int{}
+	for lineNumber := 1; ctx.Err() == nil; lineNumber++ {
+		line, tooLarge, readErr := readNDJSONLine(reader, maxLineSize)
+		if readErr != nil && readErr != io.EOF {
+			encoder.Encode(newStreamResult(lineNumber, fmt.Errorf("Failed to read request: %w", readErr)))
+			counts[uploadFailed]++
+			break
+		}
+
+		line = bytes.TrimSpace(line)
+		if tooLarge || len(line) > 0 {
+			err = fmt.Errorf("%w of %d bytes", errFileTooLarge, maxLineSize)
+			if !tooLarge {
+				err = server.snapshotService.CreateSnapshotFromBody(ctx, bytes.NewReader(line))
+			}
+			result := newStreamResult(lineNumber, err)
+			counts[result.Status]++
+			encoder.Encode(result)
+			controller.Flush()
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	log.Println("StreamSnapshots: SUCCESS", counts)
+}
+
+func newStreamResult(lineNumber int, err error) streamResult {
+	result := streamResult{Line: lineNumber, Status: uploadStatus(err)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	var validationError *model.ValidationError
+	if errors.As(err, &validationError) {
+		result.Fields = validationError.Fields
+	}
+	return result
+}
+
+// readNDJSONLine reads the next line without its newline, buffering at most maxSize bytes of it. A longer line is
+// read to its end and discarded, and tooLarge is set. err is io.EOF for the last line.
+func readNDJSONLine(reader *bufio.Reader, maxSize int) (line []byte, tooLarge bool, err error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLarge {
+			line = append(line, chunk...)
+			if len(bytes.TrimRight(line, "\r\n")) > maxSize {
+				line, tooLarge = nil, true
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return bytes.TrimRight(line, "\r\n"), tooLarge, err
+	}
+}
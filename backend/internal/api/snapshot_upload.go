@@ -0,0 +1,242 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/endingwithali/2025censys/internal/model"
+	"github.com/endingwithali/2025censys/internal/service"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
+)
+
+// Upload statuses reported per file
+const (
+	uploadCreated   = "created"
+	uploadDuplicate = "duplicate"
+	uploadInvalid   = "invalid"
+	uploadFailed    = "failed"
+)
+
+var (
+	errFileNameFormat    = errors.New("expected host_<ip>_<YYYY-MM-DD>T<HH-MM-SS>[.fraction](Z|±HH-MM).json, with IPv6 colons written as dashes")
+	errFileTooLarge      = errors.New("file exceeds max file size")
+	errRequestTooLarge   = errors.New("request exceeds max request size")
+	errUnsupportedUpload = errors.New("unsupported file in archive, expected .json")
+)
+
+// uploadResult is the outcome of one uploaded file, or of one file inside an uploaded archive
+type uploadResult struct {
+	File   string             `json:"file"`
+	Status string             `json:"status"`
+	Error  string             `json:"error,omitempty"`
+	Fields []model.FieldError `json:"fields,omitempty"`
+
+	err         error
+	fromArchive bool
+}
+
+type uploadResponse struct {
+	Results []uploadResult `json:"results"`
+}
+
+// snapshotUpload ingests the files of one upload request, enforcing the per-file and per-request size limits.
+// The request limit applies to the decompressed size of archive contents as well as to the request body.
+type snapshotUpload struct {
+	ctx             context.Context
+	snapshotService *service.SnapshotService
+	metadata        string
+	maxFileSize     int64
+	remaining       int64
+	exhausted       bool
+	results         []uploadResult
+}
+
+// ingestPart ingests one `file` part, which is an archive of snapshots if it is named .tar.gz, .tgz or .zip, and
+// a snapshot otherwise
+func (upload *snapshotUpload) ingestPart(name string, part io.Reader) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		upload.ingestTarGz(name, part)
+	case strings.HasSuffix(lower, ".zip"):
+		upload.ingestZip(name, part)
+	default:
+		upload.ingestFile(name, name, part, false)
+	}
+}
+
+func (upload *snapshotUpload) ingestTarGz(name string, part io.Reader) {
+	gz, err := gzip.NewReader(part)
+	if err != nil {
+		upload.addResult(name, requestError(fmt.Errorf("Failed to read archive: %w", err)), false)
+		return
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+	for !upload.exhausted {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			upload.addResult(name, requestError(fmt.Errorf("Failed to read archive: %w", err)), true)
+			return
+		}
+		if header.Typeflag != tar.TypeReg || skipArchiveEntry(header.Name) {
+			continue
+		}
+		upload.ingestArchiveEntry(name, header.Name, archive)
+	}
+}
+
+func (upload *snapshotUpload) ingestZip(name string, part io.Reader) {
+	// zip needs random access, so the archive is buffered. It is bounded by the request size limit.
+	contents, err := io.ReadAll(io.LimitReader(part, upload.remaining+1))
+	if err != nil {
+		upload.addResult(name, requestError(err), false)
+		return
+	}
+	if int64(len(contents)) > upload.remaining {
+		upload.addResult(name, errRequestTooLarge, false)
+		return
+	}
+	archive, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		upload.addResult(name, fmt.Errorf("Failed to read archive: %w", err), false)
+		return
+	}
+	for _, entry := range archive.File {
+		if upload.exhausted {
+			return
+		}
+		if entry.FileInfo().IsDir() || skipArchiveEntry(entry.Name) {
+			continue
+		}
+		reader, err := entry.Open()
+		if err != nil {
+			upload.addResult(name+"/"+entry.Name, fmt.Errorf("Failed to read archive entry: %w", err), true)
+			continue
+		}
+		upload.ingestArchiveEntry(name, entry.Name, reader)
+		reader.Close()
+	}
+}
+
+func (upload *snapshotUpload) ingestArchiveEntry(archiveName string, entryName string, entry io.Reader) {
+	display := archiveName + "/" + entryName
+	if !strings.HasSuffix(strings.ToLower(entryName), ".json") {
+		upload.addResult(display, errUnsupportedUpload, true)
+		return
+	}
+	upload.ingestFile(display, path.Base(entryName), entry, true)
+}
+
+// skipArchiveEntry ignores hidden files, such as the AppleDouble files macOS adds to zips
+func skipArchiveEntry(name string) bool {
+	return strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/")
+}
+
+// ingestFile reads one snapshot, enforcing the size limits, and stores it
+func (upload *snapshotUpload) ingestFile(display string, filename string, file io.Reader, fromArchive bool) {
+	if upload.exhausted {
+		return
+	}
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+
+	limit := upload.maxFileSize
+	if upload.remaining < limit {
+		limit = upload.remaining
+	}
+	contents, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		upload.addResult(display, requestError(err), fromArchive)
+		return
+	}
+	if int64(len(contents)) > upload.remaining {
+		upload.addResult(display, errRequestTooLarge, fromArchive)
+		return
+	}
+	upload.remaining -= int64(len(contents))
+	if int64(len(contents)) > upload.maxFileSize {
+		// Skip the rest of the file so the next one can be read. The skipped bytes count towards the request
+		// limit, so an archive entry that decompresses forever cannot keep the request running.
+		skipped, err := io.CopyN(io.Discard, file, upload.remaining+1)
+		if err != nil && err != io.EOF {
+			upload.addResult(display, requestError(err), fromArchive)
+			return
+		}
+		if skipped > upload.remaining {
+			upload.addResult(display, errRequestTooLarge, fromArchive)
+			return
+		}
+		upload.remaining -= skipped
+		upload.addResult(display, fmt.Errorf("%w of %d bytes", errFileTooLarge, upload.maxFileSize), fromArchive)
+		return
+	}
+
+	switch upload.metadata {
+	case "body":
+		err = upload.snapshotService.CreateSnapshotFromBody(upload.ctx, bytes.NewReader(contents))
+	default:
+		if !snapshotname.Match(filename) {
+			err = errFileNameFormat
+		} else {
+			err = upload.snapshotService.CreateSnapshot(upload.ctx, bytes.NewReader(contents), filename)
+		}
+	}
+	upload.addResult(display, err, fromArchive)
+}
+
+// requestError converts a failure to read the request body into errRequestTooLarge when the body limit was hit
+func requestError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errRequestTooLarge
+	}
+	return err
+}
+
+func (upload *snapshotUpload) addResult(display string, err error, fromArchive bool) {
+	if errors.Is(err, errRequestTooLarge) {
+		upload.exhausted = true
+	}
+	result := uploadResult{File: display, Status: uploadStatus(err), err: err, fromArchive: fromArchive}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	var validationError *model.ValidationError
+	if errors.As(err, &validationError) {
+		result.Fields = validationError.Fields
+	}
+	upload.results = append(upload.results, result)
+}
+
+func uploadStatus(err error) string {
+	var validationError *model.ValidationError
+	switch {
+	case err == nil:
+		return uploadCreated
+	case errors.Is(err, service.ErrDuplicateSnapshot):
+		return uploadDuplicate
+	case errors.As(err, &validationError), errors.Is(err, errFileNameFormat), errors.Is(err, errFileTooLarge),
+		errors.Is(err, errRequestTooLarge), errors.Is(err, errUnsupportedUpload):
+		return uploadInvalid
+	default:
+		return uploadFailed
+	}
+}
+
+// isBatch reports whether the upload gets the per-file results response. A single JSON file keeps the
+// original single status code response.
+func (upload *snapshotUpload) isBatch() bool {
+	return len(upload.results) != 1 || upload.results[0].fromArchive
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/endingwithali/2025censys/internal/service"
+)
+
+// GetHostTimeline handles GET /api/host/timeline?ip={host}
+//
+// Summary: Walk a page of the snapshots of a host in time order and diff each consecutive pair, returning the
+// changes as events bounded by the timestamps of the two snapshots. Differences already computed are reused. When
+// there are more snapshots the Link header has the URL of the next page, with rel="next". The next page starts with
+// the change from the last snapshot of this page, so following the links loses no change.
+// Query Params:
+//   - ip: string (IPv4/IPv6)
+//   - from, to: timestamp (optional, the range, inclusive. Unbounded if not given.)
+//   - cursor: string (optional, from the Link header of the previous page)
+//   - limit: int (optional, snapshots in the page, 1 to 1000, default 100)
+//   - sort: string (optional, "asc"|"desc", default "asc")
+//
+// Example:
+// GET /api/host/timeline?ip=125.199.235.74&from=2025-09-01T00:00:00Z
+//
+// Responses:
+//   - 200: Timeline
+//   - 400: APIError (Invalid host ip or query params)
+//   - 406: APIError (No host ip)
+//   - 500: API Error (Unable to read or compare snapshots)
+//
+// Response Body:
+//
+//	{
+//	  "ip": "125.199.235.74",
+//	  "snapshots": ["2025-09-10T03:00:00Z", "2025-09-15T08:49:45Z"],
+//	  "events": [
+//	    {"from": "2025-09-10T03:00:00Z", "to": "2025-09-15T08:49:45Z", "type": "service_added", "port": 443, "protocol": "HTTPS", "new": {...}}
+//	  ]
+//	}
+func (server *Server) GetHostTimeline(w http.ResponseWriter, r *http.Request) {
+	log.Println("GetHostTimeline: CALLED")
+
+	query := r.URL.Query()
+	host_ip := query.Get("ip")
+	if host_ip == "" {
+		log.Println("GetHostTimeline: FAILED")
+		http.Error(w, "Error: No host ip defined", http.StatusNotAcceptable)
+		return
+	}
+	options := service.ListOptions{
+		Cursor: query.Get("cursor"),
+		Limit:  query.Get("limit"),
+		Sort:   query.Get("sort"),
+		Since:  query.Get("from"),
+		Until:  query.Get("to"),
+	}
+
+	timeline, err := server.timelineService.GetTimeline(r.Context(), host_ip, options)
+	if err != nil {
+		log.Printf("GetHostTimeline: FAILED %v", err)
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+
+	log.Printf("GetHostTimeline: SUCCESS %d events across %d snapshots", len(timeline.Events), len(timeline.Snapshots))
+	setNextLink(w, r, timeline.Next)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(timeline)
+}
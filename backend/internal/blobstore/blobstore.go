@@ -0,0 +1,56 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned (wrapped) when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore stores snapshot blobs under slash-separated keys such as "ab/ab12...ef.json"
+//
+// Implementations must be safe for concurrent use. Several backend replicas may share one store, so Put of a key
+// that already exists replaces it. With content-addressed keys the replacement has identical content.
+type BlobStore interface {
+	// Put stores the contents of r under key
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the blob stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat returns the size and modification time of the blob stored under key
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every blob whose key starts with prefix, ordered by key
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
+// ReadAll reads the whole blob stored under key
+func ReadAll(ctx context.Context, store BlobStore, key string) ([]byte, error) {
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// validateKey rejects keys that could escape the store, such as absolute paths or ".." segments
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
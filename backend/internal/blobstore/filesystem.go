@@ -0,0 +1,163 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSystemStore stores blobs as files under a root directory
+type FileSystemStore struct {
+	Root string
+}
+
+func NewFileSystemStore(root string) *FileSystemStore {
+	return &FileSystemStore{
+		Root: root,
+	}
+}
+
+func (store *FileSystemStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(store.Root, filepath.FromSlash(key)), nil
+}
+
+// tempPrefix marks partially written blobs. They are skipped by List and never returned by Get.
+const tempPrefix = ".tmp-"
+
+// Put writes the blob atomically: contents go to a temp file in the same directory, which is fsynced and then
+// renamed over the final path. A crash leaves either no blob or the complete blob, plus at most a stray temp file.
+func (store *FileSystemStore) Put(ctx context.Context, key string, r io.Reader) error {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(blobPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create blob directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(dir, tempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("Failed to write blob to disk: %v", err)
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return fmt.Errorf("Failed to write contents of blob to disk: %v", err)
+	}
+	// os.CreateTemp uses 0600, match the permissions blobs were always created with
+	if err := tmp.Chmod(0o644); err != nil {
+		return fmt.Errorf("Failed to set blob permissions: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("Failed to flush blob to disk: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to write blob to disk: %v", err)
+	}
+	if err := os.Rename(tmpPath, blobPath); err != nil {
+		return fmt.Errorf("Failed to move blob into place: %v", err)
+	}
+	committed = true
+	return syncDir(dir)
+}
+
+// syncDir fsyncs a directory so that a rename into it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("Failed to flush blob directory: %v", err)
+	}
+	return nil
+}
+
+func (store *FileSystemStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(blobPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return file, err
+}
+
+func (store *FileSystemStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	info, err := os.Stat(blobPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return BlobInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (store *FileSystemStore) Delete(ctx context.Context, key string) error {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(blobPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (store *FileSystemStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	blobs := []BlobInfo{}
+	err := filepath.WalkDir(store.Root, func(walkPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && walkPath == store.Root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), tempPrefix) {
+			return nil
+		}
+		relative, err := filepath.Rel(store.Root, walkPath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, BlobInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Key < blobs[j].Key })
+	return blobs, nil
+}
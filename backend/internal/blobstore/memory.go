@@ -0,0 +1,83 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps blobs in memory. Intended for tests and single-process development.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+type memoryBlob struct {
+	contents []byte
+	modTime  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blobs: map[string]memoryBlob{},
+	}
+}
+
+func (store *MemoryStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("Failed to read blob contents: %v", err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.blobs[key] = memoryBlob{contents: contents, modTime: time.Now()}
+	return nil
+}
+
+func (store *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	blob, ok := store.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return io.NopCloser(bytes.NewReader(blob.contents)), nil
+}
+
+func (store *MemoryStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	blob, ok := store.blobs[key]
+	if !ok {
+		return BlobInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return BlobInfo{Key: key, Size: int64(len(blob.contents)), ModTime: blob.modTime}, nil
+}
+
+func (store *MemoryStore) Delete(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.blobs, key)
+	return nil
+}
+
+func (store *MemoryStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	blobs := []BlobInfo{}
+	for key, blob := range store.blobs {
+		if strings.HasPrefix(key, prefix) {
+			blobs = append(blobs, BlobInfo{Key: key, Size: int64(len(blob.contents)), ModTime: blob.modTime})
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Key < blobs[j].Key })
+	return blobs, nil
+}
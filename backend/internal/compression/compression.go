@@ -0,0 +1,141 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs snapshots can be stored with. The names are HTTP content codings, so stored bytes can be sent as they are
+// to a client whose Accept-Encoding includes the codec.
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+)
+
+// ErrUnknownCodec is returned (wrapped) for a codec name that is not Identity, Gzip or Zstd
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+// zstdEncoder is shared, EncodeAll is safe for concurrent use
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// Parse returns the codec for a configured compression name
+//
+// Example:
+// Parse("none") -> Identity
+// Parse("ZSTD") -> Zstd
+func Parse(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", "none", Identity:
+		return Identity, nil
+	case Gzip:
+		return Gzip, nil
+	case Zstd:
+		return Zstd, nil
+	default:
+		return "", fmt.Errorf("%w: %q, expected none, gzip or zstd", ErrUnknownCodec, name)
+	}
+}
+
+// Extension is the suffix added to the key of a blob stored with the codec
+//
+// Example:
+// Extension(Zstd) -> ".zst"
+// Extension(Identity) -> ""
+func Extension(codec string) string {
+	switch codec {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// FromKey returns the codec of a blob from its key, the inverse of Extension
+func FromKey(key string) string {
+	switch {
+	case strings.HasSuffix(key, ".gz"):
+		return Gzip
+	case strings.HasSuffix(key, ".zst"):
+		return Zstd
+	default:
+		return Identity
+	}
+}
+
+// Compress encodes data with the codec. An empty codec is Identity.
+func Compress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case "", Identity:
+		return data, nil
+	case Gzip:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, codec)
+	}
+}
+
+// NewReader returns a reader of the decoded contents of r, which was encoded with the codec. An empty codec is
+// Identity. Closing the returned reader also closes r.
+func NewReader(codec string, r io.ReadCloser) (io.ReadCloser, error) {
+	switch codec {
+	case "", Identity:
+		return r, nil
+	case Gzip:
+		reader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &decodingReader{Reader: reader, closers: []io.Closer{reader, r}}, nil
+	case Zstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		decoding := decoder.IOReadCloser()
+		return &decodingReader{Reader: decoding, closers: []io.Closer{decoding, r}}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, codec)
+	}
+}
+
+// Decompress decodes data that was encoded with the codec
+func Decompress(codec string, data []byte) ([]byte, error) {
+	reader, err := NewReader(codec, io.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+type decodingReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (reader *decodingReader) Close() error {
+	var errs []error
+	for _, closer := range reader.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
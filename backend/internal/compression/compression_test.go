@@ -0,0 +1,98 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (recorder *closeRecorder) Close() error {
+	recorder.closed = true
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte(`{"timestamp": "2025-01-01T12:00:00Z", "ip": "10.0.0.1", "services": [` + strings.Repeat(`{"port": 80, "protocol": "HTTP"},`, 100) + `]}`)
+
+	for _, codec := range []string{"", Identity, Gzip, Zstd} {
+		t.Run(codec, func(t *testing.T) {
+			compressed, err := Compress(codec, data)
+			require.NoError(t, err)
+			if codec == Gzip || codec == Zstd {
+				assert.Less(t, len(compressed), len(data)/4)
+			}
+
+			source := &closeRecorder{Reader: bytes.NewReader(compressed)}
+			reader, err := NewReader(codec, source)
+			require.NoError(t, err)
+			decoded, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, data, decoded)
+			assert.True(t, source.closed)
+
+			decoded, err = Decompress(codec, compressed)
+			require.NoError(t, err)
+			assert.Equal(t, data, decoded)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectedCodec string
+		expectedError bool
+	}{
+		{"", Identity, false},
+		{"none", Identity, false},
+		{"identity", Identity, false},
+		{"gzip", Gzip, false},
+		{"ZSTD", Zstd, false},
+		{"brotli", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := Parse(tt.name)
+
+			if tt.expectedError {
+				assert.True(t, errors.Is(err, ErrUnknownCodec))
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedCodec, codec)
+			}
+		})
+	}
+}
+
+func TestExtension(t *testing.T) {
+	for _, codec := range []string{Identity, Gzip, Zstd} {
+		key := "ab/abcdef.json" + Extension(codec)
+		assert.Equal(t, codec, FromKey(key), key)
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	_, err := Compress("brotli", []byte("{}"))
+	assert.True(t, errors.Is(err, ErrUnknownCodec))
+	_, err = NewReader("brotli", io.NopCloser(strings.NewReader("{}")))
+	assert.True(t, errors.Is(err, ErrUnknownCodec))
+}
+
+func TestNewReader_Corrupt(t *testing.T) {
+	_, err := Decompress(Gzip, []byte("not gzip"))
+	assert.Error(t, err)
+	_, err = Decompress(Zstd, []byte("not zstd"))
+	assert.Error(t, err)
+}
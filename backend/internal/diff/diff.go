@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/endingwithali/2025censys/internal/model"
+)
+
+type ChangeType string
+
+const (
+	ServiceAdded    ChangeType = "service_added"
+	ServiceRemoved  ChangeType = "service_removed"
+	SoftwareChanged ChangeType = "software_changed"
+	TLSChanged      ChangeType = "tls_changed"
+	VulnAdded       ChangeType = "vuln_added"
+	VulnRemoved     ChangeType = "vuln_removed"
+	StatusChanged   ChangeType = "status_changed"
+)
+
+// Change is a single semantic difference between two host snapshots.
+// Services are identified by Port + Protocol; Old/New hold the value on each side
+// (a Service, *Software, *TLS, vulnerability ID or status code depending on Type).
+type Change struct {
+	Type     ChangeType `json:"type"`
+	Port     int        `json:"port"`
+	Protocol string     `json:"protocol"`
+	Old      any        `json:"old,omitempty"`
+	New      any        `json:"new,omitempty"`
+}
+
+// Compare returns the semantic changes needed to go from snapshot before to snapshot after
+//
+// Summary: Matches services by port+protocol and reports each difference as a typed Change
+//
+// Returns:
+//   - []Change: ordered by port, protocol, then change type. Empty if nothing changed.
+func Compare(before model.HostSnapshot, after model.HostSnapshot) []Change {
+	oldServices := indexServices(before.Services)
+	newServices := indexServices(after.Services)
+
+	changes := []Change{}
+	for key, oldService := range oldServices {
+		newService, ok := newServices[key]
+		if !ok {
+			changes = append(changes, Change{Type: ServiceRemoved, Port: oldService.Port, Protocol: oldService.Protocol, Old: oldService})
+			continue
+		}
+		changes = append(changes, compareService(oldService, newService)...)
+	}
+	for key, newService := range newServices {
+		if _, ok := oldServices[key]; !ok {
+			changes = append(changes, Change{Type: ServiceAdded, Port: newService.Port, Protocol: newService.Protocol, New: newService})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Port != changes[j].Port {
+			return changes[i].Port < changes[j].Port
+		}
+		if changes[i].Protocol != changes[j].Protocol {
+			return changes[i].Protocol < changes[j].Protocol
+		}
+		if changes[i].Type != changes[j].Type {
+			return changes[i].Type < changes[j].Type
+		}
+		return fmt.Sprint(changes[i].Old, changes[i].New) < fmt.Sprint(changes[j].Old, changes[j].New)
+	})
+	return changes
+}
+
+func compareService(before model.Service, after model.Service) []Change {
+	changes := []Change{}
+	base := Change{Port: after.Port, Protocol: after.Protocol}
+
+	if before.Status != after.Status {
+		change := base
+		change.Type, change.Old, change.New = StatusChanged, before.Status, after.Status
+		changes = append(changes, change)
+	}
+	if !reflect.DeepEqual(before.Software, after.Software) {
+		change := base
+		change.Type, change.Old, change.New = SoftwareChanged, before.Software, after.Software
+		changes = append(changes, change)
+	}
+	if !reflect.DeepEqual(before.TLS, after.TLS) {
+		change := base
+		change.Type, change.Old, change.New = TLSChanged, before.TLS, after.TLS
+		changes = append(changes, change)
+	}
+
+	oldVulns := toSet(before.Vulnerabilities)
+	newVulns := toSet(after.Vulnerabilities)
+	for vuln := range oldVulns {
+		if !newVulns[vuln] {
+			change := base
+			change.Type, change.Old = VulnRemoved, vuln
+			changes = append(changes, change)
+		}
+	}
+	for vuln := range newVulns {
+		if !oldVulns[vuln] {
+			change := base
+			change.Type, change.New = VulnAdded, vuln
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// serviceKey identifies a service across snapshots. Protocol is compared case-insensitively.
+func serviceKey(service model.Service) string {
+	return fmt.Sprintf("%d/%s", service.Port, strings.ToUpper(service.Protocol))
+}
+
+func indexServices(services []model.Service) map[string]model.Service {
+	index := make(map[string]model.Service, len(services))
+	for _, service := range services {
+		index[serviceKey(service)] = service
+	}
+	return index
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
@@ -0,0 +1,74 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/endingwithali/2025censys/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	nginx := &model.Software{Vendor: "nginx", Product: "nginx", Version: "1.22.1"}
+	nginxUpgraded := &model.Software{Vendor: "nginx", Product: "nginx", Version: "1.24.0"}
+	tls12 := &model.TLS{Version: "tlsv1_2", Cipher: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", CertFingerprintSHA256: "aaaa"}
+	tls13 := &model.TLS{Version: "tlsv1_3", Cipher: "TLS_AES_256_GCM_SHA384", CertFingerprintSHA256: "aaaa"}
+	ssh := model.Service{Port: 22, Protocol: "SSH", Vulnerabilities: []string{"CVE-2023-1"}}
+
+	tests := []struct {
+		name     string
+		before   []model.Service
+		after    []model.Service
+		expected []Change
+	}{
+		{
+			name:     "identical snapshots",
+			before:   []model.Service{ssh},
+			after:    []model.Service{ssh},
+			expected: []Change{},
+		},
+		{
+			name:   "service added and removed",
+			before: []model.Service{ssh},
+			after:  []model.Service{{Port: 80, Protocol: "HTTP", Status: 200}},
+			expected: []Change{
+				{Type: ServiceRemoved, Port: 22, Protocol: "SSH", Old: ssh},
+				{Type: ServiceAdded, Port: 80, Protocol: "HTTP", New: model.Service{Port: 80, Protocol: "HTTP", Status: 200}},
+			},
+		},
+		{
+			name:   "same port with different protocol is a different service",
+			before: []model.Service{{Port: 443, Protocol: "HTTPS"}},
+			after:  []model.Service{{Port: 443, Protocol: "UDP"}},
+			expected: []Change{
+				{Type: ServiceRemoved, Port: 443, Protocol: "HTTPS", Old: model.Service{Port: 443, Protocol: "HTTPS"}},
+				{Type: ServiceAdded, Port: 443, Protocol: "UDP", New: model.Service{Port: 443, Protocol: "UDP"}},
+			},
+		},
+		{
+			name:   "software, tls and status changed",
+			before: []model.Service{{Port: 443, Protocol: "HTTPS", Status: 200, Software: nginx, TLS: tls12}},
+			after:  []model.Service{{Port: 443, Protocol: "HTTPS", Status: 301, Software: nginxUpgraded, TLS: tls13}},
+			expected: []Change{
+				{Type: SoftwareChanged, Port: 443, Protocol: "HTTPS", Old: nginx, New: nginxUpgraded},
+				{Type: StatusChanged, Port: 443, Protocol: "HTTPS", Old: 200, New: 301},
+				{Type: TLSChanged, Port: 443, Protocol: "HTTPS", Old: tls12, New: tls13},
+			},
+		},
+		{
+			name:   "vulnerabilities added and removed",
+			before: []model.Service{{Port: 22, Protocol: "SSH", Vulnerabilities: []string{"CVE-2023-1", "CVE-2023-2"}}},
+			after:  []model.Service{{Port: 22, Protocol: "SSH", Vulnerabilities: []string{"CVE-2023-2", "CVE-2024-3"}}},
+			expected: []Change{
+				{Type: VulnAdded, Port: 22, Protocol: "SSH", New: "CVE-2024-3"},
+				{Type: VulnRemoved, Port: 22, Protocol: "SSH", Old: "CVE-2023-1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := Compare(model.HostSnapshot{Services: tt.before}, model.HostSnapshot{Services: tt.after})
+			assert.Equal(t, tt.expected, changes)
+		})
+	}
+}
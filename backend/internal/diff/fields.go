@@ -0,0 +1,41 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// IdentityFields are the top-level fields of a host snapshot that say which host it is and when it was taken,
+// rather than how the host is configured
+var IdentityFields = []string{"ip", "timestamp"}
+
+// WithoutFields removes top-level fields from a JSON object, so that two documents can be compared on the rest
+//
+// Summary: Numbers are kept as written. A document that is not a JSON object is returned unchanged, so that
+// comparing it still reports it as it is.
+//
+// Example:
+// WithoutFields([]byte(`{"ip": "1.1.1.1", "services": []}`), "ip") -> {"services":[]}
+//
+// Returns:
+//   - []byte: the document without the fields
+func WithoutFields(document []byte, fields ...string) []byte {
+	value, err := decode(document)
+	if err != nil {
+		return document
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return document
+	}
+	for _, field := range fields {
+		delete(object, field)
+	}
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(object); err != nil {
+		return document
+	}
+	return bytes.TrimSuffix(encoded.Bytes(), []byte("\n"))
+}
@@ -0,0 +1,53 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithoutFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		fields   []string
+		expected string
+	}{
+		{
+			name:     "identity fields are removed",
+			document: `{"ip": "1.1.1.1", "timestamp": "2025-09-10T03:00:00Z", "services": [{"port": 22, "ip": "kept"}]}`,
+			fields:   IdentityFields,
+			expected: `{"services":[{"ip":"kept","port":22}]}`,
+		},
+		{
+			name:     "numbers and html characters are kept as written",
+			document: `{"ip": "1.1.1.1", "score": 1.50, "version": "<1.0&>"}`,
+			fields:   []string{"ip"},
+			expected: `{"score":1.50,"version":"<1.0&>"}`,
+		},
+		{
+			name:     "missing fields are ignored",
+			document: `{"services": []}`,
+			fields:   IdentityFields,
+			expected: `{"services":[]}`,
+		},
+		{
+			name:     "not an object",
+			document: `["ip"]`,
+			fields:   IdentityFields,
+			expected: `["ip"]`,
+		},
+		{
+			name:     "invalid json",
+			document: `{"ip":`,
+			fields:   IdentityFields,
+			expected: `{"ip":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(WithoutFields([]byte(tt.document), tt.fields...)))
+		})
+	}
+}
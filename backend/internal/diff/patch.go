@@ -0,0 +1,187 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// MarshalJSON always writes "value" for add/replace so that a JSON null value is not dropped by omitempty
+func (operation PatchOperation) MarshalJSON() ([]byte, error) {
+	if operation.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{operation.Op, operation.Path})
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{operation.Op, operation.Path, operation.Value})
+}
+
+// JSONPatch creates an RFC 6902 JSON Patch that turns document1 into document2
+//
+// Summary: Objects are compared key by key and arrays index by index. Extra array elements
+// are removed from the end first so that every path is valid when the operations are applied in order.
+//
+// Returns:
+//   - []PatchOperation: operations to apply to document1, empty if the documents are equal
+//   - error: error if either document is not valid JSON {nil | error}
+func JSONPatch(document1 []byte, document2 []byte) ([]PatchOperation, error) {
+	value1, value2, err := decodePair(document1, document2)
+	if err != nil {
+		return nil, err
+	}
+	return appendPatch([]PatchOperation{}, "", value1, value2), nil
+}
+
+// MergePatch creates an RFC 7396 JSON Merge Patch that turns document1 into document2
+//
+// Summary: Keys missing from document2 are set to null and arrays are replaced as a whole.
+// Merge patches cannot express a member whose new value is null, so such members are treated as removed.
+//
+// Returns:
+//   - json.RawMessage: the merge patch document, {} if the documents are equal
+//   - error: error if either document is not valid JSON {nil | error}
+func MergePatch(document1 []byte, document2 []byte) (json.RawMessage, error) {
+	value1, value2, err := decodePair(document1, document2)
+	if err != nil {
+		return nil, err
+	}
+	patch, changed := mergePatch(value1, value2)
+	if !changed {
+		// An empty object only leaves an object target untouched, any other value has to be restated
+		if _, ok := value1.(map[string]any); ok {
+			patch = map[string]any{}
+		} else {
+			patch = value2
+		}
+	}
+	return json.Marshal(patch)
+}
+
+func decodePair(document1 []byte, document2 []byte) (any, any, error) {
+	value1, err := decode(document1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("First document is invalid JSON: %v", err)
+	}
+	value2, err := decode(document2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Second document is invalid JSON: %v", err)
+	}
+	return value1, value2, nil
+}
+
+// decode keeps numbers as json.Number so that values are written back exactly as they were read
+func decode(document []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func appendPatch(operations []PatchOperation, path string, value1 any, value2 any) []PatchOperation {
+	switch typed1 := value1.(type) {
+	case map[string]any:
+		typed2, ok := value2.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(typed1) {
+			child, ok := typed2[key]
+			if !ok {
+				operations = append(operations, PatchOperation{Op: "remove", Path: path + "/" + escapePointer(key)})
+				continue
+			}
+			operations = appendPatch(operations, path+"/"+escapePointer(key), typed1[key], child)
+		}
+		for _, key := range sortedKeys(typed2) {
+			if _, ok := typed1[key]; !ok {
+				operations = append(operations, PatchOperation{Op: "add", Path: path + "/" + escapePointer(key), Value: typed2[key]})
+			}
+		}
+		return operations
+	case []any:
+		typed2, ok := value2.([]any)
+		if !ok {
+			break
+		}
+		common := min(len(typed1), len(typed2))
+		for i := 0; i < common; i++ {
+			operations = appendPatch(operations, path+"/"+strconv.Itoa(i), typed1[i], typed2[i])
+		}
+		for i := len(typed1) - 1; i >= common; i-- {
+			operations = append(operations, PatchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(typed2); i++ {
+			operations = append(operations, PatchOperation{Op: "add", Path: path + "/" + strconv.Itoa(i), Value: typed2[i]})
+		}
+		return operations
+	}
+	if !reflect.DeepEqual(value1, value2) {
+		operations = append(operations, PatchOperation{Op: "replace", Path: path, Value: value2})
+	}
+	return operations
+}
+
+// mergePatch returns the merge patch for value1 -> value2 and whether the values differ
+func mergePatch(value1 any, value2 any) (any, bool) {
+	object1, ok1 := value1.(map[string]any)
+	object2, ok2 := value2.(map[string]any)
+	if !ok1 || !ok2 {
+		if reflect.DeepEqual(value1, value2) {
+			return nil, false
+		}
+		return value2, true
+	}
+
+	patch := map[string]any{}
+	for key, child1 := range object1 {
+		child2, ok := object2[key]
+		if !ok || child2 == nil {
+			if child1 != nil || !ok {
+				patch[key] = nil
+			}
+			continue
+		}
+		if childPatch, changed := mergePatch(child1, child2); changed {
+			patch[key] = childPatch
+		}
+	}
+	for key, child2 := range object2 {
+		if _, ok := object1[key]; !ok && child2 != nil {
+			patch[key] = child2
+		}
+	}
+	return patch, len(patch) > 0
+}
+
+// escapePointer escapes a key for use as an RFC 6901 JSON Pointer token
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
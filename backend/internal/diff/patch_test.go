@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		document1 string
+		document2 string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:      "equal documents",
+			document1: `{"ip": "1.1.1.1", "services": [{"port": 22}]}`,
+			document2: `{"ip": "1.1.1.1", "services": [{"port": 22}]}`,
+			expected:  `[]`,
+		},
+		{
+			name:      "replace, add and remove members",
+			document1: `{"service_count": 1, "timestamp": "a", "old": true}`,
+			document2: `{"service_count": 2, "timestamp": "a", "new": null}`,
+			expected:  `[{"op":"remove","path":"/old"},{"op":"replace","path":"/service_count","value":2},{"op":"add","path":"/new","value":null}]`,
+		},
+		{
+			name:      "arrays shrink from the end",
+			document1: `{"services": [{"port": 22}, {"port": 80}, {"port": 443}]}`,
+			document2: `{"services": [{"port": 23}]}`,
+			expected:  `[{"op":"replace","path":"/services/0/port","value":23},{"op":"remove","path":"/services/2"},{"op":"remove","path":"/services/1"}]`,
+		},
+		{
+			name:      "arrays grow at the end",
+			document1: `{"vulnerabilities": ["CVE-1"]}`,
+			document2: `{"vulnerabilities": ["CVE-1", "CVE-2"]}`,
+			expected:  `[{"op":"add","path":"/vulnerabilities/1","value":"CVE-2"}]`,
+		},
+		{
+			name:      "keys are escaped as JSON pointers",
+			document1: `{"a/b": 1, "c~d": 1}`,
+			document2: `{"a/b": 2, "c~d": 2}`,
+			expected:  `[{"op":"replace","path":"/a~1b","value":2},{"op":"replace","path":"/c~0d","value":2}]`,
+		},
+		{
+			name:      "invalid json",
+			document1: `{`,
+			document2: `{}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := JSONPatch([]byte(tt.document1), []byte(tt.document2))
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			encoded, err := json.Marshal(patch)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(encoded))
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		document1 string
+		document2 string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:      "equal documents",
+			document1: `{"ip": "1.1.1.1"}`,
+			document2: `{"ip": "1.1.1.1"}`,
+			expected:  `{}`,
+		},
+		{
+			name:      "nested changes and removals",
+			document1: `{"tls": {"version": "tlsv1_2", "cipher": "x"}, "status": 200}`,
+			document2: `{"tls": {"version": "tlsv1_3", "cipher": "x"}}`,
+			expected:  `{"tls": {"version": "tlsv1_3"}, "status": null}`,
+		},
+		{
+			name:      "arrays are replaced as a whole",
+			document1: `{"services": [{"port": 22}, {"port": 80}]}`,
+			document2: `{"services": [{"port": 22}]}`,
+			expected:  `{"services": [{"port": 22}]}`,
+		},
+		{
+			name:      "non object documents",
+			document1: `[1]`,
+			document2: `[1]`,
+			expected:  `[1]`,
+		},
+		{
+			name:      "invalid json",
+			document1: `{}`,
+			document2: `nope`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := MergePatch([]byte(tt.document1), []byte(tt.document2))
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(patch))
+		})
+	}
+}
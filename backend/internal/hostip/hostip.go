@@ -0,0 +1,52 @@
+package hostip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ErrInvalid is returned (wrapped) for any host IP that cannot be parsed
+var ErrInvalid = errors.New("invalid host ip")
+
+// Canonical parses an IPv4 or IPv6 address and returns the single form it is stored and queried as
+//
+// Summary: IPv6 addresses are lower-cased and zero-compressed (RFC 5952), and IPv4-mapped IPv6 addresses
+// (::ffff:1.2.3.4) are converted to plain IPv4, so the same host is never stored two ways.
+// Zoned addresses (fe80::1%eth0) are rejected since the zone is local to the scanner.
+//
+// Example:
+// Canonical("2001:DB8:0:0::1") -> "2001:db8::1"
+//
+// Returns:
+//   - string: canonical address
+//   - error: wraps ErrInvalid if the address cannot be parsed {nil | error}
+func Canonical(ip string) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, ip)
+	}
+	if addr.Zone() != "" {
+		return "", fmt.Errorf("%w: %q has a zone", ErrInvalid, ip)
+	}
+	return addr.Unmap().String(), nil
+}
+
+// ToFileName encodes a canonical address for use in a host_<ip>_<timestamp>.json filename.
+// Colons are not allowed in filenames on every filesystem, so IPv6 colons are written as dashes.
+//
+// Example:
+// ToFileName("2001:db8::1") -> "2001-db8--1"
+func ToFileName(ip string) string {
+	return strings.ReplaceAll(ip, ":", "-")
+}
+
+// FromFileName decodes an address written by ToFileName and returns its canonical form
+//
+// Example:
+// FromFileName("2001-db8--1") -> "2001:db8::1"
+// FromFileName("125.199.235.74") -> "125.199.235.74"
+func FromFileName(encoded string) (string, error) {
+	return Canonical(strings.ReplaceAll(encoded, "-", ":"))
+}
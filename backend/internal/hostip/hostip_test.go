@@ -0,0 +1,68 @@
+package hostip
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		expected  string
+		expectErr bool
+	}{
+		{name: "ipv4", ip: "125.199.235.74", expected: "125.199.235.74"},
+		{name: "ipv6 compressed", ip: "2001:db8::1", expected: "2001:db8::1"},
+		{name: "ipv6 uppercase and expanded", ip: "2001:DB8:0:0:0:0:0:1", expected: "2001:db8::1"},
+		{name: "ipv4 mapped ipv6", ip: "::ffff:125.199.235.74", expected: "125.199.235.74"},
+		{name: "loopback", ip: "::1", expected: "::1"},
+		{name: "zoned", ip: "fe80::1%eth0", expectErr: true},
+		{name: "out of range ipv4", ip: "999.999.999.999", expectErr: true},
+		{name: "leading zeros", ip: "010.1.1.1", expectErr: true},
+		{name: "empty", ip: "", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, err := Canonical(tt.ip)
+			if tt.expectErr {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrInvalid))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, canonical)
+		})
+	}
+}
+
+func TestFileNameEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		encoded string
+	}{
+		{name: "ipv4 is unchanged", ip: "125.199.235.74", encoded: "125.199.235.74"},
+		{name: "ipv6", ip: "2001:db8::1", encoded: "2001-db8--1"},
+		{name: "ipv6 full", ip: "2001:db8:1:2:3:4:5:6", encoded: "2001-db8-1-2-3-4-5-6"},
+		{name: "ipv6 loopback", ip: "::1", encoded: "--1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.encoded, ToFileName(tt.ip))
+			decoded, err := FromFileName(tt.encoded)
+			require.NoError(t, err)
+			assert.Equal(t, tt.ip, decoded)
+		})
+	}
+
+	// non canonical encodings decode to the canonical address
+	decoded, err := FromFileName("2001-DB8-0-0-0-0-0-1")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", decoded)
+}
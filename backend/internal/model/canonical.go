@@ -0,0 +1,26 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// CanonicalJSON re-encodes a JSON document with object keys sorted and no insignificant whitespace, so that two
+// documents with the same content produce the same bytes however they were formatted. Numbers are kept exactly as
+// written.
+func CanonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var canonical bytes.Buffer
+	encoder := json.NewEncoder(&canonical)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(canonical.Bytes(), []byte("\n")), nil
+}
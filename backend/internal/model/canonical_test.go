@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		document  string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "keys are sorted and whitespace removed",
+			document: "{\n  \"ip\": \"1.1.1.1\",\n  \"services\": [ {\"protocol\": \"SSH\", \"port\": 22} ]\n}",
+			expected: `{"ip":"1.1.1.1","services":[{"port":22,"protocol":"SSH"}]}`,
+		},
+		{
+			name:     "numbers and html characters are kept as written",
+			document: `{"version": "<1.0&>", "score": 1.50, "big": 12345678901234567890}`,
+			expected: `{"big":12345678901234567890,"score":1.50,"version":"<1.0&>"}`,
+		},
+		{
+			name:      "invalid json",
+			document:  `{`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, err := CanonicalJSON([]byte(tt.document))
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(canonical))
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// HostSnapshot is the typed representation of a host snapshot file
+//
+// Example:
+//
+//	{
+//	  "timestamp": "2025-09-10T03:00:00Z",
+//	  "ip": "125.199.235.74",
+//	  "services": [{"port": 80, "protocol": "HTTP", "status": 200, "software": {...}}],
+//	  "service_count": 1
+//	}
+type HostSnapshot struct {
+	Timestamp    time.Time `json:"timestamp"`
+	IP           string    `json:"ip"`
+	Services     []Service `json:"services"`
+	ServiceCount int       `json:"service_count"`
+}
+
+// Service is a single port/protocol exposed by a host
+type Service struct {
+	Port            int       `json:"port"`
+	Protocol        string    `json:"protocol"`
+	Status          int       `json:"status,omitempty"`
+	Software        *Software `json:"software,omitempty"`
+	TLS             *TLS      `json:"tls,omitempty"`
+	Vulnerabilities []string  `json:"vulnerabilities,omitempty"`
+}
+
+type Software struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Version string `json:"version"`
+}
+
+type TLS struct {
+	Version               string `json:"version"`
+	Cipher                string `json:"cipher"`
+	CertFingerprintSHA256 string `json:"cert_fingerprint_sha256"`
+}
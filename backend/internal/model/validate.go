@@ -0,0 +1,142 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// FieldError describes a single invalid field of a host snapshot
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a host snapshot cannot be decoded or fails validation
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (validationError *ValidationError) Error() string {
+	messages := make([]string, 0, len(validationError.Fields))
+	for _, field := range validationError.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return "Invalid host snapshot: " + strings.Join(messages, "; ")
+}
+
+// ParseHostSnapshot decodes and validates the body of a host snapshot file
+//
+// Returns:
+//   - HostSnapshot: the decoded snapshot
+//   - error: *ValidationError listing each invalid field {nil | *ValidationError}
+func ParseHostSnapshot(data []byte) (HostSnapshot, error) {
+	var snapshot HostSnapshot
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&snapshot); err != nil {
+		return HostSnapshot{}, &ValidationError{Fields: []FieldError{decodeFieldError(err)}}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return HostSnapshot{}, &ValidationError{Fields: []FieldError{{Field: "$", Message: "unexpected data after the snapshot object"}}}
+	}
+	if err := snapshot.Validate(); err != nil {
+		return HostSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// Validate checks the decoded snapshot for missing and out of range fields
+//
+// Returns:
+//   - error: *ValidationError listing every invalid field, nil if the snapshot is valid
+func (snapshot HostSnapshot) Validate() error {
+	fields := []FieldError{}
+	if snapshot.Timestamp.IsZero() {
+		fields = append(fields, FieldError{Field: "timestamp", Message: "is required"})
+	}
+	if snapshot.IP == "" {
+		fields = append(fields, FieldError{Field: "ip", Message: "is required"})
+	} else if _, err := netip.ParseAddr(snapshot.IP); err != nil {
+		fields = append(fields, FieldError{Field: "ip", Message: fmt.Sprintf("%q is not a valid IP address", snapshot.IP)})
+	}
+	if snapshot.Services == nil {
+		fields = append(fields, FieldError{Field: "services", Message: "is required"})
+	}
+
+	seen := map[string]int{}
+	for i, service := range snapshot.Services {
+		fields = append(fields, service.validate(fmt.Sprintf("services[%d]", i))...)
+		key := fmt.Sprintf("%d/%s", service.Port, strings.ToUpper(service.Protocol))
+		if first, ok := seen[key]; ok {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("services[%d]", i), Message: fmt.Sprintf("duplicates port %d/%s of services[%d]", service.Port, service.Protocol, first)})
+			continue
+		}
+		seen[key] = i
+	}
+	if snapshot.ServiceCount != len(snapshot.Services) {
+		fields = append(fields, FieldError{Field: "service_count", Message: fmt.Sprintf("is %d but %d services are listed", snapshot.ServiceCount, len(snapshot.Services))})
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func (service Service) validate(path string) []FieldError {
+	fields := []FieldError{}
+	if service.Port < 1 || service.Port > 65535 {
+		fields = append(fields, FieldError{Field: path + ".port", Message: fmt.Sprintf("%d is not between 1 and 65535", service.Port)})
+	}
+	if service.Protocol == "" {
+		fields = append(fields, FieldError{Field: path + ".protocol", Message: "is required"})
+	}
+	// status is optional, 0 means it was not reported
+	if service.Status != 0 && (service.Status < 100 || service.Status > 599) {
+		fields = append(fields, FieldError{Field: path + ".status", Message: fmt.Sprintf("%d is not a valid status code", service.Status)})
+	}
+	if service.Software != nil && service.Software.Product == "" {
+		fields = append(fields, FieldError{Field: path + ".software.product", Message: "is required"})
+	}
+	if service.TLS != nil && service.TLS.Version == "" {
+		fields = append(fields, FieldError{Field: path + ".tls.version", Message: "is required"})
+	}
+	for j, vulnerability := range service.Vulnerabilities {
+		if strings.TrimSpace(vulnerability) == "" {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("%s.vulnerabilities[%d]", path, j), Message: "must not be empty"})
+		}
+	}
+	return fields
+}
+
+var arrayIndexPattern = regexp.MustCompile(`\.(\d+)`)
+
+// decodeFieldError turns a json decoding error into a FieldError naming the offending field when possible
+func decodeFieldError(err error) FieldError {
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		// encoding/json reports array elements as "services.0.port", use the same "services[0].port" form as Validate
+		field := arrayIndexPattern.ReplaceAllString(typeError.Field, "[$1]")
+		if field == "" {
+			field = "$"
+		}
+		return FieldError{Field: field, Message: fmt.Sprintf("expected %s but got %s", typeError.Type, typeError.Value)}
+	}
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) {
+		return FieldError{Field: "$", Message: fmt.Sprintf("invalid JSON at offset %d: %v", syntaxError.Offset, err)}
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return FieldError{Field: "$", Message: "unexpected end of JSON"}
+	}
+	// time.Time fields report their own parse errors
+	if strings.Contains(err.Error(), "parsing time") {
+		return FieldError{Field: "timestamp", Message: err.Error()}
+	}
+	return FieldError{Field: "$", Message: err.Error()}
+}
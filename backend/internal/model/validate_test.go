@@ -0,0 +1,96 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostSnapshot(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedFields []string
+	}{
+		{
+			name: "valid snapshot",
+			body: `{"timestamp": "2025-09-10T03:00:00Z", "ip": "125.199.235.74", "services": [
+				{"port": 80, "protocol": "HTTP", "status": 200, "software": {"vendor": "microsoft", "product": "iis", "version": "8.5"}},
+				{"port": 443, "protocol": "HTTPS", "tls": {"version": "tlsv1_2"}, "vulnerabilities": ["CVE-2023-44446"]}
+			], "service_count": 2}`,
+			expectedFields: nil,
+		},
+		{
+			name:           "valid snapshot with no services",
+			body:           `{"timestamp": "2025-09-10T03:00:00Z", "ip": "2001:db8::1", "services": [], "service_count": 0}`,
+			expectedFields: nil,
+		},
+		{
+			name:           "malformed json",
+			body:           `{"timestamp": "2025-09-10T03:00:00Z",`,
+			expectedFields: []string{"$"},
+		},
+		{
+			name:           "wrong type",
+			body:           `{"timestamp": "2025-09-10T03:00:00Z", "ip": "1.1.1.1", "services": [{"port": "80"}]}`,
+			expectedFields: []string{"services[0].port"},
+		},
+		{
+			name:           "invalid timestamp",
+			body:           `{"timestamp": "yesterday", "ip": "1.1.1.1", "services": []}`,
+			expectedFields: []string{"timestamp"},
+		},
+		{
+			name:           "trailing data",
+			body:           `{"timestamp": "2025-09-10T03:00:00Z", "ip": "1.1.1.1", "services": [], "service_count": 0} {}`,
+			expectedFields: []string{"$"},
+		},
+		{
+			name:           "missing required fields",
+			body:           `{"test": "data"}`,
+			expectedFields: []string{"timestamp", "ip", "services"},
+		},
+		{
+			name: "invalid fields are all reported",
+			body: `{"timestamp": "2025-09-10T03:00:00Z", "ip": "999.1.1.1", "services": [
+				{"port": 70000, "protocol": "", "status": 42, "software": {"vendor": "x"}, "tls": {}, "vulnerabilities": [""]},
+				{"port": 22, "protocol": "SSH"},
+				{"port": 22, "protocol": "ssh"}
+			], "service_count": 1}`,
+			expectedFields: []string{
+				"ip",
+				"services[0].port",
+				"services[0].protocol",
+				"services[0].status",
+				"services[0].software.product",
+				"services[0].tls.version",
+				"services[0].vulnerabilities[0]",
+				"services[2]",
+				"service_count",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := ParseHostSnapshot([]byte(tt.body))
+
+			if tt.expectedFields == nil {
+				require.NoError(t, err)
+				assert.False(t, snapshot.Timestamp.IsZero())
+				assert.Equal(t, time.UTC, snapshot.Timestamp.Location())
+				return
+			}
+			var validationError *ValidationError
+			require.True(t, errors.As(err, &validationError))
+			fields := []string{}
+			for _, field := range validationError.Fields {
+				fields = append(fields, field.Field)
+			}
+			assert.Equal(t, tt.expectedFields, fields)
+		})
+	}
+}
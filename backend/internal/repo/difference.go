@@ -1,18 +1,20 @@
 package repo
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Differences model used to cache a computed difference between two snapshots of a host
 type Differences struct {
-	gorm.Model
-	Host_IP    string          `json:"host_ip"`
-	Timestamp1 time.Time       `json:"timestamp1"`
-	Timestamp2 time.Time       `json:"timestamp2"`
-	JSON_Data  json.RawMessage `json:"json_data"`
+	Host_IP    string    `json:"host_ip" gorm:"column:host_ip;primaryKey"`
+	Timestamp1 time.Time `json:"timestamp1" gorm:"column:timestamp1;primaryKey"`
+	Timestamp2 time.Time `json:"timestamp2" gorm:"column:timestamp2;primaryKey"`
+	JSON_Data  string    `json:"json_data" gorm:"column:json_data"`
 }
 
 func (Differences) TableName() string {
@@ -20,29 +22,56 @@ func (Differences) TableName() string {
 	return "snapshot_differences"
 }
 
-func InsertDifference(difference Differences) error {
-	// ctx := context.Background()
+type DifferenceRepo interface {
+	Insert(ctx context.Context, difference Differences) error
+	CheckForComparison(ctx context.Context, host_ip string, timestamp1 time.Time, timestamp2 time.Time) (Differences, bool, error)
+	DeleteForSnapshot(ctx context.Context, host_ip string, timestamp time.Time) error
+}
+
+type differenceRepo struct {
+	db *gorm.DB
+}
 
-	// err := DB.WithContext(ctx).Where(
-	// 	"host_ip=? AND timestamp1=? AND timestamp2=?",
-	// 	host_ip, timestamp1, timestamp2,
-	// )
-	// err := DB.WithContext(ctx).Create(difference).Error
-	// return err
-	return nil
+func NewDifferenceRepo(db *gorm.DB) DifferenceRepo {
+	return &differenceRepo{
+		db: db,
+	}
 }
 
-func CheckForComparison(host_ip string, timestamp1 time.Time, timestamp2 time.Time) (Differences, error) {
-	// ctx := context.Background()
-	// var differences SnapshotDifferences
-	// err := DB.WithContext(ctx).Where(
-	// 	"host_ip=? AND timestamp1=? AND timestamp2=?",
-	// 	host_ip, timestamp1, timestamp2,
-	// ).First(&differences).Error
+// Insert stores a computed difference. Snapshots are immutable, so if the comparison was
+// already stored by a concurrent request the existing row is kept.
+func (dr *differenceRepo) Insert(ctx context.Context, difference Differences) error {
+	difference.Timestamp1 = difference.Timestamp1.UTC()
+	difference.Timestamp2 = difference.Timestamp2.UTC()
+	return dr.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&difference).Error
+}
+
+// CheckForComparison looks up a stored difference of timestamp1 -> timestamp2 for a host
+//
+// Returns:
+//   - Differences: the stored difference {empty if not found}
+//   - bool: true if the difference was found
+//   - error: error if the lookup failed {nil | error}
+func (dr *differenceRepo) CheckForComparison(ctx context.Context, host_ip string, timestamp1 time.Time, timestamp2 time.Time) (Differences, bool, error) {
+	var difference Differences
+	err := dr.db.WithContext(ctx).Where(
+		"host_ip = ? AND timestamp1 = ? AND timestamp2 = ?",
+		host_ip, timestamp1.UTC(), timestamp2.UTC(),
+	).First(&difference).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Differences{}, false, nil
+	}
+	if err != nil {
+		return Differences{}, false, err
+	}
+	return difference, true, nil
+}
 
-	// if err != nil {
-	// 	return differences, err
-	// }
-	// return differences, nil
-	return Differences{}, nil
+// DeleteForSnapshot removes every stored difference that has the snapshot on either side.
+// Must be called whenever a snapshot is deleted, since that is the only way a stored difference goes stale.
+func (dr *differenceRepo) DeleteForSnapshot(ctx context.Context, host_ip string, timestamp time.Time) error {
+	return dr.db.WithContext(ctx).Where(
+		"host_ip = ? AND (timestamp1 = ? OR timestamp2 = ?)",
+		host_ip, timestamp.UTC(), timestamp.UTC(),
+	).Delete(&Differences{}).Error
 }
@@ -0,0 +1,72 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	r "github.com/endingwithali/2025censys/internal/repo"
+)
+
+// Test storing a difference and reading it back
+func TestDifference_InsertAndCheck(t *testing.T) {
+	ctx := context.Background()
+	host := "10.10.10.1"
+	t1 := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	t2 := time.Date(2025, 2, 2, 12, 0, 0, 0, time.UTC)
+
+	if _, found, err := diffRepo.CheckForComparison(ctx, host, t1, t2); err != nil || found {
+		t.Fatalf("expected no stored difference before insert, got found=%v err=%v", found, err)
+	}
+
+	difference := r.Differences{Host_IP: host, Timestamp1: t1, Timestamp2: t2, JSON_Data: `{"DiffStatus":"NoMatch"}`}
+	if err := diffRepo.Insert(ctx, difference); err != nil {
+		t.Fatalf("Insert returned error: %v", err)
+	}
+	// a second insert of the same comparison is ignored
+	if err := diffRepo.Insert(ctx, difference); err != nil {
+		t.Fatalf("duplicate Insert returned error: %v", err)
+	}
+
+	stored, found, err := diffRepo.CheckForComparison(ctx, host, t1, t2)
+	if err != nil || !found {
+		t.Fatalf("expected stored difference, got found=%v err=%v", found, err)
+	}
+	if stored.JSON_Data != difference.JSON_Data {
+		t.Errorf("expected json_data %s, got %s", difference.JSON_Data, stored.JSON_Data)
+	}
+
+	// the comparison is directional
+	if _, found, _ := diffRepo.CheckForComparison(ctx, host, t2, t1); found {
+		t.Errorf("expected no stored difference for reversed timestamps")
+	}
+}
+
+// Test that deleting a snapshot's differences removes both directions
+func TestDifference_DeleteForSnapshot(t *testing.T) {
+	ctx := context.Background()
+	host := "10.10.10.2"
+	t1 := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	t2 := time.Date(2025, 2, 2, 12, 0, 0, 0, time.UTC)
+	t3 := time.Date(2025, 2, 3, 12, 0, 0, 0, time.UTC)
+
+	for _, pair := range [][2]time.Time{{t1, t2}, {t2, t3}, {t1, t3}} {
+		if err := diffRepo.Insert(ctx, r.Differences{Host_IP: host, Timestamp1: pair[0], Timestamp2: pair[1], JSON_Data: "{}"}); err != nil {
+			t.Fatalf("Insert returned error: %v", err)
+		}
+	}
+
+	if err := diffRepo.DeleteForSnapshot(ctx, host, t2); err != nil {
+		t.Fatalf("DeleteForSnapshot returned error: %v", err)
+	}
+
+	if _, found, _ := diffRepo.CheckForComparison(ctx, host, t1, t2); found {
+		t.Errorf("expected t1->t2 to be deleted")
+	}
+	if _, found, _ := diffRepo.CheckForComparison(ctx, host, t2, t3); found {
+		t.Errorf("expected t2->t3 to be deleted")
+	}
+	if _, found, _ := diffRepo.CheckForComparison(ctx, host, t1, t3); !found {
+		t.Errorf("expected t1->t3 to be kept")
+	}
+}
@@ -0,0 +1,391 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/version"
+	"github.com/google/uuid"
+)
+
+// memorySnapshotRepo keeps snapshot rows in memory, for development and tests. Rows are lost on restart.
+type memorySnapshotRepo struct {
+	mu        sync.RWMutex
+	snapshots map[uuid.UUID]Snapshot
+	// onDelete is called with mu held for each row removed, like the cascades of the database backed repo
+	onDelete []func(id uuid.UUID)
+}
+
+// NewMemorySnapshotRepo creates an empty in-memory SnapshotRepo. It behaves like the database backed repo,
+// including rejecting a second committed snapshot of a host at one timestamp with ErrDuplicate.
+func NewMemorySnapshotRepo() SnapshotRepo {
+	return &memorySnapshotRepo{
+		snapshots: map[uuid.UUID]Snapshot{},
+	}
+}
+
+func (mr *memorySnapshotRepo) Insert(ctx context.Context, snapshot Snapshot) error {
+	if snapshot.UUID == uuid.Nil {
+		snapshot.UUID = uuid.New()
+	}
+	if snapshot.Status == "" {
+		snapshot.Status = StatusCommitted
+	}
+	if snapshot.Content_Encoding == "" {
+		snapshot.Content_Encoding = compression.Identity
+	}
+	snapshot = copySnapshot(snapshot)
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.snapshots[snapshot.UUID]; ok {
+		return fmt.Errorf("Snapshot %s already exists", snapshot.UUID)
+	}
+	if snapshot.Status == StatusCommitted && mr.committedExists(snapshot) {
+		return fmt.Errorf("%w: %s", ErrDuplicate, snapshot.Host_IP)
+	}
+	mr.snapshots[snapshot.UUID] = snapshot
+	return nil
+}
+
+func (mr *memorySnapshotRepo) MarkCommitted(ctx context.Context, id uuid.UUID) error {
+	return mr.setStatus(id, StatusPending, StatusCommitted, nil)
+}
+
+func (mr *memorySnapshotRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.snapshots[id]; ok {
+		mr.remove(id)
+	}
+	return nil
+}
+
+func (mr *memorySnapshotRepo) DeleteWithStatus(ctx context.Context, id uuid.UUID, status string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	snapshot, ok := mr.snapshots[id]
+	if !ok || snapshot.Status != status {
+		return ErrNotFound
+	}
+	mr.remove(id)
+	return nil
+}
+
+// remove removes a row and calls onDelete. mu must be held.
+func (mr *memorySnapshotRepo) remove(id uuid.UUID) {
+	delete(mr.snapshots, id)
+	for _, removed := range mr.onDelete {
+		removed(id)
+	}
+}
+
+func (mr *memorySnapshotRepo) SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	return mr.setStatus(id, StatusCommitted, StatusDeleted, &deletedAt)
+}
+
+func (mr *memorySnapshotRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	return mr.setStatus(id, StatusDeleted, StatusCommitted, nil)
+}
+
+// setStatus moves a row from one status to another, setting its deletion time. Returns ErrNotFound if there is no
+// row with the id and status.
+func (mr *memorySnapshotRepo) setStatus(id uuid.UUID, from string, to string, deletedAt *time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	snapshot, ok := mr.snapshots[id]
+	if !ok || snapshot.Status != from {
+		return ErrNotFound
+	}
+	if to == StatusCommitted && mr.committedExists(snapshot) {
+		return fmt.Errorf("%w: %s", ErrDuplicate, snapshot.Host_IP)
+	}
+	snapshot.Status = to
+	snapshot.Deleted_At = deletedAt
+	mr.snapshots[id] = copySnapshot(snapshot)
+	return nil
+}
+
+// committedExists reports whether another committed row has the host and timestamp of snapshot. mu must be held.
+func (mr *memorySnapshotRepo) committedExists(snapshot Snapshot) bool {
+	for _, other := range mr.snapshots {
+		if other.UUID != snapshot.UUID && other.Status == StatusCommitted && other.Host_IP == snapshot.Host_IP && other.Timestamp.Equal(snapshot.Timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+func (mr *memorySnapshotRepo) GetSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (Snapshot, error) {
+	return mr.find(func(snapshot Snapshot) bool {
+		return snapshot.Status == StatusCommitted && snapshot.Host_IP == host_ip && snapshot.Timestamp.Equal(timestamp)
+	})
+}
+
+func (mr *memorySnapshotRepo) GetDeletedSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (Snapshot, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var latest *Snapshot
+	for _, snapshot := range mr.snapshots {
+		if snapshot.Status != StatusDeleted || snapshot.Host_IP != host_ip || !snapshot.Timestamp.Equal(timestamp) {
+			continue
+		}
+		if latest == nil || (snapshot.Deleted_At != nil && (latest.Deleted_At == nil || snapshot.Deleted_At.After(*latest.Deleted_At))) {
+			found := snapshot
+			latest = &found
+		}
+	}
+	if latest == nil {
+		return Snapshot{}, ErrNotFound
+	}
+	return copySnapshot(*latest), nil
+}
+
+func (mr *memorySnapshotRepo) UpdateBlob(ctx context.Context, snapshot Snapshot) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	stored, ok := mr.snapshots[snapshot.UUID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.File_PWD = snapshot.File_PWD
+	stored.Content_SHA256 = snapshot.Content_SHA256
+	stored.Size_Bytes = snapshot.Size_Bytes
+	stored.Canonical_SHA256 = snapshot.Canonical_SHA256
+	stored.Content_Encoding = snapshot.Content_Encoding
+	mr.snapshots[snapshot.UUID] = stored
+	return nil
+}
+
+func (mr *memorySnapshotRepo) find(match func(Snapshot) bool) (Snapshot, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	for _, snapshot := range mr.snapshots {
+		if match(snapshot) {
+			return copySnapshot(snapshot), nil
+		}
+	}
+	return Snapshot{}, ErrNotFound
+}
+
+func (mr *memorySnapshotRepo) GetAllHosts(ctx context.Context) ([]string, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	seen := map[string]bool{}
+	hosts := []string{}
+	for _, snapshot := range mr.snapshots {
+		if snapshot.Status == StatusCommitted && !seen[snapshot.Host_IP] {
+			seen[snapshot.Host_IP] = true
+			hosts = append(hosts, snapshot.Host_IP)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+func (mr *memorySnapshotRepo) ListAllHostSnapshots(ctx context.Context, host_ip string) ([]string, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	snapshots := []Snapshot{}
+	for _, snapshot := range mr.snapshots {
+		if snapshot.Status == StatusCommitted && snapshot.Host_IP == host_ip {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Timestamp.Before(snapshots[j].Timestamp) })
+	timestamps := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		timestamps = append(timestamps, snapshot.Timestamp.UTC().Format(time.RFC3339))
+	}
+	return timestamps, nil
+}
+
+func (mr *memorySnapshotRepo) ListHosts(ctx context.Context, query HostQuery) ([]string, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	seen := map[string]bool{}
+	hosts := []string{}
+	for _, snapshot := range mr.snapshots {
+		if snapshot.Status != StatusCommitted || seen[snapshot.Host_IP] || !strings.HasPrefix(snapshot.Host_IP, query.Prefix) || !inRange(snapshot.Timestamp, query.Since, query.Until) {
+			continue
+		}
+		if query.After != "" && ((!query.Descending && snapshot.Host_IP <= query.After) || (query.Descending && snapshot.Host_IP >= query.After)) {
+			continue
+		}
+		seen[snapshot.Host_IP] = true
+		hosts = append(hosts, snapshot.Host_IP)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return (hosts[i] < hosts[j]) != query.Descending })
+	return limit(hosts, query.Limit), nil
+}
+
+func (mr *memorySnapshotRepo) ListHostSnapshots(ctx context.Context, host_ip string, query SnapshotQuery) ([]time.Time, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	timestamps := []time.Time{}
+	for _, snapshot := range mr.snapshots {
+		if snapshot.Status != StatusCommitted || snapshot.Host_IP != host_ip || !inRange(snapshot.Timestamp, query.Since, query.Until) {
+			continue
+		}
+		if query.After != nil && ((!query.Descending && !snapshot.Timestamp.After(*query.After)) || (query.Descending && !snapshot.Timestamp.Before(*query.After))) {
+			continue
+		}
+		timestamps = append(timestamps, snapshot.Timestamp.UTC())
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) != query.Descending })
+	return limit(timestamps, query.Limit), nil
+}
+
+// inRange reports whether timestamp is between since and until, inclusive, where a zero time is unbounded
+func inRange(timestamp time.Time, since time.Time, until time.Time) bool {
+	return (since.IsZero() || !timestamp.Before(since)) && (until.IsZero() || !timestamp.After(until))
+}
+
+func limit[T any](items []T, limit int) []T {
+	if limit > 0 && len(items) > limit {
+		return items[:limit]
+	}
+	return items
+}
+
+func (mr *memorySnapshotRepo) ListAll(ctx context.Context) ([]Snapshot, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	snapshots := make([]Snapshot, 0, len(mr.snapshots))
+	for _, snapshot := range mr.snapshots {
+		snapshots = append(snapshots, copySnapshot(snapshot))
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Host_IP != snapshots[j].Host_IP {
+			return snapshots[i].Host_IP < snapshots[j].Host_IP
+		}
+		return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+	})
+	return snapshots, nil
+}
+
+func (mr *memorySnapshotRepo) CountBlobReferences(ctx context.Context, blobKey string) (int64, error) {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	var count int64
+	for _, snapshot := range mr.snapshots {
+		if snapshot.File_PWD == blobKey {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// copySnapshot returns snapshot with its own copy of Deleted_At, so callers cannot change a stored row
+func copySnapshot(snapshot Snapshot) Snapshot {
+	if snapshot.Deleted_At != nil {
+		deletedAt := *snapshot.Deleted_At
+		snapshot.Deleted_At = &deletedAt
+	}
+	return snapshot
+}
+
+// memoryServiceIndexRepo keeps indexed services in memory, for development and tests. Snapshots are looked up in
+// the SnapshotRepo, so services of soft deleted snapshots are never returned. The services of a snapshot are removed
+// when its row is, if the SnapshotRepo is the in-memory one.
+type memoryServiceIndexRepo struct {
+	snapshotRepo SnapshotRepo
+	mu           sync.RWMutex
+	records      map[uuid.UUID][]ServiceRecord
+}
+
+// NewMemoryServiceIndexRepo creates an empty in-memory ServiceIndexRepo for the snapshots of snapshotRepo
+func NewMemoryServiceIndexRepo(snapshotRepo SnapshotRepo) ServiceIndexRepo {
+	ir := &memoryServiceIndexRepo{
+		snapshotRepo: snapshotRepo,
+		records:      map[uuid.UUID][]ServiceRecord{},
+	}
+	if memory, ok := snapshotRepo.(*memorySnapshotRepo); ok {
+		memory.mu.Lock()
+		memory.onDelete = append(memory.onDelete, ir.remove)
+		memory.mu.Unlock()
+	}
+	return ir
+}
+
+// remove drops the indexed services of a snapshot whose row was removed
+func (ir *memoryServiceIndexRepo) remove(snapshotID uuid.UUID) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	delete(ir.records, snapshotID)
+}
+
+func (ir *memoryServiceIndexRepo) Index(ctx context.Context, snapshotID uuid.UUID, records []ServiceRecord) error {
+	rows := make([]ServiceRecord, 0, len(records))
+	for _, record := range records {
+		record.Snapshot_UUID = snapshotID
+		record.Host_IP = ""
+		record.Timestamp = time.Time{}
+		record.Version_Key = version.Key(record.Version)
+		rows = append(rows, record)
+	}
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	ir.records[snapshotID] = rows
+	return nil
+}
+
+func (ir *memoryServiceIndexRepo) Search(ctx context.Context, query ServiceQuery) ([]ServiceRecord, error) {
+	snapshots, err := ir.snapshotRepo.ListAll(ctx)
+	if err != nil {
+		return []ServiceRecord{}, err
+	}
+	// The snapshot each host is searched as of
+	searched := map[string]Snapshot{}
+	for _, snapshot := range snapshots {
+		if snapshot.Status != StatusCommitted || !strings.HasPrefix(snapshot.Host_IP, query.Prefix) || (!query.At.IsZero() && snapshot.Timestamp.After(query.At)) {
+			continue
+		}
+		if query.After != "" && ((!query.Descending && snapshot.Host_IP <= query.After) || (query.Descending && snapshot.Host_IP >= query.After)) {
+			continue
+		}
+		if current, ok := searched[snapshot.Host_IP]; !ok || snapshot.Timestamp.After(current.Timestamp) {
+			searched[snapshot.Host_IP] = snapshot
+		}
+	}
+	hosts := make([]string, 0, len(searched))
+	for host := range searched {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return (hosts[i] < hosts[j]) != query.Descending })
+
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+	records := []ServiceRecord{}
+	found := 0
+	for _, host := range hosts {
+		snapshot := searched[host]
+		matched := []ServiceRecord{}
+		for _, record := range ir.records[snapshot.UUID] {
+			if query.matches(record) {
+				record.Host_IP = snapshot.Host_IP
+				record.Timestamp = snapshot.Timestamp.UTC()
+				matched = append(matched, record)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if found++; query.Limit > 0 && found > query.Limit {
+			break
+		}
+		sort.Slice(matched, func(i, j int) bool {
+			if matched[i].Port != matched[j].Port {
+				return matched[i].Port < matched[j].Port
+			}
+			return matched[i].Protocol < matched[j].Protocol
+		})
+		records = append(records, matched...)
+	}
+	return records, nil
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS snapshot_differences;
+DROP TABLE IF EXISTS snapshot;
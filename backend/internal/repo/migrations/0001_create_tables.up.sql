@@ -0,0 +1,27 @@
+-- Databases set up by hand with the old schema.sql already have some of these tables and columns, so everything is
+-- created only if it is missing.
+CREATE TABLE IF NOT EXISTS snapshot (
+    uuid                UUID PRIMARY KEY,
+    timestamp           TIMESTAMP NOT NULL,
+    host_ip             VARCHAR(255) NOT NULL,
+    file_pwd            TEXT NOT NULL,
+    file_name           TEXT NOT NULL
+);
+
+ALTER TABLE snapshot
+    ADD COLUMN IF NOT EXISTS content_sha256      CHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS size_bytes          BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS canonical_sha256    CHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status              VARCHAR(16) NOT NULL DEFAULT 'committed',
+    ADD COLUMN IF NOT EXISTS content_encoding    VARCHAR(16) NOT NULL DEFAULT 'identity',
+    ADD COLUMN IF NOT EXISTS deleted_at          TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS snapshot_content_sha256_idx ON snapshot (content_sha256);
+
+CREATE TABLE IF NOT EXISTS snapshot_differences (
+    host_ip     VARCHAR(255) NOT NULL,
+    timestamp1  TIMESTAMP NOT NULL,
+    timestamp2  TIMESTAMP NOT NULL,
+    json_data   TEXT NOT NULL,
+    PRIMARY KEY (host_ip, timestamp1, timestamp2)
+);
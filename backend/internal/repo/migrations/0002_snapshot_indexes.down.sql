@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS snapshot_differences_timestamp2_idx;
+DROP INDEX IF EXISTS snapshot_host_ip_timestamp_committed_idx;
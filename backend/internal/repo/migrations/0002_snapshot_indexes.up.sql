@@ -0,0 +1,8 @@
+-- Only one committed snapshot per host and timestamp. Pending rows of concurrent uploads and soft deleted rows are
+-- not covered, the second upload to commit fails instead. This fails if the table already has duplicates, which can
+-- be listed with:
+--   SELECT host_ip, timestamp, count(*) FROM snapshot WHERE status = 'committed' GROUP BY 1, 2 HAVING count(*) > 1;
+CREATE UNIQUE INDEX snapshot_host_ip_timestamp_committed_idx ON snapshot (host_ip, timestamp) WHERE status = 'committed';
+
+-- The primary key covers lookups by timestamp1, this covers removing the differences of a snapshot by timestamp2
+CREATE INDEX snapshot_differences_timestamp2_idx ON snapshot_differences (host_ip, timestamp2);
@@ -0,0 +1,17 @@
+-- One row per service of each snapshot, for searching the fleet by what hosts run. Rows are removed with their
+-- snapshot. Snapshots stored before this migration are not indexed until the reindex command is run. version_key is
+-- compared byte by byte, as version.Key requires, whatever the collation of the database.
+CREATE TABLE service_index (
+    snapshot_uuid   UUID NOT NULL REFERENCES snapshot (uuid) ON DELETE CASCADE,
+    port            INTEGER NOT NULL,
+    protocol        TEXT NOT NULL DEFAULT '',
+    vendor          TEXT NOT NULL DEFAULT '',
+    product         TEXT NOT NULL DEFAULT '',
+    version         TEXT NOT NULL DEFAULT '',
+    version_key     TEXT COLLATE "C" NOT NULL DEFAULT '',
+    tls_version     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX service_index_snapshot_uuid_idx ON service_index (snapshot_uuid);
+CREATE INDEX service_index_port_idx ON service_index (port);
+CREATE INDEX service_index_product_idx ON service_index (LOWER(product));
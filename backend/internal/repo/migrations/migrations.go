@@ -0,0 +1,265 @@
+// Package migrations holds the versioned database schema, embedded in the binary, and applies it.
+//
+// Each migration is a pair of files, <version>_<name>.up.sql and <version>_<name>.down.sql, with versions numbered
+// from 1 without gaps. Applied versions are recorded in the schema_migrations table. Migrations are never edited once
+// released; a schema change is a new migration.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed *.sql
+var embedded embed.FS
+
+// lockID is the Postgres advisory lock held while a migration is applied, so that servers starting together with
+// auto-migrate apply each migration once. It is the 64-bit FNV-1a hash of "schema_migrations" as a signed bigint,
+// which only needs to be unlikely to clash with other advisory locks on the database. It must never change, or a
+// server of an older version would apply migrations alongside one of a newer version.
+const lockID int64 = -4387181548746815398
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one version of the schema. Up applies it and Down reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied. AppliedAt is nil for a pending migration, and Name is empty for a
+// version applied to the database that this binary does not know about.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	Version    int       `gorm:"column:version;primaryKey"`
+	Name       string    `gorm:"column:name"`
+	Applied_At time.Time `gorm:"column:applied_at"`
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Embedded returns the migrations built into the binary
+func Embedded() ([]Migration, error) {
+	return Load(embedded)
+}
+
+// Load reads the migrations in the root of fsys, ordered by version
+//
+// Responses:
+//   - []Migration: the migrations, ordered by version
+//   - error: error if a file is misnamed, a version is missing its up or down file, or versions have gaps {nil | error}
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("Invalid migration file name %q, expected <version>_<name>.up.sql or <version>_<name>.down.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid migration version in %q: %v", entry.Name(), err)
+		}
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("Migration %d has two names, %q and %q", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("Migration %d is missing", i+1)
+		}
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("Migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			return nil, fmt.Errorf("Migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+	}
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator applying migrations, as returned by Load, to db
+func NewMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+// Status lists every known migration and when it was applied, followed by any applied versions this binary does
+// not know about
+func (migrator *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var applied []appliedMigration
+	db := migrator.db.WithContext(ctx)
+	if db.Migrator().HasTable(&appliedMigration{}) {
+		if err := db.Order("version").Find(&applied).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	appliedAt := map[int]time.Time{}
+	for _, row := range applied {
+		appliedAt[row.Version] = row.Applied_At
+	}
+	statuses := make([]Status, 0, len(migrator.migrations))
+	for _, migration := range migrator.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		if row.Version > len(migrator.migrations) {
+			at := row.Applied_At
+			statuses = append(statuses, Status{Version: row.Version, AppliedAt: &at})
+		}
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction, and stops at the first failure
+//
+// Responses:
+//   - []Migration: the migrations applied by this call
+//   - error: error if a migration failed, in which case it and the later migrations are not applied {nil | error}
+func (migrator *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied := []Migration{}
+	for _, migration := range migrator.migrations {
+		ran := false
+		err := migrator.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lock(tx); err != nil {
+				return err
+			}
+			var count int64
+			if err := tx.Model(&appliedMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&appliedMigration{Version: migration.Version, Name: migration.Name, Applied_At: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("Failed to apply migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		if ran {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Down reverts the latest steps applied migrations, newest first, each in its own transaction
+//
+// Responses:
+//   - []Migration: the migrations reverted by this call, fewer than steps if there were fewer applied
+//   - error: error if a migration failed or is not known to this binary {nil | error}
+func (migrator *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	reverted := []Migration{}
+	for len(reverted) < steps {
+		var migration Migration
+		done := false
+		err := migrator.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lock(tx); err != nil {
+				return err
+			}
+			var latest appliedMigration
+			err := tx.Order("version DESC").First(&latest).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				done = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if latest.Version > len(migrator.migrations) {
+				return fmt.Errorf("Cannot revert migration %d, it is newer than this binary", latest.Version)
+			}
+			migration = migrator.migrations[latest.Version-1]
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return fmt.Errorf("Failed to revert migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			return tx.Delete(&latest).Error
+		})
+		if err != nil {
+			return reverted, err
+		}
+		if done {
+			break
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// lock takes the migration lock until the end of the transaction, and creates schema_migrations if needed
+func lock(tx *gorm.DB) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID).Error; err != nil {
+		return fmt.Errorf("Failed to lock migrations: %v", err)
+	}
+	return createTable(tx)
+}
+
+func createTable(tx *gorm.DB) error {
+	return tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version     INTEGER PRIMARY KEY,
+    name        TEXT NOT NULL,
+    applied_at  TIMESTAMP NOT NULL
+)`).Error
+}
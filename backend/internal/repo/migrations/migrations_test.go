@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"hash/fnv"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedded(t *testing.T) {
+	migrations, err := Embedded()
+
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, "create_tables", migrations[0].Name)
+	assert.Contains(t, migrations[0].Up, "CREATE TABLE IF NOT EXISTS snapshot ")
+}
+
+func TestLockID(t *testing.T) {
+	hash := fnv.New64a()
+	hash.Write([]byte("schema_migrations"))
+
+	assert.Equal(t, int64(hash.Sum64()), lockID)
+}
+
+func TestLoad(t *testing.T) {
+	file := func(contents string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(contents)} }
+
+	tests := []struct {
+		name             string
+		files            fstest.MapFS
+		expectedVersions []int
+		expectedError    string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"0002_add_index.up.sql":      file("CREATE INDEX a ON t (b);"),
+				"0002_add_index.down.sql":    file("DROP INDEX a;"),
+				"0001_create_table.up.sql":   file("CREATE TABLE t (b INT);"),
+				"0001_create_table.down.sql": file("DROP TABLE t;"),
+				"README.md":                  file("not a migration"),
+			},
+			expectedVersions: []int{1, 2},
+		},
+		{
+			name:             "no migrations",
+			files:            fstest.MapFS{},
+			expectedVersions: []int{},
+		},
+		{
+			name: "missing down file",
+			files: fstest.MapFS{
+				"0001_create_table.up.sql": file("CREATE TABLE t (b INT);"),
+			},
+			expectedError: "has no down file",
+		},
+		{
+			name: "gap in versions",
+			files: fstest.MapFS{
+				"0001_create_table.up.sql":   file("CREATE TABLE t (b INT);"),
+				"0001_create_table.down.sql": file("DROP TABLE t;"),
+				"0003_add_index.up.sql":      file("CREATE INDEX a ON t (b);"),
+				"0003_add_index.down.sql":    file("DROP INDEX a;"),
+			},
+			expectedError: "Migration 2 is missing",
+		},
+		{
+			name: "names differ",
+			files: fstest.MapFS{
+				"0001_create_table.up.sql": file("CREATE TABLE t (b INT);"),
+				"0001_drop_table.down.sql": file("DROP TABLE t;"),
+			},
+			expectedError: "has two names",
+		},
+		{
+			name: "misnamed file",
+			files: fstest.MapFS{
+				"create_table.sql": file("CREATE TABLE t (b INT);"),
+			},
+			expectedError: "Invalid migration file name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			versions := []int{}
+			for _, migration := range migrations {
+				versions = append(versions, migration.Version)
+			}
+			assert.Equal(t, tt.expectedVersions, versions)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/endingwithali/2025censys/internal/repo/migrations"
+)
+
+// Test reverting and re-applying the latest migration on the test DB
+func TestMigrations_DownAndUp(t *testing.T) {
+	ctx := context.Background()
+	embedded, err := migrations.Embedded()
+	if err != nil {
+		t.Fatalf("Embedded returned error: %v", err)
+	}
+	migrator := migrations.NewMigrator(testDB, embedded)
+	latest := embedded[len(embedded)-1]
+
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down returned error: %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != latest.Version {
+		t.Fatalf("expected migration %d to be reverted, got %+v", latest.Version, reverted)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	for _, status := range statuses {
+		if pending := status.AppliedAt == nil; pending != (status.Version == latest.Version) {
+			t.Errorf("unexpected status for migration %d: applied at %v", status.Version, status.AppliedAt)
+		}
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != latest.Version {
+		t.Errorf("expected migration %d to be applied, got %+v", latest.Version, applied)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("expected nothing to apply, got %+v, %v", applied, err)
+	}
+}
@@ -0,0 +1,388 @@
+// Package repotest is the contract every repo.SnapshotRepo and repo.ServiceIndexRepo implementation must satisfy.
+//
+// Implementations run it from their own tests:
+//
+//	func TestMemorySnapshotRepo(t *testing.T) {
+//		repotest.TestSnapshotRepo(t, func(t *testing.T) repo.SnapshotRepo { return repo.NewMemorySnapshotRepo() })
+//	}
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSnapshotRepo runs the contract. newRepo must return an empty repo, and is called once per subtest.
+func TestSnapshotRepo(t *testing.T, newRepo func(t *testing.T) repo.SnapshotRepo) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, snapshotRepo repo.SnapshotRepo)
+	}{
+		{"InsertAndGet", testInsertAndGet},
+		{"NotFound", testNotFound},
+		{"PendingUntilCommitted", testPendingUntilCommitted},
+		{"UniqueCommitted", testUniqueCommitted},
+		{"Delete", testDelete},
+		{"DeleteWithStatus", testDeleteWithStatus},
+		{"SoftDeleteAndRestore", testSoftDeleteAndRestore},
+		{"UpdateBlob", testUpdateBlob},
+		{"CountBlobReferences", testCountBlobReferences},
+		{"Listings", testListings},
+		{"ListHosts", testListHosts},
+		{"ListHostSnapshots", testListHostSnapshots},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+var jan1 = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func snapshot(hostIP string, timestamp time.Time, blobKey string) repo.Snapshot {
+	return repo.Snapshot{UUID: uuid.New(), Host_IP: hostIP, Timestamp: timestamp, File_PWD: blobKey, File_Name: "snapshot.json"}
+}
+
+func insert(t *testing.T, snapshotRepo repo.SnapshotRepo, snapshots ...repo.Snapshot) {
+	t.Helper()
+	for _, snapshot := range snapshots {
+		require.NoError(t, snapshotRepo.Insert(context.Background(), snapshot))
+	}
+}
+
+func testInsertAndGet(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	stored := repo.Snapshot{
+		UUID:             uuid.New(),
+		Host_IP:          "10.0.0.1",
+		Timestamp:        jan1,
+		File_PWD:         "ab/abcdef.json.zst",
+		File_Name:        "host_10.0.0.1_2025-01-01T12-00-00Z.json",
+		Content_SHA256:   "abcdef",
+		Size_Bytes:       123,
+		Canonical_SHA256: "fedcba",
+		Content_Encoding: compression.Zstd,
+	}
+	insert(t, snapshotRepo, stored)
+	// The defaults: committed and uncompressed, with a generated UUID
+	insert(t, snapshotRepo, repo.Snapshot{Host_IP: "10.0.0.2", Timestamp: jan1, File_PWD: "cd/plain.json", File_Name: "plain.json"})
+
+	byTimestamp, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	require.NoError(t, err)
+	assert.Equal(t, stored.UUID, byTimestamp.UUID)
+	assert.Equal(t, stored.File_PWD, byTimestamp.File_PWD)
+	assert.Equal(t, stored.File_Name, byTimestamp.File_Name)
+	assert.Equal(t, stored.Content_SHA256, byTimestamp.Content_SHA256)
+	assert.Equal(t, stored.Size_Bytes, byTimestamp.Size_Bytes)
+	assert.Equal(t, stored.Canonical_SHA256, byTimestamp.Canonical_SHA256)
+	assert.Equal(t, compression.Zstd, byTimestamp.Content_Encoding)
+	assert.Equal(t, repo.StatusCommitted, byTimestamp.Status)
+	assert.True(t, jan1.Equal(byTimestamp.Timestamp), "timestamp %v", byTimestamp.Timestamp)
+	assert.Nil(t, byTimestamp.Deleted_At)
+
+	// The same instant in another time zone finds the same snapshot
+	byOtherZone, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1.In(time.FixedZone("UTC+2", 2*60*60)))
+	require.NoError(t, err)
+	assert.Equal(t, stored.UUID, byOtherZone.UUID)
+
+	defaults, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.2", jan1)
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, defaults.UUID)
+	assert.Equal(t, repo.StatusCommitted, defaults.Status)
+	assert.Equal(t, compression.Identity, defaults.Content_Encoding)
+}
+
+func testNotFound(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	insert(t, snapshotRepo, snapshot("10.0.0.1", jan1, "ab/one.json"))
+
+	_, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1.Add(time.Second))
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+	_, err = snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.2", jan1)
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+	_, err = snapshotRepo.GetDeletedSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+	assert.ErrorIs(t, snapshotRepo.MarkCommitted(ctx, uuid.New()), repo.ErrNotFound)
+	assert.ErrorIs(t, snapshotRepo.SoftDelete(ctx, uuid.New(), jan1), repo.ErrNotFound)
+	assert.ErrorIs(t, snapshotRepo.Restore(ctx, uuid.New()), repo.ErrNotFound)
+	assert.ErrorIs(t, snapshotRepo.UpdateBlob(ctx, repo.Snapshot{UUID: uuid.New()}), repo.ErrNotFound)
+
+	timestamps, err := snapshotRepo.ListAllHostSnapshots(ctx, "10.0.0.2")
+	require.NoError(t, err)
+	assert.Empty(t, timestamps)
+}
+
+func testPendingUntilCommitted(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	pending := snapshot("10.0.0.1", jan1, "ab/pending.json")
+	pending.Status = repo.StatusPending
+	insert(t, snapshotRepo, pending)
+
+	_, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	assert.ErrorIs(t, err, repo.ErrNotFound, "pending rows are hidden")
+	hosts, err := snapshotRepo.GetAllHosts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, hosts)
+
+	require.NoError(t, snapshotRepo.MarkCommitted(ctx, pending.UUID))
+	committed, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	require.NoError(t, err)
+	assert.Equal(t, pending.UUID, committed.UUID)
+	assert.ErrorIs(t, snapshotRepo.MarkCommitted(ctx, pending.UUID), repo.ErrNotFound, "already committed")
+}
+
+func testUniqueCommitted(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	first := snapshot("10.0.0.1", jan1, "ab/first.json")
+	insert(t, snapshotRepo, first)
+
+	assert.ErrorIs(t, snapshotRepo.Insert(ctx, snapshot("10.0.0.1", jan1, "ab/second.json")), repo.ErrDuplicate)
+
+	// A pending row for the same host and timestamp is allowed, committing it is not
+	second := snapshot("10.0.0.1", jan1, "ab/second.json")
+	second.Status = repo.StatusPending
+	insert(t, snapshotRepo, second)
+	assert.ErrorIs(t, snapshotRepo.MarkCommitted(ctx, second.UUID), repo.ErrDuplicate)
+
+	// Other hosts and timestamps are independent
+	insert(t, snapshotRepo, snapshot("10.0.0.2", jan1, "ab/first.json"), snapshot("10.0.0.1", jan1.Add(time.Hour), "ab/first.json"))
+
+	// Once the first is soft deleted the second can be committed, and the first can no longer be restored
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, first.UUID, jan1.Add(time.Hour)))
+	require.NoError(t, snapshotRepo.MarkCommitted(ctx, second.UUID))
+	assert.ErrorIs(t, snapshotRepo.Restore(ctx, first.UUID), repo.ErrDuplicate)
+}
+
+func testDelete(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	removed := snapshot("10.0.0.1", jan1, "ab/removed.json")
+	insert(t, snapshotRepo, removed)
+
+	require.NoError(t, snapshotRepo.Delete(ctx, removed.UUID))
+	_, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+	all, err := snapshotRepo.ListAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+	assert.NoError(t, snapshotRepo.Delete(ctx, removed.UUID), "deleting a missing row is not an error")
+}
+
+func testDeleteWithStatus(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	removed := snapshot("10.0.0.1", jan1, "ab/removed.json")
+	insert(t, snapshotRepo, removed)
+
+	assert.ErrorIs(t, snapshotRepo.DeleteWithStatus(ctx, removed.UUID, repo.StatusDeleted), repo.ErrNotFound)
+	_, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	require.NoError(t, err, "a row with another status is kept")
+
+	require.NoError(t, snapshotRepo.DeleteWithStatus(ctx, removed.UUID, repo.StatusCommitted))
+	_, err = snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+	assert.ErrorIs(t, snapshotRepo.DeleteWithStatus(ctx, removed.UUID, repo.StatusCommitted), repo.ErrNotFound)
+}
+
+func testSoftDeleteAndRestore(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	older := snapshot("10.0.0.1", jan1, "ab/older.json")
+	newer := snapshot("10.0.0.1", jan1, "ab/newer.json")
+	insert(t, snapshotRepo, older)
+	olderDeletedAt := jan1.Add(time.Hour)
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, older.UUID, olderDeletedAt))
+	insert(t, snapshotRepo, newer)
+	newerDeletedAt := jan1.Add(2 * time.Hour)
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, newer.UUID, newerDeletedAt))
+
+	_, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	assert.ErrorIs(t, err, repo.ErrNotFound, "deleted rows are hidden")
+	hosts, err := snapshotRepo.GetAllHosts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, hosts)
+	assert.ErrorIs(t, snapshotRepo.SoftDelete(ctx, newer.UUID, newerDeletedAt), repo.ErrNotFound, "already deleted")
+
+	// The most recently deleted is found first
+	deleted, err := snapshotRepo.GetDeletedSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	require.NoError(t, err)
+	assert.Equal(t, newer.UUID, deleted.UUID)
+	assert.Equal(t, repo.StatusDeleted, deleted.Status)
+	require.NotNil(t, deleted.Deleted_At)
+	assert.True(t, newerDeletedAt.Equal(*deleted.Deleted_At), "deleted at %v", deleted.Deleted_At)
+
+	require.NoError(t, snapshotRepo.Restore(ctx, newer.UUID))
+	restored, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	require.NoError(t, err)
+	assert.Equal(t, newer.UUID, restored.UUID)
+	assert.Nil(t, restored.Deleted_At)
+	assert.ErrorIs(t, snapshotRepo.Restore(ctx, newer.UUID), repo.ErrNotFound, "already restored")
+}
+
+func testUpdateBlob(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	legacy := snapshot("10.0.0.1", jan1, "backend/snapshots/host_10.0.0.1_2025-01-01T12-00-00Z.json")
+	insert(t, snapshotRepo, legacy)
+
+	rekeyed := repo.Snapshot{
+		UUID:             legacy.UUID,
+		File_PWD:         "ab/abcdef.json.zst",
+		Content_SHA256:   "abcdef",
+		Size_Bytes:       123,
+		Canonical_SHA256: "fedcba",
+		Content_Encoding: compression.Zstd,
+	}
+	require.NoError(t, snapshotRepo.UpdateBlob(ctx, rekeyed))
+
+	updated, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	require.NoError(t, err)
+	assert.Equal(t, rekeyed.File_PWD, updated.File_PWD)
+	assert.Equal(t, rekeyed.Content_SHA256, updated.Content_SHA256)
+	assert.Equal(t, rekeyed.Size_Bytes, updated.Size_Bytes)
+	assert.Equal(t, rekeyed.Canonical_SHA256, updated.Canonical_SHA256)
+	assert.Equal(t, compression.Zstd, updated.Content_Encoding)
+	// The rest of the row is kept
+	assert.Equal(t, legacy.File_Name, updated.File_Name)
+	assert.Equal(t, repo.StatusCommitted, updated.Status)
+}
+
+func testCountBlobReferences(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	committed := snapshot("10.0.0.1", jan1, "ab/shared.json")
+	pending := snapshot("10.0.0.2", jan1, "ab/shared.json")
+	pending.Status = repo.StatusPending
+	deleted := snapshot("10.0.0.3", jan1, "ab/shared.json")
+	other := snapshot("10.0.0.4", jan1, "ab/other.json")
+	insert(t, snapshotRepo, committed, pending, deleted, other)
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, deleted.UUID, jan1))
+
+	count, err := snapshotRepo.CountBlobReferences(ctx, "ab/shared.json")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count, "pending and deleted rows still reference the blob")
+
+	require.NoError(t, snapshotRepo.Delete(ctx, committed.UUID))
+	count, err = snapshotRepo.CountBlobReferences(ctx, "ab/shared.json")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	count, err = snapshotRepo.CountBlobReferences(ctx, "ab/missing.json")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func testListings(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	pending := snapshot("10.0.0.3", jan1, "ab/pending.json")
+	pending.Status = repo.StatusPending
+	deleted := snapshot("10.0.0.1", jan1.Add(48*time.Hour), "ab/deleted.json")
+	insert(t, snapshotRepo,
+		snapshot("10.0.0.2", jan1, "ab/b.json"),
+		snapshot("10.0.0.1", jan1.Add(24*time.Hour), "ab/a2.json"),
+		snapshot("10.0.0.1", jan1, "ab/a1.json"),
+		pending,
+		deleted,
+	)
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, deleted.UUID, jan1))
+
+	hosts, err := snapshotRepo.GetAllHosts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, hosts)
+
+	timestamps, err := snapshotRepo.ListAllHostSnapshots(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2025-01-01T12:00:00Z", "2025-01-02T12:00:00Z"}, timestamps)
+
+	all, err := snapshotRepo.ListAll(ctx)
+	require.NoError(t, err)
+	keys := []string{}
+	for _, row := range all {
+		keys = append(keys, row.File_PWD)
+	}
+	assert.Equal(t, []string{"ab/a1.json", "ab/a2.json", "ab/deleted.json", "ab/b.json", "ab/pending.json"}, keys, "every row, by host and timestamp")
+}
+
+func testListHosts(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	pending := snapshot("10.0.1.9", jan1, "ab/pending.json")
+	pending.Status = repo.StatusPending
+	insert(t, snapshotRepo,
+		snapshot("10.0.0.1", jan1, "ab/a.json"),
+		snapshot("10.0.0.1", jan1.Add(48*time.Hour), "ab/a.json"),
+		snapshot("10.0.0.2", jan1.Add(24*time.Hour), "ab/b.json"),
+		snapshot("10.0.1.1", jan1, "ab/c.json"),
+		snapshot("10_0_2_1", jan1, "ab/d.json"),
+		snapshot("192.168.0.1", jan1.Add(48*time.Hour), "ab/e.json"),
+		pending,
+	)
+
+	tests := []struct {
+		name     string
+		query    repo.HostQuery
+		expected []string
+	}{
+		{"all", repo.HostQuery{}, []string{"10.0.0.1", "10.0.0.2", "10.0.1.1", "10_0_2_1", "192.168.0.1"}},
+		{"first page", repo.HostQuery{Limit: 2}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"next page", repo.HostQuery{Limit: 2, After: "10.0.0.2"}, []string{"10.0.1.1", "10_0_2_1"}},
+		{"last page", repo.HostQuery{Limit: 2, After: "10_0_2_1"}, []string{"192.168.0.1"}},
+		{"past the end", repo.HostQuery{Limit: 2, After: "192.168.0.1"}, []string{}},
+		{"descending", repo.HostQuery{Descending: true, Limit: 2}, []string{"192.168.0.1", "10_0_2_1"}},
+		{"descending next page", repo.HostQuery{Descending: true, After: "10_0_2_1"}, []string{"10.0.1.1", "10.0.0.2", "10.0.0.1"}},
+		{"prefix", repo.HostQuery{Prefix: "10.0.0."}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"prefix is not a pattern", repo.HostQuery{Prefix: "10_0_"}, []string{"10_0_2_1"}},
+		{"since", repo.HostQuery{Since: jan1.Add(24 * time.Hour)}, []string{"10.0.0.1", "10.0.0.2", "192.168.0.1"}},
+		{"until", repo.HostQuery{Until: jan1}, []string{"10.0.0.1", "10.0.1.1", "10_0_2_1"}},
+		{"since and until", repo.HostQuery{Since: jan1.Add(time.Hour), Until: jan1.Add(24 * time.Hour)}, []string{"10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := snapshotRepo.ListHosts(ctx, tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, hosts)
+		})
+	}
+}
+
+func testListHostSnapshots(t *testing.T, snapshotRepo repo.SnapshotRepo) {
+	ctx := context.Background()
+	deleted := snapshot("10.0.0.1", jan1.Add(time.Hour), "ab/deleted.json")
+	insert(t, snapshotRepo,
+		snapshot("10.0.0.1", jan1.Add(2*time.Hour), "ab/c.json"),
+		snapshot("10.0.0.1", jan1, "ab/a.json"),
+		snapshot("10.0.0.1", jan1.Add(1500*time.Millisecond), "ab/b.json"),
+		snapshot("10.0.0.1", jan1.Add(3*time.Hour), "ab/d.json"),
+		snapshot("10.0.0.2", jan1, "ab/a.json"),
+		deleted,
+	)
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, deleted.UUID, jan1))
+
+	at := func(offset time.Duration) time.Time { return jan1.Add(offset) }
+	after := func(offset time.Duration) *time.Time { timestamp := jan1.Add(offset); return &timestamp }
+	tests := []struct {
+		name     string
+		query    repo.SnapshotQuery
+		expected []time.Time
+	}{
+		{"all", repo.SnapshotQuery{}, []time.Time{at(0), at(1500 * time.Millisecond), at(2 * time.Hour), at(3 * time.Hour)}},
+		{"first page", repo.SnapshotQuery{Limit: 2}, []time.Time{at(0), at(1500 * time.Millisecond)}},
+		{"next page keeps fractional seconds", repo.SnapshotQuery{Limit: 2, After: after(1500 * time.Millisecond)}, []time.Time{at(2 * time.Hour), at(3 * time.Hour)}},
+		{"descending", repo.SnapshotQuery{Descending: true, Limit: 3}, []time.Time{at(3 * time.Hour), at(2 * time.Hour), at(1500 * time.Millisecond)}},
+		{"descending next page", repo.SnapshotQuery{Descending: true, After: after(1500 * time.Millisecond)}, []time.Time{at(0)}},
+		{"since and until are inclusive", repo.SnapshotQuery{Since: at(1500 * time.Millisecond), Until: at(2 * time.Hour)}, []time.Time{at(1500 * time.Millisecond), at(2 * time.Hour)}},
+		{"empty range", repo.SnapshotQuery{Since: at(4 * time.Hour)}, []time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamps, err := snapshotRepo.ListHostSnapshots(ctx, "10.0.0.1", tt.query)
+			require.NoError(t, err)
+			require.Len(t, timestamps, len(tt.expected))
+			for i := range tt.expected {
+				assert.True(t, tt.expected[i].Equal(timestamps[i]), "timestamp %d: expected %v, got %v", i, tt.expected[i], timestamps[i])
+				assert.Equal(t, time.UTC, timestamps[i].Location())
+			}
+		})
+	}
+}
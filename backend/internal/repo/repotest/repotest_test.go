@@ -0,0 +1,189 @@
+package repotest_test
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/repo/migrations"
+	"github.com/endingwithali/2025censys/internal/repo/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMemorySnapshotRepo(t *testing.T) {
+	repotest.TestSnapshotRepo(t, func(t *testing.T) repo.SnapshotRepo {
+		return repo.NewMemorySnapshotRepo()
+	})
+}
+
+func TestSQLiteSnapshotRepo(t *testing.T) {
+	repotest.TestSnapshotRepo(t, func(t *testing.T) repo.SnapshotRepo {
+		return repo.NewSnapshotRepo(openSQLite(t))
+	})
+}
+
+func TestMemoryServiceIndexRepo(t *testing.T) {
+	repotest.TestServiceIndexRepo(t, func(t *testing.T) (repo.SnapshotRepo, repo.ServiceIndexRepo) {
+		snapshotRepo := repo.NewMemorySnapshotRepo()
+		return snapshotRepo, repo.NewMemoryServiceIndexRepo(snapshotRepo)
+	})
+}
+
+func TestSQLiteServiceIndexRepo(t *testing.T) {
+	repotest.TestServiceIndexRepo(t, func(t *testing.T) (repo.SnapshotRepo, repo.ServiceIndexRepo) {
+		db := openSQLite(t)
+		return repo.NewSnapshotRepo(db), repo.NewServiceIndexRepo(db)
+	})
+}
+
+func TestSQLiteDifferenceRepo(t *testing.T) {
+	ctx := context.Background()
+	differenceRepo := repo.NewDifferenceRepo(openSQLite(t))
+	timestamp1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	timestamp2 := timestamp1.Add(time.Hour)
+
+	_, found, err := differenceRepo.CheckForComparison(ctx, "10.0.0.1", timestamp1, timestamp2)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, differenceRepo.Insert(ctx, repo.Differences{Host_IP: "10.0.0.1", Timestamp1: timestamp1, Timestamp2: timestamp2, JSON_Data: `{"added":[]}`}))
+	// Storing the same comparison again keeps the first
+	require.NoError(t, differenceRepo.Insert(ctx, repo.Differences{Host_IP: "10.0.0.1", Timestamp1: timestamp1, Timestamp2: timestamp2, JSON_Data: `{"added":[1]}`}))
+	difference, found, err := differenceRepo.CheckForComparison(ctx, "10.0.0.1", timestamp1, timestamp2)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, `{"added":[]}`, difference.JSON_Data)
+
+	require.NoError(t, differenceRepo.DeleteForSnapshot(ctx, "10.0.0.1", timestamp2))
+	_, found, err = differenceRepo.CheckForComparison(ctx, "10.0.0.1", timestamp1, timestamp2)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+// schema is the tables, with their sorted column names, and the indexes, with their definition after ON, of a
+// database
+type schema struct {
+	tables  map[string][]string
+	indexes map[string]string
+}
+
+var (
+	sqlCommentPattern   = regexp.MustCompile(`--[^\n]*`)
+	createTablePattern  = regexp.MustCompile(`(?is)^CREATE TABLE (?:IF NOT EXISTS )?(\w+)\s*\((.*)\)$`)
+	alterTablePattern   = regexp.MustCompile(`(?is)^ALTER TABLE (?:IF EXISTS )?(\w+)\s+(.*)$`)
+	alterColumnPattern  = regexp.MustCompile(`(?i)(ADD|DROP) COLUMN (?:IF (?:NOT )?EXISTS )?(\w+)`)
+	dropTablePattern    = regexp.MustCompile(`(?i)^DROP TABLE (?:IF EXISTS )?(\w+)`)
+	createIndexPattern  = regexp.MustCompile(`(?is)^CREATE (UNIQUE )?INDEX (?:IF NOT EXISTS )?(\w+) ON (.*)$`)
+	dropIndexPattern    = regexp.MustCompile(`(?i)^DROP INDEX (?:IF EXISTS )?(\w+)`)
+	whitespacePattern   = regexp.MustCompile(`\s+`)
+	tableConstraintWord = map[string]bool{"PRIMARY": true, "UNIQUE": true, "CONSTRAINT": true, "FOREIGN": true, "CHECK": true}
+)
+
+// indexDefinition normalises the part of a CREATE INDEX statement after ON, so that the same index reads the same
+// in both dialects
+func indexDefinition(unique string, definition string) string {
+	return strings.ToLower(strings.TrimSpace(unique + " " + whitespacePattern.ReplaceAllString(definition, " ")))
+}
+
+// migratedSchema applies the up migrations, in order, to an empty schema
+func migratedSchema(t *testing.T) schema {
+	embedded, err := migrations.Embedded()
+	require.NoError(t, err)
+	columns := map[string]map[string]bool{}
+	indexes := map[string]string{}
+	for _, migration := range embedded {
+		for _, statement := range strings.Split(sqlCommentPattern.ReplaceAllString(migration.Up, ""), ";") {
+			statement = strings.TrimSpace(statement)
+			if match := createTablePattern.FindStringSubmatch(statement); match != nil {
+				if columns[match[1]] == nil {
+					columns[match[1]] = map[string]bool{}
+				}
+				for _, line := range strings.Split(match[2], "\n") {
+					if fields := strings.Fields(line); len(fields) > 0 && !tableConstraintWord[strings.ToUpper(fields[0])] {
+						columns[match[1]][fields[0]] = true
+					}
+				}
+			} else if match := alterTablePattern.FindStringSubmatch(statement); match != nil {
+				for _, alter := range alterColumnPattern.FindAllStringSubmatch(match[2], -1) {
+					columns[match[1]][alter[2]] = strings.EqualFold(alter[1], "ADD")
+				}
+			} else if match := dropTablePattern.FindStringSubmatch(statement); match != nil {
+				delete(columns, match[1])
+			} else if match := createIndexPattern.FindStringSubmatch(statement); match != nil {
+				indexes[match[2]] = indexDefinition(match[1], match[3])
+			} else if match := dropIndexPattern.FindStringSubmatch(statement); match != nil {
+				delete(indexes, match[1])
+			} else if statement != "" {
+				t.Fatalf("Migration %d has a statement the schema comparison does not understand: %s", migration.Version, statement)
+			}
+		}
+	}
+
+	tables := map[string][]string{}
+	for table, tableColumns := range columns {
+		tables[table] = []string{}
+		for column, exists := range tableColumns {
+			if exists {
+				tables[table] = append(tables[table], column)
+			}
+		}
+		sort.Strings(tables[table])
+	}
+	return schema{tables: tables, indexes: indexes}
+}
+
+// sqliteSchema reads the schema of an opened SQLite database
+func sqliteSchema(t *testing.T, db *gorm.DB) schema {
+	var tableNames []string
+	require.NoError(t, db.Raw(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`).Scan(&tableNames).Error)
+	tables := map[string][]string{}
+	for _, table := range tableNames {
+		var columns []string
+		require.NoError(t, db.Raw(`SELECT name FROM pragma_table_info(?)`, table).Scan(&columns).Error)
+		sort.Strings(columns)
+		tables[table] = columns
+	}
+
+	// Indexes SQLite creates for primary keys have no SQL, and are covered by comparing the tables
+	var rows []struct {
+		Name string
+		SQL  string `gorm:"column:sql"`
+	}
+	require.NoError(t, db.Raw(`SELECT name, sql FROM sqlite_master WHERE type = 'index' AND sql IS NOT NULL`).Scan(&rows).Error)
+	indexes := map[string]string{}
+	for _, row := range rows {
+		match := createIndexPattern.FindStringSubmatch(strings.TrimSpace(row.SQL))
+		require.NotNil(t, match, row.SQL)
+		indexes[row.Name] = indexDefinition(match[1], match[3])
+	}
+	return schema{tables: tables, indexes: indexes}
+}
+
+// Test that the schema SQLite databases are created with has the tables, columns and indexes of the migrations
+func TestSQLiteSchema_MatchesMigrations(t *testing.T) {
+	migrated := migratedSchema(t)
+	sqlite := sqliteSchema(t, openSQLite(t))
+
+	assert.Equal(t, migrated.tables, sqlite.tables)
+	assert.Equal(t, migrated.indexes, sqlite.indexes)
+}
+
+// openSQLite opens a new database file, closed at the end of the test
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := repo.OpenSQLite(filepath.Join(t.TempDir(), "censys.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
@@ -0,0 +1,219 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServiceIndexRepo runs the contract of repo.ServiceIndexRepo. newRepos must return an empty SnapshotRepo and
+// a ServiceIndexRepo of its snapshots, and is called once per subtest.
+func TestServiceIndexRepo(t *testing.T, newRepos func(t *testing.T) (repo.SnapshotRepo, repo.ServiceIndexRepo)) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo)
+	}{
+		{"SearchLatest", testSearchLatest},
+		{"SearchAt", testSearchAt},
+		{"SearchFilters", testSearchFilters},
+		{"SearchPages", testSearchPages},
+		{"SearchVersionOrder", testSearchVersionOrder},
+		{"Reindex", testReindex},
+		{"RemovedWithSnapshot", testRemovedWithSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshotRepo, serviceIndex := newRepos(t)
+			tt.run(t, snapshotRepo, serviceIndex)
+		})
+	}
+}
+
+// index inserts a committed snapshot and indexes its services
+func index(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo, stored repo.Snapshot, records ...repo.ServiceRecord) {
+	t.Helper()
+	insert(t, snapshotRepo, stored)
+	require.NoError(t, serviceIndex.Index(context.Background(), stored.UUID, records))
+}
+
+func nginx(port int, version string) repo.ServiceRecord {
+	return repo.ServiceRecord{Port: port, Protocol: "HTTP", Vendor: "F5", Product: "nginx", Version: version}
+}
+
+func openSSH(version string) repo.ServiceRecord {
+	return repo.ServiceRecord{Port: 22, Protocol: "SSH", Vendor: "OpenBSD", Product: "OpenSSH", Version: version}
+}
+
+// found formats search results as "<host> <timestamp> <port>/<protocol> <version>"
+func found(t *testing.T, serviceIndex repo.ServiceIndexRepo, query repo.ServiceQuery) []string {
+	t.Helper()
+	records, err := serviceIndex.Search(context.Background(), query)
+	require.NoError(t, err)
+	result := []string{}
+	for _, record := range records {
+		result = append(result, fmt.Sprintf("%s %s %d/%s %s", record.Host_IP, record.Timestamp.Format(time.RFC3339), record.Port, record.Protocol, record.Version))
+	}
+	return result
+}
+
+func testSearchLatest(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo) {
+	ctx := context.Background()
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.1", jan1, "a"), nginx(80, "1.22.0"))
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.1", jan1.Add(time.Hour), "b"), nginx(80, "1.24.0"), openSSH("8.9"))
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.2", jan1, "c"), nginx(8080, "1.25.1"))
+	// Pending snapshots are not searched, the latest committed one is
+	pending := snapshot("10.0.0.2", jan1.Add(time.Hour), "d")
+	pending.Status = repo.StatusPending
+	index(t, snapshotRepo, serviceIndex, pending, openSSH("9.6"))
+
+	assert.Equal(t, []string{
+		"10.0.0.1 2025-01-01T13:00:00Z 22/SSH 8.9",
+		"10.0.0.1 2025-01-01T13:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.2 2025-01-01T12:00:00Z 8080/HTTP 1.25.1",
+	}, found(t, serviceIndex, repo.ServiceQuery{}))
+
+	// Once the latest snapshot is deleted, its host is searched as of the one before
+	latest, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1.Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, latest.UUID, jan1.Add(2*time.Hour)))
+	assert.Equal(t, []string{"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.22.0"}, found(t, serviceIndex, repo.ServiceQuery{Prefix: "10.0.0.1"}))
+
+	// Services of removed snapshots are not searched
+	require.NoError(t, snapshotRepo.Delete(ctx, latest.UUID))
+	first, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "10.0.0.1", jan1)
+	require.NoError(t, err)
+	require.NoError(t, snapshotRepo.Delete(ctx, first.UUID))
+	assert.Equal(t, []string{"10.0.0.2 2025-01-01T12:00:00Z 8080/HTTP 1.25.1"}, found(t, serviceIndex, repo.ServiceQuery{}))
+}
+
+func testSearchAt(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo) {
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.1", jan1, "a"), nginx(80, "1.22.0"))
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.1", jan1.Add(24*time.Hour), "b"), nginx(80, "1.24.0"))
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.2", jan1.Add(12*time.Hour), "c"), nginx(80, "1.25.1"))
+
+	assert.Equal(t, []string{"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.22.0"}, found(t, serviceIndex, repo.ServiceQuery{At: jan1.Add(time.Hour)}))
+	assert.Equal(t, []string{
+		"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.22.0",
+		"10.0.0.2 2025-01-02T00:00:00Z 80/HTTP 1.25.1",
+	}, found(t, serviceIndex, repo.ServiceQuery{At: jan1.Add(12 * time.Hour)}))
+	assert.Equal(t, []string{
+		"10.0.0.1 2025-01-02T12:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.2 2025-01-02T00:00:00Z 80/HTTP 1.25.1",
+	}, found(t, serviceIndex, repo.ServiceQuery{At: jan1.Add(24 * time.Hour)}))
+	assert.Empty(t, found(t, serviceIndex, repo.ServiceQuery{At: jan1.Add(-time.Hour)}))
+}
+
+func testSearchFilters(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo) {
+	tls := repo.ServiceRecord{Port: 443, Protocol: "HTTPS", Vendor: "F5", Product: "nginx", Version: "1.18.0", TLS_Version: "TLSv1.2"}
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.1", jan1, "a"), nginx(80, "1.18.0"), tls, openSSH("7.4"))
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.2", jan1, "b"), nginx(80, "1.24.0"), openSSH("9.6"))
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.3", jan1, "c"), repo.ServiceRecord{Port: 80, Protocol: "HTTP", Product: "nginx"})
+
+	ranges := func(text string) []version.Constraint {
+		constraints, err := version.ParseRange(text)
+		require.NoError(t, err)
+		return constraints
+	}
+	tests := []struct {
+		name     string
+		query    repo.ServiceQuery
+		expected []string
+	}{
+		{"port", repo.ServiceQuery{Port: 22}, []string{"10.0.0.1 2025-01-01T12:00:00Z 22/SSH 7.4", "10.0.0.2 2025-01-01T12:00:00Z 22/SSH 9.6"}},
+		{"protocol ignores case", repo.ServiceQuery{Protocol: "https"}, []string{"10.0.0.1 2025-01-01T12:00:00Z 443/HTTPS 1.18.0"}},
+		{"vendor", repo.ServiceQuery{Vendor: "openbsd", Port: 22, Prefix: "10.0.0.2"}, []string{"10.0.0.2 2025-01-01T12:00:00Z 22/SSH 9.6"}},
+		{"tls version", repo.ServiceQuery{TLSVersion: "tlsv1.2"}, []string{"10.0.0.1 2025-01-01T12:00:00Z 443/HTTPS 1.18.0"}},
+		{"version below", repo.ServiceQuery{Product: "NGINX", Versions: ranges("<1.24")}, []string{"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.18.0", "10.0.0.1 2025-01-01T12:00:00Z 443/HTTPS 1.18.0"}},
+		{"version range", repo.ServiceQuery{Versions: ranges(">=1.18,<=8")}, []string{"10.0.0.1 2025-01-01T12:00:00Z 22/SSH 7.4", "10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.18.0", "10.0.0.1 2025-01-01T12:00:00Z 443/HTTPS 1.18.0", "10.0.0.2 2025-01-01T12:00:00Z 80/HTTP 1.24.0"}},
+		{"version exact", repo.ServiceQuery{Versions: ranges("1.24")}, []string{"10.0.0.2 2025-01-01T12:00:00Z 80/HTTP 1.24.0"}},
+		{"all filters on one service", repo.ServiceQuery{Port: 80, Product: "OpenSSH"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, found(t, serviceIndex, tt.query))
+		})
+	}
+}
+
+// Test that versions are compared as by version.Compare, which a collation ignoring punctuation would not do
+func testSearchVersionOrder(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo) {
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.1", jan1, "a"), nginx(80, "1.10-ubuntu"))
+	index(t, snapshotRepo, serviceIndex, snapshot("10.0.0.2", jan1, "b"), nginx(80, "1.10.1"))
+
+	below, err := version.ParseRange("<1.10.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.10-ubuntu"}, found(t, serviceIndex, repo.ServiceQuery{Versions: below}))
+	above, err := version.ParseRange(">1.10-ubuntu")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2 2025-01-01T12:00:00Z 80/HTTP 1.10.1"}, found(t, serviceIndex, repo.ServiceQuery{Versions: above}))
+}
+
+func testSearchPages(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo) {
+	for i, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		services := []repo.ServiceRecord{nginx(80, "1.24.0"), nginx(8080, "1.24.0")}
+		if i == 2 {
+			services = []repo.ServiceRecord{openSSH("9.6")}
+		}
+		index(t, snapshotRepo, serviceIndex, snapshot(host, jan1, host), services...)
+	}
+
+	// Limit counts hosts with a matching service, and never splits a host's services
+	assert.Equal(t, []string{
+		"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.1 2025-01-01T12:00:00Z 8080/HTTP 1.24.0",
+		"10.0.0.2 2025-01-01T12:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.2 2025-01-01T12:00:00Z 8080/HTTP 1.24.0",
+	}, found(t, serviceIndex, repo.ServiceQuery{Product: "nginx", Limit: 2}))
+	assert.Equal(t, []string{
+		"10.0.0.4 2025-01-01T12:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.4 2025-01-01T12:00:00Z 8080/HTTP 1.24.0",
+	}, found(t, serviceIndex, repo.ServiceQuery{Product: "nginx", After: "10.0.0.2", Limit: 2}))
+	assert.Equal(t, []string{
+		"10.0.0.4 2025-01-01T12:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.4 2025-01-01T12:00:00Z 8080/HTTP 1.24.0",
+		"10.0.0.2 2025-01-01T12:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.2 2025-01-01T12:00:00Z 8080/HTTP 1.24.0",
+	}, found(t, serviceIndex, repo.ServiceQuery{Product: "nginx", Descending: true, Limit: 2}))
+	assert.Equal(t, []string{
+		"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.24.0",
+		"10.0.0.1 2025-01-01T12:00:00Z 8080/HTTP 1.24.0",
+	}, found(t, serviceIndex, repo.ServiceQuery{Product: "nginx", Descending: true, After: "10.0.0.2"}))
+}
+
+func testReindex(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo) {
+	ctx := context.Background()
+	stored := snapshot("10.0.0.1", jan1, "a")
+	index(t, snapshotRepo, serviceIndex, stored, nginx(80, "1.22.0"), openSSH("8.9"))
+
+	// Indexing a snapshot again replaces its services
+	require.NoError(t, serviceIndex.Index(ctx, stored.UUID, []repo.ServiceRecord{nginx(80, "1.24.0")}))
+	assert.Equal(t, []string{"10.0.0.1 2025-01-01T12:00:00Z 80/HTTP 1.24.0"}, found(t, serviceIndex, repo.ServiceQuery{}))
+
+	require.NoError(t, serviceIndex.Index(ctx, stored.UUID, nil))
+	assert.Empty(t, found(t, serviceIndex, repo.ServiceQuery{}))
+}
+
+func testRemovedWithSnapshot(t *testing.T, snapshotRepo repo.SnapshotRepo, serviceIndex repo.ServiceIndexRepo) {
+	ctx := context.Background()
+	committed := snapshot("10.0.0.1", jan1, "a")
+	index(t, snapshotRepo, serviceIndex, committed, nginx(80, "1.22.0"))
+	// Rolled back uploads remove their pending row
+	pending := snapshot("10.0.0.2", jan1, "b")
+	pending.Status = repo.StatusPending
+	index(t, snapshotRepo, serviceIndex, pending, openSSH("9.6"))
+
+	require.NoError(t, snapshotRepo.Delete(ctx, committed.UUID))
+	require.NoError(t, snapshotRepo.Delete(ctx, pending.UUID))
+
+	// Rows inserted again with the same ids have no services until they are indexed
+	committed.Status = repo.StatusCommitted
+	pending.Status = repo.StatusCommitted
+	insert(t, snapshotRepo, committed, pending)
+	assert.Empty(t, found(t, serviceIndex, repo.ServiceQuery{}))
+}
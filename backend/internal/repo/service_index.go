@@ -0,0 +1,207 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/version"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ServiceRecord is one service of a snapshot, as indexed for searching the fleet. Host_IP and Timestamp are those of
+// the snapshot, and are filled in by searches only. Version_Key is the version.Key of Version, set by Index.
+type ServiceRecord struct {
+	Snapshot_UUID uuid.UUID `json:"-" gorm:"column:snapshot_uuid"`
+	Host_IP       string    `json:"-" gorm:"column:host_ip;->"`
+	Timestamp     time.Time `json:"-" gorm:"column:timestamp;->"`
+	Port          int       `json:"port" gorm:"column:port"`
+	Protocol      string    `json:"protocol" gorm:"column:protocol"`
+	Vendor        string    `json:"vendor,omitempty" gorm:"column:vendor"`
+	Product       string    `json:"product,omitempty" gorm:"column:product"`
+	Version       string    `json:"version,omitempty" gorm:"column:version"`
+	Version_Key   string    `json:"-" gorm:"column:version_key"`
+	TLS_Version   string    `json:"tls_version,omitempty" gorm:"column:tls_version"`
+}
+
+func (ServiceRecord) TableName() string {
+	return "service_index"
+}
+
+// ServiceIndexRepo indexes the services of snapshots, so that hosts can be searched by what they run
+type ServiceIndexRepo interface {
+	Index(ctx context.Context, snapshotID uuid.UUID, records []ServiceRecord) error
+	Search(ctx context.Context, query ServiceQuery) ([]ServiceRecord, error)
+}
+
+// ServiceQuery selects the services of a page of hosts, ordered by IP as text. Each host is searched as of its
+// latest committed snapshot, or its latest at or before At, and only services matching every filter are returned.
+type ServiceQuery struct {
+	// Port keeps services on the port, 0 for any port
+	Port int
+	// Protocol, Vendor, Product and TLSVersion keep services with the value, compared case-insensitively. Empty
+	// matches any value.
+	Protocol   string
+	Vendor     string
+	Product    string
+	TLSVersion string
+	// Versions keeps services whose version matches every constraint. Services without a version match none.
+	Versions []version.Constraint
+	// At is the time to search the fleet as of. A zero time searches the latest snapshots.
+	At time.Time
+	// Prefix keeps hosts whose IP starts with it
+	Prefix string
+	// After is the last host of the previous page. The page starts after it in the sort order.
+	After      string
+	Descending bool
+	// Limit is the most hosts whose services are returned, 0 for no limit
+	Limit int
+}
+
+// matches reports whether an indexed service matches the filters of the query
+func (query ServiceQuery) matches(record ServiceRecord) bool {
+	if query.Port != 0 && record.Port != query.Port {
+		return false
+	}
+	for _, filter := range [][2]string{
+		{query.Protocol, record.Protocol},
+		{query.Vendor, record.Vendor},
+		{query.Product, record.Product},
+		{query.TLSVersion, record.TLS_Version},
+	} {
+		if filter[0] != "" && !strings.EqualFold(filter[0], filter[1]) {
+			return false
+		}
+	}
+	for _, constraint := range query.Versions {
+		if !constraint.Matches(record.Version) {
+			return false
+		}
+	}
+	return true
+}
+
+// versionOperators are the SQL operators of the version.Constraint operators
+var versionOperators = map[string]string{
+	version.OpEqual:        "=",
+	version.OpLess:         "<",
+	version.OpLessEqual:    "<=",
+	version.OpGreater:      ">",
+	version.OpGreaterEqual: ">=",
+}
+
+type serviceIndexRepo struct {
+	db *gorm.DB
+}
+
+// NewServiceIndexRepo creates the ServiceIndexRepo of a database with the service_index table. Indexed services are
+// removed with their snapshot row by the database.
+func NewServiceIndexRepo(db *gorm.DB) ServiceIndexRepo {
+	return &serviceIndexRepo{
+		db: db,
+	}
+}
+
+// Index replaces the indexed services of a snapshot with records
+func (ir *serviceIndexRepo) Index(ctx context.Context, snapshotID uuid.UUID, records []ServiceRecord) error {
+	rows := make([]ServiceRecord, 0, len(records))
+	for _, record := range records {
+		record.Snapshot_UUID = snapshotID
+		record.Version_Key = version.Key(record.Version)
+		rows = append(rows, record)
+	}
+	return ir.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("snapshot_uuid = ?", snapshotID).Delete(&ServiceRecord{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// Search finds the hosts of a page first, then their matching services, so that a host is never split across pages
+func (ir *serviceIndexRepo) Search(ctx context.Context, query ServiceQuery) ([]ServiceRecord, error) {
+	order := "s.host_ip"
+	if query.Descending {
+		order = "s.host_ip DESC"
+	}
+
+	hostsQuery, err := ir.matching(ctx, query)
+	if err != nil {
+		return []ServiceRecord{}, err
+	}
+	if query.After != "" {
+		if query.Descending {
+			hostsQuery = hostsQuery.Where("s.host_ip < ?", query.After)
+		} else {
+			hostsQuery = hostsQuery.Where("s.host_ip > ?", query.After)
+		}
+	}
+	if query.Limit > 0 {
+		hostsQuery = hostsQuery.Limit(query.Limit)
+	}
+	hosts := []string{}
+	if err := hostsQuery.Distinct("s.host_ip").Order(order).Pluck("s.host_ip", &hosts).Error; err != nil {
+		return []ServiceRecord{}, err
+	}
+	if len(hosts) == 0 {
+		return []ServiceRecord{}, nil
+	}
+
+	recordsQuery, err := ir.matching(ctx, query)
+	if err != nil {
+		return []ServiceRecord{}, err
+	}
+	records := []ServiceRecord{}
+	err = recordsQuery.Where("s.host_ip IN ?", hosts).
+		Select("si.*, s.host_ip, s.timestamp").
+		Order(order + ", si.port, si.protocol").
+		Find(&records).Error
+	if err != nil {
+		return []ServiceRecord{}, err
+	}
+	for i := range records {
+		records[i].Timestamp = records[i].Timestamp.UTC()
+	}
+	return records, nil
+}
+
+// matching selects the indexed services of the snapshots searched that match the filters of the query
+func (ir *serviceIndexRepo) matching(ctx context.Context, query ServiceQuery) (*gorm.DB, error) {
+	db := ir.db.WithContext(ctx).Table("service_index AS si").
+		Joins("JOIN snapshot AS s ON s.uuid = si.snapshot_uuid").
+		Where("s.status = ?", StatusCommitted)
+	if query.At.IsZero() {
+		db = db.Where("s.timestamp = (SELECT MAX(latest.timestamp) FROM snapshot AS latest WHERE latest.host_ip = s.host_ip AND latest.status = ?)", StatusCommitted)
+	} else {
+		db = db.Where("s.timestamp = (SELECT MAX(latest.timestamp) FROM snapshot AS latest WHERE latest.host_ip = s.host_ip AND latest.status = ? AND latest.timestamp <= ?)", StatusCommitted, query.At.UTC())
+	}
+	if query.Prefix != "" {
+		db = db.Where(`s.host_ip LIKE ? ESCAPE '\'`, escapeLike(query.Prefix)+"%")
+	}
+	if query.Port != 0 {
+		db = db.Where("si.port = ?", query.Port)
+	}
+	for _, filter := range [][2]string{
+		{"si.protocol", query.Protocol},
+		{"si.vendor", query.Vendor},
+		{"si.product", query.Product},
+		{"si.tls_version", query.TLSVersion},
+	} {
+		if filter[1] != "" {
+			db = db.Where("LOWER("+filter[0]+") = ?", strings.ToLower(filter[1]))
+		}
+	}
+	for _, constraint := range query.Versions {
+		operator, ok := versionOperators[constraint.Op]
+		if !ok {
+			return nil, fmt.Errorf("Unknown version operator %q", constraint.Op)
+		}
+		db = db.Where("si.version_key <> '' AND si.version_key "+operator+" ?", constraint.Key)
+	}
+	return db, nil
+}
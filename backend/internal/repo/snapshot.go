@@ -2,19 +2,53 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/endingwithali/2025censys/internal/compression"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
+// ErrNotFound is returned by lookups that match no row
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ErrDuplicate is returned when committing a snapshot would give a host two committed snapshots at one timestamp
+var ErrDuplicate = errors.New("Snapshot already exists for host and timestamp")
+
+// uniqueViolation is the Postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// Snapshot statuses. A row is inserted as pending before its blob is written, and marked committed once the blob
+// is durable, so lookups (which only return committed rows) never see a snapshot whose blob is missing or partial.
+// A deleted row is hidden from lookups like a pending one, and keeps its blob until it is purged.
+const (
+	StatusPending   = "pending"
+	StatusCommitted = "committed"
+	StatusDeleted   = "deleted"
+)
+
 // Snapshot model used by
+//
+// File_PWD is the content-addressed blob the snapshot is stored in, and may be shared by several snapshots with
+// identical content. File_Name is the name the snapshot was uploaded as. Content_Encoding is the codec the blob is
+// compressed with (see package compression), and the hashes and Size_Bytes are of the uncompressed content.
+// Deleted_At is set while the snapshot is soft deleted.
 type Snapshot struct {
-	UUID      uuid.UUID `json:"uuid" gorm:"column:uuid"`
-	Host_IP   string    `json:"host_ip" gorm:"column:host_ip"`
-	Timestamp time.Time `json:"timestamp" gorm:"column:timestamp"`
-	File_PWD  string    `json:"file_pwd" gorm:"column:file_pwd"`
-	File_Name string    `json:"file_name" gorm:"column:file_name"`
+	UUID             uuid.UUID  `json:"uuid" gorm:"column:uuid"`
+	Host_IP          string     `json:"host_ip" gorm:"column:host_ip"`
+	Timestamp        time.Time  `json:"timestamp" gorm:"column:timestamp"`
+	File_PWD         string     `json:"file_pwd" gorm:"column:file_pwd"`
+	File_Name        string     `json:"file_name" gorm:"column:file_name"`
+	Content_SHA256   string     `json:"content_sha256" gorm:"column:content_sha256"`
+	Size_Bytes       int64      `json:"size_bytes" gorm:"column:size_bytes"`
+	Canonical_SHA256 string     `json:"canonical_sha256" gorm:"column:canonical_sha256"`
+	Status           string     `json:"status" gorm:"column:status"`
+	Content_Encoding string     `json:"content_encoding" gorm:"column:content_encoding"`
+	Deleted_At       *time.Time `json:"deleted_at" gorm:"column:deleted_at"`
 }
 
 func (Snapshot) TableName() string {
@@ -22,11 +56,47 @@ func (Snapshot) TableName() string {
 }
 
 type SnapshotRepo interface {
-	Insert(ctx context.Context, host_ip string, timestap time.Time, file_pwd string, file_name string) error
+	Insert(ctx context.Context, snapshot Snapshot) error
+	MarkCommitted(ctx context.Context, id uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteWithStatus(ctx context.Context, id uuid.UUID, status string) error
+	SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error
+	Restore(ctx context.Context, id uuid.UUID) error
+	UpdateBlob(ctx context.Context, snapshot Snapshot) error
 	GetSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (Snapshot, error)
-	GetSnapshotByFileName(ctx context.Context, host_ip string, filename string) (Snapshot, error)
+	GetDeletedSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (Snapshot, error)
 	GetAllHosts(ctx context.Context) ([]string, error)
 	ListAllHostSnapshots(ctx context.Context, host_ip string) ([]string, error)
+	ListHosts(ctx context.Context, query HostQuery) ([]string, error)
+	ListHostSnapshots(ctx context.Context, host_ip string, query SnapshotQuery) ([]time.Time, error)
+	ListAll(ctx context.Context) ([]Snapshot, error)
+	CountBlobReferences(ctx context.Context, blobKey string) (int64, error)
+}
+
+// HostQuery selects a page of the hosts with committed snapshots, ordered by IP as text
+type HostQuery struct {
+	// Prefix keeps hosts whose IP starts with it
+	Prefix string
+	// Since and Until keep hosts with a snapshot in the range, inclusive. A zero time is unbounded.
+	Since time.Time
+	Until time.Time
+	// After is the last host of the previous page. The page starts after it in the sort order.
+	After      string
+	Descending bool
+	// Limit is the most hosts returned, 0 for no limit
+	Limit int
+}
+
+// SnapshotQuery selects a page of the committed snapshot timestamps of a host, ordered by timestamp
+type SnapshotQuery struct {
+	// Since and Until keep snapshots in the range, inclusive. A zero time is unbounded.
+	Since time.Time
+	Until time.Time
+	// After is the last timestamp of the previous page. The page starts after it in the sort order.
+	After      *time.Time
+	Descending bool
+	// Limit is the most timestamps returned, 0 for no limit
+	Limit int
 }
 
 type snapshotRepo struct {
@@ -39,24 +109,110 @@ func NewSnapshotRepo(db *gorm.DB) SnapshotRepo {
 	}
 }
 
-func (sr *snapshotRepo) Insert(ctx context.Context, host_ip string, timestamp time.Time, file_pwd string, file_name string) error {
+// Insert creates a snapshot row, generating its UUID if it is not set. Rows without a status are committed, and
+// rows without a content encoding are uncompressed.
+func (sr *snapshotRepo) Insert(ctx context.Context, snapshot Snapshot) error {
 	// TO DO: Handle duplicates being added to the db? What happens if duplicates are added with the same timestamps and host, but different json_data
-	snapshot := Snapshot{
-		UUID:      uuid.New(),
-		Host_IP:   host_ip,
-		Timestamp: timestamp,
-		File_PWD:  file_pwd,
-		File_Name: file_name,
-	}
-	err := sr.db.WithContext(ctx).Create(snapshot).Error
-	return err
+	if snapshot.UUID == uuid.Nil {
+		snapshot.UUID = uuid.New()
+	}
+	if snapshot.Status == "" {
+		snapshot.Status = StatusCommitted
+	}
+	if snapshot.Content_Encoding == "" {
+		snapshot.Content_Encoding = compression.Identity
+	}
+	snapshot.Timestamp = snapshot.Timestamp.UTC()
+	err := sr.db.WithContext(ctx).Create(&snapshot).Error
+	return translateError(err)
+}
+
+// MarkCommitted makes a pending snapshot visible to lookups. Returns ErrNotFound if there is no pending row with the id.
+func (sr *snapshotRepo) MarkCommitted(ctx context.Context, id uuid.UUID) error {
+	result := sr.db.WithContext(ctx).Model(&Snapshot{}).
+		Where("uuid = ? AND status = ?", id, StatusPending).
+		Update("status", StatusCommitted)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a snapshot row. Deleting a missing row is not an error.
+func (sr *snapshotRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return sr.db.WithContext(ctx).Where("uuid = ?", id).Delete(&Snapshot{}).Error
+}
+
+// DeleteWithStatus removes a snapshot row only while it has status, so a row restored or deleted since it was read
+// is kept. Returns ErrNotFound if there is no row with the id and status.
+func (sr *snapshotRepo) DeleteWithStatus(ctx context.Context, id uuid.UUID, status string) error {
+	result := sr.db.WithContext(ctx).Where("uuid = ? AND status = ?", id, status).Delete(&Snapshot{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SoftDelete hides a committed snapshot from lookups. Returns ErrNotFound if there is no committed row with the id.
+func (sr *snapshotRepo) SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	result := sr.db.WithContext(ctx).Model(&Snapshot{}).
+		Where("uuid = ? AND status = ?", id, StatusCommitted).
+		Updates(map[string]any{"status": StatusDeleted, "deleted_at": deletedAt.UTC()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Restore makes a soft deleted snapshot visible again. Returns ErrNotFound if there is no deleted row with the id.
+func (sr *snapshotRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	result := sr.db.WithContext(ctx).Model(&Snapshot{}).
+		Where("uuid = ? AND status = ?", id, StatusDeleted).
+		Updates(map[string]any{"status": StatusCommitted, "deleted_at": nil})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateBlob points a snapshot row at another blob, setting File_PWD, the hashes, Size_Bytes and Content_Encoding
+// from snapshot. Returns ErrNotFound if there is no row with snapshot.UUID.
+func (sr *snapshotRepo) UpdateBlob(ctx context.Context, snapshot Snapshot) error {
+	result := sr.db.WithContext(ctx).Model(&Snapshot{}).
+		Where("uuid = ?", snapshot.UUID).
+		Updates(map[string]any{
+			"file_pwd":         snapshot.File_PWD,
+			"content_sha256":   snapshot.Content_SHA256,
+			"size_bytes":       snapshot.Size_Bytes,
+			"canonical_sha256": snapshot.Canonical_SHA256,
+			"content_encoding": snapshot.Content_Encoding,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-func (sr *snapshotRepo) GetSnapshotByFileName(ctx context.Context, host_ip string, filename string) (Snapshot, error) {
+func (sr *snapshotRepo) GetSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (Snapshot, error) {
 	var snapshot Snapshot
 	err := sr.db.WithContext(ctx).Where(
-		"host_ip = ? AND File_PWD = ?",
-		host_ip, filename,
+		"host_ip = ? AND timestamp = ? AND status = ?",
+		host_ip, timestamp.UTC(), StatusCommitted,
 	).First(&snapshot).Error
 	if err != nil {
 		return snapshot, err
@@ -64,12 +220,13 @@ func (sr *snapshotRepo) GetSnapshotByFileName(ctx context.Context, host_ip strin
 	return snapshot, nil
 }
 
-func (sr *snapshotRepo) GetSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (Snapshot, error) {
+// GetDeletedSnapshotByTimeStamp returns the most recently deleted snapshot of a host at a timestamp
+func (sr *snapshotRepo) GetDeletedSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (Snapshot, error) {
 	var snapshot Snapshot
 	err := sr.db.WithContext(ctx).Where(
-		"host_ip = ? AND timestamp = ?",
-		host_ip, timestamp,
-	).First(&snapshot).Error
+		"host_ip = ? AND timestamp = ? AND status = ?",
+		host_ip, timestamp.UTC(), StatusDeleted,
+	).Order("deleted_at DESC").First(&snapshot).Error
 	if err != nil {
 		return snapshot, err
 	}
@@ -78,7 +235,7 @@ func (sr *snapshotRepo) GetSnapshotByTimeStamp(ctx context.Context, host_ip stri
 
 func (sr *snapshotRepo) GetAllHosts(ctx context.Context) ([]string, error) {
 	var hosts []string
-	err := sr.db.WithContext(ctx).Model(&Snapshot{}).Distinct("host_ip").Pluck("host_ip", &hosts).Error
+	err := sr.db.WithContext(ctx).Model(&Snapshot{}).Where("status = ?", StatusCommitted).Distinct("host_ip").Order("host_ip").Pluck("host_ip", &hosts).Error
 	if err != nil {
 		return []string{}, err
 	}
@@ -87,13 +244,109 @@ func (sr *snapshotRepo) GetAllHosts(ctx context.Context) ([]string, error) {
 
 func (sr *snapshotRepo) ListAllHostSnapshots(ctx context.Context, host_ip string) ([]string, error) {
 	var availSnapshots []Snapshot
-	err := sr.db.WithContext(ctx).Where("host_ip = ?", host_ip).Find(&availSnapshots).Error
+	err := sr.db.WithContext(ctx).Where("host_ip = ? AND status = ?", host_ip, StatusCommitted).Order("timestamp").Find(&availSnapshots).Error
 	if err != nil {
 		return []string{}, err
 	}
 	timestamps := make([]string, 0, len(availSnapshots))
 	for _, snapshot := range availSnapshots {
-		timestamps = append(timestamps, snapshot.Timestamp.Format(time.RFC3339))
+		timestamps = append(timestamps, snapshot.Timestamp.UTC().Format(time.RFC3339))
+	}
+	return timestamps, nil
+}
+
+func (sr *snapshotRepo) ListHosts(ctx context.Context, query HostQuery) ([]string, error) {
+	db := sr.db.WithContext(ctx).Model(&Snapshot{}).Where("status = ?", StatusCommitted)
+	if query.Prefix != "" {
+		db = db.Where(`host_ip LIKE ? ESCAPE '\'`, escapeLike(query.Prefix)+"%")
+	}
+	db = whereTimestampBetween(db, query.Since, query.Until)
+	order := "host_ip"
+	if query.Descending {
+		order = "host_ip DESC"
+		if query.After != "" {
+			db = db.Where("host_ip < ?", query.After)
+		}
+	} else if query.After != "" {
+		db = db.Where("host_ip > ?", query.After)
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	hosts := []string{}
+	if err := db.Distinct("host_ip").Order(order).Pluck("host_ip", &hosts).Error; err != nil {
+		return []string{}, err
+	}
+	return hosts, nil
+}
+
+func (sr *snapshotRepo) ListHostSnapshots(ctx context.Context, host_ip string, query SnapshotQuery) ([]time.Time, error) {
+	db := sr.db.WithContext(ctx).Where("host_ip = ? AND status = ?", host_ip, StatusCommitted)
+	db = whereTimestampBetween(db, query.Since, query.Until)
+	order := "timestamp"
+	if query.Descending {
+		order = "timestamp DESC"
+		if query.After != nil {
+			db = db.Where("timestamp < ?", query.After.UTC())
+		}
+	} else if query.After != nil {
+		db = db.Where("timestamp > ?", query.After.UTC())
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	var snapshots []Snapshot
+	if err := db.Select("timestamp").Order(order).Find(&snapshots).Error; err != nil {
+		return []time.Time{}, err
+	}
+	timestamps := make([]time.Time, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		timestamps = append(timestamps, snapshot.Timestamp.UTC())
 	}
 	return timestamps, nil
 }
+
+func whereTimestampBetween(db *gorm.DB, since time.Time, until time.Time) *gorm.DB {
+	if !since.IsZero() {
+		db = db.Where("timestamp >= ?", since.UTC())
+	}
+	if !until.IsZero() {
+		db = db.Where("timestamp <= ?", until.UTC())
+	}
+	return db
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with backslash as the escape character
+func escapeLike(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(pattern)
+}
+
+// ListAll returns every snapshot row, including pending and deleted ones, ordered by host and timestamp
+func (sr *snapshotRepo) ListAll(ctx context.Context) ([]Snapshot, error) {
+	var snapshots []Snapshot
+	err := sr.db.WithContext(ctx).Order("host_ip, timestamp").Find(&snapshots).Error
+	if err != nil {
+		return []Snapshot{}, err
+	}
+	return snapshots, nil
+}
+
+// CountBlobReferences counts the rows, including pending and deleted ones, whose File_PWD is blobKey
+func (sr *snapshotRepo) CountBlobReferences(ctx context.Context, blobKey string) (int64, error) {
+	var count int64
+	err := sr.db.WithContext(ctx).Model(&Snapshot{}).Where("file_pwd = ?", blobKey).Count(&count).Error
+	return count, err
+}
+
+// translateError turns a violation of the unique index on committed snapshots into ErrDuplicate. SQLite errors
+// are translated by gorm (see OpenSQLite).
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %s", ErrDuplicate, pgErr.Message)
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package repo_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,7 +10,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/endingwithali/2025censys/internal/compression"
 	r "github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/repo/migrations"
+	"github.com/endingwithali/2025censys/internal/repo/repotest"
 	"github.com/google/uuid"
 
 	// no service import; tests exercise repo behavior directly
@@ -20,10 +24,19 @@ import (
 
 var testDB *gorm.DB
 var snapRepo r.SnapshotRepo
+var diffRepo r.DifferenceRepo
 
 func TestMain(m *testing.M) {
 	testDB = setupTestDBConnection()
+	embedded, err := migrations.Embedded()
+	if err != nil {
+		log.Fatalf("Snapshot_TEST: Failed to load migrations: %v", err)
+	}
+	if _, err := migrations.NewMigrator(testDB, embedded).Up(context.Background()); err != nil {
+		log.Fatalf("Snapshot_TEST: Failed to migrate db: %v", err)
+	}
 	snapRepo = r.NewSnapshotRepo(testDB)
+	diffRepo = r.NewDifferenceRepo(testDB)
 	code := m.Run()
 	cleanUpDB()
 	os.Exit(code)
@@ -44,9 +57,28 @@ func cleanUpDB() {
 	// remove everything from the table snapshot
 	if testDB != nil {
 		testDB.Exec("TRUNCATE TABLE snapshot RESTART IDENTITY CASCADE;")
+		testDB.Exec("TRUNCATE TABLE snapshot_differences;")
 	}
 }
 
+// The Postgres repo must satisfy the contract shared with the in-memory and SQLite repos
+func TestSnapshot_Contract(t *testing.T) {
+	repotest.TestSnapshotRepo(t, func(t *testing.T) r.SnapshotRepo {
+		cleanUpDB()
+		return snapRepo
+	})
+	cleanUpDB()
+}
+
+func TestServiceIndex_Contract(t *testing.T) {
+	serviceIndex := r.NewServiceIndexRepo(testDB)
+	repotest.TestServiceIndexRepo(t, func(t *testing.T) (r.SnapshotRepo, r.ServiceIndexRepo) {
+		cleanUpDB()
+		return snapRepo, serviceIndex
+	})
+	cleanUpDB()
+}
+
 // Test creating a snapshot via the service layer using file from testfiles
 func TestSnapshot_Create(t *testing.T) {
 	ctx := context.Background()
@@ -76,7 +108,7 @@ func TestSnapshot_Create(t *testing.T) {
 	}
 	dst.Close()
 
-	if err := snapRepo.Insert(ctx, host, timestamp, dstPath, filename); err != nil {
+	if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: dstPath, File_Name: filename}); err != nil {
 		t.Fatalf("repo.Insert returned error: %v", err)
 	}
 
@@ -125,14 +157,14 @@ func TestSnapshot_CreateDuplicate(t *testing.T) {
 	dst.Close()
 
 	// first insert
-	if err := snapRepo.Insert(ctx, host, timestamp, dstPath, filename); err != nil {
+	if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: dstPath, File_Name: filename}); err != nil {
 		t.Fatalf("initial repo.Insert returned error: %v", err)
 	}
 
 	// second insert: repo.Insert currently does not check for duplicates, so behavior
 	// depends on DB constraints. We attempt a second insert and then check how many
 	// rows exist for the host/timestamp combination.
-	if err := snapRepo.Insert(ctx, host, timestamp, dstPath, filename); err != nil {
+	if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: dstPath, File_Name: filename}); err != nil {
 		// if DB prevents duplicate inserts, that's acceptable; assert that only one row exists
 		var snaps []r.Snapshot
 		_ = testDB.WithContext(ctx).Where("host_ip = ? AND timestamp = ?", host, timestamp).Find(&snaps).Error
@@ -180,7 +212,7 @@ func TestSnapshot_GetSnapshotByTimeStamp(t *testing.T) {
 	dst.Close()
 
 	// Insert the snapshot
-	if err := snapRepo.Insert(ctx, host, timestamp, dstPath, filename); err != nil {
+	if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: dstPath, File_Name: filename}); err != nil {
 		t.Fatalf("repo.Insert returned error: %v", err)
 	}
 
@@ -224,76 +256,6 @@ func TestSnapshot_GetSnapshotByTimeStamp_NotFound(t *testing.T) {
 	}
 }
 
-// Test GetSnapshotByFileName method
-func TestSnapshot_GetSnapshotByFileName(t *testing.T) {
-	ctx := context.Background()
-
-	// Setup: Insert a test snapshot first
-	testFileRel := filepath.Join("..", "repo", "testfiles", "host_125.199.235.74_2025-09-15T08-49-45Z.json")
-	f, err := os.Open(testFileRel)
-	if err != nil {
-		t.Fatalf("failed to open test file: %v", err)
-	}
-	defer f.Close()
-
-	filename := filepath.Base(testFileRel)
-	host := "125.199.235.74"
-	timestamp := parseTestTimestamp(t)
-	dstPath := filepath.Join(t.TempDir(), filename)
-
-	// Create the file
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		t.Fatalf("failed to create dst file: %v", err)
-	}
-	if _, err := dst.ReadFrom(f); err != nil {
-		dst.Close()
-		t.Fatalf("failed to copy file: %v", err)
-	}
-	dst.Close()
-
-	// Insert the snapshot
-	if err := snapRepo.Insert(ctx, host, timestamp, dstPath, filename); err != nil {
-		t.Fatalf("repo.Insert returned error: %v", err)
-	}
-
-	// Test: Get snapshot by filename (note: this uses File_PWD, not File_Name)
-	retrievedSnapshot, err := snapRepo.GetSnapshotByFileName(ctx, host, dstPath)
-	if err != nil {
-		t.Fatalf("GetSnapshotByFileName returned error: %v", err)
-	}
-
-	// Verify the retrieved snapshot
-	if retrievedSnapshot.Host_IP != host {
-		t.Errorf("expected host %s, got %s", host, retrievedSnapshot.Host_IP)
-	}
-	if !retrievedSnapshot.Timestamp.Equal(timestamp) {
-		t.Errorf("expected timestamp %v, got %v", timestamp, retrievedSnapshot.Timestamp)
-	}
-	if retrievedSnapshot.File_PWD != dstPath {
-		t.Errorf("expected file path %s, got %s", dstPath, retrievedSnapshot.File_PWD)
-	}
-	if retrievedSnapshot.File_Name != filename {
-		t.Errorf("expected filename %s, got %s", filename, retrievedSnapshot.File_Name)
-	}
-}
-
-// Test GetSnapshotByFileName with non-existent snapshot
-func TestSnapshot_GetSnapshotByFileName_NotFound(t *testing.T) {
-	ctx := context.Background()
-
-	host := "192.168.1.1"
-	filename := "/path/to/nonexistent.json"
-
-	_, err := snapRepo.GetSnapshotByFileName(ctx, host, filename)
-	if err == nil {
-		t.Error("expected error for non-existent snapshot, got nil")
-	}
-	if err != gorm.ErrRecordNotFound {
-		t.Errorf("expected gorm.ErrRecordNotFound, got %v", err)
-	}
-}
-
 // Test GetAllHosts method
 func TestSnapshot_GetAllHosts(t *testing.T) {
 	ctx := context.Background()
@@ -309,7 +271,7 @@ func TestSnapshot_GetAllHosts(t *testing.T) {
 			t.Fatalf("failed to create test file: %v", err)
 		}
 
-		if err := snapRepo.Insert(ctx, host, timestamp, filename, "test_"+host+".json"); err != nil {
+		if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: filename, File_Name: "test_" + host + ".json"}); err != nil {
 			t.Fatalf("repo.Insert returned error for host %s: %v", host, err)
 		}
 	}
@@ -374,7 +336,7 @@ func TestSnapshot_ListAllHostSnapshots(t *testing.T) {
 			t.Fatalf("failed to create test file: %v", err)
 		}
 
-		if err := snapRepo.Insert(ctx, host, timestamp, filename, fmt.Sprintf("test_%d.json", i)); err != nil {
+		if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: filename, File_Name: fmt.Sprintf("test_%d.json", i)}); err != nil {
 			t.Fatalf("repo.Insert returned error for timestamp %v: %v", timestamp, err)
 		}
 	}
@@ -430,7 +392,7 @@ func TestSnapshot_Insert_InvalidData(t *testing.T) {
 	ctx := context.Background()
 
 	// Test with empty host IP - this might succeed depending on DB constraints
-	err := snapRepo.Insert(ctx, "", time.Now(), "/tmp/test.json", "test.json")
+	err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: "", Timestamp: time.Now(), File_PWD: "/tmp/test.json", File_Name: "test.json"})
 	// We don't assert on this because it might succeed depending on DB constraints
 	if err != nil {
 		t.Logf("Insert with empty host IP failed as expected: %v", err)
@@ -438,7 +400,7 @@ func TestSnapshot_Insert_InvalidData(t *testing.T) {
 
 	// Test with invalid file path (this might not fail depending on DB constraints)
 	// but it's good to test the behavior
-	err = snapRepo.Insert(ctx, "192.168.1.1", time.Now(), "", "test.json")
+	err = snapRepo.Insert(ctx, r.Snapshot{Host_IP: "192.168.1.1", Timestamp: time.Now(), File_PWD: "", File_Name: "test.json"})
 	// We don't assert on this because it might succeed depending on DB constraints
 	_ = err
 }
@@ -464,7 +426,7 @@ func TestSnapshot_ConcurrentInserts(t *testing.T) {
 				return
 			}
 
-			err := snapRepo.Insert(ctx, host, timestamp.Add(time.Duration(index)*time.Second), filename, fmt.Sprintf("concurrent_test_%d.json", index))
+			err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp.Add(time.Duration(index) * time.Second), File_PWD: filename, File_Name: fmt.Sprintf("concurrent_test_%d.json", index)})
 			errorChan <- err
 		}(i)
 	}
@@ -508,7 +470,7 @@ func TestSnapshot_LongHostIP(t *testing.T) {
 		t.Fatalf("failed to create test file: %v", err)
 	}
 
-	err := snapRepo.Insert(ctx, longIP, timestamp, filename, "long_ip_test.json")
+	err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: longIP, Timestamp: timestamp, File_PWD: filename, File_Name: "long_ip_test.json"})
 	// This might succeed or fail depending on DB constraints
 	_ = err
 }
@@ -529,7 +491,7 @@ func TestSnapshot_SpecialCharactersInPath(t *testing.T) {
 		t.Fatalf("failed to create test file: %v", err)
 	}
 
-	err := snapRepo.Insert(ctx, host, timestamp, specialPath, filename)
+	err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: specialPath, File_Name: filename})
 	if err != nil {
 		t.Logf("Insert with special characters failed (might be expected): %v", err)
 	}
@@ -559,7 +521,7 @@ func TestSnapshot_UUIDGeneration(t *testing.T) {
 		t.Fatalf("failed to create test file: %v", err)
 	}
 
-	err := snapRepo.Insert(ctx, host, timestamp, filename, "uuid_test.json")
+	err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: host, Timestamp: timestamp, File_PWD: filename, File_Name: "uuid_test.json"})
 	if err != nil {
 		t.Fatalf("repo.Insert returned error: %v", err)
 	}
@@ -581,6 +543,174 @@ func TestSnapshot_UUIDGeneration(t *testing.T) {
 	}
 }
 
+// Test that pending snapshots are hidden from lookups until committed
+func TestSnapshot_PendingUntilCommitted(t *testing.T) {
+	cleanUpDB()
+	ctx := context.Background()
+
+	host := "10.0.0.1"
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	err := snapRepo.Insert(ctx, r.Snapshot{UUID: id, Host_IP: host, Timestamp: timestamp, File_PWD: "ab/pending.json", File_Name: "pending.json", Status: r.StatusPending})
+	if err != nil {
+		t.Fatalf("repo.Insert returned error: %v", err)
+	}
+
+	if _, err := snapRepo.GetSnapshotByTimeStamp(ctx, host, timestamp); !errors.Is(err, r.ErrNotFound) {
+		t.Fatalf("expected pending snapshot to be hidden, got %v", err)
+	}
+	hosts, err := snapRepo.GetAllHosts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllHosts returned error: %v", err)
+	}
+	if len(hosts) != 0 {
+		t.Errorf("expected no hosts while pending, got %v", hosts)
+	}
+
+	if err := snapRepo.MarkCommitted(ctx, id); err != nil {
+		t.Fatalf("MarkCommitted returned error: %v", err)
+	}
+	retrieved, err := snapRepo.GetSnapshotByTimeStamp(ctx, host, timestamp)
+	if err != nil {
+		t.Fatalf("GetSnapshotByTimeStamp returned error: %v", err)
+	}
+	if retrieved.Status != r.StatusCommitted {
+		t.Errorf("expected status %s, got %s", r.StatusCommitted, retrieved.Status)
+	}
+
+	// Committing twice is reported, since the row is no longer pending
+	if err := snapRepo.MarkCommitted(ctx, id); !errors.Is(err, r.ErrNotFound) {
+		t.Errorf("expected ErrNotFound committing a committed snapshot, got %v", err)
+	}
+}
+
+// Test deleting a snapshot row
+func TestSnapshot_Delete(t *testing.T) {
+	cleanUpDB()
+	ctx := context.Background()
+
+	host := "10.0.0.2"
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	if err := snapRepo.Insert(ctx, r.Snapshot{UUID: id, Host_IP: host, Timestamp: timestamp, File_PWD: "ab/delete.json", File_Name: "delete.json"}); err != nil {
+		t.Fatalf("repo.Insert returned error: %v", err)
+	}
+
+	if err := snapRepo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, err := snapRepo.GetSnapshotByTimeStamp(ctx, host, timestamp); !errors.Is(err, r.ErrNotFound) {
+		t.Errorf("expected deleted snapshot to be gone, got %v", err)
+	}
+	if err := snapRepo.Delete(ctx, id); err != nil {
+		t.Errorf("expected deleting a missing snapshot to succeed, got %v", err)
+	}
+}
+
+// Test that the content encoding is stored, and defaults to uncompressed
+func TestSnapshot_ContentEncoding(t *testing.T) {
+	cleanUpDB()
+	ctx := context.Background()
+
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: "10.0.0.3", Timestamp: timestamp, File_PWD: "ab/zstd.json.zst", File_Name: "zstd.json", Content_Encoding: compression.Zstd}); err != nil {
+		t.Fatalf("repo.Insert returned error: %v", err)
+	}
+	if err := snapRepo.Insert(ctx, r.Snapshot{Host_IP: "10.0.0.4", Timestamp: timestamp, File_PWD: "ab/plain.json", File_Name: "plain.json"}); err != nil {
+		t.Fatalf("repo.Insert returned error: %v", err)
+	}
+
+	for host, expected := range map[string]string{"10.0.0.3": compression.Zstd, "10.0.0.4": compression.Identity} {
+		retrieved, err := snapRepo.GetSnapshotByTimeStamp(ctx, host, timestamp)
+		if err != nil {
+			t.Fatalf("GetSnapshotByTimeStamp returned error: %v", err)
+		}
+		if retrieved.Content_Encoding != expected {
+			t.Errorf("expected content encoding %s for %s, got %s", expected, host, retrieved.Content_Encoding)
+		}
+	}
+}
+
+// Test soft deleting and restoring a snapshot
+func TestSnapshot_SoftDeleteAndRestore(t *testing.T) {
+	cleanUpDB()
+	ctx := context.Background()
+
+	host := "10.0.0.5"
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := timestamp.Add(time.Hour)
+	id := uuid.New()
+	if err := snapRepo.Insert(ctx, r.Snapshot{UUID: id, Host_IP: host, Timestamp: timestamp, File_PWD: "ab/soft.json", File_Name: "soft.json"}); err != nil {
+		t.Fatalf("repo.Insert returned error: %v", err)
+	}
+
+	if err := snapRepo.SoftDelete(ctx, id, deletedAt); !errors.Is(err, r.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a pending snapshot, got %v", err)
+	}
+	if err := snapRepo.MarkCommitted(ctx, id); err != nil {
+		t.Fatalf("MarkCommitted returned error: %v", err)
+	}
+	if err := snapRepo.SoftDelete(ctx, id, deletedAt); err != nil {
+		t.Fatalf("SoftDelete returned error: %v", err)
+	}
+	if _, err := snapRepo.GetSnapshotByTimeStamp(ctx, host, timestamp); !errors.Is(err, r.ErrNotFound) {
+		t.Errorf("expected deleted snapshot to be hidden, got %v", err)
+	}
+	deleted, err := snapRepo.GetDeletedSnapshotByTimeStamp(ctx, host, timestamp)
+	if err != nil {
+		t.Fatalf("GetDeletedSnapshotByTimeStamp returned error: %v", err)
+	}
+	if deleted.UUID != id || deleted.Deleted_At == nil || !deleted.Deleted_At.Equal(deletedAt) {
+		t.Errorf("unexpected deleted snapshot %+v", deleted)
+	}
+
+	if err := snapRepo.Restore(ctx, id); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+	restored, err := snapRepo.GetSnapshotByTimeStamp(ctx, host, timestamp)
+	if err != nil {
+		t.Fatalf("GetSnapshotByTimeStamp returned error: %v", err)
+	}
+	if restored.Deleted_At != nil {
+		t.Errorf("expected deleted_at to be cleared, got %v", restored.Deleted_At)
+	}
+	if err := snapRepo.Restore(ctx, id); !errors.Is(err, r.ErrNotFound) {
+		t.Errorf("expected ErrNotFound restoring a committed snapshot, got %v", err)
+	}
+}
+
+// Test that a host cannot have two committed snapshots at one timestamp
+func TestSnapshot_UniqueCommitted(t *testing.T) {
+	cleanUpDB()
+	ctx := context.Background()
+
+	host := "10.0.0.6"
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	first := uuid.New()
+	second := uuid.New()
+	if err := snapRepo.Insert(ctx, r.Snapshot{UUID: first, Host_IP: host, Timestamp: timestamp, File_PWD: "ab/first.json", File_Name: "first.json"}); err != nil {
+		t.Fatalf("repo.Insert returned error: %v", err)
+	}
+	// A pending row for the same host and timestamp is allowed, committing it is not
+	if err := snapRepo.Insert(ctx, r.Snapshot{UUID: second, Host_IP: host, Timestamp: timestamp, File_PWD: "ab/second.json", File_Name: "second.json", Status: r.StatusPending}); err != nil {
+		t.Fatalf("repo.Insert of pending duplicate returned error: %v", err)
+	}
+	if err := snapRepo.MarkCommitted(ctx, second); !errors.Is(err, r.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate committing a duplicate, got %v", err)
+	}
+
+	// Once the first is soft deleted the second can be committed, and the first can no longer be restored
+	if err := snapRepo.SoftDelete(ctx, first, time.Now()); err != nil {
+		t.Fatalf("SoftDelete returned error: %v", err)
+	}
+	if err := snapRepo.MarkCommitted(ctx, second); err != nil {
+		t.Fatalf("MarkCommitted returned error: %v", err)
+	}
+	if err := snapRepo.Restore(ctx, first); !errors.Is(err, r.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate restoring over a committed snapshot, got %v", err)
+	}
+}
+
 // helper: parse the timestamp used in test filename
 func parseTestTimestamp(t *testing.T) (ts time.Time) {
 	t.Helper()
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// sqliteSchema is the schema of package migrations for SQLite. SQLite databases are for development and have no
+// migration history, the tables and indexes are created when missing each time the database is opened. A migration
+// must be mirrored here; TestSQLiteSchema_MatchesMigrations in package repotest fails until the tables, columns and
+// indexes agree.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS snapshot (
+    uuid                TEXT PRIMARY KEY,
+    timestamp           DATETIME NOT NULL,
+    host_ip             TEXT NOT NULL,
+    file_pwd            TEXT NOT NULL,
+    file_name           TEXT NOT NULL,
+    content_sha256      TEXT NOT NULL DEFAULT '',
+    size_bytes          INTEGER NOT NULL DEFAULT 0,
+    canonical_sha256    TEXT NOT NULL DEFAULT '',
+    status              TEXT NOT NULL DEFAULT 'committed',
+    content_encoding    TEXT NOT NULL DEFAULT 'identity',
+    deleted_at          DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS snapshot_content_sha256_idx ON snapshot (content_sha256);
+CREATE UNIQUE INDEX IF NOT EXISTS snapshot_host_ip_timestamp_committed_idx ON snapshot (host_ip, timestamp) WHERE status = 'committed';
+
+CREATE TABLE IF NOT EXISTS snapshot_differences (
+    host_ip     TEXT NOT NULL,
+    timestamp1  DATETIME NOT NULL,
+    timestamp2  DATETIME NOT NULL,
+    json_data   TEXT NOT NULL,
+    PRIMARY KEY (host_ip, timestamp1, timestamp2)
+);
+
+CREATE INDEX IF NOT EXISTS snapshot_differences_timestamp2_idx ON snapshot_differences (host_ip, timestamp2);
+
+CREATE TABLE IF NOT EXISTS service_index (
+    snapshot_uuid   TEXT NOT NULL REFERENCES snapshot (uuid) ON DELETE CASCADE,
+    port            INTEGER NOT NULL,
+    protocol        TEXT NOT NULL DEFAULT '',
+    vendor          TEXT NOT NULL DEFAULT '',
+    product         TEXT NOT NULL DEFAULT '',
+    version         TEXT NOT NULL DEFAULT '',
+    version_key     TEXT COLLATE BINARY NOT NULL DEFAULT '',
+    tls_version     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS service_index_snapshot_uuid_idx ON service_index (snapshot_uuid);
+CREATE INDEX IF NOT EXISTS service_index_port_idx ON service_index (port);
+CREATE INDEX IF NOT EXISTS service_index_product_idx ON service_index (LOWER(product));
+`
+
+// OpenSQLite opens the SQLite database file at path, creating it and its tables if needed, for use with
+// NewSnapshotRepo, NewDifferenceRepo and NewServiceIndexRepo. A path of ":memory:" keeps the database in memory.
+//
+// The driver is pure Go, so no C toolchain or database server is needed. Writes are serialised over one connection.
+// Foreign keys are enforced, so indexed services are removed with their snapshot as in Postgres.
+func OpenSQLite(path string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(path+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// Each connection to ":memory:" would be a separate database
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Exec(sqliteSchema).Error; err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import "sync"
+
+// blobLocks serializes the uploads and removals of each blob key, so that a blob is never removed between an upload
+// finding it and the upload's row referencing it. The zero value is ready to use.
+type blobLocks struct {
+	mu    sync.Mutex
+	locks map[string]*blobLock
+}
+
+type blobLock struct {
+	sync.Mutex
+	// holders counts the callers holding or waiting for the lock, so it is dropped from the map once unused
+	holders int
+}
+
+// lock locks key and returns the function that unlocks it
+func (locks *blobLocks) lock(key string) func() {
+	locks.mu.Lock()
+	if locks.locks == nil {
+		locks.locks = map[string]*blobLock{}
+	}
+	keyLock, ok := locks.locks[key]
+	if !ok {
+		keyLock = &blobLock{}
+		locks.locks[key] = keyLock
+	}
+	keyLock.holders++
+	locks.mu.Unlock()
+
+	keyLock.Lock()
+	return func() {
+		keyLock.Unlock()
+		locks.mu.Lock()
+		keyLock.holders--
+		if keyLock.holders == 0 {
+			delete(locks.locks, key)
+		}
+		locks.mu.Unlock()
+	}
+}
@@ -1,49 +1,234 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"os"
+	"log"
 
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/diff"
+	"github.com/endingwithali/2025censys/internal/model"
+	"github.com/endingwithali/2025censys/internal/repo"
 	"github.com/nsf/jsondiff"
 )
 
 type DifferencesService struct {
-	// if reading from db, would add here
+	differenceRepo repo.DifferenceRepo
+	blobStore      blobstore.BlobStore
 }
 
-func NewDifferencesServicet() *DifferencesService {
-	return &DifferencesService{}
+// NewDifferencesServicet creates the differences service. differenceRepo may be nil, in which case
+// differences are always computed and never cached.
+func NewDifferencesServicet(differenceRepo repo.DifferenceRepo, blobStore blobstore.BlobStore) *DifferencesService {
+	return &DifferencesService{
+		differenceRepo: differenceRepo,
+		blobStore:      blobStore,
+	}
+}
+
+// cachedDifference is the shape stored in snapshot_differences.json_data
+type cachedDifference struct {
+	DiffStatus  string
+	Differences string
+	Changes     []diff.Change
 }
 
-// GetDifferences reads files from disk and creates a difference between them
+// GetDifferences creates a difference between two snapshots of a host, using the stored difference if one exists
 //
-// Summary: Reads files from disk and compares them using github.com/nsf/jsondiff
+// Summary: Reads files from the blob store and compares them using github.com/nsf/jsondiff, and semantically
+// using the host snapshot shape (services matched by port+protocol). The result is stored in
+// snapshot_differences, since snapshots never change once created.
 // Path Params:
-//   - file1path: string (path to file 1)
-//   - file2path: string (path to file 2)
+//   - snapshot1: repo.Snapshot (snapshot at t1)
+//   - snapshot2: repo.Snapshot (snapshot at t2)
 //
 // Responses:
 //   - string: difference between the two files {diffStatus": "FullMatch"|"SupersetMatch"|"NoMatch"|"FirstArgIsInvalidJson"|"SecondArgIsInvalidJson"|"BothArgsAreInvalidJson"|"Invalid"|"" if error occurs}
 //   - string: explanation of the difference {Color Coded Differences String | "" if error occurs}
+//   - []diff.Change: typed changes from file1 to file2 {nil if either file is not a valid host snapshot}
 //   - error: error if the files cannot be read {nil | error}
-func (service *DifferencesService) GetDifferences(file1Path string, file2Path string) (string, string, error) {
-	// Read both files
-	file1, err := os.ReadFile(file1Path)
+func (service *DifferencesService) GetDifferences(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) (string, string, []diff.Change, error) {
+	if cached, ok := service.checkCache(ctx, snapshot1, snapshot2); ok {
+		return cached.DiffStatus, cached.Differences, cached.Changes, nil
+	}
+
+	file1, file2, err := service.readSnapshotFiles(ctx, snapshot1, snapshot2)
 	if err != nil {
-		// Do not include file path in response to protect against domain traversal attempts!!
-		return "", "", fmt.Errorf("Failed to read contents of file1: %v", err.Error())
+		return "", "", nil, err
+	}
+
+	opts := jsondiff.DefaultConsoleOptions()
+	status, explanation := jsondiff.Compare(file1, file2, &opts)
+	result := cachedDifference{
+		DiffStatus:  status.String(),
+		Differences: explanation,
+		Changes:     compareHostSnapshots(file1, file2),
+	}
+	service.storeCache(ctx, snapshot1, snapshot2, result)
+	return result.DiffStatus, result.Differences, result.Changes, nil
+
+}
+
+// checkCache returns the stored difference for snapshot1 -> snapshot2. Lookup failures are logged and
+// treated as a miss so that a cache problem never fails a diff request.
+func (service *DifferencesService) checkCache(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) (cachedDifference, bool) {
+	if service.differenceRepo == nil {
+		return cachedDifference{}, false
+	}
+	stored, found, err := service.differenceRepo.CheckForComparison(ctx, snapshot1.Host_IP, snapshot1.Timestamp, snapshot2.Timestamp)
+	if err != nil {
+		log.Printf("GetDifferences: Failed to check for stored difference: %v", err)
+		return cachedDifference{}, false
+	}
+	if !found {
+		return cachedDifference{}, false
+	}
+	var cached cachedDifference
+	if err := json.Unmarshal([]byte(stored.JSON_Data), &cached); err != nil {
+		log.Printf("GetDifferences: Ignoring unreadable stored difference: %v", err)
+		return cachedDifference{}, false
+	}
+	return cached, true
+}
+
+func (service *DifferencesService) storeCache(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot, result cachedDifference) {
+	if service.differenceRepo == nil {
+		return
 	}
-	file2, err := os.ReadFile(file2Path)
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("GetDifferences: Failed to encode difference for storage: %v", err)
+		return
+	}
+	err = service.differenceRepo.Insert(ctx, repo.Differences{
+		Host_IP:    snapshot1.Host_IP,
+		Timestamp1: snapshot1.Timestamp,
+		Timestamp2: snapshot2.Timestamp,
+		JSON_Data:  string(data),
+	})
+	if err != nil {
+		log.Printf("GetDifferences: Failed to store difference: %v", err)
+	}
+}
+
+// GetJSONPatch reads files from the blob store and creates an RFC 6902 JSON Patch that turns snapshot 1 into snapshot 2
+//
+// Path Params:
+//   - snapshot1: repo.Snapshot (snapshot at t1)
+//   - snapshot2: repo.Snapshot (snapshot at t2)
+//
+// Responses:
+//   - []diff.PatchOperation: ordered patch operations {empty if the files are equal}
+//   - error: error if the files cannot be read or are not valid JSON {nil | error}
+func (service *DifferencesService) GetJSONPatch(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) ([]diff.PatchOperation, error) {
+	file1, file2, err := service.readSnapshotFiles(ctx, snapshot1, snapshot2)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to read contents of file2: %v", err.Error())
+		return nil, err
 	}
+	return diff.JSONPatch(file1, file2)
+}
 
+// GetMergePatch reads files from the blob store and creates an RFC 7396 JSON Merge Patch that turns snapshot 1 into snapshot 2
+//
+// Path Params:
+//   - snapshot1: repo.Snapshot (snapshot at t1)
+//   - snapshot2: repo.Snapshot (snapshot at t2)
+//
+// Responses:
+//   - json.RawMessage: merge patch document {{} if the files are equal}
+//   - error: error if the files cannot be read or are not valid JSON {nil | error}
+func (service *DifferencesService) GetMergePatch(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) (json.RawMessage, error) {
+	file1, file2, err := service.readSnapshotFiles(ctx, snapshot1, snapshot2)
+	if err != nil {
+		return nil, err
+	}
+	return diff.MergePatch(file1, file2)
+}
+
+// CompareHosts compares snapshots of any two hosts, or of one host, ignoring diff.IdentityFields
+//
+// Summary: As GetDifferences, but the fields saying which host a snapshot is of and when it was taken are removed
+// before comparing, so snapshots of identically configured hosts are a FullMatch. The result is not stored, since
+// stored differences belong to a single host.
+// Path Params:
+//   - snapshot1: repo.Snapshot (first snapshot)
+//   - snapshot2: repo.Snapshot (second snapshot)
+//
+// Responses:
+//   - string: difference between the two files, as for GetDifferences
+//   - string: explanation of the difference {Color Coded Differences String}
+//   - []diff.Change: typed changes from file1 to file2 {nil if either file is not a valid host snapshot}
+//   - error: error if the files cannot be read {nil | error}
+func (service *DifferencesService) CompareHosts(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) (string, string, []diff.Change, error) {
+	file1, file2, err := service.readComparableFiles(ctx, snapshot1, snapshot2)
+	if err != nil {
+		return "", "", nil, err
+	}
 	opts := jsondiff.DefaultConsoleOptions()
-	diff, explanation := jsondiff.Compare(file1, file2, &opts)
-	return diff.String(), explanation, nil
+	status, explanation := jsondiff.Compare(file1, file2, &opts)
+	return status.String(), explanation, compareHostSnapshots(file1, file2), nil
+}
 
+// CompareHostsJSONPatch creates an RFC 6902 JSON Patch between snapshots of any two hosts, ignoring diff.IdentityFields
+//
+// Responses:
+//   - []diff.PatchOperation: ordered patch operations {empty if the files are equal but for their identity}
+//   - error: error if the files cannot be read or are not valid JSON {nil | error}
+func (service *DifferencesService) CompareHostsJSONPatch(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) ([]diff.PatchOperation, error) {
+	file1, file2, err := service.readComparableFiles(ctx, snapshot1, snapshot2)
+	if err != nil {
+		return nil, err
+	}
+	return diff.JSONPatch(file1, file2)
 }
 
-// Excluded Functionality:
-// - writing checked differences to db
-// - checking if difference already exists
+// CompareHostsMergePatch creates an RFC 7396 JSON Merge Patch between snapshots of any two hosts, ignoring
+// diff.IdentityFields
+//
+// Responses:
+//   - json.RawMessage: merge patch document {{} if the files are equal but for their identity}
+//   - error: error if the files cannot be read or are not valid JSON {nil | error}
+func (service *DifferencesService) CompareHostsMergePatch(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) (json.RawMessage, error) {
+	file1, file2, err := service.readComparableFiles(ctx, snapshot1, snapshot2)
+	if err != nil {
+		return nil, err
+	}
+	return diff.MergePatch(file1, file2)
+}
+
+// readComparableFiles reads the contents of both snapshots without their diff.IdentityFields
+func (service *DifferencesService) readComparableFiles(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) ([]byte, []byte, error) {
+	file1, file2, err := service.readSnapshotFiles(ctx, snapshot1, snapshot2)
+	if err != nil {
+		return nil, nil, err
+	}
+	return diff.WithoutFields(file1, diff.IdentityFields...), diff.WithoutFields(file2, diff.IdentityFields...), nil
+}
+
+// readSnapshotFiles reads the contents of both snapshots, decompressing them if they are stored compressed
+func (service *DifferencesService) readSnapshotFiles(ctx context.Context, snapshot1 repo.Snapshot, snapshot2 repo.Snapshot) ([]byte, []byte, error) {
+	file1, err := readSnapshotContents(ctx, service.blobStore, snapshot1)
+	if err != nil {
+		// Do not include file path in response to protect against domain traversal attempts!!
+		return nil, nil, fmt.Errorf("Failed to read contents of file1: %v", err.Error())
+	}
+	file2, err := readSnapshotContents(ctx, service.blobStore, snapshot2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read contents of file2: %v", err.Error())
+	}
+	return file1, file2, nil
+}
+
+// compareHostSnapshots decodes both files as host snapshots and returns the semantic changes between them.
+// Files that do not decode are already reported through the jsondiff status, so nil is returned for them.
+func compareHostSnapshots(file1 []byte, file2 []byte) []diff.Change {
+	var snapshot1, snapshot2 model.HostSnapshot
+	if err := json.Unmarshal(file1, &snapshot1); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(file2, &snapshot2); err != nil {
+		return nil
+	}
+	return diff.Compare(snapshot1, snapshot2)
+}
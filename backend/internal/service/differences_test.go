@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/diff"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockDifferenceRepo implements the DifferenceRepo interface for testing
+type MockDifferenceRepo struct {
+	mock.Mock
+}
+
+func (m *MockDifferenceRepo) Insert(ctx context.Context, difference repo.Differences) error {
+	args := m.Called(ctx, difference)
+	return args.Error(0)
+}
+
+func (m *MockDifferenceRepo) CheckForComparison(ctx context.Context, host_ip string, timestamp1 time.Time, timestamp2 time.Time) (repo.Differences, bool, error) {
+	args := m.Called(ctx, host_ip, timestamp1, timestamp2)
+	return args.Get(0).(repo.Differences), args.Bool(1), args.Error(2)
+}
+
+func (m *MockDifferenceRepo) DeleteForSnapshot(ctx context.Context, host_ip string, timestamp time.Time) error {
+	args := m.Called(ctx, host_ip, timestamp)
+	return args.Error(0)
+}
+
+func TestDifferencesService_GetDifferences(t *testing.T) {
+	time1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	time2 := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	cached := `{"DiffStatus":"NoMatch","Differences":"cached","Changes":[{"type":"service_added","port":80,"protocol":"HTTP"}]}`
+
+	tests := []struct {
+		name                string
+		stored              repo.Differences
+		found               bool
+		checkError          error
+		expectInsert        bool
+		expectedDifferences string
+		expectedChanges     []diff.ChangeType
+	}{
+		{
+			name:                "stored difference is returned without reading files",
+			stored:              repo.Differences{JSON_Data: cached},
+			found:               true,
+			expectedDifferences: "cached",
+			expectedChanges:     []diff.ChangeType{diff.ServiceAdded},
+		},
+		{
+			name:            "missing difference is computed and stored",
+			found:           false,
+			expectInsert:    true,
+			expectedChanges: []diff.ChangeType{diff.SoftwareChanged},
+		},
+		{
+			name:            "lookup error falls back to computing",
+			checkError:      fmt.Errorf("database error"),
+			expectInsert:    true,
+			expectedChanges: []diff.ChangeType{diff.SoftwareChanged},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			ctx := context.Background()
+			blobStore := blobstore.NewMemoryStore()
+			require.NoError(t, blobStore.Put(ctx, "file1.json", strings.NewReader(`{"services": [{"port": 80, "protocol": "HTTP", "software": {"version": "1"}}]}`)))
+			require.NoError(t, blobStore.Put(ctx, "file2.json", strings.NewReader(`{"services": [{"port": 80, "protocol": "HTTP", "software": {"version": "2"}}]}`)))
+			snapshot1 := repo.Snapshot{Host_IP: "192.168.1.1", Timestamp: time1, File_PWD: "file1.json"}
+			snapshot2 := repo.Snapshot{Host_IP: "192.168.1.1", Timestamp: time2, File_PWD: "file2.json"}
+
+			mockRepo := &MockDifferenceRepo{}
+			service := NewDifferencesServicet(mockRepo, blobStore)
+
+			mockRepo.On("CheckForComparison", ctx, "192.168.1.1", time1, time2).Return(tt.stored, tt.found, tt.checkError)
+			if tt.expectInsert {
+				mockRepo.On("Insert", ctx, mock.MatchedBy(func(difference repo.Differences) bool {
+					var stored cachedDifference
+					return difference.Host_IP == "192.168.1.1" &&
+						difference.Timestamp1.Equal(time1) &&
+						difference.Timestamp2.Equal(time2) &&
+						json.Unmarshal([]byte(difference.JSON_Data), &stored) == nil &&
+						stored.DiffStatus == "NoMatch"
+				})).Return(nil)
+			}
+
+			// Test
+			status, differences, changes, err := service.GetDifferences(ctx, snapshot1, snapshot2)
+
+			// Assertions
+			require.NoError(t, err)
+			assert.Equal(t, "NoMatch", status)
+			if tt.expectedDifferences != "" {
+				assert.Equal(t, tt.expectedDifferences, differences)
+			}
+			changeTypes := []diff.ChangeType{}
+			for _, change := range changes {
+				changeTypes = append(changeTypes, change.Type)
+			}
+			assert.Equal(t, tt.expectedChanges, changeTypes)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDifferencesService_GetDifferences_NoRepo(t *testing.T) {
+	service := NewDifferencesServicet(nil, blobstore.NewMemoryStore())
+
+	_, _, _, err := service.GetDifferences(context.Background(), repo.Snapshot{File_PWD: "nonexistent1.json"}, repo.Snapshot{File_PWD: "nonexistent2.json"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to read contents of file1")
+}
+
+func TestDifferencesService_CompressedSnapshots(t *testing.T) {
+	ctx := context.Background()
+	blobStore := blobstore.NewMemoryStore()
+	file1 := `{"services": [{"port": 80, "protocol": "HTTP", "software": {"version": "1"}}]}`
+	file2 := `{"services": [{"port": 80, "protocol": "HTTP", "software": {"version": "2"}}]}`
+	gzipped, err := compression.Compress(compression.Gzip, []byte(file1))
+	require.NoError(t, err)
+	zstded, err := compression.Compress(compression.Zstd, []byte(file2))
+	require.NoError(t, err)
+	require.NoError(t, blobStore.Put(ctx, "file1.json.gz", bytes.NewReader(gzipped)))
+	require.NoError(t, blobStore.Put(ctx, "file2.json.zst", bytes.NewReader(zstded)))
+	require.NoError(t, blobStore.Put(ctx, "file1.json", strings.NewReader(file1)))
+	require.NoError(t, blobStore.Put(ctx, "file2.json", strings.NewReader(file2)))
+	service := NewDifferencesServicet(nil, blobStore)
+
+	compressed1 := repo.Snapshot{File_PWD: "file1.json.gz", Content_Encoding: compression.Gzip}
+	compressed2 := repo.Snapshot{File_PWD: "file2.json.zst", Content_Encoding: compression.Zstd}
+	plain1 := repo.Snapshot{File_PWD: "file1.json"}
+	plain2 := repo.Snapshot{File_PWD: "file2.json", Content_Encoding: compression.Identity}
+
+	status, differences, changes, err := service.GetDifferences(ctx, compressed1, compressed2)
+	require.NoError(t, err)
+	expectedStatus, expectedDifferences, expectedChanges, err := service.GetDifferences(ctx, plain1, plain2)
+	require.NoError(t, err)
+	assert.Equal(t, expectedStatus, status)
+	assert.Equal(t, expectedDifferences, differences)
+	assert.Equal(t, expectedChanges, changes)
+
+	patch, err := service.GetJSONPatch(ctx, compressed1, plain2)
+	require.NoError(t, err)
+	require.Len(t, patch, 1)
+	assert.Equal(t, "replace", patch[0].Op)
+	assert.Equal(t, "/services/0/software/version", patch[0].Path)
+}
+
+func TestDifferencesService_CompareHosts(t *testing.T) {
+	ctx := context.Background()
+	blobStore := blobstore.NewMemoryStore()
+	files := map[string]string{
+		"replica1.json": `{"ip": "10.0.0.1", "timestamp": "2025-01-01T12:00:00Z", "services": [{"port": 80, "protocol": "HTTP", "software": {"version": "1"}}]}`,
+		"replica2.json": `{"ip": "10.0.0.2", "timestamp": "2025-01-01T12:05:00Z", "services": [{"port": 80, "protocol": "HTTP", "software": {"version": "1"}}]}`,
+		"replica3.json": `{"ip": "10.0.0.3", "timestamp": "2025-01-01T12:10:00Z", "services": [{"port": 80, "protocol": "HTTP", "software": {"version": "2"}}]}`,
+	}
+	for name, contents := range files {
+		require.NoError(t, blobStore.Put(ctx, name, strings.NewReader(contents)))
+	}
+	replica1 := repo.Snapshot{Host_IP: "10.0.0.1", File_PWD: "replica1.json"}
+	replica2 := repo.Snapshot{Host_IP: "10.0.0.2", File_PWD: "replica2.json"}
+	replica3 := repo.Snapshot{Host_IP: "10.0.0.3", File_PWD: "replica3.json"}
+	// Cross-host comparisons are never stored, so the repo must not be used
+	service := NewDifferencesServicet(&MockDifferenceRepo{}, blobStore)
+
+	status, _, changes, err := service.CompareHosts(ctx, replica1, replica2)
+	require.NoError(t, err)
+	assert.Equal(t, "FullMatch", status)
+	assert.Empty(t, changes)
+
+	status, _, changes, err = service.CompareHosts(ctx, replica1, replica3)
+	require.NoError(t, err)
+	assert.Equal(t, "NoMatch", status)
+	require.Len(t, changes, 1)
+	assert.Equal(t, diff.SoftwareChanged, changes[0].Type)
+
+	patch, err := service.CompareHostsJSONPatch(ctx, replica1, replica2)
+	require.NoError(t, err)
+	assert.Empty(t, patch)
+	patch, err = service.CompareHostsJSONPatch(ctx, replica1, replica3)
+	require.NoError(t, err)
+	require.Len(t, patch, 1)
+	assert.Equal(t, "/services/0/software/version", patch[0].Path)
+
+	merge, err := service.CompareHostsMergePatch(ctx, replica1, replica2)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(merge))
+
+	_, _, _, err = service.CompareHosts(ctx, replica1, repo.Snapshot{File_PWD: "nonexistent.json"})
+	assert.ErrorContains(t, err, "Failed to read contents of file2")
+}
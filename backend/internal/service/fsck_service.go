@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
+)
+
+// QuarantinePrefix is the blob key prefix broken blobs are moved under. Quarantined blobs are not checked.
+const QuarantinePrefix = "quarantine/"
+
+// FsckIssueKind is the kind of inconsistency found between the blob store and the snapshot table
+type FsckIssueKind string
+
+const (
+	// IssueOrphanBlob is a blob that no snapshot row references
+	IssueOrphanBlob FsckIssueKind = "orphan_blob"
+	// IssueDanglingRow is a committed snapshot row whose blob does not exist
+	IssueDanglingRow FsckIssueKind = "dangling_row"
+	// IssuePendingRow is a snapshot row left pending by an upload that never finished
+	IssuePendingRow FsckIssueKind = "pending_row"
+	// IssueHashMismatch is a blob whose SHA-256 differs from its key or from the rows referencing it
+	IssueHashMismatch FsckIssueKind = "hash_mismatch"
+	// IssueUnparseable is a blob that is not valid JSON
+	IssueUnparseable FsckIssueKind = "unparseable"
+	// IssueLegacyRow is a snapshot row written before snapshots were stored by content, see IsLegacy
+	IssueLegacyRow FsckIssueKind = "legacy_row"
+)
+
+type FsckIssue struct {
+	Kind FsckIssueKind
+	// Key is the blob key the issue is about
+	Key string
+	// Snapshots are the rows involved. Empty for orphan blobs.
+	Snapshots []repo.Snapshot
+	Detail    string
+}
+
+type FsckReport struct {
+	RowsChecked  int
+	BlobsChecked int
+	Issues       []FsckIssue
+}
+
+// FsckRepair is the outcome of repairing one issue
+type FsckRepair struct {
+	Issue  FsckIssue
+	Action string
+	Err    error
+}
+
+type FsckService struct {
+	snapshotRepo    repo.SnapshotRepo
+	blobStore       blobstore.BlobStore
+	snapshotService *SnapshotService
+}
+
+// NewFsckService creates the reconciliation service. Orphans are re-indexed, and rows are removed along with their
+// stored differences, through snapshotService.
+func NewFsckService(snapshotRepo repo.SnapshotRepo, blobStore blobstore.BlobStore, snapshotService *SnapshotService) *FsckService {
+	return &FsckService{
+		snapshotRepo:    snapshotRepo,
+		blobStore:       blobStore,
+		snapshotService: snapshotService,
+	}
+}
+
+var contentKeyPattern = regexp.MustCompile(`^[0-9a-f]{2}/([0-9a-f]{64})\.json(\.gz|\.zst)?$`)
+
+// Check compares every snapshot row against every blob and reports where they disagree
+//
+// Summary: Every blob is read, decompressed and hashed, so this is proportional to the size of the store.
+//
+// Responses:
+//   - FsckReport: the issues found, ordered by rows first and then by blob key
+//   - error: error if the rows or blobs cannot be listed {nil | error}
+func (service *FsckService) Check(ctx context.Context) (FsckReport, error) {
+	rows, err := service.snapshotRepo.ListAll(ctx)
+	if err != nil {
+		return FsckReport{}, fmt.Errorf("Failed to list snapshots: %v", err)
+	}
+	blobs, err := service.blobStore.List(ctx, "")
+	if err != nil {
+		return FsckReport{}, fmt.Errorf("Failed to list blobs: %v", err)
+	}
+
+	report := FsckReport{RowsChecked: len(rows)}
+	references := map[string][]repo.Snapshot{}
+	blobKeys := map[string]bool{}
+	for _, blob := range blobs {
+		blobKeys[blob.Key] = true
+	}
+	for _, row := range rows {
+		references[row.File_PWD] = append(references[row.File_PWD], row)
+		if row.Status != repo.StatusPending && IsLegacy(row) {
+			// The file of a legacy row is in the blob store under its upload name, see ConvertLegacySnapshot
+			references[row.File_Name] = append(references[row.File_Name], row)
+			report.Issues = append(report.Issues, FsckIssue{Kind: IssueLegacyRow, Key: row.File_Name, Snapshots: []repo.Snapshot{row}, Detail: "stored before content addressing"})
+		} else if row.Status == repo.StatusPending {
+			report.Issues = append(report.Issues, FsckIssue{Kind: IssuePendingRow, Key: row.File_PWD, Snapshots: []repo.Snapshot{row}, Detail: "upload never committed"})
+		} else if !blobKeys[row.File_PWD] {
+			report.Issues = append(report.Issues, FsckIssue{Kind: IssueDanglingRow, Key: row.File_PWD, Snapshots: []repo.Snapshot{row}, Detail: "blob does not exist"})
+		}
+	}
+
+	for _, blob := range blobs {
+		if strings.HasPrefix(blob.Key, QuarantinePrefix) {
+			continue
+		}
+		report.BlobsChecked++
+		contents, err := blobstore.ReadAll(ctx, service.blobStore, blob.Key)
+		if err != nil {
+			return report, fmt.Errorf("Failed to read blob %s: %v", blob.Key, err)
+		}
+		if issue, broken := checkBlob(blob.Key, contents, references[blob.Key]); broken {
+			report.Issues = append(report.Issues, issue)
+		} else if len(references[blob.Key]) == 0 {
+			report.Issues = append(report.Issues, FsckIssue{Kind: IssueOrphanBlob, Key: blob.Key, Detail: "no snapshot references this blob"})
+		}
+	}
+	return report, nil
+}
+
+// checkBlob verifies a blob against the hash in its key and in the rows referencing it, and that it is JSON. The
+// hashes are of the uncompressed content.
+func checkBlob(key string, stored []byte, rows []repo.Snapshot) (FsckIssue, bool) {
+	contents, err := compression.Decompress(compression.FromKey(key), stored)
+	if err != nil {
+		return FsckIssue{Kind: IssueUnparseable, Key: key, Snapshots: rows, Detail: "blob cannot be decompressed: " + err.Error()}, true
+	}
+	sum := sha256.Sum256(contents)
+	actual := hex.EncodeToString(sum[:])
+
+	expected := ""
+	if match := contentKeyPattern.FindStringSubmatch(key); match != nil {
+		expected = match[1]
+	}
+	for _, row := range rows {
+		if expected == "" && row.Content_SHA256 != "" {
+			expected = row.Content_SHA256
+		}
+	}
+	if expected != "" && expected != actual {
+		return FsckIssue{Kind: IssueHashMismatch, Key: key, Snapshots: rows, Detail: fmt.Sprintf("expected sha256 %s, got %s", expected, actual)}, true
+	}
+	if !json.Valid(contents) {
+		return FsckIssue{Kind: IssueUnparseable, Key: key, Snapshots: rows, Detail: "blob is not valid JSON"}, true
+	}
+	return FsckIssue{}, false
+}
+
+// Repair fixes the issues in a report
+//
+// Summary:
+//   - orphan blobs are re-indexed through the normal ingest path. Blobs that fail validation or conflict with an
+//     existing snapshot are quarantined.
+//   - hash mismatches and unparseable blobs are quarantined, and the rows referencing them are removed
+//   - dangling and pending rows are removed
+//   - legacy rows are converted to content-addressed blobs
+//
+// Removing a row also removes its stored differences. Pending rows of uploads in flight cannot be told apart from
+// abandoned ones, so Repair should not run while the server is accepting uploads.
+func (service *FsckService) Repair(ctx context.Context, report FsckReport) []FsckRepair {
+	repairs := make([]FsckRepair, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		var action string
+		var err error
+		switch issue.Kind {
+		case IssueOrphanBlob:
+			action, err = service.reindex(ctx, issue.Key)
+		case IssueHashMismatch, IssueUnparseable:
+			action = "quarantined"
+			err = service.quarantine(ctx, issue.Key)
+			if err == nil {
+				err = service.removeRows(ctx, issue.Snapshots)
+				action = "quarantined, removed rows"
+			}
+		case IssueDanglingRow, IssuePendingRow:
+			action = "removed row"
+			err = service.removeRows(ctx, issue.Snapshots)
+		case IssueLegacyRow:
+			var converted repo.Snapshot
+			converted, err = service.snapshotService.ConvertLegacySnapshot(ctx, issue.Snapshots[0])
+			action = "converted to " + converted.File_PWD
+		default:
+			err = fmt.Errorf("unknown issue kind %q", issue.Kind)
+		}
+		repairs = append(repairs, FsckRepair{Issue: issue, Action: action, Err: err})
+	}
+	return repairs
+}
+
+// reindex ingests an orphan blob as if it was uploaded. Blobs named like an upload (host_<ip>_<timestamp>.json, as
+// stored before content addressing) use the filename metadata, content-addressed blobs use the body metadata.
+func (service *FsckService) reindex(ctx context.Context, key string) (string, error) {
+	stored, err := blobstore.ReadAll(ctx, service.blobStore, key)
+	if err != nil {
+		return "", err
+	}
+	contents, err := compression.Decompress(compression.FromKey(key), stored)
+	if err != nil {
+		return "", err
+	}
+	codec, err := compression.Parse(service.snapshotService.Compression)
+	if err != nil {
+		return "", err
+	}
+	filename := path.Base(key)
+	if snapshotname.Match(filename) {
+		err = service.snapshotService.CreateSnapshot(ctx, bytes.NewReader(contents), filename)
+	} else {
+		err = service.snapshotService.CreateSnapshotFromBody(ctx, bytes.NewReader(contents))
+	}
+	if err != nil {
+		if qErr := service.quarantine(ctx, key); qErr != nil {
+			return "", fmt.Errorf("Failed to re-index (%v) and to quarantine: %v", err, qErr)
+		}
+		return "quarantined: " + err.Error(), nil
+	}
+
+	// A legacy blob, or one stored with another codec, has been copied to its content-addressed key, so the
+	// original is now a duplicate
+	sum := sha256.Sum256(contents)
+	if contentKey := BlobKey(hex.EncodeToString(sum[:]), codec); contentKey != key {
+		if err := service.blobStore.Delete(ctx, key); err != nil {
+			return "re-indexed as " + contentKey, fmt.Errorf("Failed to remove original blob: %v", err)
+		}
+		return "re-indexed as " + contentKey, nil
+	}
+	return "re-indexed", nil
+}
+
+// quarantine moves a blob under QuarantinePrefix so it can be inspected by hand
+func (service *FsckService) quarantine(ctx context.Context, key string) error {
+	reader, err := service.blobStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := service.blobStore.Put(ctx, QuarantinePrefix+key, reader); err != nil {
+		return err
+	}
+	return service.blobStore.Delete(ctx, key)
+}
+
+func (service *FsckService) removeRows(ctx context.Context, rows []repo.Snapshot) error {
+	var errs []error
+	for _, row := range rows {
+		if err := service.snapshotService.removeSnapshot(ctx, row, row.Status); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
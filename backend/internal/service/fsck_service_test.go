@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const otherSnapshotContent = `{"timestamp": "2025-01-02T12:00:00Z", "ip": "10.0.0.1", "services": [], "service_count": 0}`
+
+// legacyRowContent is the file of a row stored before content addressing
+const legacyRowContent = `{"timestamp": "2025-01-01T12:00:00Z", "ip": "192.168.1.5", "services": [], "service_count": 0}`
+
+// fsckFixture is a blob store and rows covering every kind of issue
+type fsckFixture struct {
+	blobStore *blobstore.MemoryStore
+	good      repo.Snapshot
+	dangling  repo.Snapshot
+	pending   repo.Snapshot
+	corrupt   repo.Snapshot
+	legacy    repo.Snapshot
+}
+
+func newFsckFixture(t *testing.T) fsckFixture {
+	ctx := context.Background()
+	blobStore := blobstore.NewMemoryStore()
+	put := func(key string, content string) {
+		require.NoError(t, blobStore.Put(ctx, key, strings.NewReader(content)))
+	}
+
+	fixture := fsckFixture{
+		blobStore: blobStore,
+		good:      repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.1", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: blobKeyFor(validSnapshotContent), Status: repo.StatusCommitted},
+		dangling:  repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.2", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: "ab/missing.json", Status: repo.StatusCommitted},
+		pending:   repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.3", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: "cd/pending.json", Status: repo.StatusPending},
+		corrupt:   repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.4", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: blobKeyFor(`{"original": true}`), Status: repo.StatusCommitted},
+		legacy:    repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.5", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: "backend/snapshots/host_192.168.1.5_2025-01-01T12-00-00Z.json", File_Name: "host_192.168.1.5_2025-01-01T12-00-00Z.json", Status: repo.StatusCommitted},
+	}
+	put(fixture.good.File_PWD, validSnapshotContent)
+	put(fixture.corrupt.File_PWD, `{"original": false}`)
+	put(fixture.legacy.File_Name, legacyRowContent)
+	put(blobKeyFor(otherSnapshotContent), otherSnapshotContent)
+	put("host_10.0.0.2_2025-01-03T12-00-00Z.json", `{"timestamp": "2025-01-03T12:00:00Z", "ip": "10.0.0.2", "services": [], "service_count": 0}`)
+	put("host_10.0.0.3_2025-01-03T12-00-00Z.json", `{"truncated": `)
+	put(QuarantinePrefix+"ef/old.json", `not checked`)
+	return fixture
+}
+
+func (fixture fsckFixture) rows() []repo.Snapshot {
+	return []repo.Snapshot{fixture.good, fixture.dangling, fixture.pending, fixture.corrupt, fixture.legacy}
+}
+
+func TestFsckService_Check(t *testing.T) {
+	ctx := context.Background()
+	fixture := newFsckFixture(t)
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("ListAll", ctx).Return(fixture.rows(), nil)
+	fsckService := NewFsckService(mockRepo, fixture.blobStore, NewSnapshotService(mockRepo, fixture.blobStore))
+
+	report, err := fsckService.Check(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.RowsChecked)
+	assert.Equal(t, 6, report.BlobsChecked)
+	type found struct {
+		Kind FsckIssueKind
+		Key  string
+	}
+	issues := []found{}
+	for _, issue := range report.Issues {
+		issues = append(issues, found{issue.Kind, issue.Key})
+	}
+	assert.ElementsMatch(t, []found{
+		{IssueDanglingRow, "ab/missing.json"},
+		{IssuePendingRow, "cd/pending.json"},
+		{IssueLegacyRow, fixture.legacy.File_Name},
+		{IssueHashMismatch, fixture.corrupt.File_PWD},
+		{IssueOrphanBlob, blobKeyFor(otherSnapshotContent)},
+		{IssueOrphanBlob, "host_10.0.0.2_2025-01-03T12-00-00Z.json"},
+		{IssueUnparseable, "host_10.0.0.3_2025-01-03T12-00-00Z.json"},
+	}, issues)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFsckService_Check_ListError(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("ListAll", ctx).Return([]repo.Snapshot{}, fmt.Errorf("database error"))
+	blobStore := blobstore.NewMemoryStore()
+	fsckService := NewFsckService(mockRepo, blobStore, NewSnapshotService(mockRepo, blobStore))
+
+	_, err := fsckService.Check(ctx)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to list snapshots")
+}
+
+func TestFsckService_Repair(t *testing.T) {
+	ctx := context.Background()
+	fixture := newFsckFixture(t)
+	mockRepo := &MockSnapshotRepo{}
+	mockDiffRepo := &MockDifferenceRepo{}
+	mockRepo.On("ListAll", ctx).Return(fixture.rows(), nil)
+	snapshotService := NewSnapshotService(mockRepo, fixture.blobStore)
+	snapshotService.DifferenceRepo = mockDiffRepo
+	fsckService := NewFsckService(mockRepo, fixture.blobStore, snapshotService)
+
+	// Dangling, pending and corrupt rows are removed along with their stored differences
+	for _, row := range []repo.Snapshot{fixture.dangling, fixture.pending, fixture.corrupt} {
+		mockRepo.On("DeleteWithStatus", ctx, row.UUID, row.Status).Return(nil)
+		mockDiffRepo.On("DeleteForSnapshot", ctx, row.Host_IP, row.Timestamp).Return(nil)
+	}
+	// Orphans are re-indexed through the ingest path
+	legacyContent := `{"timestamp": "2025-01-03T12:00:00Z", "ip": "10.0.0.2", "services": [], "service_count": 0}`
+	orphanTime := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	legacyTime := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "10.0.0.1", orphanTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "10.0.0.2", legacyTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, matchSnapshot("10.0.0.1", orphanTime, "host_10.0.0.1_2025-01-02T12-00-00Z.json", blobKeyFor(otherSnapshotContent))).Return(nil)
+	mockRepo.On("Insert", ctx, matchSnapshot("10.0.0.2", legacyTime, "host_10.0.0.2_2025-01-03T12-00-00Z.json", blobKeyFor(legacyContent))).Return(nil)
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+	mockDiffRepo.On("DeleteForSnapshot", ctx, "10.0.0.1", orphanTime).Return(nil)
+	mockDiffRepo.On("DeleteForSnapshot", ctx, "10.0.0.2", legacyTime).Return(nil)
+	// Legacy rows are pointed at the content-addressed copy of their file
+	mockRepo.On("UpdateBlob", ctx, mock.MatchedBy(func(snapshot repo.Snapshot) bool {
+		return snapshot.UUID == fixture.legacy.UUID && snapshot.File_PWD == blobKeyFor(legacyRowContent)
+	})).Return(nil)
+
+	report, err := fsckService.Check(ctx)
+	require.NoError(t, err)
+	repairs := fsckService.Repair(ctx, report)
+
+	require.Len(t, repairs, len(report.Issues))
+	for _, repair := range repairs {
+		assert.NoError(t, repair.Err, "%s %s", repair.Issue.Kind, repair.Issue.Key)
+	}
+
+	// Broken blobs are moved to quarantine, legacy blobs are moved to their content-addressed key
+	keys := []string{}
+	blobs, err := fixture.blobStore.List(ctx, "")
+	require.NoError(t, err)
+	for _, blob := range blobs {
+		keys = append(keys, blob.Key)
+	}
+	assert.ElementsMatch(t, []string{
+		blobKeyFor(validSnapshotContent),
+		blobKeyFor(otherSnapshotContent),
+		blobKeyFor(legacyContent),
+		blobKeyFor(legacyRowContent),
+		QuarantinePrefix + fixture.corrupt.File_PWD,
+		QuarantinePrefix + "host_10.0.0.3_2025-01-03T12-00-00Z.json",
+		QuarantinePrefix + "ef/old.json",
+	}, keys)
+	mockRepo.AssertExpectations(t)
+	mockDiffRepo.AssertExpectations(t)
+}
+
+func TestFsckService_Repair_QuarantinesInvalidOrphan(t *testing.T) {
+	ctx := context.Background()
+	blobStore := blobstore.NewMemoryStore()
+	invalid := `{"ip": "10.0.0.1"}`
+	require.NoError(t, blobStore.Put(ctx, blobKeyFor(invalid), strings.NewReader(invalid)))
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("ListAll", ctx).Return([]repo.Snapshot{}, nil)
+	fsckService := NewFsckService(mockRepo, blobStore, NewSnapshotService(mockRepo, blobStore))
+
+	report, err := fsckService.Check(ctx)
+	require.NoError(t, err)
+	repairs := fsckService.Repair(ctx, report)
+
+	require.Len(t, repairs, 1)
+	require.NoError(t, repairs[0].Err)
+	assert.Contains(t, repairs[0].Action, "quarantined: Invalid host snapshot")
+	_, err = blobStore.Stat(ctx, QuarantinePrefix+blobKeyFor(invalid))
+	assert.NoError(t, err)
+}
+
+func TestFsckService_CompressedBlobs(t *testing.T) {
+	ctx := context.Background()
+	blobStore := blobstore.NewMemoryStore()
+	putCompressed := func(codec string, content string) string {
+		sum := sha256.Sum256([]byte(content))
+		key := BlobKey(hex.EncodeToString(sum[:]), codec)
+		compressed, err := compression.Compress(codec, []byte(content))
+		require.NoError(t, err)
+		require.NoError(t, blobStore.Put(ctx, key, bytes.NewReader(compressed)))
+		return key
+	}
+	orphanContent := `{"timestamp": "2025-01-03T12:00:00Z", "ip": "10.0.0.2", "services": [], "service_count": 0}`
+
+	good := repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.1", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: putCompressed(compression.Zstd, validSnapshotContent), Content_Encoding: compression.Zstd, Status: repo.StatusCommitted}
+	zstdOrphan := putCompressed(compression.Zstd, otherSnapshotContent)
+	gzipOrphan := putCompressed(compression.Gzip, orphanContent)
+	corruptKey := "ab/" + strings.Repeat("ab", 32) + ".json.gz"
+	require.NoError(t, blobStore.Put(ctx, corruptKey, strings.NewReader("not gzip")))
+
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("ListAll", ctx).Return([]repo.Snapshot{good}, nil)
+	snapshotService := NewSnapshotService(mockRepo, blobStore)
+	snapshotService.Compression = compression.Zstd
+	fsckService := NewFsckService(mockRepo, blobStore, snapshotService)
+
+	report, err := fsckService.Check(ctx)
+	require.NoError(t, err)
+	kinds := map[string]FsckIssueKind{}
+	for _, issue := range report.Issues {
+		kinds[issue.Key] = issue.Kind
+	}
+	assert.Equal(t, map[string]FsckIssueKind{
+		zstdOrphan: IssueOrphanBlob,
+		gzipOrphan: IssueOrphanBlob,
+		corruptKey: IssueUnparseable,
+	}, kinds)
+
+	// Orphans are re-indexed with the configured codec, so the gzip blob moves to its zstd key
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, mock.Anything, mock.Anything).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, mock.MatchedBy(func(snapshot repo.Snapshot) bool { return snapshot.Content_Encoding == compression.Zstd })).Return(nil)
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+	repairs := fsckService.Repair(ctx, report)
+	for _, repair := range repairs {
+		assert.NoError(t, repair.Err, repair.Issue.Key)
+	}
+
+	keys := []string{}
+	blobs, err := blobStore.List(ctx, "")
+	require.NoError(t, err)
+	for _, blob := range blobs {
+		keys = append(keys, blob.Key)
+	}
+	sum := sha256.Sum256([]byte(orphanContent))
+	assert.ElementsMatch(t, []string{
+		good.File_PWD,
+		zstdOrphan,
+		BlobKey(hex.EncodeToString(sum[:]), compression.Zstd),
+		QuarantinePrefix + corruptKey,
+	}, keys)
+}
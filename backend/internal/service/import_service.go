@@ -0,0 +1,234 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/model"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
+)
+
+// ImportStatus is the outcome of importing one file
+type ImportStatus string
+
+const (
+	ImportImported ImportStatus = "imported"
+	// ImportDuplicate means a snapshot for the host and timestamp already exists, so the file was skipped
+	ImportDuplicate ImportStatus = "duplicate"
+	// ImportInvalid means the file is not a valid host snapshot, is larger than the max file size, or its name does
+	// not match its body
+	ImportInvalid ImportStatus = "invalid"
+	// ImportFailed means the file could not be read or stored
+	ImportFailed ImportStatus = "failed"
+)
+
+type ImportResult struct {
+	Path   string
+	Status ImportStatus
+	Err    error
+}
+
+// errFileTooLarge is returned (wrapped) for a file larger than the max file size
+var errFileTooLarge = errors.New("file exceeds max file size")
+
+type ImportService struct {
+	snapshotService *SnapshotService
+	maxFileSize     int64
+}
+
+// NewImportService creates the import service. Files larger than maxFileSize bytes are not imported, like uploads
+// larger than host_file.max_size, so that at most maxFileSize bytes of each file being imported are held in memory.
+func NewImportService(snapshotService *SnapshotService, maxFileSize int) *ImportService {
+	return &ImportService{
+		snapshotService: snapshotService,
+		maxFileSize:     int64(maxFileSize),
+	}
+}
+
+// ExpandImportPaths turns directories and glob patterns into the list of .json files to import
+//
+// Summary: Directories are walked recursively. Other arguments are treated as glob patterns (a plain file path is a
+// pattern that matches itself). Each file is returned once, sorted by path.
+func ExpandImportPaths(patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	add := func(path string) {
+		seen[filepath.Clean(path)] = true
+	}
+	for _, pattern := range patterns {
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			err := filepath.WalkDir(pattern, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".json") {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to walk %s: %v", pattern, err)
+			}
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %s: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No files match %s", pattern)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() {
+				add(match)
+			}
+		}
+	}
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Import ingests files through the same path as uploads, at most concurrency at a time
+//
+// Summary: Files named host_<ip>_<timestamp>.json are checked against their body like an upload with
+// metadata=filename, other files take the host and timestamp from the body. Files that were already imported are
+// reported as duplicates, so running the same import twice is safe.
+// Params:
+//   - paths: files to import
+//   - concurrency: maximum number of files imported at once, values below 1 are treated as 1
+//   - progress: called once per file as it finishes, from the importing goroutine. May be nil.
+//
+// Once ctx is cancelled no more files are started, and the rest are reported as ImportFailed with ctx.Err().
+//
+// Responses:
+//   - []ImportResult: one result per path, in the same order as paths
+func (service *ImportService) Import(ctx context.Context, paths []string, concurrency int, progress func(ImportResult)) []ImportResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]ImportResult, len(paths))
+	semaphore := make(chan struct{}, concurrency)
+	var progressMu sync.Mutex
+	var wg sync.WaitGroup
+	report := func(result ImportResult) {
+		if progress != nil {
+			progressMu.Lock()
+			progress(result)
+			progressMu.Unlock()
+		}
+	}
+	for i, path := range paths {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			// Cancelled, so the files not yet started are not attempted
+			for j := i; j < len(paths); j++ {
+				results[j] = ImportResult{Path: paths[j], Status: ImportFailed, Err: ctx.Err()}
+				report(results[j])
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i] = service.importFile(ctx, path)
+			report(results[i])
+		}(i, path)
+	}
+	wg.Wait()
+	return results
+}
+
+func (service *ImportService) importFile(ctx context.Context, path string) ImportResult {
+	file, err := os.Open(path)
+	if err != nil {
+		return ImportResult{Path: path, Status: ImportFailed, Err: err}
+	}
+	defer file.Close()
+
+	filename := filepath.Base(path)
+	if snapshotname.Match(filename) {
+		if _, _, err := snapshotname.Parse(filename); err != nil {
+			return ImportResult{Path: path, Status: ImportInvalid, Err: err}
+		}
+	}
+	// Read one byte past the limit to tell a file of exactly the max size from a larger one
+	contents, err := io.ReadAll(io.LimitReader(file, service.maxFileSize+1))
+	if err != nil {
+		return ImportResult{Path: path, Status: ImportFailed, Err: err}
+	}
+	if int64(len(contents)) > service.maxFileSize {
+		return ImportResult{Path: path, Status: ImportInvalid, Err: fmt.Errorf("%w of %d bytes", errFileTooLarge, service.maxFileSize)}
+	}
+
+	if snapshotname.Match(filename) {
+		err = service.snapshotService.CreateSnapshot(ctx, bytes.NewReader(contents), filename)
+	} else {
+		err = service.snapshotService.CreateSnapshotFromBody(ctx, bytes.NewReader(contents))
+	}
+	return ImportResult{Path: path, Status: importStatus(err), Err: err}
+}
+
+func importStatus(err error) ImportStatus {
+	var validationErr *model.ValidationError
+	switch {
+	case err == nil:
+		return ImportImported
+	case errors.Is(err, ErrDuplicateSnapshot):
+		return ImportDuplicate
+	case errors.As(err, &validationErr), errors.Is(err, hostip.ErrInvalid), errors.Is(err, errFileTooLarge):
+		return ImportInvalid
+	default:
+		return ImportFailed
+	}
+}
+
+// ImportLegacy converts the snapshot rows written before snapshots were stored by content, see
+// ConvertLegacySnapshot. Each result's Path is the File_PWD the row had. Rows that were already converted are
+// skipped, so running it twice is safe.
+//
+// Responses:
+//   - []ImportResult: one result per legacy row, ordered by host and timestamp
+//   - error: error if the rows cannot be listed {nil | error}
+func (service *ImportService) ImportLegacy(ctx context.Context, progress func(ImportResult)) ([]ImportResult, error) {
+	snapshots, err := service.snapshotService.snapshotRepo.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := []ImportResult{}
+	for _, snapshot := range snapshots {
+		if !IsLegacy(snapshot) || snapshot.Status == repo.StatusPending {
+			continue
+		}
+		result := ImportResult{Path: snapshot.File_PWD, Status: ImportImported}
+		if err := ctx.Err(); err != nil {
+			result.Status = ImportFailed
+			result.Err = err
+		} else if _, err := service.snapshotService.ConvertLegacySnapshot(ctx, snapshot); err != nil {
+			result.Status = ImportFailed
+			result.Err = err
+		}
+		results = append(results, result)
+		if progress != nil {
+			progress(result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// testImportMaxSize is the max file size of imports in tests, larger than any test snapshot
+const testImportMaxSize = 1 << 20
+
+func writeImportFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestExpandImportPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeImportFiles(t, dir, map[string]string{
+		"host_192.168.1.1_2025-01-01T12-00-00Z.json":     validSnapshotContent,
+		"nested/host_10.0.0.1_2025-01-02T12-00-00Z.json": otherSnapshotContent,
+		"nested/README.md": "not a snapshot",
+		"other/scan.JSON":  otherSnapshotContent,
+	})
+
+	tests := []struct {
+		name          string
+		patterns      []string
+		expectedPaths []string
+		expectedError string
+	}{
+		{
+			name:     "directory is walked recursively for json files",
+			patterns: []string{dir},
+			expectedPaths: []string{
+				filepath.Join(dir, "host_192.168.1.1_2025-01-01T12-00-00Z.json"),
+				filepath.Join(dir, "nested", "host_10.0.0.1_2025-01-02T12-00-00Z.json"),
+				filepath.Join(dir, "other", "scan.JSON"),
+			},
+		},
+		{
+			name:     "glob",
+			patterns: []string{filepath.Join(dir, "*", "host_*.json")},
+			expectedPaths: []string{
+				filepath.Join(dir, "nested", "host_10.0.0.1_2025-01-02T12-00-00Z.json"),
+			},
+		},
+		{
+			name:     "overlapping patterns are deduplicated",
+			patterns: []string{filepath.Join(dir, "nested"), filepath.Join(dir, "nested", "*.json")},
+			expectedPaths: []string{
+				filepath.Join(dir, "nested", "host_10.0.0.1_2025-01-02T12-00-00Z.json"),
+			},
+		},
+		{
+			name:          "pattern with no matches",
+			patterns:      []string{filepath.Join(dir, "missing*.json")},
+			expectedError: "No files match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := ExpandImportPaths(tt.patterns)
+
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedPaths, paths)
+			}
+		})
+	}
+}
+
+func TestImportService_Import(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeImportFiles(t, dir, map[string]string{
+		"host_192.168.1.1_2025-01-01T12-00-00Z.json": validSnapshotContent,
+		"scan-from-body.json":                        otherSnapshotContent,
+		"host_192.168.1.9_2025-01-01T12-00-00Z.json": `{"timestamp": "2025-01-01T12:00:00Z", "ip": "192.168.1.9", "services": [], "service_count": 0}`,
+		"host_192.168.1.2_2025-01-01T12-00-00Z.json": validSnapshotContent,
+		"host_999.1.1.1_2025-01-01T12-00-00Z.json":   validSnapshotContent,
+	})
+	paths := []string{
+		filepath.Join(dir, "host_192.168.1.1_2025-01-01T12-00-00Z.json"),
+		filepath.Join(dir, "scan-from-body.json"),
+		filepath.Join(dir, "host_192.168.1.9_2025-01-01T12-00-00Z.json"),
+		filepath.Join(dir, "host_192.168.1.2_2025-01-01T12-00-00Z.json"),
+		filepath.Join(dir, "host_999.1.1.1_2025-01-01T12-00-00Z.json"),
+		filepath.Join(dir, "missing.json"),
+	}
+
+	mockRepo := &MockSnapshotRepo{}
+	importService := NewImportService(NewSnapshotService(mockRepo, blobstore.NewMemoryStore()), testImportMaxSize)
+	jan1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	jan2 := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", jan1).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "10.0.0.1", jan2).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.9", jan1).Return(repo.Snapshot{Host_IP: "192.168.1.9"}, nil)
+	mockRepo.On("Insert", ctx, mock.Anything).Return(nil)
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+
+	progressed := []string{}
+	results := importService.Import(ctx, paths, 2, func(result ImportResult) {
+		progressed = append(progressed, result.Path)
+	})
+
+	statuses := []ImportStatus{}
+	for i, result := range results {
+		assert.Equal(t, paths[i], result.Path)
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(t, []ImportStatus{ImportImported, ImportImported, ImportDuplicate, ImportInvalid, ImportInvalid, ImportFailed}, statuses)
+	assert.ElementsMatch(t, paths, progressed)
+	mockRepo.AssertNumberOfCalls(t, "Insert", 2)
+}
+
+func TestImportService_Import_ConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	paths := []string{}
+	for i := 1; i <= 8; i++ {
+		name := fmt.Sprintf("host_10.0.0.%d_2025-01-01T12-00-00Z.json", i)
+		writeImportFiles(t, dir, map[string]string{
+			name: fmt.Sprintf(`{"timestamp": "2025-01-01T12:00:00Z", "ip": "10.0.0.%d", "services": [], "service_count": 0}`, i),
+		})
+		paths = append(paths, filepath.Join(dir, name))
+	}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, mock.Anything).Return(nil)
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+	importService := NewImportService(NewSnapshotService(mockRepo, blobstore.NewMemoryStore()), testImportMaxSize)
+
+	results := importService.Import(ctx, paths, 3, nil)
+
+	for _, result := range results {
+		assert.Equal(t, ImportImported, result.Status, result.Path)
+	}
+	assert.LessOrEqual(t, maxRunning, 3)
+	assert.Greater(t, maxRunning, 1)
+}
+
+func TestImportService_ImportLegacy(t *testing.T) {
+	ctx := context.Background()
+	snapshotRepo := repo.NewMemorySnapshotRepo()
+	blobStore := blobstore.NewMemoryStore()
+	snapshotService := NewSnapshotService(snapshotRepo, blobStore)
+	importService := NewImportService(snapshotService, testImportMaxSize)
+
+	// Rows as written before content addressing, with the file at <location>/<file_name>
+	legacy := repo.Snapshot{Host_IP: "192.168.1.5", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: "backend/snapshots/host_192.168.1.5_2025-01-01T12-00-00Z.json", File_Name: "host_192.168.1.5_2025-01-01T12-00-00Z.json"}
+	missing := repo.Snapshot{Host_IP: "192.168.1.6", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), File_PWD: "backend/snapshots/host_192.168.1.6_2025-01-01T12-00-00Z.json", File_Name: "host_192.168.1.6_2025-01-01T12-00-00Z.json"}
+	require.NoError(t, snapshotRepo.Insert(ctx, legacy))
+	require.NoError(t, snapshotRepo.Insert(ctx, missing))
+	require.NoError(t, blobStore.Put(ctx, legacy.File_Name, strings.NewReader(legacyRowContent)))
+	require.NoError(t, snapshotService.CreateSnapshotFromBody(ctx, strings.NewReader(otherSnapshotContent)))
+
+	results, err := importService.ImportLegacy(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, ImportResult{Path: legacy.File_PWD, Status: ImportImported}, results[0])
+	assert.Equal(t, ImportFailed, results[1].Status)
+	assert.ErrorIs(t, results[1].Err, blobstore.ErrNotFound)
+
+	converted, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, legacy.Host_IP, legacy.Timestamp)
+	require.NoError(t, err)
+	assert.Equal(t, blobKeyFor(legacyRowContent), converted.File_PWD)
+	assert.Equal(t, legacy.File_Name, converted.File_Name)
+	assert.Equal(t, int64(len(legacyRowContent)), converted.Size_Bytes)
+	contents, err := readSnapshotContents(ctx, blobStore, converted)
+	require.NoError(t, err)
+	assert.Equal(t, legacyRowContent, string(contents))
+	_, err = blobStore.Stat(ctx, legacy.File_Name)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound, "the legacy file is removed")
+
+	// Converted rows are skipped when run again
+	results, err = importService.ImportLegacy(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, missing.File_PWD, results[0].Path)
+}
+
+func TestImportService_Import_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{}
+	for i := 1; i <= 4; i++ {
+		name := fmt.Sprintf("host_10.0.0.%d_2025-01-01T12-00-00Z.json", i)
+		writeImportFiles(t, dir, map[string]string{
+			name: fmt.Sprintf(`{"timestamp": "2025-01-01T12:00:00Z", "ip": "10.0.0.%d", "services": [], "service_count": 0}`, i),
+		})
+		paths = append(paths, filepath.Join(dir, name))
+	}
+
+	// The import is cancelled while the first file is being imported
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("GetSnapshotByTimeStamp", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		cancel()
+	}).Return(repo.Snapshot{}, repo.ErrNotFound).Once()
+	mockRepo.On("Insert", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("MarkCommitted", mock.Anything, mock.Anything).Return(nil)
+	importService := NewImportService(NewSnapshotService(mockRepo, blobstore.NewMemoryStore()), testImportMaxSize)
+
+	progressed := 0
+	results := importService.Import(ctx, paths, 1, func(ImportResult) { progressed++ })
+
+	require.Len(t, results, 4)
+	assert.Equal(t, ImportImported, results[0].Status)
+	for _, result := range results[1:] {
+		assert.Equal(t, ImportFailed, result.Status, result.Path)
+		assert.ErrorIs(t, result.Err, context.Canceled)
+	}
+	assert.Equal(t, 4, progressed)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestImportService_Import_TooLarge(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeImportFiles(t, dir, map[string]string{
+		"host_192.168.1.1_2025-01-01T12-00-00Z.json": validSnapshotContent,
+		"too-large.json": validSnapshotContent + "\n",
+	})
+	paths := []string{
+		filepath.Join(dir, "host_192.168.1.1_2025-01-01T12-00-00Z.json"),
+		filepath.Join(dir, "too-large.json"),
+	}
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", lookupJan1).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, mock.Anything).Return(nil)
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+	importService := NewImportService(NewSnapshotService(mockRepo, blobstore.NewMemoryStore()), len(validSnapshotContent))
+
+	results := importService.Import(ctx, paths, 2, nil)
+
+	require.Len(t, results, 2)
+	assert.Equal(t, ImportImported, results[0].Status, "a file of exactly the max size is imported")
+	assert.Equal(t, ImportInvalid, results[1].Status)
+	assert.ErrorIs(t, results[1].Err, errFileTooLarge)
+	mockRepo.AssertNumberOfCalls(t, "Insert", 1)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/model"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/google/uuid"
+)
+
+// IsLegacy reports whether a snapshot row was written before snapshots were stored by content, when File_PWD was
+// the path the file was uploaded to, <host_file.location>/<file_name>, rather than a blob key
+func IsLegacy(snapshot repo.Snapshot) bool {
+	return snapshot.File_Name != "" && filepath.Base(snapshot.File_PWD) == snapshot.File_Name
+}
+
+// ConvertLegacySnapshot stores the file of a legacy snapshot row as a content-addressed blob and points the row at it
+//
+// Summary: Older versions wrote each upload to <host_file.location>/<file_name> and recorded that path in File_PWD.
+// The file is read from the blob store under its File_Name, which is where the filesystem store finds it, stored
+// as if it was uploaded now, and the row is updated to the new blob. Its services are indexed as by Reindex. The
+// old file is removed once nothing refers to it.
+//
+// Responses:
+//   - repo.Snapshot: the converted row
+//   - error: blobstore.ErrNotFound if the file is missing, or error if it is not JSON or cannot be stored {nil | error}
+func (service *SnapshotService) ConvertLegacySnapshot(ctx context.Context, snapshot repo.Snapshot) (repo.Snapshot, error) {
+	contents, err := blobstore.ReadAll(ctx, service.BlobStore, snapshot.File_Name)
+	if err != nil {
+		return repo.Snapshot{}, fmt.Errorf("Failed to read legacy file %s: %w", snapshot.File_Name, err)
+	}
+	blob, stored, err := service.newBlob(contents)
+	if err != nil {
+		return repo.Snapshot{}, err
+	}
+	// Unlike an upload the row does not reference the blob until it is updated, so the blob's lock is held until then
+	unlock := service.blobLocks.lock(blob.File_PWD)
+	defer unlock()
+	if err := service.putBlob(ctx, blob.File_PWD, stored); err != nil {
+		return repo.Snapshot{}, err
+	}
+	// Indexed before the row is updated, so that a failure leaves the row legacy and the conversion can be retried
+	if _, err := service.indexContents(ctx, snapshot.UUID, contents); err != nil {
+		return repo.Snapshot{}, fmt.Errorf("Failed to index snapshot services: %v", err)
+	}
+
+	blob.UUID = snapshot.UUID
+	if err := service.snapshotRepo.UpdateBlob(ctx, blob); err != nil {
+		return repo.Snapshot{}, fmt.Errorf("Failed to update snapshot row: %v", err)
+	}
+	converted := snapshot
+	converted.File_PWD = blob.File_PWD
+	converted.Content_SHA256 = blob.Content_SHA256
+	converted.Size_Bytes = blob.Size_Bytes
+	converted.Canonical_SHA256 = blob.Canonical_SHA256
+	converted.Content_Encoding = blob.Content_Encoding
+
+	if err := service.BlobStore.Delete(ctx, snapshot.File_Name); err != nil {
+		// Left behind as an orphan blob, which fsck reports
+		log.Printf("ConvertLegacySnapshot: Failed to remove legacy file %s: %v", snapshot.File_Name, err)
+	}
+	return converted, nil
+}
+
+// indexContents indexes the services of a stored snapshot file. Files are decoded as they are, without the
+// validation of uploads, so that older snapshots are indexed as far as possible.
+//
+// Returns:
+//   - int: the number of services indexed
+//   - error: error if the file is not JSON or cannot be indexed {nil | error}
+func (service *SnapshotService) indexContents(ctx context.Context, snapshotID uuid.UUID, contents []byte) (int, error) {
+	var hostSnapshot model.HostSnapshot
+	if err := json.Unmarshal(contents, &hostSnapshot); err != nil {
+		return 0, err
+	}
+	if err := service.indexServices(ctx, snapshotID, hostSnapshot); err != nil {
+		return 0, err
+	}
+	return len(hostSnapshot.Services), nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
+)
+
+// DefaultPageSize is the number of items in a page when no limit is given, and MaxPageSize the largest limit allowed
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// ErrInvalidListOptions is returned (wrapped) for list options that cannot be parsed
+var ErrInvalidListOptions = errors.New("Invalid list options")
+
+// ListOptions are the query params of a host or snapshot listing, as given by the client. Every field is optional.
+//
+//   - Cursor: the Next of the previous page
+//   - Limit: the most items in the page, from 1 to MaxPageSize, DefaultPageSize if empty
+//   - Sort: "asc" (default) or "desc"
+//   - Since, Until: keep snapshots taken in the range, inclusive, in any format accepted by snapshotname.ParseTimestamp.
+//     Hosts are kept if they have a snapshot in the range.
+//   - Prefix: keep hosts whose canonical IP starts with it, e.g. "10.0." or "2001:db8:". Hosts only.
+type ListOptions struct {
+	Cursor string
+	Limit  string
+	Sort   string
+	Since  string
+	Until  string
+	Prefix string
+}
+
+// Page is one page of a listing. Next is the cursor of the following page, and is empty on the last page.
+type Page struct {
+	Items []string
+	Next  string
+}
+
+// listQuery is ListOptions parsed
+type listQuery struct {
+	after      string
+	limit      int
+	descending bool
+	since      time.Time
+	until      time.Time
+}
+
+// ListHosts returns a page of the hosts with snapshots, ordered by IP as text
+//
+// Responses:
+//   - Page: the hosts, and the cursor of the next page
+//   - error: ErrInvalidListOptions if options cannot be parsed {nil | error}
+func (service *SnapshotService) ListHosts(ctx context.Context, options ListOptions) (Page, error) {
+	query, err := parseListOptions(options)
+	if err != nil {
+		return Page{}, err
+	}
+	prefix, err := parsePrefix(options.Prefix)
+	if err != nil {
+		return Page{}, err
+	}
+
+	// One more than the limit is fetched to find out if there is a next page
+	hosts, err := service.snapshotRepo.ListHosts(ctx, repo.HostQuery{
+		Prefix:     prefix,
+		Since:      query.since,
+		Until:      query.until,
+		After:      query.after,
+		Descending: query.descending,
+		Limit:      query.limit + 1,
+	})
+	if err != nil {
+		return Page{}, err
+	}
+	return newPage(hosts, query.limit), nil
+}
+
+// ListSnapshotsForHost returns a page of the timestamps of a host's snapshots, in RFC 3339, ordered by time
+//
+// Responses:
+//   - Page: the timestamps, and the cursor of the next page
+//   - error: hostip.ErrInvalid for a bad host, ErrInvalidListOptions if options cannot be parsed {nil | error}
+func (service *SnapshotService) ListSnapshotsForHost(ctx context.Context, host_ip string, options ListOptions) (Page, error) {
+	host_ip, err := hostip.Canonical(host_ip)
+	if err != nil {
+		return Page{}, err
+	}
+	query, err := parseListOptions(options)
+	if err != nil {
+		return Page{}, err
+	}
+	if options.Prefix != "" {
+		return Page{}, fmt.Errorf("%w: prefix only applies to hosts", ErrInvalidListOptions)
+	}
+	snapshotQuery := repo.SnapshotQuery{
+		Since:      query.since,
+		Until:      query.until,
+		Descending: query.descending,
+		Limit:      query.limit + 1,
+	}
+	if query.after != "" {
+		after, err := time.Parse(time.RFC3339Nano, query.after)
+		if err != nil {
+			return Page{}, fmt.Errorf("%w: invalid cursor", ErrInvalidListOptions)
+		}
+		snapshotQuery.After = &after
+	}
+
+	timestamps, err := service.snapshotRepo.ListHostSnapshots(ctx, host_ip, snapshotQuery)
+	if err != nil {
+		return Page{}, err
+	}
+	items := make([]string, 0, len(timestamps))
+	for _, timestamp := range timestamps {
+		items = append(items, timestamp.UTC().Format(time.RFC3339Nano))
+	}
+	return newPage(items, query.limit), nil
+}
+
+func parseListOptions(options ListOptions) (listQuery, error) {
+	query := listQuery{limit: DefaultPageSize}
+	if options.Cursor != "" {
+		after, err := decodeCursor(options.Cursor)
+		if err != nil {
+			return listQuery{}, err
+		}
+		query.after = after
+	}
+	if options.Limit != "" {
+		limit, err := strconv.Atoi(options.Limit)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return listQuery{}, fmt.Errorf("%w: limit must be a number from 1 to %d", ErrInvalidListOptions, MaxPageSize)
+		}
+		query.limit = limit
+	}
+	switch strings.ToLower(options.Sort) {
+	case "", "asc":
+	case "desc":
+		query.descending = true
+	default:
+		return listQuery{}, fmt.Errorf("%w: sort must be asc or desc", ErrInvalidListOptions)
+	}
+	var err error
+	if query.since, err = parseRangeTimestamp("since", options.Since); err != nil {
+		return listQuery{}, err
+	}
+	if query.until, err = parseRangeTimestamp("until", options.Until); err != nil {
+		return listQuery{}, err
+	}
+	if !query.since.IsZero() && !query.until.IsZero() && query.until.Before(query.since) {
+		return listQuery{}, fmt.Errorf("%w: until must not be before since", ErrInvalidListOptions)
+	}
+	return query, nil
+}
+
+// parsePrefix normalises a host prefix to the form of canonical IPs
+func parsePrefix(prefix string) (string, error) {
+	normalised := strings.ToLower(strings.TrimSpace(prefix))
+	if strings.Trim(normalised, "0123456789abcdef.:") != "" {
+		return "", fmt.Errorf("%w: prefix %q must be the start of an IP address", ErrInvalidListOptions, prefix)
+	}
+	return normalised, nil
+}
+
+// decodeCursor returns the last item of the page a cursor was made for
+func decodeCursor(cursor string) (string, error) {
+	after, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(after) == 0 {
+		return "", fmt.Errorf("%w: invalid cursor", ErrInvalidListOptions)
+	}
+	return string(after), nil
+}
+
+func parseRangeTimestamp(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	timestamp, err := snapshotname.ParseTimestamp(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s: %v", ErrInvalidListOptions, name, err)
+	}
+	return timestamp, nil
+}
+
+// newPage trims items, fetched with one more than limit, to a page. The cursor is the last item of the page.
+func newPage(items []string, limit int) Page {
+	if len(items) <= limit {
+		return Page{Items: items}
+	}
+	items = items[:limit]
+	return Page{Items: items, Next: base64.RawURLEncoding.EncodeToString([]byte(items[len(items)-1]))}
+}
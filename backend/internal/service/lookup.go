@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
+)
+
+// Lookup modes of FindSnapshot, picking the snapshot at a timestamp, or the closest one at or before it, at or after
+// it, or on either side. Nearest picks the earlier snapshot when both are as close.
+const (
+	ModeExact   = "exact"
+	ModeBefore  = "before"
+	ModeAfter   = "after"
+	ModeNearest = "nearest"
+)
+
+// Aliases FindSnapshot accepts in place of a timestamp. Previous is the snapshot before the latest.
+const (
+	AtLatest   = "latest"
+	AtEarliest = "earliest"
+	AtPrevious = "previous"
+)
+
+// ErrInvalidMode is returned (wrapped) for an unknown lookup mode, or a mode given with an alias
+var ErrInvalidMode = errors.New("Invalid lookup mode")
+
+// FindSnapshot returns a snapshot of a host by timestamp or alias
+//
+// Summary: at is a timestamp, in any format accepted by snapshotname.ParseTimestamp, or one of AtLatest, AtEarliest
+// and AtPrevious. For a timestamp, mode is one of ModeExact (the default when empty), ModeBefore, ModeAfter and
+// ModeNearest. Aliases take no mode.
+//
+// Example:
+// FindSnapshot(ctx, "10.0.0.1", "2025-09-10T03:00:00Z", "before") -> the latest snapshot at or before 03:00
+// FindSnapshot(ctx, "10.0.0.1", "previous", "") -> the second latest snapshot
+//
+// Responses:
+//   - repo.Snapshot: the snapshot found
+//   - error: hostip.ErrInvalid, ErrInvalidTimestamp or ErrInvalidMode for bad input, repo.ErrNotFound if there is no
+//     such snapshot {nil | error}
+func (service *SnapshotService) FindSnapshot(ctx context.Context, host_ip string, at string, mode string) (repo.Snapshot, error) {
+	host_ip, err := hostip.Canonical(host_ip)
+	if err != nil {
+		return repo.Snapshot{}, err
+	}
+	timestamp, err := service.resolveTimestamp(ctx, host_ip, strings.TrimSpace(at), strings.ToLower(mode))
+	if err != nil {
+		return repo.Snapshot{}, err
+	}
+	return service.snapshotRepo.GetSnapshotByTimeStamp(ctx, host_ip, timestamp)
+}
+
+// resolveTimestamp finds the timestamp of the snapshot FindSnapshot returns. In exact mode the timestamp is
+// returned as given, whether or not there is a snapshot at it.
+func (service *SnapshotService) resolveTimestamp(ctx context.Context, host_ip string, at string, mode string) (time.Time, error) {
+	switch alias := strings.ToLower(at); alias {
+	case AtLatest, AtEarliest, AtPrevious:
+		if mode != "" && mode != ModeExact {
+			return time.Time{}, fmt.Errorf("%w: mode cannot be used with %q", ErrInvalidMode, alias)
+		}
+		query := repo.SnapshotQuery{Descending: alias != AtEarliest, Limit: 1}
+		if alias == AtPrevious {
+			query.Limit = 2
+		}
+		return service.nthTimestamp(ctx, host_ip, query, query.Limit-1)
+	}
+
+	timestamp, err := snapshotname.ParseTimestamp(at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidTimestamp, err)
+	}
+	switch mode {
+	case "", ModeExact:
+		return timestamp, nil
+	case ModeBefore:
+		return service.nthTimestamp(ctx, host_ip, repo.SnapshotQuery{Until: timestamp, Descending: true, Limit: 1}, 0)
+	case ModeAfter:
+		return service.nthTimestamp(ctx, host_ip, repo.SnapshotQuery{Since: timestamp, Limit: 1}, 0)
+	case ModeNearest:
+		before, beforeErr := service.nthTimestamp(ctx, host_ip, repo.SnapshotQuery{Until: timestamp, Descending: true, Limit: 1}, 0)
+		after, afterErr := service.nthTimestamp(ctx, host_ip, repo.SnapshotQuery{Since: timestamp, Limit: 1}, 0)
+		switch {
+		case beforeErr != nil && !errors.Is(beforeErr, repo.ErrNotFound):
+			return time.Time{}, beforeErr
+		case afterErr != nil && !errors.Is(afterErr, repo.ErrNotFound):
+			return time.Time{}, afterErr
+		case beforeErr != nil:
+			return after, afterErr
+		case afterErr != nil:
+			return before, nil
+		case after.Sub(timestamp) < timestamp.Sub(before):
+			return after, nil
+		default:
+			return before, nil
+		}
+	default:
+		return time.Time{}, fmt.Errorf("%w: %q, expected one of %s, %s, %s, %s", ErrInvalidMode, mode, ModeExact, ModeBefore, ModeAfter, ModeNearest)
+	}
+}
+
+// nthTimestamp returns the timestamp at index of a listing, or repo.ErrNotFound if the listing is shorter
+func (service *SnapshotService) nthTimestamp(ctx context.Context, host_ip string, query repo.SnapshotQuery, index int) (time.Time, error) {
+	timestamps, err := service.snapshotRepo.ListHostSnapshots(ctx, host_ip, query)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(timestamps) <= index {
+		return time.Time{}, repo.ErrNotFound
+	}
+	return timestamps[index], nil
+}
+
+// SnapshotsInRange returns a page of the snapshots of a host, ordered by time, for options as for
+// ListSnapshotsForHost. options.Since and options.Until are the range.
+//
+// Responses:
+//   - []repo.Snapshot: the snapshots
+//   - string: the cursor of the next page, empty on the last page
+//   - error: as for ListSnapshotsForHost {nil | error}
+func (service *SnapshotService) SnapshotsInRange(ctx context.Context, host_ip string, options ListOptions) ([]repo.Snapshot, string, error) {
+	page, err := service.ListSnapshotsForHost(ctx, host_ip, options)
+	if err != nil {
+		return nil, "", err
+	}
+	snapshots := make([]repo.Snapshot, 0, len(page.Items))
+	for _, timestamp := range page.Items {
+		snapshot, err := service.GetSnapshot(ctx, host_ip, timestamp)
+		if errors.Is(err, repo.ErrNotFound) {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, page.Next, nil
+}
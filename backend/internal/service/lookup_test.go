@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLookupService creates a service over an in-memory repo with snapshots of 10.0.0.1 at the offsets from jan1
+func newLookupService(t *testing.T, offsets ...time.Duration) *SnapshotService {
+	snapshotRepo := repo.NewMemorySnapshotRepo()
+	for _, offset := range offsets {
+		require.NoError(t, snapshotRepo.Insert(context.Background(), repo.Snapshot{Host_IP: "10.0.0.1", Timestamp: lookupJan1.Add(offset), File_PWD: "ab/blob.json"}))
+	}
+	return NewSnapshotService(snapshotRepo, blobstore.NewMemoryStore())
+}
+
+var lookupJan1 = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSnapshotService_FindSnapshot(t *testing.T) {
+	tests := []struct {
+		name          string
+		at            string
+		mode          string
+		expected      time.Duration
+		expectedError error
+	}{
+		{name: "exact", at: "2025-01-02T12:00:00Z", expected: 24 * time.Hour},
+		{name: "exact with mode", at: "2025-01-02T12:00:00Z", mode: "exact", expected: 24 * time.Hour},
+		{name: "exact miss", at: "2025-01-02T13:00:00Z", expectedError: repo.ErrNotFound},
+		{name: "before", at: "2025-01-02T13:00:00Z", mode: "before", expected: 24 * time.Hour},
+		{name: "before includes at", at: "2025-01-02T12:00:00Z", mode: "before", expected: 24 * time.Hour},
+		{name: "before the first", at: "2025-01-01T11:00:00Z", mode: "before", expectedError: repo.ErrNotFound},
+		{name: "after", at: "2025-01-02T13:00:00Z", mode: "after", expected: 72 * time.Hour},
+		{name: "after the last", at: "2025-01-05T00:00:00Z", mode: "after", expectedError: repo.ErrNotFound},
+		{name: "nearest is later", at: "2025-01-03T13:00:00Z", mode: "nearest", expected: 72 * time.Hour},
+		{name: "nearest is earlier", at: "2025-01-03T11:00:00Z", mode: "NEAREST", expected: 24 * time.Hour},
+		{name: "nearest tie is earlier", at: "2025-01-03T12:00:00Z", mode: "nearest", expected: 24 * time.Hour},
+		{name: "nearest before the first", at: "2025-01-01T00:00:00Z", mode: "nearest", expected: 0},
+		{name: "nearest after the last", at: "2025-02-01T00:00:00Z", mode: "nearest", expected: 72 * time.Hour},
+		{name: "latest", at: "latest", expected: 72 * time.Hour},
+		{name: "earliest", at: "Earliest", expected: 0},
+		{name: "previous", at: "previous", expected: 24 * time.Hour},
+		{name: "alias with mode", at: "latest", mode: "before", expectedError: ErrInvalidMode},
+		{name: "unknown mode", at: "2025-01-02T12:00:00Z", mode: "closest", expectedError: ErrInvalidMode},
+		{name: "invalid timestamp", at: "yesterday", expectedError: ErrInvalidTimestamp},
+	}
+
+	service := newLookupService(t, 0, 24*time.Hour, 72*time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := service.FindSnapshot(context.Background(), "10.0.0.1", tt.at, tt.mode)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, lookupJan1.Add(tt.expected), snapshot.Timestamp)
+		})
+	}
+}
+
+func TestSnapshotService_FindSnapshot_FewSnapshots(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := newLookupService(t).FindSnapshot(ctx, "10.0.0.1", "latest", "")
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+	_, err = newLookupService(t).FindSnapshot(ctx, "10.0.0.1", "2025-01-01T12:00:00Z", "nearest")
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+	_, err = newLookupService(t, 0).FindSnapshot(ctx, "10.0.0.1", "previous", "")
+	assert.ErrorIs(t, err, repo.ErrNotFound)
+}
+
+func TestSnapshotService_SnapshotsInRange(t *testing.T) {
+	ctx := context.Background()
+	service := newLookupService(t, 0, time.Hour, 2*time.Hour, 3*time.Hour)
+
+	// Pages of two, following the cursor to the end
+	options := ListOptions{Since: "2025-01-01T12:30:00Z", Limit: "2"}
+	snapshots, next, err := service.SnapshotsInRange(ctx, "10.0.0.1", options)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, lookupJan1.Add(time.Hour), snapshots[0].Timestamp)
+	assert.Equal(t, lookupJan1.Add(2*time.Hour), snapshots[1].Timestamp)
+	require.NotEmpty(t, next)
+
+	options.Cursor = next
+	snapshots, next, err = service.SnapshotsInRange(ctx, "10.0.0.1", options)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, lookupJan1.Add(3*time.Hour), snapshots[0].Timestamp)
+	assert.Empty(t, next)
+
+	snapshots, _, err = service.SnapshotsInRange(ctx, "10.0.0.1", ListOptions{Until: "2025-01-01T13:00:00Z", Sort: "desc"})
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, lookupJan1.Add(time.Hour), snapshots[0].Timestamp)
+	assert.Equal(t, lookupJan1, snapshots[1].Timestamp)
+
+	_, _, err = service.SnapshotsInRange(ctx, "10.0.0.1", ListOptions{Since: "later"})
+	assert.ErrorIs(t, err, ErrInvalidListOptions)
+}
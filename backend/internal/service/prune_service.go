@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/repo"
+)
+
+// RetentionPolicy decides which snapshots of a host are kept as they age
+//
+// Summary: Snapshots younger than KeepAll are all kept. Snapshots older than KeepAll and younger than KeepDaily keep
+// the latest snapshot of each UTC day, and older snapshots keep the latest of each ISO week. The first and latest
+// snapshot of every host are always kept. Soft deleted snapshots are purged once they have been deleted for
+// PurgeDeletedAfter.
+type RetentionPolicy struct {
+	KeepAll           time.Duration
+	KeepDaily         time.Duration
+	PurgeDeletedAfter time.Duration
+}
+
+// Validate checks that the tiers are in order
+func (policy RetentionPolicy) Validate() error {
+	if policy.KeepAll < 0 {
+		return fmt.Errorf("Invalid retention policy: keep all must not be negative")
+	}
+	if policy.KeepDaily < policy.KeepAll {
+		return fmt.Errorf("Invalid retention policy: keep daily (%s) must not be shorter than keep all (%s)", policy.KeepDaily, policy.KeepAll)
+	}
+	if policy.PurgeDeletedAfter < 0 {
+		return fmt.Errorf("Invalid retention policy: purge deleted after must not be negative")
+	}
+	return nil
+}
+
+// bucket is the retention bucket of a snapshot. Only the latest snapshot in a bucket is kept, and snapshots in the
+// keep all tier get a bucket of their own.
+func (policy RetentionPolicy) bucket(snapshot repo.Snapshot, now time.Time) string {
+	timestamp := snapshot.Timestamp.UTC()
+	age := now.Sub(timestamp)
+	switch {
+	case age < policy.KeepAll:
+		return "all " + timestamp.Format(time.RFC3339Nano)
+	case age < policy.KeepDaily:
+		return "day " + timestamp.Format(time.DateOnly)
+	default:
+		year, week := timestamp.ISOWeek()
+		return fmt.Sprintf("week %d-%02d", year, week)
+	}
+}
+
+// PrunePlan lists the snapshots a retention policy removes. Delete are committed snapshots outside the policy, and
+// Purge are soft deleted snapshots past their grace period.
+type PrunePlan struct {
+	Kept   int
+	Delete []repo.Snapshot
+	Purge  []repo.Snapshot
+}
+
+// PruneResult is the outcome of removing one snapshot
+type PruneResult struct {
+	Snapshot    repo.Snapshot
+	BlobRemoved bool
+	Err         error
+}
+
+type PruneService struct {
+	snapshotRepo    repo.SnapshotRepo
+	snapshotService *SnapshotService
+	policy          RetentionPolicy
+}
+
+// NewPruneService creates the retention service. Snapshots are removed through snapshotService, which must be the
+// instance that stores uploads so that an upload reusing a blob cannot race its removal.
+func NewPruneService(snapshotRepo repo.SnapshotRepo, snapshotService *SnapshotService, policy RetentionPolicy) *PruneService {
+	return &PruneService{
+		snapshotRepo:    snapshotRepo,
+		snapshotService: snapshotService,
+		policy:          policy,
+	}
+}
+
+// Plan applies the retention policy to every committed snapshot, and finds the soft deleted snapshots to purge
+//
+// Params:
+//   - now: the time snapshot ages are measured from
+//
+// Responses:
+//   - PrunePlan: the snapshots to remove and purge, ordered by host and timestamp
+//   - error: error if the policy is invalid or the snapshots cannot be listed {nil | error}
+func (service *PruneService) Plan(ctx context.Context, now time.Time) (PrunePlan, error) {
+	if err := service.policy.Validate(); err != nil {
+		return PrunePlan{}, err
+	}
+	rows, err := service.snapshotRepo.ListAll(ctx)
+	if err != nil {
+		return PrunePlan{}, fmt.Errorf("Failed to list snapshots: %v", err)
+	}
+
+	plan := PrunePlan{Delete: []repo.Snapshot{}, Purge: []repo.Snapshot{}}
+	hosts := map[string][]repo.Snapshot{}
+	purgeBefore := now.Add(-service.policy.PurgeDeletedAfter)
+	for _, row := range rows {
+		switch row.Status {
+		case repo.StatusCommitted:
+			hosts[row.Host_IP] = append(hosts[row.Host_IP], row)
+		case repo.StatusDeleted:
+			if row.Deleted_At == nil || !row.Deleted_At.After(purgeBefore) {
+				plan.Purge = append(plan.Purge, row)
+			}
+		}
+	}
+	hostIPs := make([]string, 0, len(hosts))
+	for hostIP := range hosts {
+		hostIPs = append(hostIPs, hostIP)
+	}
+	sort.Strings(hostIPs)
+
+	for _, hostIP := range hostIPs {
+		snapshots := hosts[hostIP]
+		sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Timestamp.Before(snapshots[j].Timestamp) })
+		// Walking from the latest snapshot, the first one seen in each bucket is the one kept
+		seen := map[string]bool{}
+		keep := make([]bool, len(snapshots))
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			bucket := service.policy.bucket(snapshots[i], now)
+			keep[i] = !seen[bucket] || i == 0
+			seen[bucket] = true
+		}
+		for i, snapshot := range snapshots {
+			if keep[i] {
+				plan.Kept++
+			} else {
+				plan.Delete = append(plan.Delete, snapshot)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Prune removes the snapshots in a plan, those to delete first and then those to purge
+//
+// Summary: For each snapshot its stored differences are removed first, then its row, then its blob if no other row
+// references it. A row is only removed while it is still committed, for those to delete, or still deleted, for those
+// to purge, so a snapshot restored or deleted since the plan was made is kept with its blob and reported as failed.
+// References are counted when the row is gone, under a lock that uploads also take, so an upload reusing the blob
+// at the same time always keeps it. If pruning stops part way, or the blob cannot be removed, what is left is an
+// orphan blob, which fsck reports.
+func (service *PruneService) Prune(ctx context.Context, plan PrunePlan) []PruneResult {
+	results := make([]PruneResult, 0, len(plan.Delete)+len(plan.Purge))
+	for _, snapshot := range plan.Delete {
+		results = append(results, service.prune(ctx, snapshot, repo.StatusCommitted))
+	}
+	for _, snapshot := range plan.Purge {
+		results = append(results, service.prune(ctx, snapshot, repo.StatusDeleted))
+	}
+	return results
+}
+
+// prune removes a snapshot whose row has status, then its blob if nothing else references it
+func (service *PruneService) prune(ctx context.Context, snapshot repo.Snapshot, status string) PruneResult {
+	result := PruneResult{Snapshot: snapshot}
+	if err := service.snapshotService.removeSnapshot(ctx, snapshot, status); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			err = fmt.Errorf("Snapshot is no longer %s, kept: %w", status, err)
+		}
+		result.Err = err
+		return result
+	}
+	result.BlobRemoved, result.Err = service.snapshotService.removeUnreferencedBlob(ctx, snapshot.File_PWD)
+	return result
+}
+
+// Run plans and prunes every interval until ctx is cancelled. Results are logged.
+func (service *PruneService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.pruneOnce(ctx, time.Now()); err != nil {
+				log.Printf("Prune: FAILED %v", err)
+			}
+		}
+	}
+}
+
+func (service *PruneService) pruneOnce(ctx context.Context, now time.Time) error {
+	plan, err := service.Plan(ctx, now)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, result := range service.Prune(ctx, plan) {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", result.Snapshot.Host_IP, result.Snapshot.Timestamp.UTC().Format(time.RFC3339Nano), result.Err))
+		}
+	}
+	log.Printf("Prune: removed %d snapshots, kept %d", len(plan.Delete)+len(plan.Purge)-len(errs), plan.Kept)
+	return errors.Join(errs...)
+}
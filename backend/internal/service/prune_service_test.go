@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetentionPolicy = RetentionPolicy{KeepAll: 7 * 24 * time.Hour, KeepDaily: 30 * 24 * time.Hour}
+
+func retainedSnapshot(hostIP string, timestamp string, blobKey string) repo.Snapshot {
+	parsed, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		panic(err)
+	}
+	return repo.Snapshot{UUID: uuid.New(), Host_IP: hostIP, Timestamp: parsed, File_PWD: blobKey, Status: repo.StatusCommitted}
+}
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        RetentionPolicy
+		expectedError string
+	}{
+		{name: "valid", policy: testRetentionPolicy},
+		{name: "no tiers keeps only weekly", policy: RetentionPolicy{}},
+		{name: "negative keep all", policy: RetentionPolicy{KeepAll: -time.Hour}, expectedError: "must not be negative"},
+		{name: "daily shorter than all", policy: RetentionPolicy{KeepAll: 48 * time.Hour, KeepDaily: 24 * time.Hour}, expectedError: "must not be shorter"},
+		{name: "negative purge grace period", policy: RetentionPolicy{PurgeDeletedAfter: -time.Hour}, expectedError: "purge deleted after must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPruneService_Plan(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	rows := []repo.Snapshot{
+		// Weekly tier: the first snapshot is always kept, then the latest of the week
+		retainedSnapshot("10.0.0.1", "2024-12-02T09:00:00Z", "ab/first.json"),
+		retainedSnapshot("10.0.0.1", "2024-12-03T09:00:00Z", "ab/weekly-old.json"),
+		retainedSnapshot("10.0.0.1", "2024-12-04T09:00:00Z", "ab/weekly.json"),
+		// Daily tier: the latest of each day
+		retainedSnapshot("10.0.0.1", "2025-02-10T08:00:00Z", "ab/daily-old.json"),
+		retainedSnapshot("10.0.0.1", "2025-02-10T20:00:00Z", "ab/daily.json"),
+		retainedSnapshot("10.0.0.1", "2025-02-11T08:00:00Z", "ab/daily-next.json"),
+		// Keep all tier
+		retainedSnapshot("10.0.0.1", "2025-02-25T08:00:00Z", "ab/recent-1.json"),
+		retainedSnapshot("10.0.0.1", "2025-02-25T09:00:00Z", "ab/recent-2.json"),
+		// A host with one old snapshot keeps it, since it is both the first and latest
+		retainedSnapshot("10.0.0.2", "2024-01-01T00:00:00Z", "ab/only.json"),
+	}
+	pending := retainedSnapshot("10.0.0.1", "2024-12-03T10:00:00Z", "ab/pending.json")
+	pending.Status = repo.StatusPending
+	rows = append(rows, pending)
+
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("ListAll", ctx).Return(rows, nil)
+	pruneService := NewPruneService(mockRepo, nil, testRetentionPolicy)
+
+	plan, err := pruneService.Plan(ctx, now)
+
+	require.NoError(t, err)
+	deleted := []string{}
+	for _, snapshot := range plan.Delete {
+		deleted = append(deleted, snapshot.File_PWD)
+	}
+	assert.Equal(t, []string{"ab/weekly-old.json", "ab/daily-old.json"}, deleted)
+	assert.Equal(t, 7, plan.Kept)
+}
+
+func TestPruneService_Plan_Errors(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := &MockSnapshotRepo{}
+	mockRepo.On("ListAll", ctx).Return([]repo.Snapshot{}, fmt.Errorf("database error"))
+
+	_, err := NewPruneService(mockRepo, nil, testRetentionPolicy).Plan(ctx, time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to list snapshots")
+
+	_, err = NewPruneService(mockRepo, nil, RetentionPolicy{KeepAll: time.Hour}).Plan(ctx, time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid retention policy")
+}
+
+// deleteFailingBlobStore fails to delete one key
+type deleteFailingBlobStore struct {
+	*blobstore.MemoryStore
+	failKey string
+}
+
+func (store deleteFailingBlobStore) Delete(ctx context.Context, key string) error {
+	if key == store.failKey {
+		return fmt.Errorf("permission denied")
+	}
+	return store.MemoryStore.Delete(ctx, key)
+}
+
+func TestPruneService_Prune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	memoryStore := blobstore.NewMemoryStore()
+	for _, key := range []string{"ab/shared.json", "ab/own.json", "ab/stuck.json", "ab/latest.json"} {
+		require.NoError(t, memoryStore.Put(ctx, key, strings.NewReader("{}")))
+	}
+	blobStore := deleteFailingBlobStore{MemoryStore: memoryStore, failKey: "ab/stuck.json"}
+
+	// Weeks start on Monday 2024-12-02 and 2024-12-09
+	first := retainedSnapshot("10.0.0.1", "2024-12-02T09:00:00Z", "ab/shared.json")
+	sharesBlob := retainedSnapshot("10.0.0.1", "2024-12-03T09:00:00Z", "ab/shared.json")
+	weekly := retainedSnapshot("10.0.0.1", "2024-12-04T09:00:00Z", "ab/shared.json")
+	ownBlob := retainedSnapshot("10.0.0.1", "2024-12-09T09:00:00Z", "ab/own.json")
+	stuck := retainedSnapshot("10.0.0.1", "2024-12-10T09:00:00Z", "ab/stuck.json")
+	nextWeekly := retainedSnapshot("10.0.0.1", "2024-12-11T09:00:00Z", "ab/latest.json")
+	latest := retainedSnapshot("10.0.0.1", "2025-02-28T09:00:00Z", "ab/latest.json")
+
+	mockRepo := &MockSnapshotRepo{}
+	mockDiffRepo := &MockDifferenceRepo{}
+	mockRepo.On("ListAll", ctx).Return([]repo.Snapshot{first, sharesBlob, weekly, ownBlob, stuck, nextWeekly, latest}, nil)
+	for _, snapshot := range []repo.Snapshot{sharesBlob, ownBlob, stuck} {
+		mockDiffRepo.On("DeleteForSnapshot", ctx, snapshot.Host_IP, snapshot.Timestamp).Return(nil)
+		mockRepo.On("DeleteWithStatus", ctx, snapshot.UUID, snapshot.Status).Return(nil)
+	}
+	// Counted once the pruned row is gone
+	mockRepo.On("CountBlobReferences", ctx, "ab/shared.json").Return(int64(2), nil)
+	mockRepo.On("CountBlobReferences", ctx, "ab/own.json").Return(int64(0), nil)
+	mockRepo.On("CountBlobReferences", ctx, "ab/stuck.json").Return(int64(0), nil)
+	snapshotService := NewSnapshotService(mockRepo, blobStore)
+	snapshotService.DifferenceRepo = mockDiffRepo
+	pruneService := NewPruneService(mockRepo, snapshotService, testRetentionPolicy)
+
+	plan, err := pruneService.Plan(ctx, now)
+	require.NoError(t, err)
+	results := pruneService.Prune(ctx, plan)
+
+	require.Len(t, results, 3)
+	assert.Equal(t, sharesBlob.UUID, results[0].Snapshot.UUID)
+	assert.NoError(t, results[0].Err)
+	assert.False(t, results[0].BlobRemoved, "blob is still used by other snapshots")
+	assert.Equal(t, ownBlob.UUID, results[1].Snapshot.UUID)
+	assert.NoError(t, results[1].Err)
+	assert.True(t, results[1].BlobRemoved)
+	assert.Equal(t, stuck.UUID, results[2].Snapshot.UUID)
+	assert.ErrorContains(t, results[2].Err, "Failed to remove blob")
+
+	blobs, err := memoryStore.List(ctx, "")
+	require.NoError(t, err)
+	keys := []string{}
+	for _, blob := range blobs {
+		keys = append(keys, blob.Key)
+	}
+	// The snapshot whose blob could not be removed is gone, leaving an orphan blob
+	assert.Equal(t, []string{"ab/latest.json", "ab/shared.json", "ab/stuck.json"}, keys)
+	assert.False(t, results[2].BlobRemoved)
+	mockRepo.AssertExpectations(t)
+	mockDiffRepo.AssertExpectations(t)
+}
+
+func TestPruneService_Prune_DifferenceError(t *testing.T) {
+	ctx := context.Background()
+	blobStore := blobstore.NewMemoryStore()
+	snapshot := retainedSnapshot("10.0.0.1", "2024-12-01T09:00:00Z", "ab/old.json")
+	mockRepo := &MockSnapshotRepo{}
+	mockDiffRepo := &MockDifferenceRepo{}
+	mockDiffRepo.On("DeleteForSnapshot", ctx, snapshot.Host_IP, snapshot.Timestamp).Return(fmt.Errorf("database error"))
+	require.NoError(t, blobStore.Put(ctx, snapshot.File_PWD, strings.NewReader("{}")))
+	snapshotService := NewSnapshotService(mockRepo, blobStore)
+	snapshotService.DifferenceRepo = mockDiffRepo
+	pruneService := NewPruneService(mockRepo, snapshotService, testRetentionPolicy)
+
+	results := pruneService.Prune(ctx, PrunePlan{Delete: []repo.Snapshot{snapshot}})
+
+	require.Len(t, results, 1)
+	assert.ErrorContains(t, results[0].Err, "Failed to remove stored differences")
+	mockRepo.AssertNotCalled(t, "DeleteWithStatus", ctx, snapshot.UUID, snapshot.Status)
+	_, err := blobStore.Stat(ctx, snapshot.File_PWD)
+	assert.NoError(t, err, "the blob is kept with its row")
+}
+
+func TestPruneService_Purge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	blobStore := blobstore.NewMemoryStore()
+	for _, key := range []string{"ab/shared.json", "ab/expired.json", "ab/recent.json"} {
+		require.NoError(t, blobStore.Put(ctx, key, strings.NewReader("{}")))
+	}
+	deletedSnapshot := func(timestamp string, blobKey string, deletedAt time.Time) repo.Snapshot {
+		snapshot := retainedSnapshot("10.0.0.1", timestamp, blobKey)
+		snapshot.Status = repo.StatusDeleted
+		snapshot.Deleted_At = &deletedAt
+		return snapshot
+	}
+	latest := retainedSnapshot("10.0.0.1", "2025-02-28T09:00:00Z", "ab/shared.json")
+	// Deleted past the grace period, but its blob is also used by a committed snapshot
+	sharesBlob := deletedSnapshot("2025-02-27T09:00:00Z", "ab/shared.json", now.Add(-8*24*time.Hour))
+	expired := deletedSnapshot("2025-02-26T09:00:00Z", "ab/expired.json", now.Add(-7*24*time.Hour))
+	recent := deletedSnapshot("2025-02-25T09:00:00Z", "ab/recent.json", now.Add(-time.Hour))
+
+	mockRepo := &MockSnapshotRepo{}
+	mockDiffRepo := &MockDifferenceRepo{}
+	mockRepo.On("ListAll", ctx).Return([]repo.Snapshot{latest, sharesBlob, expired, recent}, nil)
+	for _, snapshot := range []repo.Snapshot{sharesBlob, expired} {
+		mockDiffRepo.On("DeleteForSnapshot", ctx, snapshot.Host_IP, snapshot.Timestamp).Return(nil)
+		mockRepo.On("DeleteWithStatus", ctx, snapshot.UUID, snapshot.Status).Return(nil)
+	}
+	mockRepo.On("CountBlobReferences", ctx, "ab/shared.json").Return(int64(1), nil)
+	mockRepo.On("CountBlobReferences", ctx, "ab/expired.json").Return(int64(0), nil)
+	policy := testRetentionPolicy
+	policy.PurgeDeletedAfter = 7 * 24 * time.Hour
+	snapshotService := NewSnapshotService(mockRepo, blobStore)
+	snapshotService.DifferenceRepo = mockDiffRepo
+	pruneService := NewPruneService(mockRepo, snapshotService, policy)
+
+	plan, err := pruneService.Plan(ctx, now)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Delete)
+	assert.Equal(t, 1, plan.Kept)
+	require.Len(t, plan.Purge, 2)
+	results := pruneService.Prune(ctx, plan)
+
+	require.Len(t, results, 2)
+	assert.Equal(t, sharesBlob.UUID, results[0].Snapshot.UUID)
+	assert.NoError(t, results[0].Err)
+	assert.False(t, results[0].BlobRemoved, "blob is still used by a committed snapshot")
+	assert.Equal(t, expired.UUID, results[1].Snapshot.UUID)
+	assert.NoError(t, results[1].Err)
+	assert.True(t, results[1].BlobRemoved)
+
+	blobs, err := blobStore.List(ctx, "")
+	require.NoError(t, err)
+	keys := []string{}
+	for _, blob := range blobs {
+		keys = append(keys, blob.Key)
+	}
+	assert.Equal(t, []string{"ab/recent.json", "ab/shared.json"}, keys)
+	mockRepo.AssertNotCalled(t, "DeleteWithStatus", ctx, recent.UUID, recent.Status)
+	mockRepo.AssertExpectations(t)
+	mockDiffRepo.AssertExpectations(t)
+}
+
+// countHookSnapshotRepo calls onCount after each CountBlobReferences, to run code between prune counting the
+// references of a blob and removing it
+type countHookSnapshotRepo struct {
+	repo.SnapshotRepo
+	onCount func()
+}
+
+func (snapshotRepo countHookSnapshotRepo) CountBlobReferences(ctx context.Context, blobKey string) (int64, error) {
+	count, err := snapshotRepo.SnapshotRepo.CountBlobReferences(ctx, blobKey)
+	snapshotRepo.onCount()
+	return count, err
+}
+
+// Test that purging a snapshot while the same content is uploaded again never leaves the upload without its blob
+func TestPruneService_Prune_RacesUpload(t *testing.T) {
+	ctx := context.Background()
+	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+	blobStore := blobstore.NewMemoryStore()
+	var onCount func()
+	snapshotRepo := countHookSnapshotRepo{SnapshotRepo: repo.NewMemorySnapshotRepo(), onCount: func() {
+		if onCount != nil {
+			onCount()
+		}
+	}}
+	snapshotService := NewSnapshotService(snapshotRepo, blobStore)
+	pruneService := NewPruneService(snapshotRepo, snapshotService, RetentionPolicy{})
+
+	require.NoError(t, snapshotService.CreateSnapshot(ctx, strings.NewReader(validSnapshotContent), filename))
+	deleted, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "192.168.1.1", lookupJan1)
+	require.NoError(t, err)
+	require.NoError(t, snapshotRepo.SoftDelete(ctx, deleted.UUID, lookupJan1))
+	plan, err := pruneService.Plan(ctx, lookupJan1)
+	require.NoError(t, err)
+	require.Len(t, plan.Purge, 1)
+
+	// Once prune finds no references, the upload is given the chance to find the blob and commit before it is removed
+	uploaded := make(chan error, 1)
+	onCount = func() {
+		onCount = nil
+		go func() {
+			uploaded <- snapshotService.CreateSnapshot(ctx, strings.NewReader(validSnapshotContent), filename)
+		}()
+		time.Sleep(100 * time.Millisecond)
+	}
+	results := pruneService.Prune(ctx, plan)
+	require.NoError(t, <-uploaded)
+
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	snapshot, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "192.168.1.1", lookupJan1)
+	require.NoError(t, err)
+	_, err = blobStore.Stat(ctx, snapshot.File_PWD)
+	assert.NoError(t, err, "the committed snapshot has its blob")
+}
+
+// Test that a snapshot restored after the plan is made is kept with its blob
+func TestPruneService_Prune_RestoredAfterPlan(t *testing.T) {
+	ctx := context.Background()
+	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+	blobStore := blobstore.NewMemoryStore()
+	snapshotRepo := repo.NewMemorySnapshotRepo()
+	snapshotService := NewSnapshotService(snapshotRepo, blobStore)
+	pruneService := NewPruneService(snapshotRepo, snapshotService, RetentionPolicy{})
+
+	require.NoError(t, snapshotService.CreateSnapshot(ctx, strings.NewReader(validSnapshotContent), filename))
+	_, err := snapshotService.DeleteSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+	require.NoError(t, err)
+	plan, err := pruneService.Plan(ctx, time.Now())
+	require.NoError(t, err)
+	require.Len(t, plan.Purge, 1)
+
+	restored, err := snapshotService.RestoreSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+	require.NoError(t, err)
+	results := pruneService.Prune(ctx, plan)
+
+	require.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Err, repo.ErrNotFound)
+	assert.False(t, results[0].BlobRemoved)
+	snapshot, err := snapshotRepo.GetSnapshotByTimeStamp(ctx, "192.168.1.1", lookupJan1)
+	require.NoError(t, err)
+	assert.Equal(t, restored.UUID, snapshot.UUID)
+	_, err = blobStore.Stat(ctx, snapshot.File_PWD)
+	assert.NoError(t, err, "the restored snapshot has its blob")
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/model"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
+	"github.com/endingwithali/2025censys/internal/version"
+	"github.com/google/uuid"
+)
+
+// ErrNoServiceIndex is returned by Search and Reindex when the service has no ServiceIndex
+var ErrNoServiceIndex = errors.New("Search is not available, no service index is configured")
+
+// SearchOptions are the query params of a search, as given by the client. Every field is optional, and a service
+// must match all of those given.
+//
+//   - ListOptions: Cursor, Limit, Sort and Prefix as for ListHosts. Limit counts hosts. Since and Until are not
+//     allowed, At picks the snapshots searched.
+//   - Port: the port number
+//   - Protocol, Vendor, Product, TLSVersion: the value, compared case-insensitively
+//   - Version: a version range as parsed by version.ParseRange, e.g. "<1.24" or ">=1.20,<1.24"
+//   - At: search each host as of its latest snapshot at or before this timestamp, in any format accepted by
+//     snapshotname.ParseTimestamp. Empty or AtLatest searches the latest snapshots.
+type SearchOptions struct {
+	ListOptions
+	Port       string
+	Protocol   string
+	Vendor     string
+	Product    string
+	Version    string
+	TLSVersion string
+	At         string
+}
+
+// SearchHit is a host with services matching a search, as of the snapshot taken at Timestamp
+type SearchHit struct {
+	Host_IP   string               `json:"ip"`
+	Timestamp time.Time            `json:"timestamp"`
+	Services  []repo.ServiceRecord `json:"services"`
+}
+
+// Search finds the hosts running matching services, ordered by IP as text
+//
+// Summary: Each host is searched as of one snapshot, its latest or its latest at options.At, using the services
+// indexed when the snapshot was stored. A host is a hit if any of its services matches every filter, and only the
+// matching services are returned.
+//
+// Example:
+// Search(ctx, SearchOptions{Product: "nginx", Version: "<1.24"}) -> the hosts running nginx older than 1.24
+// Search(ctx, SearchOptions{Port: "22", At: "2025-09-01T00:00:00Z"}) -> the hosts exposing port 22 on 1 September
+//
+// Responses:
+//   - []SearchHit: the hosts of the page
+//   - string: the cursor of the next page, empty on the last page
+//   - error: ErrInvalidListOptions for bad input, ErrNoServiceIndex if there is no ServiceIndex {nil | error}
+func (service *SnapshotService) Search(ctx context.Context, options SearchOptions) ([]SearchHit, string, error) {
+	if service.ServiceIndex == nil {
+		return nil, "", ErrNoServiceIndex
+	}
+	query, err := parseSearchOptions(options)
+	if err != nil {
+		return nil, "", err
+	}
+	pageSize := query.Limit
+	// One more host than the limit is fetched to find out if there is a next page
+	query.Limit++
+
+	records, err := service.ServiceIndex.Search(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+	hits := []SearchHit{}
+	for _, record := range records {
+		if len(hits) == 0 || hits[len(hits)-1].Host_IP != record.Host_IP {
+			hits = append(hits, SearchHit{Host_IP: record.Host_IP, Timestamp: record.Timestamp, Services: []repo.ServiceRecord{}})
+		}
+		hit := &hits[len(hits)-1]
+		hit.Services = append(hit.Services, record)
+	}
+	if len(hits) <= pageSize {
+		return hits, "", nil
+	}
+	hits = hits[:pageSize]
+	return hits, base64.RawURLEncoding.EncodeToString([]byte(hits[pageSize-1].Host_IP)), nil
+}
+
+func parseSearchOptions(options SearchOptions) (repo.ServiceQuery, error) {
+	if options.Since != "" || options.Until != "" {
+		return repo.ServiceQuery{}, fmt.Errorf("%w: since and until do not apply to searches, use at", ErrInvalidListOptions)
+	}
+	list, err := parseListOptions(options.ListOptions)
+	if err != nil {
+		return repo.ServiceQuery{}, err
+	}
+	prefix, err := parsePrefix(options.Prefix)
+	if err != nil {
+		return repo.ServiceQuery{}, err
+	}
+	query := repo.ServiceQuery{
+		Protocol:   strings.TrimSpace(options.Protocol),
+		Vendor:     strings.TrimSpace(options.Vendor),
+		Product:    strings.TrimSpace(options.Product),
+		TLSVersion: strings.TrimSpace(options.TLSVersion),
+		Prefix:     prefix,
+		After:      list.after,
+		Descending: list.descending,
+		Limit:      list.limit,
+	}
+	if options.Port != "" {
+		port, err := strconv.Atoi(options.Port)
+		if err != nil || port < 1 || port > 65535 {
+			return repo.ServiceQuery{}, fmt.Errorf("%w: port must be a number from 1 to 65535", ErrInvalidListOptions)
+		}
+		query.Port = port
+	}
+	if query.Versions, err = version.ParseRange(options.Version); err != nil {
+		return repo.ServiceQuery{}, fmt.Errorf("%w: %v", ErrInvalidListOptions, err)
+	}
+	if at := strings.TrimSpace(options.At); at != "" && !strings.EqualFold(at, AtLatest) {
+		if query.At, err = snapshotname.ParseTimestamp(at); err != nil {
+			return repo.ServiceQuery{}, fmt.Errorf("%w: at: %v", ErrInvalidListOptions, err)
+		}
+	}
+	return query, nil
+}
+
+// indexServices indexes the services of a host snapshot, if there is a ServiceIndex
+func (service *SnapshotService) indexServices(ctx context.Context, snapshotID uuid.UUID, hostSnapshot model.HostSnapshot) error {
+	if service.ServiceIndex == nil {
+		return nil
+	}
+	return service.ServiceIndex.Index(ctx, snapshotID, serviceRecords(hostSnapshot))
+}
+
+// serviceRecords are the services of a host snapshot, as indexed for Search
+func serviceRecords(hostSnapshot model.HostSnapshot) []repo.ServiceRecord {
+	records := make([]repo.ServiceRecord, 0, len(hostSnapshot.Services))
+	for _, hostService := range hostSnapshot.Services {
+		record := repo.ServiceRecord{Port: hostService.Port, Protocol: hostService.Protocol}
+		if hostService.Software != nil {
+			record.Vendor = hostService.Software.Vendor
+			record.Product = hostService.Software.Product
+			record.Version = hostService.Software.Version
+		}
+		if hostService.TLS != nil {
+			record.TLS_Version = hostService.TLS.Version
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// ReindexResult is the outcome of indexing the services of one snapshot. Services is the number indexed.
+type ReindexResult struct {
+	Snapshot repo.Snapshot
+	Services int
+	Err      error
+}
+
+// Reindex indexes the services of every committed and soft deleted snapshot again, for snapshots stored before
+// there was a service index, or whose indexed services were lost
+//
+// Summary: Each snapshot is read from the blob store and its services replace those indexed for it, see
+// indexContents.
+//
+// Responses:
+//   - []ReindexResult: one result per snapshot, ordered by host and timestamp
+//   - error: ErrNoServiceIndex if there is no ServiceIndex, or error if the snapshots cannot be listed {nil | error}
+func (service *SnapshotService) Reindex(ctx context.Context, progress func(ReindexResult)) ([]ReindexResult, error) {
+	if service.ServiceIndex == nil {
+		return nil, ErrNoServiceIndex
+	}
+	snapshots, err := service.snapshotRepo.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := []ReindexResult{}
+	for _, snapshot := range snapshots {
+		if snapshot.Status == repo.StatusPending {
+			continue
+		}
+		result := ReindexResult{Snapshot: snapshot}
+		contents, err := readSnapshotContents(ctx, service.BlobStore, snapshot)
+		if err == nil {
+			result.Services, err = service.indexContents(ctx, snapshot.UUID, contents)
+		}
+		result.Err = err
+		results = append(results, result)
+		if progress != nil {
+			progress(result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSearchService creates a service over in-memory repos, indexing the services of the snapshots it stores
+func newSearchService(t *testing.T) *SnapshotService {
+	snapshotRepo := repo.NewMemorySnapshotRepo()
+	service := NewSnapshotService(snapshotRepo, blobstore.NewMemoryStore())
+	service.ServiceIndex = repo.NewMemoryServiceIndexRepo(snapshotRepo)
+	return service
+}
+
+// uploadServices stores a snapshot of host_ip taken at timestamp with the services given as JSON
+func uploadServices(t *testing.T, service *SnapshotService, host_ip string, timestamp string, services ...string) {
+	t.Helper()
+	body := fmt.Sprintf(`{"ip":%q,"timestamp":%q,"services":[%s],"service_count":%d}`, host_ip, timestamp, strings.Join(services, ","), len(services))
+	require.NoError(t, service.CreateSnapshotFromBody(context.Background(), strings.NewReader(body)))
+}
+
+const (
+	sshService   = `{"port":22,"protocol":"SSH","software":{"vendor":"openbsd","product":"openssh","version":"8.9"}}`
+	nginx122     = `{"port":443,"protocol":"HTTP","software":{"vendor":"f5","product":"nginx","version":"1.22.1"},"tls":{"version":"tlsv1.2"}}`
+	nginx124     = `{"port":443,"protocol":"HTTP","software":{"vendor":"f5","product":"nginx","version":"1.24.0"},"tls":{"version":"tlsv1.3"}}`
+	plainService = `{"port":8080,"protocol":"HTTP"}`
+)
+
+func TestSnapshotService_Search(t *testing.T) {
+	service := newSearchService(t)
+	uploadServices(t, service, "10.0.0.1", "2025-01-01T12:00:00Z", sshService, nginx122)
+	uploadServices(t, service, "10.0.0.1", "2025-01-02T12:00:00Z", sshService, nginx124)
+	uploadServices(t, service, "10.0.0.2", "2025-01-01T12:00:00Z", nginx122, plainService)
+	uploadServices(t, service, "10.0.0.3", "2025-01-03T12:00:00Z", sshService)
+
+	tests := []struct {
+		name          string
+		options       SearchOptions
+		expected      map[string][]int
+		expectedError error
+	}{
+		{name: "everything", expected: map[string][]int{"10.0.0.1": {22, 443}, "10.0.0.2": {443, 8080}, "10.0.0.3": {22}}},
+		{name: "port", options: SearchOptions{Port: "22"}, expected: map[string][]int{"10.0.0.1": {22}, "10.0.0.3": {22}}},
+		{name: "product ignores case", options: SearchOptions{Product: "NGINX"}, expected: map[string][]int{"10.0.0.1": {443}, "10.0.0.2": {443}}},
+		{name: "version range of the latest", options: SearchOptions{Product: "nginx", Version: "<1.24"}, expected: map[string][]int{"10.0.0.2": {443}}},
+		{name: "version range at a time", options: SearchOptions{Product: "nginx", Version: ">=1.20,<1.24", At: "2025-01-01T18:00:00Z"}, expected: map[string][]int{"10.0.0.1": {443}, "10.0.0.2": {443}}},
+		{name: "tls version", options: SearchOptions{TLSVersion: "TLSv1.3"}, expected: map[string][]int{"10.0.0.1": {443}}},
+		{name: "before any snapshot", options: SearchOptions{At: "2024-12-31T00:00:00Z"}, expected: map[string][]int{}},
+		{name: "latest alias", options: SearchOptions{Protocol: "http", At: "latest"}, expected: map[string][]int{"10.0.0.1": {443}, "10.0.0.2": {443, 8080}}},
+		{name: "prefix", options: SearchOptions{ListOptions: ListOptions{Prefix: "10.0.0.3"}}, expected: map[string][]int{"10.0.0.3": {22}}},
+		{name: "invalid port", options: SearchOptions{Port: "70000"}, expectedError: ErrInvalidListOptions},
+		{name: "invalid version range", options: SearchOptions{Version: ">=1.20,<"}, expectedError: ErrInvalidListOptions},
+		{name: "invalid at", options: SearchOptions{At: "yesterday"}, expectedError: ErrInvalidListOptions},
+		{name: "since is not allowed", options: SearchOptions{ListOptions: ListOptions{Since: "2025-01-01T00:00:00Z"}}, expectedError: ErrInvalidListOptions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, next, err := service.Search(context.Background(), tt.options)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, next)
+			ports := map[string][]int{}
+			for _, hit := range hits {
+				for _, record := range hit.Services {
+					ports[hit.Host_IP] = append(ports[hit.Host_IP], record.Port)
+				}
+			}
+			assert.Equal(t, tt.expected, ports)
+		})
+	}
+}
+
+func TestSnapshotService_Search_Pages(t *testing.T) {
+	ctx := context.Background()
+	service := newSearchService(t)
+	for _, host_ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		uploadServices(t, service, host_ip, "2025-01-01T12:00:00Z", sshService, plainService)
+	}
+
+	// Limit counts hosts, not services
+	options := SearchOptions{ListOptions: ListOptions{Limit: "2", Sort: "desc"}}
+	hits, next, err := service.Search(ctx, options)
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	assert.Equal(t, "10.0.0.3", hits[0].Host_IP)
+	assert.Equal(t, "10.0.0.2", hits[1].Host_IP)
+	assert.Len(t, hits[1].Services, 2)
+	assert.Equal(t, lookupJan1, hits[1].Timestamp)
+	require.NotEmpty(t, next)
+
+	options.Cursor = next
+	hits, next, err = service.Search(ctx, options)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "10.0.0.1", hits[0].Host_IP)
+	assert.Empty(t, next)
+}
+
+func TestSnapshotService_Search_NoServiceIndex(t *testing.T) {
+	service := NewSnapshotService(repo.NewMemorySnapshotRepo(), blobstore.NewMemoryStore())
+
+	_, _, err := service.Search(context.Background(), SearchOptions{})
+	assert.ErrorIs(t, err, ErrNoServiceIndex)
+	_, err = service.Reindex(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNoServiceIndex)
+}
+
+func TestSnapshotService_Reindex(t *testing.T) {
+	ctx := context.Background()
+	snapshotRepo := repo.NewMemorySnapshotRepo()
+	service := NewSnapshotService(snapshotRepo, blobstore.NewMemoryStore())
+	// Stored before there was a service index
+	uploadServices(t, service, "10.0.0.1", "2025-01-01T12:00:00Z", sshService, nginx122)
+	uploadServices(t, service, "10.0.0.2", "2025-01-01T12:00:00Z", plainService)
+	require.NoError(t, snapshotRepo.Insert(ctx, repo.Snapshot{Host_IP: "10.0.0.3", Timestamp: lookupJan1, File_PWD: "ab/missing.json", Status: repo.StatusCommitted}))
+
+	service.ServiceIndex = repo.NewMemoryServiceIndexRepo(snapshotRepo)
+	hits, _, err := service.Search(ctx, SearchOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+
+	var progress []ReindexResult
+	results, err := service.Reindex(ctx, func(result ReindexResult) { progress = append(progress, result) })
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, results, progress)
+	assert.Equal(t, 2, results[0].Services)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, 1, results[1].Services)
+	assert.Error(t, results[2].Err, "the blob of 10.0.0.3 is missing")
+
+	hits, _, err = service.Search(ctx, SearchOptions{Product: "nginx"})
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "10.0.0.1", hits[0].Host_IP)
+}
@@ -1,126 +1,471 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
-	"net"
-	"os"
-	"path/filepath"
-	"regexp"
 	"time"
 
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/model"
 	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/endingwithali/2025censys/internal/snapshotname"
+	"github.com/google/uuid"
 )
 
+// ErrDuplicateSnapshot is returned (wrapped) when a snapshot already exists for the host and timestamp
+var ErrDuplicateSnapshot = errors.New("Attempting to add duplicate file for host")
+
+// ErrInvalidTimestamp is returned (wrapped) for a timestamp query that cannot be parsed
+var ErrInvalidTimestamp = errors.New("Incorrectly formatted timestamp string")
+
 type SnapshotService struct {
 	snapshotRepo repo.SnapshotRepo
-	FileLocation string
+	BlobStore    blobstore.BlobStore
+	// Compression is the codec new snapshots are stored with (see package compression). Empty stores them
+	// uncompressed. Existing snapshots keep the codec they were stored with.
+	Compression string
+	// ServiceIndex is where the services of new snapshots are indexed for Search. Nil indexes nothing, and Search
+	// returns ErrNoServiceIndex.
+	ServiceIndex repo.ServiceIndexRepo
+	// DifferenceRepo is where the differences between snapshots are stored (see DifferencesService). A snapshot's
+	// stored differences are removed whenever another snapshot may take its host and timestamp. Nil removes none.
+	DifferenceRepo repo.DifferenceRepo
+	blobLocks      blobLocks
 }
 
-func NewSnapshotService(snapshotRepo repo.SnapshotRepo, fileLocation string) *SnapshotService {
+func NewSnapshotService(snapshotRepo repo.SnapshotRepo, blobStore blobstore.BlobStore) *SnapshotService {
 	return &SnapshotService{
 		snapshotRepo: snapshotRepo,
-		FileLocation: fileLocation,
+		BlobStore:    blobStore,
 	}
 }
 
-func (service *SnapshotService) CreateSnapshot(ctx context.Context, file multipart.File, filename string) error {
-	hostIP, timestamp, err := service.parseFileName(filename)
+// CreateSnapshot validates an uploaded host snapshot and stores it in the blob store and the DB
+//
+// Summary: The host IP and timestamp are taken from the filename, and must match the ip and timestamp in the body
+//
+// Responses:
+//   - error: *model.ValidationError if the body is not a valid host snapshot or does not match the filename,
+//     other errors if it cannot be stored {nil | error}
+func (service *SnapshotService) CreateSnapshot(ctx context.Context, file io.Reader, filename string) error {
+	hostIP, timestamp, err := snapshotname.Parse(filename)
 	if err != nil {
 		return fmt.Errorf("Failed to parse file name: %s", err.Error())
 	}
 
-	filepath := filepath.Join(service.FileLocation, filename)
-	if _, err := os.Stat(filepath); err == nil {
-		return fmt.Errorf("Attempting to add duplicate file for host: %s", filename)
-	} else if !errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("Failed to create file: %v", err.Error())
+	contents, snapshot, err := readHostSnapshot(file)
+	if err != nil {
+		return err
 	}
+	if err := checkFileNameMatchesBody(hostIP, timestamp, snapshot); err != nil {
+		return err
+	}
+	return service.storeSnapshot(ctx, contents, snapshot, hostIP, timestamp, filename)
+}
 
-	log.Println("File Path", filepath)
-
-	/*
-		os.OpenFile: low-level open with flags + permissions.
-		dstPath: where you want to create the file.
-		Flags:
-			os.O_CREATE — create the file if it doesn’t exist.
-			os.O_WRONLY — open write-only (you’ll use dst.Write / io.Copy).
-			os.O_EXCL — exclusive create: if the path already exists, the open fails with EEXIST (no overwrite, no truncate). This is the safety switch that prevents clobbering an existing file.
-			0o644 (octal) — file mode on Unix: rw-r--r--\
-				Owner: read+write
-				Group: read
-				Others: read
-			(Subject to the process umask, so the actual bits may be more restrictive.)
-
-		ChatGPT ADDITION: these writes are not atomic - GPT says to use temp files to write to, then rename to final path using fsync
-	*/
-	dst, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+// CreateSnapshotFromBody validates an uploaded host snapshot and stores it in the blob store and the DB
+//
+// Summary: The host IP and timestamp are taken from the ip and timestamp in the body, so the upload can have any
+// filename. The snapshot is stored as host_<ip>_<timestamp>.json.
+//
+// Responses:
+//   - error: *model.ValidationError if the body is not a valid host snapshot, other errors if it cannot be stored {nil | error}
+func (service *SnapshotService) CreateSnapshotFromBody(ctx context.Context, file io.Reader) error {
+	contents, snapshot, err := readHostSnapshot(file)
 	if err != nil {
-		return fmt.Errorf("Failed to write file to disk: %v", err.Error())
+		return err
 	}
-	defer dst.Close()
+	hostIP, err := hostip.Canonical(snapshot.IP)
+	if err != nil {
+		return err
+	}
+	timestamp := snapshotname.NormalizeTime(snapshot.Timestamp)
+	return service.storeSnapshot(ctx, contents, snapshot, hostIP, timestamp, snapshotname.Format(hostIP, timestamp))
+}
 
-	_, err = io.Copy(dst, file)
+func readHostSnapshot(file io.Reader) ([]byte, model.HostSnapshot, error) {
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, model.HostSnapshot{}, fmt.Errorf("Failed to read uploaded file: %v", err.Error())
+	}
+	snapshot, err := model.ParseHostSnapshot(contents)
 	if err != nil {
-		_ = os.RemoveAll(filepath)
-		return fmt.Errorf("Failed to write contents of file to file on OS: %v", err.Error())
+		return nil, model.HostSnapshot{}, err
 	}
+	return contents, snapshot, nil
+}
 
-	err = service.snapshotRepo.Insert(ctx, hostIP, timestamp, filepath, filename)
+// checkFileNameMatchesBody guards against renamed files being indexed under the wrong host or time
+func checkFileNameMatchesBody(hostIP string, timestamp time.Time, snapshot model.HostSnapshot) error {
+	fields := []model.FieldError{}
+	bodyIP, err := hostip.Canonical(snapshot.IP)
+	if err != nil || bodyIP != hostIP {
+		fields = append(fields, model.FieldError{Field: "ip", Message: fmt.Sprintf("%q does not match %q from the filename", snapshot.IP, hostIP)})
+	}
+	if !snapshotname.NormalizeTime(snapshot.Timestamp).Equal(timestamp) {
+		fields = append(fields, model.FieldError{Field: "timestamp", Message: fmt.Sprintf("%q does not match %q from the filename", snapshot.Timestamp.Format(time.RFC3339Nano), timestamp.Format(time.RFC3339Nano))})
+	}
+	if len(fields) > 0 {
+		return &model.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// storeSnapshot writes a validated snapshot to the blob store and records it in the DB
+//
+// Summary: Snapshots are stored by content. The blob is stored under the key <sha256[:2]>/<sha256>.json, followed by
+// the extension of the compression codec, and a snapshot whose content was already uploaded (e.g. a host that did
+// not change between scans) reuses the existing blob instead of writing a new one. The services of the snapshot are
+// indexed before it is committed, so a committed snapshot is always searchable.
+func (service *SnapshotService) storeSnapshot(ctx context.Context, contents []byte, hostSnapshot model.HostSnapshot, hostIP string, timestamp time.Time, filename string) error {
+	_, err := service.snapshotRepo.GetSnapshotByTimeStamp(ctx, hostIP, timestamp)
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateSnapshot, filename)
+	} else if !errors.Is(err, repo.ErrNotFound) {
+		return fmt.Errorf("Failed to check for existing snapshot: %v", err.Error())
+	}
+
+	blob, stored, err := service.newBlob(contents)
 	if err != nil {
-		_ = os.RemoveAll(filepath)
+		return err
+	}
+
+	// The row is inserted as pending first so that a crash at any point leaves either nothing visible, or a
+	// committed row whose blob is complete. Pending rows left behind by a crash are never returned by lookups.
+	snapshot := blob
+	snapshot.UUID = uuid.New()
+	snapshot.Host_IP = hostIP
+	snapshot.Timestamp = timestamp
+	snapshot.File_Name = filename
+	snapshot.Status = repo.StatusPending
+	if err := service.snapshotRepo.Insert(ctx, snapshot); err != nil {
 		return fmt.Errorf("Failed to write file to DB: %v", err.Error())
 	}
+
+	if err := service.writeBlob(ctx, snapshot.File_PWD, stored); err != nil {
+		service.rollback(ctx, snapshot)
+		return err
+	}
+
+	if err := service.indexServices(ctx, snapshot.UUID, hostSnapshot); err != nil {
+		service.rollback(ctx, snapshot)
+		return fmt.Errorf("Failed to index snapshot services: %v", err.Error())
+	}
+
+	// Differences left by an earlier snapshot of the host at this timestamp, whose removal failed, are never used
+	if err := service.forgetDifferences(ctx, snapshot); err != nil {
+		service.rollback(ctx, snapshot)
+		return err
+	}
+
+	if err := service.snapshotRepo.MarkCommitted(ctx, snapshot.UUID); err != nil {
+		service.rollback(ctx, snapshot)
+		// A concurrent upload of the same host and timestamp committed first
+		if errors.Is(err, repo.ErrDuplicate) {
+			return fmt.Errorf("%w: %s", ErrDuplicateSnapshot, filename)
+		}
+		return fmt.Errorf("Failed to commit snapshot to DB: %v", err.Error())
+	}
 	return nil
 }
 
-func (service *SnapshotService) GetSnapshotByTimestamp(ctx context.Context, host_ip string, timestampString string) (string, error) {
-	timestamp, err := time.Parse(time.RFC3339, timestampString)
+// newBlob hashes and compresses the contents of a snapshot for storing under its content-addressed key
+//
+// Returns:
+//   - repo.Snapshot: the blob fields of the snapshot row, File_PWD, the hashes, Size_Bytes and Content_Encoding
+//   - []byte: the contents as stored, compressed with the codec
+//   - error: error if the contents are not JSON or cannot be compressed {nil | error}
+func (service *SnapshotService) newBlob(contents []byte) (repo.Snapshot, []byte, error) {
+	canonical, err := model.CanonicalJSON(contents)
+	if err != nil {
+		return repo.Snapshot{}, nil, fmt.Errorf("Failed to canonicalize snapshot: %v", err.Error())
+	}
+	contentHash := sha256.Sum256(contents)
+	canonicalHash := sha256.Sum256(canonical)
+	contentSHA256 := hex.EncodeToString(contentHash[:])
+	codec, err := compression.Parse(service.Compression)
+	if err != nil {
+		return repo.Snapshot{}, nil, err
+	}
+	stored, err := compression.Compress(codec, contents)
+	if err != nil {
+		return repo.Snapshot{}, nil, fmt.Errorf("Failed to compress snapshot: %v", err.Error())
+	}
+	blob := repo.Snapshot{
+		File_PWD:         BlobKey(contentSHA256, codec),
+		Content_SHA256:   contentSHA256,
+		Size_Bytes:       int64(len(contents)),
+		Canonical_SHA256: hex.EncodeToString(canonicalHash[:]),
+		Content_Encoding: codec,
+	}
+	return blob, stored, nil
+}
+
+// rollback removes a pending snapshot row. The blob is kept even if this upload wrote it, since a concurrent upload
+// of the same content may have found it and committed a row pointing at it. A blob no row references is an orphan,
+// which fsck reports. Failures are logged, the row stays pending and is never visible to lookups.
+func (service *SnapshotService) rollback(ctx context.Context, snapshot repo.Snapshot) {
+	if err := service.snapshotRepo.Delete(ctx, snapshot.UUID); err != nil {
+		log.Printf("CreateSnapshot: Failed to remove pending snapshot %s: %v", snapshot.UUID, err)
+	}
+}
+
+// BlobKey is the content-addressed key of a blob whose uncompressed content has the given SHA-256
+func BlobKey(contentSHA256 string, codec string) string {
+	return contentSHA256[:2] + "/" + contentSHA256 + ".json" + compression.Extension(codec)
+}
+
+// writeBlob stores contents under its content-addressed key, unless a blob with the same content already exists
+//
+// Summary: The blob's lock is held so that removeUnreferencedBlob cannot remove a blob this finds. The caller must
+// have inserted the row referencing the blob first, which then keeps it from being removed once the lock is released.
+func (service *SnapshotService) writeBlob(ctx context.Context, blobKey string, contents []byte) error {
+	unlock := service.blobLocks.lock(blobKey)
+	defer unlock()
+	return service.putBlob(ctx, blobKey, contents)
+}
+
+// putBlob is writeBlob for callers already holding the blob's lock
+func (service *SnapshotService) putBlob(ctx context.Context, blobKey string, contents []byte) error {
+	_, err := service.BlobStore.Stat(ctx, blobKey)
+	if err == nil {
+		// Same SHA-256, so the existing blob has identical content
+		return nil
+	}
+	if !errors.Is(err, blobstore.ErrNotFound) {
+		return fmt.Errorf("Failed to check for existing blob: %v", err.Error())
+	}
+	if err := service.BlobStore.Put(ctx, blobKey, bytes.NewReader(contents)); err != nil {
+		return fmt.Errorf("Failed to write file to blob store: %v", err.Error())
+	}
+	return nil
+}
+
+// forgetDifferences removes the stored differences involving the host and timestamp of a snapshot, so that another
+// snapshot taking its place is never compared using the old one's differences
+func (service *SnapshotService) forgetDifferences(ctx context.Context, snapshot repo.Snapshot) error {
+	if service.DifferenceRepo == nil {
+		return nil
+	}
+	if err := service.DifferenceRepo.DeleteForSnapshot(ctx, snapshot.Host_IP, snapshot.Timestamp); err != nil {
+		return fmt.Errorf("Failed to remove stored differences: %v", err)
+	}
+	return nil
+}
+
+// removeSnapshot removes the stored differences of a snapshot, then its row if it still has status. The blob is
+// kept, see removeUnreferencedBlob.
+//
+// Responses:
+//   - error: repo.ErrNotFound (wrapped) if the row no longer has status, when it is kept, or error {nil | error}
+func (service *SnapshotService) removeSnapshot(ctx context.Context, snapshot repo.Snapshot, status string) error {
+	if err := service.forgetDifferences(ctx, snapshot); err != nil {
+		return err
+	}
+	if err := service.snapshotRepo.DeleteWithStatus(ctx, snapshot.UUID, status); err != nil {
+		return fmt.Errorf("Failed to remove snapshot row: %w", err)
+	}
+	return nil
+}
+
+// removeUnreferencedBlob removes a blob if no snapshot row references it, including pending and deleted rows
+//
+// Summary: The references are counted under the blob's lock, after the caller removed its own row, so an upload
+// either inserted its row before the count and keeps the blob, or finds the blob missing and writes it again.
+//
+// Responses:
+//   - bool: true if the blob was removed
+//   - error: error if the references cannot be counted or the blob cannot be removed {nil | error}
+func (service *SnapshotService) removeUnreferencedBlob(ctx context.Context, blobKey string) (bool, error) {
+	unlock := service.blobLocks.lock(blobKey)
+	defer unlock()
+	references, err := service.snapshotRepo.CountBlobReferences(ctx, blobKey)
 	if err != nil {
-		return "", fmt.Errorf("Incorrectly formatted timestamp string")
+		return false, fmt.Errorf("Failed to count blob references: %v", err)
+	}
+	if references > 0 {
+		return false, nil
 	}
-	snapshot, err := service.snapshotRepo.GetSnapshotByTimeStamp(ctx, host_ip, timestamp)
+	if err := service.BlobStore.Delete(ctx, blobKey); err != nil {
+		return false, fmt.Errorf("Failed to remove blob: %v", err)
+	}
+	return true, nil
+}
+
+// GetSnapshotByTimestamp returns the blob key of the snapshot of a host at a timestamp
+func (service *SnapshotService) GetSnapshotByTimestamp(ctx context.Context, host_ip string, timestampString string) (string, error) {
+	snapshot, err := service.GetSnapshot(ctx, host_ip, timestampString)
 	if err != nil {
 		return "", err
 	}
 	return snapshot.File_PWD, nil
 }
 
-func (service *SnapshotService) GetAllHosts(ctx context.Context) ([]string, error) {
-	return service.snapshotRepo.GetAllHosts(ctx)
+// OpenSnapshot opens the contents of the snapshot of a host at a timestamp, decompressed. The caller must close it.
+//
+// Responses:
+//   - io.ReadCloser: snapshot contents
+//   - error: hostip.ErrInvalid or a timestamp error for bad input, repo.ErrNotFound if there is no such snapshot,
+//     blobstore.ErrNotFound if the snapshot is indexed but its blob is missing {nil | error}
+func (service *SnapshotService) OpenSnapshot(ctx context.Context, host_ip string, timestampString string) (io.ReadCloser, error) {
+	stored, codec, err := service.OpenStoredSnapshot(ctx, host_ip, timestampString)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := compression.NewReader(codec, stored)
+	if err != nil {
+		stored.Close()
+		return nil, fmt.Errorf("Failed to decompress snapshot: %v", err)
+	}
+	return reader, nil
 }
 
-func (service *SnapshotService) ListAllSnapshotsForHost(ctx context.Context, host_ip string) ([]string, error) {
-	return service.snapshotRepo.ListAllHostSnapshots(ctx, host_ip)
+// OpenStoredSnapshot opens the snapshot of a host at a timestamp as it is stored, so compressed snapshots can be
+// sent on without decompressing them. The caller must close it.
+//
+// Responses:
+//   - io.ReadCloser: snapshot contents encoded with the codec
+//   - string: compression codec of the contents
+//   - error: as for OpenSnapshot {nil | error}
+func (service *SnapshotService) OpenStoredSnapshot(ctx context.Context, host_ip string, timestampString string) (io.ReadCloser, string, error) {
+	snapshot, err := service.GetSnapshot(ctx, host_ip, timestampString)
+	if err != nil {
+		return nil, "", err
+	}
+	return service.OpenStored(ctx, snapshot)
 }
 
-func (service *SnapshotService) parseFileName(filename string) (string, time.Time, error) {
-	// host_<ip>_<timestamp>.json
-	// timestamp is file-safe ISO: 2006-01-02T15-04-05Z (colons replaced by dashes)
-	var re = regexp.MustCompile(`^host_([0-9]{1,3}(?:\.[0-9]{1,3}){3})_([0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}-[0-9]{2}-[0-9]{2}Z)\.json$`)
+// OpenStored opens the blob of a snapshot as it is stored, see OpenStoredSnapshot. The caller must close it.
+//
+// Responses:
+//   - io.ReadCloser: snapshot contents encoded with the codec
+//   - string: compression codec of the contents
+//   - error: blobstore.ErrNotFound if the blob is missing {nil | error}
+func (service *SnapshotService) OpenStored(ctx context.Context, snapshot repo.Snapshot) (io.ReadCloser, string, error) {
+	reader, err := service.BlobStore.Get(ctx, snapshot.File_PWD)
+	if err != nil {
+		return nil, "", err
+	}
+	return reader, snapshotCodec(snapshot), nil
+}
 
-	m := re.FindStringSubmatch(filename)
-	if m == nil {
-		return "", time.Time{}, fmt.Errorf("filename %q does not match expected pattern host_<ip>_<timestamp>.json", filename)
+// snapshotCodec is the codec of a snapshot's blob. Rows from before compression have no codec and are uncompressed.
+func snapshotCodec(snapshot repo.Snapshot) string {
+	if snapshot.Content_Encoding == "" {
+		return compression.Identity
 	}
+	return snapshot.Content_Encoding
+}
 
-	ipStr := m[1]
-	if net.ParseIP(ipStr) == nil {
-		return "", time.Time{}, fmt.Errorf("invalid IPv4 address in filename: %q", ipStr)
+// readSnapshotContents reads and decompresses the blob of a snapshot
+func readSnapshotContents(ctx context.Context, blobStore blobstore.BlobStore, snapshot repo.Snapshot) ([]byte, error) {
+	stored, err := blobStore.Get(ctx, snapshot.File_PWD)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := compression.NewReader(snapshotCodec(snapshot), stored)
+	if err != nil {
+		stored.Close()
+		return nil, err
 	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (service *SnapshotService) GetSnapshot(ctx context.Context, host_ip string, timestampString string) (repo.Snapshot, error) {
+	host_ip, err := hostip.Canonical(host_ip)
+	if err != nil {
+		return repo.Snapshot{}, err
+	}
+	timestamp, err := snapshotname.ParseTimestamp(timestampString)
+	if err != nil {
+		return repo.Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidTimestamp, err)
+	}
+	return service.snapshotRepo.GetSnapshotByTimeStamp(ctx, host_ip, timestamp)
+}
 
-	tsStr := m[2]
+// DeleteSnapshot soft deletes the snapshot of a host at a timestamp, hiding it from lookups, listings and diffs
+//
+// Summary: The row and blob are kept until the snapshot is purged, so it can be restored until then. Another
+// snapshot can be uploaded for the same host and timestamp while it is deleted.
+//
+// Responses:
+//   - repo.Snapshot: the deleted snapshot
+//   - error: hostip.ErrInvalid or a timestamp error for bad input, repo.ErrNotFound if there is no such snapshot {nil | error}
+func (service *SnapshotService) DeleteSnapshot(ctx context.Context, host_ip string, timestampString string) (repo.Snapshot, error) {
+	snapshot, err := service.GetSnapshot(ctx, host_ip, timestampString)
+	if err != nil {
+		return repo.Snapshot{}, err
+	}
+	deletedAt := time.Now().UTC()
+	if err := service.snapshotRepo.SoftDelete(ctx, snapshot.UUID, deletedAt); err != nil {
+		return repo.Snapshot{}, err
+	}
+	// Stored differences would be wrong for a snapshot uploaded later at the same timestamp. If they cannot be
+	// removed now, that upload or a restore removes them.
+	if err := service.forgetDifferences(ctx, snapshot); err != nil {
+		log.Printf("DeleteSnapshot: %v", err)
+	}
+	snapshot.Status = repo.StatusDeleted
+	snapshot.Deleted_At = &deletedAt
+	return snapshot, nil
+}
 
-	// Parse the file-safe ISO timestamp (with dashes in the clock) into time.Time.
-	// Layout matches: 2025-09-10T03-00-00Z
-	t, err := time.Parse("2006-01-02T15-04-05Z", tsStr)
+// RestoreSnapshot undoes DeleteSnapshot for the most recently deleted snapshot of a host at a timestamp
+//
+// Responses:
+//   - repo.Snapshot: the restored snapshot
+//   - error: hostip.ErrInvalid or a timestamp error for bad input, repo.ErrNotFound if there is no deleted
+//     snapshot, ErrDuplicateSnapshot if another snapshot has since been uploaded for the host and timestamp {nil | error}
+func (service *SnapshotService) RestoreSnapshot(ctx context.Context, host_ip string, timestampString string) (repo.Snapshot, error) {
+	host_ip, err := hostip.Canonical(host_ip)
+	if err != nil {
+		return repo.Snapshot{}, err
+	}
+	timestamp, err := snapshotname.ParseTimestamp(timestampString)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("invalid timestamp in filename: %q: %w", tsStr, err)
+		return repo.Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidTimestamp, err)
 	}
+	snapshot, err := service.snapshotRepo.GetDeletedSnapshotByTimeStamp(ctx, host_ip, timestamp)
+	if err != nil {
+		return repo.Snapshot{}, err
+	}
+	_, err = service.snapshotRepo.GetSnapshotByTimeStamp(ctx, host_ip, timestamp)
+	if err == nil {
+		return repo.Snapshot{}, fmt.Errorf("%w: %s", ErrDuplicateSnapshot, snapshotname.Format(host_ip, timestamp))
+	} else if !errors.Is(err, repo.ErrNotFound) {
+		return repo.Snapshot{}, fmt.Errorf("Failed to check for existing snapshot: %v", err.Error())
+	}
+	if err := service.forgetDifferences(ctx, snapshot); err != nil {
+		return repo.Snapshot{}, err
+	}
+	if err := service.snapshotRepo.Restore(ctx, snapshot.UUID); err != nil {
+		if errors.Is(err, repo.ErrDuplicate) {
+			return repo.Snapshot{}, fmt.Errorf("%w: %s", ErrDuplicateSnapshot, snapshotname.Format(host_ip, timestamp))
+		}
+		return repo.Snapshot{}, err
+	}
+	snapshot.Status = repo.StatusCommitted
+	snapshot.Deleted_At = nil
+	return snapshot, nil
+}
+
+func (service *SnapshotService) GetAllHosts(ctx context.Context) ([]string, error) {
+	return service.snapshotRepo.GetAllHosts(ctx)
+}
 
-	return ipStr, t, nil
+func (service *SnapshotService) ListAllSnapshotsForHost(ctx context.Context, host_ip string) ([]string, error) {
+	host_ip, err := hostip.Canonical(host_ip)
+	if err != nil {
+		return nil, err
+	}
+	return service.snapshotRepo.ListAllHostSnapshots(ctx, host_ip)
 }
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -11,6 +13,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/compression"
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/model"
 	"github.com/endingwithali/2025censys/internal/repo"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -23,8 +29,33 @@ type MockSnapshotRepo struct {
 	mock.Mock
 }
 
-func (m *MockSnapshotRepo) Insert(ctx context.Context, host_ip string, timestamp time.Time, file_pwd string, file_name string) error {
-	args := m.Called(ctx, host_ip, timestamp, file_pwd, file_name)
+func (m *MockSnapshotRepo) Insert(ctx context.Context, snapshot repo.Snapshot) error {
+	args := m.Called(ctx, snapshot)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) MarkCommitted(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) DeleteWithStatus(ctx context.Context, id uuid.UUID, status string) error {
+	args := m.Called(ctx, id, status)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	args := m.Called(ctx, id, deletedAt)
+	return args.Error(0)
+}
+
+func (m *MockSnapshotRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
@@ -33,11 +64,16 @@ func (m *MockSnapshotRepo) GetSnapshotByTimeStamp(ctx context.Context, host_ip s
 	return args.Get(0).(repo.Snapshot), args.Error(1)
 }
 
-func (m *MockSnapshotRepo) GetSnapshotByFileName(ctx context.Context, host_ip string, filename string) (repo.Snapshot, error) {
-	args := m.Called(ctx, host_ip, filename)
+func (m *MockSnapshotRepo) GetDeletedSnapshotByTimeStamp(ctx context.Context, host_ip string, timestamp time.Time) (repo.Snapshot, error) {
+	args := m.Called(ctx, host_ip, timestamp)
 	return args.Get(0).(repo.Snapshot), args.Error(1)
 }
 
+func (m *MockSnapshotRepo) UpdateBlob(ctx context.Context, snapshot repo.Snapshot) error {
+	args := m.Called(ctx, snapshot)
+	return args.Error(0)
+}
+
 func (m *MockSnapshotRepo) GetAllHosts(ctx context.Context) ([]string, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]string), args.Error(1)
@@ -48,6 +84,51 @@ func (m *MockSnapshotRepo) ListAllHostSnapshots(ctx context.Context, host_ip str
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m *MockSnapshotRepo) ListHosts(ctx context.Context, query repo.HostQuery) ([]string, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockSnapshotRepo) ListHostSnapshots(ctx context.Context, host_ip string, query repo.SnapshotQuery) ([]time.Time, error) {
+	args := m.Called(ctx, host_ip, query)
+	return args.Get(0).([]time.Time), args.Error(1)
+}
+
+func (m *MockSnapshotRepo) ListAll(ctx context.Context) ([]repo.Snapshot, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]repo.Snapshot), args.Error(1)
+}
+
+func (m *MockSnapshotRepo) CountBlobReferences(ctx context.Context, blobKey string) (int64, error) {
+	args := m.Called(ctx, blobKey)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// validSnapshotContent is a host snapshot body matching host_192.168.1.1_2025-01-01T12-00-00Z.json
+const validSnapshotContent = `{"timestamp": "2025-01-01T12:00:00Z", "ip": "192.168.1.1", "services": [{"port": 80, "protocol": "HTTP", "status": 200}], "service_count": 1}`
+
+// blobKeyFor returns the content-addressed key the service stores content under
+func blobKeyFor(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return BlobKey(hex.EncodeToString(sum[:]), compression.Identity)
+}
+
+// blobPathFor returns the path of the blob for content in a filesystem store rooted at dir
+func blobPathFor(dir string, content string) string {
+	return filepath.Join(dir, filepath.FromSlash(blobKeyFor(content)))
+}
+
+// matchSnapshot matches an inserted snapshot by host, timestamp, upload filename and blob key
+func matchSnapshot(hostIP string, timestamp time.Time, filename string, blobKey string) any {
+	return mock.MatchedBy(func(snapshot repo.Snapshot) bool {
+		return snapshot.Host_IP == hostIP &&
+			snapshot.Timestamp.Equal(timestamp) &&
+			snapshot.File_Name == filename &&
+			snapshot.File_PWD == blobKey &&
+			snapshot.Status == repo.StatusPending
+	})
+}
+
 // Helper function to create a multipart file for testing
 func createMultipartFile(content string) multipart.File {
 	reader := strings.NewReader(content)
@@ -80,13 +161,13 @@ func (m *mockMultipartFile) Close() error {
 
 func TestNewSnapshotService(t *testing.T) {
 	mockRepo := &MockSnapshotRepo{}
-	fileLocation := "/tmp/test"
+	blobStore := blobstore.NewFileSystemStore("/tmp/test")
 
-	service := NewSnapshotService(mockRepo, fileLocation)
+	service := NewSnapshotService(mockRepo, blobStore)
 
 	assert.NotNil(t, service)
 	assert.Equal(t, mockRepo, service.snapshotRepo)
-	assert.Equal(t, fileLocation, service.FileLocation)
+	assert.Equal(t, blobStore, service.BlobStore)
 }
 
 func TestSnapshotService_CreateSnapshot(t *testing.T) {
@@ -96,47 +177,77 @@ func TestSnapshotService_CreateSnapshot(t *testing.T) {
 		fileContent    string
 		expectedStatus error
 		repoError      error
-		fileExists     bool
+		snapshotExists bool
 		expectedIP     string
 		expectedTime   time.Time
 	}{
 		{
 			name:           "successful snapshot creation",
 			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
-			fileContent:    `{"test": "data"}`,
+			fileContent:    validSnapshotContent,
 			expectedStatus: nil,
 			repoError:      nil,
-			fileExists:     false,
+			snapshotExists: false,
 			expectedIP:     "192.168.1.1",
 			expectedTime:   time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
 		},
 		{
 			name:           "invalid filename format",
 			filename:       "invalid.json",
-			fileContent:    `{"test": "data"}`,
+			fileContent:    validSnapshotContent,
 			expectedStatus: fmt.Errorf("Failed to parse file name"),
 			repoError:      nil,
-			fileExists:     false,
+			snapshotExists: false,
 			expectedIP:     "",
 			expectedTime:   time.Time{},
 		},
 		{
-			name:           "duplicate file",
+			name:           "invalid snapshot body",
 			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
 			fileContent:    `{"test": "data"}`,
-			expectedStatus: fmt.Errorf("Attempting to add duplicate file for host"),
+			expectedStatus: fmt.Errorf("Invalid host snapshot"),
 			repoError:      nil,
-			fileExists:     true,
+			snapshotExists: false,
 			expectedIP:     "",
 			expectedTime:   time.Time{},
 		},
+		{
+			name:           "filename ip does not match body",
+			filename:       "host_192.168.1.2_2025-01-01T12-00-00Z.json",
+			fileContent:    validSnapshotContent,
+			expectedStatus: fmt.Errorf(`ip: "192.168.1.1" does not match "192.168.1.2" from the filename`),
+			repoError:      nil,
+			snapshotExists: false,
+			expectedIP:     "",
+			expectedTime:   time.Time{},
+		},
+		{
+			name:           "filename timestamp does not match body",
+			filename:       "host_192.168.1.1_2025-01-02T12-00-00Z.json",
+			fileContent:    validSnapshotContent,
+			expectedStatus: fmt.Errorf(`timestamp: "2025-01-01T12:00:00Z" does not match "2025-01-02T12:00:00Z" from the filename`),
+			repoError:      nil,
+			snapshotExists: false,
+			expectedIP:     "",
+			expectedTime:   time.Time{},
+		},
+		{
+			name:           "duplicate file",
+			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
+			fileContent:    validSnapshotContent,
+			expectedStatus: fmt.Errorf("Attempting to add duplicate file for host"),
+			repoError:      nil,
+			snapshotExists: true,
+			expectedIP:     "192.168.1.1",
+			expectedTime:   time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
 		{
 			name:           "repository error",
 			filename:       "host_192.168.1.1_2025-01-01T12-00-00Z.json",
-			fileContent:    `{"test": "data"}`,
+			fileContent:    validSnapshotContent,
 			expectedStatus: fmt.Errorf("Failed to write file to DB"),
 			repoError:      fmt.Errorf("database error"),
-			fileExists:     false,
+			snapshotExists: false,
 			expectedIP:     "192.168.1.1",
 			expectedTime:   time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
 		},
@@ -147,20 +258,22 @@ func TestSnapshotService_CreateSnapshot(t *testing.T) {
 			// Setup
 			tempDir := t.TempDir()
 			mockRepo := &MockSnapshotRepo{}
-			service := NewSnapshotService(mockRepo, tempDir)
+			service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
 			ctx := context.Background()
 
-			// Create existing file if needed
-			if tt.fileExists {
-				existingFilePath := filepath.Join(tempDir, tt.filename)
-				err := os.WriteFile(existingFilePath, []byte("existing content"), 0644)
-				require.NoError(t, err)
+			// Setup mock expectations for cases that reach storage
+			if tt.expectedIP != "" {
+				existing, lookupErr := repo.Snapshot{}, repo.ErrNotFound
+				if tt.snapshotExists {
+					existing, lookupErr = repo.Snapshot{Host_IP: tt.expectedIP, Timestamp: tt.expectedTime}, nil
+				}
+				mockRepo.On("GetSnapshotByTimeStamp", ctx, tt.expectedIP, tt.expectedTime).Return(existing, lookupErr)
 			}
-
-			// Setup mock expectations for successful cases
-			if tt.expectedStatus == nil || (tt.repoError != nil && tt.expectedIP != "") {
-				expectedFilePath := filepath.Join(tempDir, tt.filename)
-				mockRepo.On("Insert", ctx, tt.expectedIP, tt.expectedTime, expectedFilePath, tt.filename).Return(tt.repoError)
+			if tt.expectedStatus == nil || tt.repoError != nil {
+				mockRepo.On("Insert", ctx, matchSnapshot(tt.expectedIP, tt.expectedTime, tt.filename, blobKeyFor(tt.fileContent))).Return(tt.repoError)
+				if tt.repoError == nil {
+					mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+				}
 			}
 
 			// Test
@@ -174,8 +287,8 @@ func TestSnapshotService_CreateSnapshot(t *testing.T) {
 			} else {
 				require.NoError(t, err)
 
-				// Verify file was created
-				expectedFilePath := filepath.Join(tempDir, tt.filename)
+				// Verify blob was created
+				expectedFilePath := blobPathFor(tempDir, tt.fileContent)
 				assert.FileExists(t, expectedFilePath)
 
 				// Verify file content
@@ -189,6 +302,76 @@ func TestSnapshotService_CreateSnapshot(t *testing.T) {
 	}
 }
 
+func TestSnapshotService_CreateSnapshotFromBody(t *testing.T) {
+	tests := []struct {
+		name             string
+		fileContent      string
+		expectedStatus   error
+		expectedIP       string
+		expectedFilename string
+		expectedTime     time.Time
+	}{
+		{
+			name:             "metadata taken from body",
+			fileContent:      validSnapshotContent,
+			expectedStatus:   nil,
+			expectedIP:       "192.168.1.1",
+			expectedFilename: "host_192.168.1.1_2025-01-01T12-00-00Z.json",
+			expectedTime:     time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:             "body timestamp is normalized to UTC",
+			fileContent:      `{"timestamp": "2025-01-01T17:30:00.5+05:30", "ip": "192.168.1.1", "services": [], "service_count": 0}`,
+			expectedStatus:   nil,
+			expectedIP:       "192.168.1.1",
+			expectedFilename: "host_192.168.1.1_2025-01-01T12-00-00.5Z.json",
+			expectedTime:     time.Date(2025, 1, 1, 12, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name:             "IPv6 body ip is canonicalized and dash-encoded",
+			fileContent:      `{"timestamp": "2025-01-01T12:00:00Z", "ip": "2001:DB8:0::1", "services": [], "service_count": 0}`,
+			expectedStatus:   nil,
+			expectedIP:       "2001:db8::1",
+			expectedFilename: "host_2001-db8--1_2025-01-01T12-00-00Z.json",
+			expectedTime:     time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:           "invalid body",
+			fileContent:    `{"ip": "192.168.1.1"}`,
+			expectedStatus: fmt.Errorf("Invalid host snapshot"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			tempDir := t.TempDir()
+			mockRepo := &MockSnapshotRepo{}
+			service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
+			ctx := context.Background()
+
+			if tt.expectedStatus == nil {
+				mockRepo.On("GetSnapshotByTimeStamp", ctx, tt.expectedIP, tt.expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+				mockRepo.On("Insert", ctx, matchSnapshot(tt.expectedIP, tt.expectedTime, tt.expectedFilename, blobKeyFor(tt.fileContent))).Return(nil)
+				mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+			}
+
+			// Test
+			err := service.CreateSnapshotFromBody(ctx, strings.NewReader(tt.fileContent))
+
+			// Assertions
+			if tt.expectedStatus != nil {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedStatus.Error())
+			} else {
+				require.NoError(t, err)
+				assert.FileExists(t, blobPathFor(tempDir, tt.fileContent))
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestSnapshotService_GetSnapshotByTimestamp(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -228,7 +411,7 @@ func TestSnapshotService_GetSnapshotByTimestamp(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Setup
 			mockRepo := &MockSnapshotRepo{}
-			service := NewSnapshotService(mockRepo, "/tmp")
+			service := NewSnapshotService(mockRepo, blobstore.NewMemoryStore())
 			ctx := context.Background()
 
 			// Setup mock expectations
@@ -265,6 +448,35 @@ func TestSnapshotService_GetSnapshotByTimestamp(t *testing.T) {
 	}
 }
 
+func TestSnapshotService_GetSnapshot_TimestampFormats(t *testing.T) {
+	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	timestamps := []string{
+		"2025-01-01T12:00:00Z",
+		"2025-01-01T17:30:00+05:30",
+		"2025-01-01T12:00:00.000Z",
+		"2025-01-01T12-00-00Z",
+		"2025-01-01T07-00-00-05-00",
+	}
+
+	for _, timestamp := range timestamps {
+		t.Run(timestamp, func(t *testing.T) {
+			// Setup
+			mockRepo := &MockSnapshotRepo{}
+			service := NewSnapshotService(mockRepo, blobstore.NewMemoryStore())
+			ctx := context.Background()
+			mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{File_PWD: "/path/to/snapshot.json"}, nil)
+
+			// Test
+			snapshot, err := service.GetSnapshot(ctx, "192.168.1.1", timestamp)
+
+			// Assertions
+			require.NoError(t, err)
+			assert.Equal(t, "/path/to/snapshot.json", snapshot.File_PWD)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestSnapshotService_GetAllHosts(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -296,7 +508,7 @@ func TestSnapshotService_GetAllHosts(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Setup
 			mockRepo := &MockSnapshotRepo{}
-			service := NewSnapshotService(mockRepo, "/tmp")
+			service := NewSnapshotService(mockRepo, blobstore.NewMemoryStore())
 			ctx := context.Background()
 
 			mockRepo.On("GetAllHosts", ctx).Return(tt.expectedHosts, tt.repoError)
@@ -354,7 +566,7 @@ func TestSnapshotService_ListAllSnapshotsForHost(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Setup
 			mockRepo := &MockSnapshotRepo{}
-			service := NewSnapshotService(mockRepo, "/tmp")
+			service := NewSnapshotService(mockRepo, blobstore.NewMemoryStore())
 			ctx := context.Background()
 
 			mockRepo.On("ListAllHostSnapshots", ctx, tt.hostIP).Return(tt.expectedSnapshots, tt.repoError)
@@ -377,124 +589,22 @@ func TestSnapshotService_ListAllSnapshotsForHost(t *testing.T) {
 	}
 }
 
-func TestSnapshotService_parseFileName(t *testing.T) {
-	tests := []struct {
-		name          string
-		filename      string
-		expectedIP    string
-		expectedTime  time.Time
-		expectedError string
-	}{
-		{
-			name:          "valid filename",
-			filename:      "host_192.168.1.1_2025-01-01T12-00-00Z.json",
-			expectedIP:    "192.168.1.1",
-			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
-			expectedError: "",
-		},
-		{
-			name:          "valid filename with different IP",
-			filename:      "host_10.0.0.1_2023-12-25T23-59-59Z.json",
-			expectedIP:    "10.0.0.1",
-			expectedTime:  time.Date(2023, 12, 25, 23, 59, 59, 0, time.UTC),
-			expectedError: "",
-		},
-		{
-			name:          "invalid filename - wrong format",
-			filename:      "invalid.json",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "does not match expected pattern",
-		},
-		{
-			name:          "invalid filename - wrong prefix",
-			filename:      "file_192.168.1.1_2025-01-01T12-00-00Z.json",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "does not match expected pattern",
-		},
-		{
-			name:          "invalid filename - wrong extension",
-			filename:      "host_192.168.1.1_2025-01-01T12-00-00Z.txt",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "does not match expected pattern",
-		},
-		{
-			name:          "invalid filename - invalid IP",
-			filename:      "host_999.999.999.999_2025-01-01T12-00-00Z.json",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "invalid IPv4 address",
-		},
-		{
-			name:          "invalid filename - invalid timestamp",
-			filename:      "host_192.168.1.1_2025-13-01T12-00-00Z.json",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "invalid timestamp",
-		},
-		{
-			name:          "invalid filename - missing timezone",
-			filename:      "host_192.168.1.1_2025-01-01T12-00-00.json",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "does not match expected pattern",
-		},
-		{
-			name:          "invalid filename - wrong timezone format",
-			filename:      "host_192.168.1.1_2025-01-01T12-00-00+05:30.json",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "does not match expected pattern",
-		},
-		{
-			name:          "invalid filename - wrong time separator",
-			filename:      "host_192.168.1.1_2025-01-01T12:00:00Z.json",
-			expectedIP:    "",
-			expectedTime:  time.Time{},
-			expectedError: "does not match expected pattern",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Setup
-			service := &SnapshotService{}
-
-			// Test
-			ip, timestamp, err := service.parseFileName(tt.filename)
-
-			// Assertions
-			if tt.expectedError != "" {
-				require.Error(t, err)
-				assert.Contains(t, err.Error(), tt.expectedError)
-				assert.Equal(t, "", ip)
-				assert.Equal(t, time.Time{}, timestamp)
-			} else {
-				require.NoError(t, err)
-				assert.Equal(t, tt.expectedIP, ip)
-				assert.Equal(t, tt.expectedTime, timestamp)
-			}
-		})
-	}
-}
-
 // Test file cleanup on repository error
 func TestSnapshotService_CreateSnapshot_CleanupOnRepoError(t *testing.T) {
 	// Setup
 	tempDir := t.TempDir()
 	mockRepo := &MockSnapshotRepo{}
-	service := NewSnapshotService(mockRepo, tempDir)
+	service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
 	ctx := context.Background()
 
 	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
-	fileContent := `{"test": "data"}`
+	fileContent := validSnapshotContent
 
 	// Setup mock to return error
-	expectedFilePath := filepath.Join(tempDir, filename)
+	expectedFilePath := blobPathFor(tempDir, fileContent)
 	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
-	mockRepo.On("Insert", ctx, "192.168.1.1", expectedTime, expectedFilePath, filename).Return(fmt.Errorf("database error"))
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, matchSnapshot("192.168.1.1", expectedTime, filename, blobKeyFor(fileContent))).Return(fmt.Errorf("database error"))
 
 	// Test
 	file := createMultipartFile(fileContent)
@@ -510,17 +620,51 @@ func TestSnapshotService_CreateSnapshot_CleanupOnRepoError(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+// Test that identical content reuses the existing blob, and that the blob is kept if the DB insert fails
+func TestSnapshotService_CreateSnapshot_ReusesExistingBlob(t *testing.T) {
+	// Setup
+	tempDir := t.TempDir()
+	mockRepo := &MockSnapshotRepo{}
+	service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
+	ctx := context.Background()
+
+	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+	expectedFilePath := blobPathFor(tempDir, validSnapshotContent)
+	require.NoError(t, os.MkdirAll(filepath.Dir(expectedFilePath), 0o755))
+	require.NoError(t, os.WriteFile(expectedFilePath, []byte(validSnapshotContent), 0o644))
+
+	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	canonical, err := model.CanonicalJSON([]byte(validSnapshotContent))
+	require.NoError(t, err)
+	canonicalSum := sha256.Sum256(canonical)
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, mock.MatchedBy(func(snapshot repo.Snapshot) bool {
+		return snapshot.File_PWD == blobKeyFor(validSnapshotContent) &&
+			filepath.Base(snapshot.File_PWD) == snapshot.Content_SHA256+".json" &&
+			snapshot.Size_Bytes == int64(len(validSnapshotContent)) &&
+			snapshot.Canonical_SHA256 == hex.EncodeToString(canonicalSum[:])
+	})).Return(fmt.Errorf("database error"))
+
+	// Test
+	err = service.CreateSnapshot(ctx, createMultipartFile(validSnapshotContent), filename)
+
+	// Assertions
+	require.Error(t, err)
+	assert.FileExists(t, expectedFilePath)
+	mockRepo.AssertExpectations(t)
+}
+
 // Test file cleanup on file write error
 func TestSnapshotService_CreateSnapshot_CleanupOnFileWriteError(t *testing.T) {
 	// Setup
 	tempDir := t.TempDir()
 	mockRepo := &MockSnapshotRepo{}
-	service := NewSnapshotService(mockRepo, tempDir)
+	service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
 	ctx := context.Background()
 
 	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
 
-	// Create a mock file that will cause an error during copy
+	// Create a mock file that will cause an error during read
 	file := &mockMultipartFileWithError{}
 
 	// Test
@@ -528,7 +672,7 @@ func TestSnapshotService_CreateSnapshot_CleanupOnFileWriteError(t *testing.T) {
 
 	// Assertions
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "Failed to write contents of file to file on OS")
+	assert.Contains(t, err.Error(), "Failed to read uploaded file")
 
 	// Verify no file was created
 	expectedFilePath := filepath.Join(tempDir, filename)
@@ -558,7 +702,7 @@ func TestSnapshotService_CreateSnapshot_LongFilename(t *testing.T) {
 	// Setup
 	tempDir := t.TempDir()
 	mockRepo := &MockSnapshotRepo{}
-	service := NewSnapshotService(mockRepo, tempDir)
+	service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
 	ctx := context.Background()
 
 	// Create a very long filename
@@ -580,16 +724,19 @@ func TestSnapshotService_CreateSnapshot_ConcurrentAccess(t *testing.T) {
 	// Setup
 	tempDir := t.TempDir()
 	mockRepo := &MockSnapshotRepo{}
-	service := NewSnapshotService(mockRepo, tempDir)
+	service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
 	ctx := context.Background()
 
 	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
-	fileContent := `{"test": "data"}`
+	fileContent := validSnapshotContent
 
 	// Setup mock expectations
-	expectedFilePath := filepath.Join(tempDir, filename)
+	expectedFilePath := blobPathFor(tempDir, fileContent)
 	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
-	mockRepo.On("Insert", ctx, "192.168.1.1", expectedTime, expectedFilePath, filename).Return(nil).Once()
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound).Once()
+	mockRepo.On("Insert", ctx, matchSnapshot("192.168.1.1", expectedTime, filename, blobKeyFor(fileContent))).Return(nil).Once()
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil).Once()
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{File_PWD: blobKeyFor(fileContent)}, nil).Once()
 
 	// Test
 	file := createMultipartFile(fileContent)
@@ -615,16 +762,18 @@ func TestSnapshotService_CreateSnapshot_SpecialCharacters(t *testing.T) {
 	// Setup
 	tempDir := t.TempDir()
 	mockRepo := &MockSnapshotRepo{}
-	service := NewSnapshotService(mockRepo, tempDir)
+	service := NewSnapshotService(mockRepo, blobstore.NewFileSystemStore(tempDir))
 	ctx := context.Background()
 
 	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
-	fileContent := `{"special": "chars: !@#$%^&*()_+-=[]{}|;':\",./<>?` + "`" + `", "unicode": "测试", "newlines": "line1\nline2\r\nline3"}`
+	fileContent := `{"timestamp": "2025-01-01T12:00:00Z", "ip": "192.168.1.1", "services": [{"port": 80, "protocol": "HTTP", "software": {"vendor": "chars: !@#$%^&*()_+-=[]{}|;':\",./<>?` + "`" + `", "product": "测试", "version": "line1\nline2\r\nline3"}}], "service_count": 1}`
 
 	// Setup mock expectations
-	expectedFilePath := filepath.Join(tempDir, filename)
+	expectedFilePath := blobPathFor(tempDir, fileContent)
 	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
-	mockRepo.On("Insert", ctx, "192.168.1.1", expectedTime, expectedFilePath, filename).Return(nil)
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, matchSnapshot("192.168.1.1", expectedTime, filename, blobKeyFor(fileContent))).Return(nil)
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
 
 	// Test
 	file := createMultipartFile(fileContent)
@@ -641,3 +790,352 @@ func TestSnapshotService_CreateSnapshot_SpecialCharacters(t *testing.T) {
 
 	mockRepo.AssertExpectations(t)
 }
+
+func TestSnapshotService_OpenSnapshot(t *testing.T) {
+	ctx := context.Background()
+	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	blobStore := blobstore.NewMemoryStore()
+	require.NoError(t, blobStore.Put(ctx, blobKeyFor(validSnapshotContent), strings.NewReader(validSnapshotContent)))
+
+	tests := []struct {
+		name          string
+		blobKey       string
+		repoError     error
+		expectedError error
+	}{
+		{
+			name:    "stored snapshot",
+			blobKey: blobKeyFor(validSnapshotContent),
+		},
+		{
+			name:          "snapshot not in DB",
+			repoError:     repo.ErrNotFound,
+			expectedError: repo.ErrNotFound,
+		},
+		{
+			name:          "blob missing from store",
+			blobKey:       "ab/missing.json",
+			expectedError: blobstore.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockSnapshotRepo{}
+			service := NewSnapshotService(mockRepo, blobStore)
+			mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{File_PWD: tt.blobKey}, tt.repoError)
+
+			reader, err := service.OpenSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+			} else {
+				require.NoError(t, err)
+				defer reader.Close()
+				contents, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				assert.Equal(t, validSnapshotContent, string(contents))
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+// failingBlobStore fails every Put, simulating a full disk or unreachable bucket
+type failingBlobStore struct {
+	*blobstore.MemoryStore
+}
+
+func (failingBlobStore) Put(ctx context.Context, key string, r io.Reader) error {
+	return fmt.Errorf("no space left on device")
+}
+
+// Test that the row is pending while the blob is written, and only committed once the blob exists
+func TestSnapshotService_CreateSnapshot_CommitsAfterBlobWrite(t *testing.T) {
+	ctx := context.Background()
+	blobStore := blobstore.NewMemoryStore()
+	mockRepo := &MockSnapshotRepo{}
+	service := NewSnapshotService(mockRepo, blobStore)
+
+	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var insertedID uuid.UUID
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+	mockRepo.On("Insert", ctx, matchSnapshot("192.168.1.1", expectedTime, filename, blobKeyFor(validSnapshotContent))).Run(func(args mock.Arguments) {
+		insertedID = args.Get(1).(repo.Snapshot).UUID
+		_, err := blobStore.Stat(ctx, blobKeyFor(validSnapshotContent))
+		assert.ErrorIs(t, err, blobstore.ErrNotFound, "blob should be written after the pending row")
+	}).Return(nil)
+	mockRepo.On("MarkCommitted", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		assert.Equal(t, insertedID, args.Get(1).(uuid.UUID))
+		_, err := blobStore.Stat(ctx, blobKeyFor(validSnapshotContent))
+		assert.NoError(t, err, "blob should exist before the row is committed")
+	}).Return(nil)
+
+	err := service.CreateSnapshot(ctx, createMultipartFile(validSnapshotContent), filename)
+
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, insertedID)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSnapshotService_CreateSnapshot_Rollback(t *testing.T) {
+	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+	expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		failPut       bool
+		commitError   error
+		expectedError string
+		// keepsBlob is whether the blob written by the upload is left behind. Another upload of the same content
+		// may have committed a row pointing at it, so a written blob is never removed.
+		keepsBlob bool
+	}{
+		{
+			name:          "blob write fails",
+			failPut:       true,
+			expectedError: "Failed to write file to blob store",
+		},
+		{
+			name:          "commit fails",
+			commitError:   fmt.Errorf("database error"),
+			expectedError: "Failed to commit snapshot to DB",
+			keepsBlob:     true,
+		},
+		{
+			name:          "concurrent upload committed first",
+			commitError:   fmt.Errorf("%w: unique violation", repo.ErrDuplicate),
+			expectedError: ErrDuplicateSnapshot.Error(),
+			keepsBlob:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			memoryStore := blobstore.NewMemoryStore()
+			var blobStore blobstore.BlobStore = memoryStore
+			if tt.failPut {
+				blobStore = failingBlobStore{memoryStore}
+			}
+			mockRepo := &MockSnapshotRepo{}
+			service := NewSnapshotService(mockRepo, blobStore)
+
+			mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound)
+			mockRepo.On("Insert", ctx, matchSnapshot("192.168.1.1", expectedTime, filename, blobKeyFor(validSnapshotContent))).Return(nil)
+			if !tt.failPut {
+				mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(tt.commitError)
+			}
+			mockRepo.On("Delete", ctx, mock.Anything).Return(nil)
+
+			err := service.CreateSnapshot(ctx, createMultipartFile(validSnapshotContent), filename)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+			_, statErr := memoryStore.Stat(ctx, blobKeyFor(validSnapshotContent))
+			if tt.keepsBlob {
+				assert.NoError(t, statErr)
+			} else {
+				assert.ErrorIs(t, statErr, blobstore.ErrNotFound)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSnapshotService_CreateSnapshot_Compressed(t *testing.T) {
+	sum := sha256.Sum256([]byte(validSnapshotContent))
+	contentSHA256 := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name          string
+		compression   string
+		expectedCodec string
+	}{
+		{name: "uncompressed by default", compression: "", expectedCodec: compression.Identity},
+		{name: "gzip", compression: compression.Gzip, expectedCodec: compression.Gzip},
+		{name: "zstd", compression: compression.Zstd, expectedCodec: compression.Zstd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			blobStore := blobstore.NewMemoryStore()
+			mockRepo := &MockSnapshotRepo{}
+			service := NewSnapshotService(mockRepo, blobStore)
+			service.Compression = tt.compression
+
+			filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+			expectedTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			expectedKey := BlobKey(contentSHA256, tt.expectedCodec)
+			var inserted repo.Snapshot
+			mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(repo.Snapshot{}, repo.ErrNotFound).Once()
+			mockRepo.On("Insert", ctx, matchSnapshot("192.168.1.1", expectedTime, filename, expectedKey)).Run(func(args mock.Arguments) {
+				inserted = args.Get(1).(repo.Snapshot)
+			}).Return(nil)
+			mockRepo.On("MarkCommitted", ctx, mock.Anything).Return(nil)
+
+			require.NoError(t, service.CreateSnapshot(ctx, createMultipartFile(validSnapshotContent), filename))
+
+			// The row records the codec, and the hashes and size of the uncompressed content
+			assert.Equal(t, tt.expectedCodec, inserted.Content_Encoding)
+			assert.Equal(t, contentSHA256, inserted.Content_SHA256)
+			assert.Equal(t, int64(len(validSnapshotContent)), inserted.Size_Bytes)
+			stored, err := blobstore.ReadAll(ctx, blobStore, expectedKey)
+			require.NoError(t, err)
+			decompressed, err := compression.Decompress(tt.expectedCodec, stored)
+			require.NoError(t, err)
+			assert.Equal(t, validSnapshotContent, string(decompressed))
+
+			// Reads are decompressed, unless the stored bytes are asked for
+			inserted.Status = repo.StatusCommitted
+			mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", expectedTime).Return(inserted, nil)
+			reader, err := service.OpenSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+			require.NoError(t, err)
+			contents, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, validSnapshotContent, string(contents))
+
+			reader, codec, err := service.OpenStoredSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+			require.NoError(t, err)
+			contents, err = io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, tt.expectedCodec, codec)
+			assert.Equal(t, stored, contents)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSnapshotService_CreateSnapshot_UnknownCompression(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := &MockSnapshotRepo{}
+	service := NewSnapshotService(mockRepo, blobstore.NewMemoryStore())
+	service.Compression = "brotli"
+	mockRepo.On("GetSnapshotByTimeStamp", ctx, "192.168.1.1", mock.Anything).Return(repo.Snapshot{}, repo.ErrNotFound)
+
+	err := service.CreateSnapshot(ctx, createMultipartFile(validSnapshotContent), "host_192.168.1.1_2025-01-01T12-00-00Z.json")
+
+	assert.ErrorIs(t, err, compression.ErrUnknownCodec)
+	mockRepo.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything)
+}
+
+func TestSnapshotService_DeleteSnapshot(t *testing.T) {
+	ctx := context.Background()
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.1", Timestamp: timestamp, Status: repo.StatusCommitted}
+
+	tests := []struct {
+		name          string
+		timestamp     string
+		lookupError   error
+		deleteError   error
+		expectedError error
+	}{
+		{name: "deletes committed snapshot", timestamp: "2025-01-01T12:00:00Z"},
+		{name: "invalid timestamp", timestamp: "invalid-timestamp", expectedError: ErrInvalidTimestamp},
+		{name: "snapshot not found", timestamp: "2025-01-01T12:00:00Z", lookupError: repo.ErrNotFound, expectedError: repo.ErrNotFound},
+		{name: "deleted concurrently", timestamp: "2025-01-01T12:00:00Z", deleteError: repo.ErrNotFound, expectedError: repo.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockSnapshotRepo{}
+			service := NewSnapshotService(mockRepo, blobstore.NewMemoryStore())
+			mockRepo.On("GetSnapshotByTimeStamp", ctx, snapshot.Host_IP, timestamp).Return(snapshot, tt.lookupError)
+			mockRepo.On("SoftDelete", ctx, snapshot.UUID, mock.AnythingOfType("time.Time")).Return(tt.deleteError)
+
+			result, err := service.DeleteSnapshot(ctx, snapshot.Host_IP, tt.timestamp)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, repo.StatusDeleted, result.Status)
+			require.NotNil(t, result.Deleted_At)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+// Test that uploads, deletes and restores remove the stored differences of the host and timestamp they change
+func TestSnapshotService_ForgetsDifferences(t *testing.T) {
+	ctx := context.Background()
+	filename := "host_192.168.1.1_2025-01-01T12-00-00Z.json"
+	snapshotRepo := repo.NewMemorySnapshotRepo()
+	service := NewSnapshotService(snapshotRepo, blobstore.NewMemoryStore())
+	mockDiffRepo := &MockDifferenceRepo{}
+	mockDiffRepo.On("DeleteForSnapshot", ctx, "192.168.1.1", lookupJan1).Return(nil)
+	service.DifferenceRepo = mockDiffRepo
+
+	require.NoError(t, service.CreateSnapshot(ctx, createMultipartFile(validSnapshotContent), filename))
+	_, err := service.DeleteSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+	require.NoError(t, err)
+	_, err = service.RestoreSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+	require.NoError(t, err)
+	mockDiffRepo.AssertNumberOfCalls(t, "DeleteForSnapshot", 3)
+
+	// Failing to remove them fails uploads and restores, which would otherwise use them. A delete only logs it,
+	// since the snapshot is already hidden and the next upload or restore removes them.
+	failingDiffRepo := &MockDifferenceRepo{}
+	failingDiffRepo.On("DeleteForSnapshot", ctx, "192.168.1.1", lookupJan1).Return(fmt.Errorf("database error"))
+	service.DifferenceRepo = failingDiffRepo
+	_, err = service.DeleteSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+	require.NoError(t, err)
+	_, err = service.RestoreSnapshot(ctx, "192.168.1.1", "2025-01-01T12:00:00Z")
+	assert.ErrorContains(t, err, "Failed to remove stored differences")
+	err = service.CreateSnapshot(ctx, createMultipartFile(validSnapshotContent), filename)
+	assert.ErrorContains(t, err, "Failed to remove stored differences")
+	_, err = snapshotRepo.GetSnapshotByTimeStamp(ctx, "192.168.1.1", lookupJan1)
+	assert.ErrorIs(t, err, repo.ErrNotFound, "the upload is rolled back")
+}
+
+func TestSnapshotService_RestoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := timestamp.Add(time.Hour)
+	deleted := repo.Snapshot{UUID: uuid.New(), Host_IP: "192.168.1.1", Timestamp: timestamp, Status: repo.StatusDeleted, Deleted_At: &deletedAt}
+
+	tests := []struct {
+		name          string
+		hostIP        string
+		deletedError  error
+		committed     bool
+		expectedError error
+	}{
+		{name: "restores deleted snapshot", hostIP: "192.168.1.1"},
+		{name: "invalid ip", hostIP: "not-an-ip", expectedError: hostip.ErrInvalid},
+		{name: "no deleted snapshot", hostIP: "192.168.1.1", deletedError: repo.ErrNotFound, expectedError: repo.ErrNotFound},
+		{name: "replaced by a new upload", hostIP: "192.168.1.1", committed: true, expectedError: ErrDuplicateSnapshot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockSnapshotRepo{}
+			service := NewSnapshotService(mockRepo, blobstore.NewMemoryStore())
+			mockRepo.On("GetDeletedSnapshotByTimeStamp", ctx, deleted.Host_IP, timestamp).Return(deleted, tt.deletedError)
+			if tt.committed {
+				mockRepo.On("GetSnapshotByTimeStamp", ctx, deleted.Host_IP, timestamp).Return(repo.Snapshot{UUID: uuid.New()}, nil)
+			} else {
+				mockRepo.On("GetSnapshotByTimeStamp", ctx, deleted.Host_IP, timestamp).Return(repo.Snapshot{}, repo.ErrNotFound)
+			}
+			mockRepo.On("Restore", ctx, deleted.UUID).Return(nil)
+
+			result, err := service.RestoreSnapshot(ctx, tt.hostIP, "2025-01-01T12:00:00Z")
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				mockRepo.AssertNotCalled(t, "Restore", ctx, deleted.UUID)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, repo.StatusCommitted, result.Status)
+			assert.Nil(t, result.Deleted_At)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/diff"
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/repo"
+)
+
+// TimelineEvent is one change of a host, between the snapshots taken at From and To
+type TimelineEvent struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	diff.Change
+}
+
+// Timeline is a page of the changes of a host. Snapshots are the timestamps walked, in the order of the listing,
+// and Next is the cursor of the following page, empty on the last page.
+type Timeline struct {
+	Host_IP   string          `json:"ip"`
+	Snapshots []time.Time     `json:"snapshots"`
+	Events    []TimelineEvent `json:"events"`
+	Next      string          `json:"-"`
+}
+
+type TimelineService struct {
+	snapshotService    *SnapshotService
+	differencesService *DifferencesService
+}
+
+// NewTimelineService creates the timeline service, listing snapshots with snapshotService and comparing them with
+// differencesService, so stored differences are used and new ones stored
+func NewTimelineService(snapshotService *SnapshotService, differencesService *DifferencesService) *TimelineService {
+	return &TimelineService{
+		snapshotService:    snapshotService,
+		differencesService: differencesService,
+	}
+}
+
+// GetTimeline walks a page of a host's snapshots and compares each consecutive pair
+//
+// Summary: Snapshots are listed as for SnapshotService.ListSnapshotsForHost, and options.Since and options.Until
+// bound them. Each pair is compared from the earlier snapshot to the later one, and its changes are events bounded
+// by the two timestamps. The events are in the order of the listing, so with Sort "desc" the latest change is first.
+// A page with a cursor also compares the last snapshot of the previous page with its first, so that no change is
+// lost between pages. Pairs where either snapshot is not a valid host snapshot have no events.
+//
+// Responses:
+//   - Timeline: the events of the page
+//   - error: hostip.ErrInvalid or ErrInvalidListOptions for bad input, or error if a snapshot cannot be read {nil | error}
+func (service *TimelineService) GetTimeline(ctx context.Context, host_ip string, options ListOptions) (Timeline, error) {
+	host_ip, err := hostip.Canonical(host_ip)
+	if err != nil {
+		return Timeline{}, err
+	}
+	snapshots, next, err := service.snapshotService.SnapshotsInRange(ctx, host_ip, options)
+	if err != nil {
+		return Timeline{}, err
+	}
+	if options.Cursor != "" {
+		previous, err := service.previousPageSnapshot(ctx, host_ip, options.Cursor)
+		if err != nil {
+			return Timeline{}, err
+		}
+		if previous != nil {
+			snapshots = append([]repo.Snapshot{*previous}, snapshots...)
+		}
+	}
+
+	timeline := Timeline{Host_IP: host_ip, Snapshots: []time.Time{}, Events: []TimelineEvent{}, Next: next}
+	for i, snapshot := range snapshots {
+		timeline.Snapshots = append(timeline.Snapshots, snapshot.Timestamp)
+		if i == 0 {
+			continue
+		}
+		earlier, later := snapshots[i-1], snapshot
+		if later.Timestamp.Before(earlier.Timestamp) {
+			earlier, later = later, earlier
+		}
+		_, _, changes, err := service.differencesService.GetDifferences(ctx, earlier, later)
+		if err != nil {
+			return Timeline{}, err
+		}
+		for _, change := range changes {
+			timeline.Events = append(timeline.Events, TimelineEvent{From: earlier.Timestamp, To: later.Timestamp, Change: change})
+		}
+	}
+	return timeline, nil
+}
+
+// previousPageSnapshot returns the last snapshot of the page a cursor was made for, or nil if it has been deleted
+func (service *TimelineService) previousPageSnapshot(ctx context.Context, host_ip string, cursor string) (*repo.Snapshot, error) {
+	timestamp, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := service.snapshotService.GetSnapshot(ctx, host_ip, timestamp)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
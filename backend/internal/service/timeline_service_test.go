@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/blobstore"
+	"github.com/endingwithali/2025censys/internal/diff"
+	"github.com/endingwithali/2025censys/internal/hostip"
+	"github.com/endingwithali/2025censys/internal/repo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTimelineServices creates services over in-memory stores with three snapshots of 10.0.0.1, a day apart from
+// jan1: HTTPS is added by the second and the HTTP status changes in the third
+func newTimelineServices(t *testing.T) (*SnapshotService, blobstore.BlobStore) {
+	blobStore := blobstore.NewMemoryStore()
+	snapshotService := NewSnapshotService(repo.NewMemorySnapshotRepo(), blobStore)
+	services := []string{
+		`{"port": 80, "protocol": "HTTP", "status": 200}`,
+		`{"port": 80, "protocol": "HTTP", "status": 200}, {"port": 443, "protocol": "HTTPS", "status": 200}`,
+		`{"port": 80, "protocol": "HTTP", "status": 301}, {"port": 443, "protocol": "HTTPS", "status": 200}`,
+	}
+	for i, service := range services {
+		count := strings.Count(service, "port")
+		contents := fmt.Sprintf(`{"timestamp": %q, "ip": "10.0.0.1", "services": [%s], "service_count": %d}`, lookupJan1.Add(time.Duration(i)*24*time.Hour).Format(time.RFC3339), service, count)
+		require.NoError(t, snapshotService.CreateSnapshotFromBody(context.Background(), strings.NewReader(contents)))
+	}
+	return snapshotService, blobStore
+}
+
+func TestTimelineService_GetTimeline(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name              string
+		options           ListOptions
+		expectedSnapshots []time.Duration
+		expectedEvents    []diff.ChangeType
+		expectedFrom      []time.Duration
+	}{
+		{
+			name:              "all",
+			expectedSnapshots: []time.Duration{0, day, 2 * day},
+			expectedEvents:    []diff.ChangeType{diff.ServiceAdded, diff.StatusChanged},
+			expectedFrom:      []time.Duration{0, day},
+		},
+		{
+			name:              "descending",
+			options:           ListOptions{Sort: "desc"},
+			expectedSnapshots: []time.Duration{2 * day, day, 0},
+			expectedEvents:    []diff.ChangeType{diff.StatusChanged, diff.ServiceAdded},
+			expectedFrom:      []time.Duration{day, 0},
+		},
+		{
+			name:              "range",
+			options:           ListOptions{Since: "2025-01-02T00:00:00Z"},
+			expectedSnapshots: []time.Duration{day, 2 * day},
+			expectedEvents:    []diff.ChangeType{diff.StatusChanged},
+			expectedFrom:      []time.Duration{day},
+		},
+		{
+			name:              "one snapshot",
+			options:           ListOptions{Until: "2025-01-01T12:00:00Z"},
+			expectedSnapshots: []time.Duration{0},
+		},
+	}
+
+	snapshotService, blobStore := newTimelineServices(t)
+	service := NewTimelineService(snapshotService, NewDifferencesServicet(nil, blobStore))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeline, err := service.GetTimeline(context.Background(), "10.0.0.1", tt.options)
+
+			require.NoError(t, err)
+			assert.Equal(t, "10.0.0.1", timeline.Host_IP)
+			assert.Empty(t, timeline.Next)
+			require.Len(t, timeline.Snapshots, len(tt.expectedSnapshots))
+			for i, offset := range tt.expectedSnapshots {
+				assert.Equal(t, lookupJan1.Add(offset), timeline.Snapshots[i])
+			}
+			require.Len(t, timeline.Events, len(tt.expectedEvents))
+			for i, event := range timeline.Events {
+				assert.Equal(t, tt.expectedEvents[i], event.Type)
+				assert.Equal(t, lookupJan1.Add(tt.expectedFrom[i]), event.From)
+				assert.Equal(t, lookupJan1.Add(tt.expectedFrom[i]+day), event.To)
+			}
+		})
+	}
+}
+
+func TestTimelineService_GetTimeline_Pages(t *testing.T) {
+	ctx := context.Background()
+	snapshotService, blobStore := newTimelineServices(t)
+	service := NewTimelineService(snapshotService, NewDifferencesServicet(nil, blobStore))
+
+	first, err := service.GetTimeline(ctx, "10.0.0.1", ListOptions{Limit: "2"})
+	require.NoError(t, err)
+	require.Len(t, first.Events, 1)
+	assert.Equal(t, diff.ServiceAdded, first.Events[0].Type)
+	require.NotEmpty(t, first.Next)
+
+	// The change between the pages is on the second page, which starts from the last snapshot of the first
+	second, err := service.GetTimeline(ctx, "10.0.0.1", ListOptions{Limit: "2", Cursor: first.Next})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{lookupJan1.Add(24 * time.Hour), lookupJan1.Add(48 * time.Hour)}, second.Snapshots)
+	require.Len(t, second.Events, 1)
+	assert.Equal(t, diff.StatusChanged, second.Events[0].Type)
+	assert.Empty(t, second.Next)
+}
+
+func TestTimelineService_GetTimeline_StoredDifferences(t *testing.T) {
+	ctx := context.Background()
+	snapshotService, blobStore := newTimelineServices(t)
+	day1, day2, day3 := lookupJan1, lookupJan1.Add(24*time.Hour), lookupJan1.Add(48*time.Hour)
+
+	differenceRepo := new(MockDifferenceRepo)
+	stored := repo.Differences{JSON_Data: `{"DiffStatus":"NoMatch","Differences":"","Changes":[{"type":"vuln_added","port":443,"protocol":"HTTPS"}]}`}
+	differenceRepo.On("CheckForComparison", mock.Anything, "10.0.0.1", day1, day2).Return(stored, true, nil)
+	differenceRepo.On("CheckForComparison", mock.Anything, "10.0.0.1", day2, day3).Return(repo.Differences{}, false, nil)
+	differenceRepo.On("Insert", mock.Anything, mock.MatchedBy(func(difference repo.Differences) bool {
+		return difference.Timestamp1.Equal(day2) && difference.Timestamp2.Equal(day3)
+	})).Return(nil).Once()
+
+	service := NewTimelineService(snapshotService, NewDifferencesServicet(differenceRepo, blobStore))
+	timeline, err := service.GetTimeline(ctx, "10.0.0.1", ListOptions{})
+
+	require.NoError(t, err)
+	require.Len(t, timeline.Events, 2)
+	assert.Equal(t, diff.VulnAdded, timeline.Events[0].Type)
+	assert.Equal(t, diff.StatusChanged, timeline.Events[1].Type)
+	differenceRepo.AssertExpectations(t)
+}
+
+func TestTimelineService_GetTimeline_Errors(t *testing.T) {
+	ctx := context.Background()
+	snapshotService, blobStore := newTimelineServices(t)
+	service := NewTimelineService(snapshotService, NewDifferencesServicet(nil, blobStore))
+
+	_, err := service.GetTimeline(ctx, "not-an-ip", ListOptions{})
+	assert.ErrorIs(t, err, hostip.ErrInvalid)
+	_, err = service.GetTimeline(ctx, "10.0.0.1", ListOptions{Cursor: "!"})
+	assert.ErrorIs(t, err, ErrInvalidListOptions)
+
+	timeline, err := service.GetTimeline(ctx, "::ffff:10.0.0.2", ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", timeline.Host_IP)
+	assert.Empty(t, timeline.Snapshots)
+	assert.Empty(t, timeline.Events)
+}
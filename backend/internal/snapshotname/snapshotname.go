@@ -0,0 +1,120 @@
+package snapshotname
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/endingwithali/2025censys/internal/hostip"
+)
+
+// fileNameRegex matches host_<ip>_<YYYY-MM-DD>T<HH-MM-SS>[.fraction](Z|±HH-MM).json
+var fileNameRegex = regexp.MustCompile(
+	`^host_` +
+		`((?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]*-[0-9A-Fa-f.\-]*)_` + // IPv4 or dash-encoded IPv6
+		`(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}(?:\.\d+)?(?:Z|[+\-]\d{2}-\d{2}))` + // file-safe timestamp
+		`\.json$`,
+)
+
+// fileSafeTimestampRegex splits a file-safe timestamp (colons replaced by dashes) into its parts
+var fileSafeTimestampRegex = regexp.MustCompile(
+	`^(\d{4}-\d{2}-\d{2})T` + // date
+		`(\d{2})-(\d{2})-(\d{2})` + // time HH-MM-SS (dashes instead of colons)
+		`(\.\d+)?` + // optional fractional seconds
+		`(Z|[+\-]\d{2}-\d{2})$`, // Z or ±HH-MM (dash instead of colon)
+)
+
+// Match reports whether filename has the host_<ip>_<timestamp>.json shape, without checking that the IP and
+// timestamp are valid values
+func Match(filename string) bool {
+	return fileNameRegex.MatchString(filename)
+}
+
+// Parse reads the host IP and timestamp from a snapshot filename
+//
+// Summary: Parse the filename format
+// Expected Format:
+//
+//	host_<ip>_<YYYY-MM-DD>T<HH-MM-SS>[.fraction](Z|±HH-MM).json
+//	- IP is IPv4, or IPv6 with colons replaced by dashes (2001:db8::1 -> 2001-db8--1)
+//	- Timestamp will be ISO 8601 format, with colons replaced by dashes
+//
+// Example:
+// Parse("host_125.199.235.74_2025-09-10T08-30-00.5+05-30.json") -> "125.199.235.74", 2025-09-10T03:00:00.5Z
+//
+// Returns:
+//   - string: canonical host IP
+//   - time.Time: timestamp normalized by NormalizeTime
+//   - error: error if the filename does not match or has an invalid IP or timestamp {nil | error}
+func Parse(filename string) (string, time.Time, error) {
+	m := fileNameRegex.FindStringSubmatch(filename)
+	if m == nil {
+		return "", time.Time{}, fmt.Errorf("filename %q does not match expected pattern host_<ip>_<timestamp>.json", filename)
+	}
+
+	ip, err := hostip.FromFileName(m[1])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid IP address in filename: %q", m[1])
+	}
+
+	timestamp, err := parseFileSafeTimestamp(m[2])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid timestamp in filename: %q: %w", m[2], err)
+	}
+	return ip, timestamp, nil
+}
+
+// Format builds the canonical filename for a host snapshot. Parse(Format(ip, t)) returns ip and NormalizeTime(t).
+//
+// Example:
+// Format("2001:db8::1", 2025-09-10T03:00:00Z) -> "host_2001-db8--1_2025-09-10T03-00-00Z.json"
+func Format(hostIP string, timestamp time.Time) string {
+	return fmt.Sprintf("host_%s_%s.json", hostip.ToFileName(hostIP), NormalizeTime(timestamp).Format("2006-01-02T15-04-05.999999Z"))
+}
+
+// ParseTimestamp reads a timestamp given in a query string
+//
+// Summary: Accepts RFC 3339 (2025-09-10T03:00:00Z), with optional fractional seconds and ±HH:MM offsets, and the
+// file-safe form used in filenames (2025-09-10T03-00-00Z). A '+' offset that was decoded to a space by an
+// unescaped query string is also accepted.
+//
+// Returns:
+//   - time.Time: timestamp normalized by NormalizeTime
+//   - error: error if the timestamp is in none of the accepted formats {nil | error}
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	timestamp = strings.TrimSpace(timestamp)
+	if strings.Count(timestamp, " ") == 1 {
+		timestamp = strings.Replace(timestamp, " ", "+", 1)
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		return NormalizeTime(parsed), nil
+	}
+	if parsed, err := parseFileSafeTimestamp(timestamp); err == nil {
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q is not in RFC 3339 (2006-01-02T15:04:05Z) or file-safe (2006-01-02T15-04-05Z) format", timestamp)
+}
+
+// NormalizeTime converts a timestamp to UTC at the microsecond precision of the snapshot table, so that the same
+// instant always compares equal whichever offset or format it was written in
+func NormalizeTime(timestamp time.Time) time.Time {
+	return timestamp.UTC().Truncate(time.Microsecond)
+}
+
+func parseFileSafeTimestamp(timestamp string) (time.Time, error) {
+	m := fileSafeTimestampRegex.FindStringSubmatch(timestamp)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("expected <YYYY-MM-DD>T<HH-MM-SS>[.fraction](Z|±HH-MM)")
+	}
+	zone := m[6]
+	if zone != "Z" {
+		// ±HH-MM -> ±HH:MM
+		zone = zone[:3] + ":" + zone[4:]
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, fmt.Sprintf("%sT%s:%s:%s%s%s", m[1], m[2], m[3], m[4], m[5], zone))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return NormalizeTime(parsed), nil
+}
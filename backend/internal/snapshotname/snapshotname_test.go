@@ -0,0 +1,232 @@
+package snapshotname
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		filename      string
+		expectedIP    string
+		expectedTime  time.Time
+		expectedError string
+	}{
+		{
+			name:          "valid filename",
+			filename:      "host_192.168.1.1_2025-01-01T12-00-00Z.json",
+			expectedIP:    "192.168.1.1",
+			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "valid filename with different IP",
+			filename:      "host_10.0.0.1_2023-12-25T23-59-59Z.json",
+			expectedIP:    "10.0.0.1",
+			expectedTime:  time.Date(2023, 12, 25, 23, 59, 59, 0, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "valid filename with IPv6",
+			filename:      "host_2001-db8--1_2025-01-01T12-00-00Z.json",
+			expectedIP:    "2001:db8::1",
+			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "valid filename with non canonical IPv6",
+			filename:      "host_2001-DB8-0-0-0-0-0-1_2025-01-01T12-00-00Z.json",
+			expectedIP:    "2001:db8::1",
+			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "invalid filename - invalid IPv6",
+			filename:      "host_2001-db8--1--2_2025-01-01T12-00-00Z.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "invalid IP address",
+		},
+		{
+			name:          "valid filename with fractional seconds",
+			filename:      "host_192.168.1.1_2025-01-01T12-00-00.123Z.json",
+			expectedIP:    "192.168.1.1",
+			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 123000000, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "valid filename with timezone offset is normalized to UTC",
+			filename:      "host_192.168.1.1_2025-01-01T17-30-00+05-30.json",
+			expectedIP:    "192.168.1.1",
+			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "valid filename with negative offset and fraction",
+			filename:      "host_192.168.1.1_2025-01-01T07-00-00.5-05-00.json",
+			expectedIP:    "192.168.1.1",
+			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 500000000, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "fractional seconds are truncated to microseconds",
+			filename:      "host_192.168.1.1_2025-01-01T12-00-00.123456789Z.json",
+			expectedIP:    "192.168.1.1",
+			expectedTime:  time.Date(2025, 1, 1, 12, 0, 0, 123456000, time.UTC),
+			expectedError: "",
+		},
+		{
+			name:          "invalid filename - wrong format",
+			filename:      "invalid.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "does not match expected pattern",
+		},
+		{
+			name:          "invalid filename - wrong prefix",
+			filename:      "file_192.168.1.1_2025-01-01T12-00-00Z.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "does not match expected pattern",
+		},
+		{
+			name:          "invalid filename - wrong extension",
+			filename:      "host_192.168.1.1_2025-01-01T12-00-00Z.txt",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "does not match expected pattern",
+		},
+		{
+			name:          "invalid filename - invalid IP",
+			filename:      "host_999.999.999.999_2025-01-01T12-00-00Z.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "invalid IP address",
+		},
+		{
+			name:          "invalid filename - invalid timestamp",
+			filename:      "host_192.168.1.1_2025-13-01T12-00-00Z.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "invalid timestamp",
+		},
+		{
+			name:          "invalid filename - missing timezone",
+			filename:      "host_192.168.1.1_2025-01-01T12-00-00.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "does not match expected pattern",
+		},
+		{
+			name:          "invalid filename - wrong timezone format",
+			filename:      "host_192.168.1.1_2025-01-01T12-00-00+05:30.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "does not match expected pattern",
+		},
+		{
+			name:          "invalid filename - wrong time separator",
+			filename:      "host_192.168.1.1_2025-01-01T12:00:00Z.json",
+			expectedIP:    "",
+			expectedTime:  time.Time{},
+			expectedError: "does not match expected pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Test
+			ip, timestamp, err := Parse(tt.filename)
+
+			// Assertions
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				assert.Equal(t, "", ip)
+				assert.Equal(t, time.Time{}, timestamp)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedIP, ip)
+				assert.Equal(t, tt.expectedTime, timestamp)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match("host_192.168.1.1_2025-01-01T12-00-00Z.json"))
+	assert.True(t, Match("host_2001-db8--1_2025-01-01T12-00-00.1+05-30.json"))
+	// format only, the IP is checked by Parse
+	assert.True(t, Match("host_999.999.999.999_2025-01-01T12-00-00Z.json"))
+	assert.False(t, Match("host_192.168.1.1_2025-01-01T12:00:00Z.json"))
+	assert.False(t, Match("host_192.168.1.1_2025-01-01T12-00-00.json"))
+}
+
+func TestParseTimestamp(t *testing.T) {
+	expected := time.Date(2025, 9, 10, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		timestamp string
+		expected  time.Time
+		expectErr bool
+	}{
+		{name: "rfc3339", timestamp: "2025-09-10T03:00:00Z", expected: expected},
+		{name: "rfc3339 with offset", timestamp: "2025-09-10T08:30:00+05:30", expected: expected},
+		{name: "rfc3339 with unescaped plus", timestamp: "2025-09-10T08:30:00 05:30", expected: expected},
+		{name: "rfc3339 with fraction", timestamp: "2025-09-10T03:00:00.250Z", expected: expected.Add(250 * time.Millisecond)},
+		{name: "file-safe", timestamp: "2025-09-10T03-00-00Z", expected: expected},
+		{name: "file-safe with offset", timestamp: "2025-09-09T23-00-00-04-00", expected: expected},
+		{name: "date only", timestamp: "2025-09-10", expectErr: true},
+		{name: "garbage", timestamp: "yesterday", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamp, err := ParseTimestamp(tt.timestamp)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, timestamp)
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		timestamp time.Time
+		expected  string
+	}{
+		{
+			name:      "ipv4",
+			ip:        "125.199.235.74",
+			timestamp: time.Date(2025, 9, 10, 3, 0, 0, 0, time.UTC),
+			expected:  "host_125.199.235.74_2025-09-10T03-00-00Z.json",
+		},
+		{
+			name:      "ipv6 with offset and fraction",
+			ip:        "2001:db8::1",
+			timestamp: time.Date(2025, 9, 10, 8, 30, 0, 500000000, time.FixedZone("IST", 5*3600+1800)),
+			expected:  "host_2001-db8--1_2025-09-10T03-00-00.5Z.json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := Format(tt.ip, tt.timestamp)
+			assert.Equal(t, tt.expected, filename)
+
+			ip, timestamp, err := Parse(filename)
+			require.NoError(t, err)
+			assert.Equal(t, tt.ip, ip)
+			assert.True(t, tt.timestamp.Equal(timestamp))
+		})
+	}
+}
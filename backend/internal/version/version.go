@@ -0,0 +1,132 @@
+// Package version orders software version strings and parses version ranges.
+//
+// Versions are compared by dot-separated segment, numerically by the leading digits of each segment and then as
+// text by the rest of it, so 1.9 < 1.10 < 1.10.1 < 1.10.1-ubuntu < 1.10a. A leading "v" is ignored, and trailing
+// zero segments do not count, so 1.24 and 1.24.0 are equal. Key turns a version into a string with the same order,
+// so that versions can be compared by a database.
+package version
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRange is returned (wrapped) for a version range that cannot be parsed
+var ErrInvalidRange = errors.New("Invalid version range")
+
+// Key returns a string whose byte order is the order of the versions, "" for an empty version. The number of each
+// segment is written without leading zeros after its length, and the length after its own number of digits, so that
+// a longer number sorts after a shorter one whatever its length.
+//
+// Example:
+// Key("1.24.0") -> "111.1224"
+// Key("v2.4.58-ubuntu") -> "112.114.1258-ubuntu"
+// Key("20250101123045") -> "21420250101123045"
+func Key(version string) string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if len(version) > 1 && version[0] == 'v' && isDigit(version[1]) {
+		version = version[1:]
+	}
+	segments := strings.Split(version, ".")
+	for len(segments) > 1 && isZero(segments[len(segments)-1]) {
+		segments = segments[:len(segments)-1]
+	}
+	for i, segment := range segments {
+		digits := 0
+		for digits < len(segment) && isDigit(segment[digits]) {
+			digits++
+		}
+		if digits == 0 {
+			continue
+		}
+		number := strings.TrimLeft(segment[:digits], "0")
+		if number == "" {
+			number = "0"
+		}
+		length := strconv.Itoa(len(number))
+		segments[i] = strconv.Itoa(len(length)) + length + number + segment[digits:]
+	}
+	return strings.Join(segments, ".")
+}
+
+// Compare returns -1, 0 or 1 as version a is before, equal to or after version b
+func Compare(a string, b string) int {
+	return strings.Compare(Key(a), Key(b))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isZero(segment string) bool {
+	return segment != "" && strings.Trim(segment, "0") == ""
+}
+
+// Comparison operators of a Constraint
+const (
+	OpEqual        = "="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+)
+
+// Constraint is one bound of a version range, e.g. "< 1.24". Key is the Key of Version.
+type Constraint struct {
+	Op      string
+	Version string
+	Key     string
+}
+
+// Matches reports whether a version is within the constraint. An empty version matches no constraint.
+func (constraint Constraint) Matches(version string) bool {
+	key := Key(version)
+	if key == "" {
+		return false
+	}
+	switch constraint.Op {
+	case OpLess:
+		return key < constraint.Key
+	case OpLessEqual:
+		return key <= constraint.Key
+	case OpGreater:
+		return key > constraint.Key
+	case OpGreaterEqual:
+		return key >= constraint.Key
+	default:
+		return key == constraint.Key
+	}
+}
+
+// ParseRange parses comma-separated constraints, all of which a version must match, e.g. ">=1.20,<1.24". A
+// constraint without an operator is an exact version.
+//
+// Returns:
+//   - []Constraint: the constraints, empty for an empty range
+//   - error: wraps ErrInvalidRange if a constraint has no version {nil | error}
+func ParseRange(text string) ([]Constraint, error) {
+	constraints := []Constraint{}
+	if strings.TrimSpace(text) == "" {
+		return constraints, nil
+	}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		op := OpEqual
+		// Two character operators first, so that "<=" is not read as "<" of "=1.2"
+		for _, candidate := range []string{OpLessEqual, OpGreaterEqual, OpLess, OpGreater, OpEqual} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				part = strings.TrimSpace(strings.TrimPrefix(part, candidate))
+				break
+			}
+		}
+		key := Key(part)
+		if key == "" || strings.ContainsAny(part, "<>=") {
+			return nil, fmt.Errorf("%w: %q, expected versions with an optional operator (%s, %s, %s, %s, %s), separated by commas", ErrInvalidRange, text, OpEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual)
+		}
+		constraints = append(constraints, Constraint{Op: op, Version: part, Key: key})
+	}
+	return constraints, nil
+}
@@ -0,0 +1,108 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"1.9", "1.10", -1},
+		{"1.10", "1.10.1", -1},
+		{"1.24", "1.24.0", 0},
+		{"v1.24.0", "1.24", 0},
+		{"1.10.1", "1.10.1-ubuntu", -1},
+		{"1.10.1-ubuntu", "1.10.2", -1},
+		{"1.10-ubuntu", "1.10.1", -1},
+		{"1.10.1-ubuntu", "1.10a", -1},
+		{"2.4.58", "2.4.6", 1},
+		{"OpenSSH_8.9", "openssh_8.9", 0},
+		{"010.1", "10.1", 0},
+		{"12345678901.0", "2.0", 1},
+		{"1.20250101123045", "1.9999999999", 1},
+		{"1.20250101123045", "1.20250101123046", -1},
+		{"0.0.1", "0.1", -1},
+		{"1.0", "1.a", -1},
+		{"", "0.1", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Compare(tt.a, tt.b))
+			assert.Equal(t, -tt.expected, Compare(tt.b, tt.a))
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"1.24.0", "111.1224"},
+		{"v2.4.58-ubuntu", "112.114.1258-ubuntu"},
+		{"20250101123045", "21420250101123045"},
+		{"0", "110"},
+		{"beta", "beta"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Key(tt.version))
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		matches   []string
+		misses    []string
+		expectErr bool
+	}{
+		{name: "less than", text: "<1.24", matches: []string{"1.23.9", "1.9"}, misses: []string{"1.24", "1.24.0", "1.24.1", ""}},
+		{name: "between", text: ">= 1.20, < 1.24", matches: []string{"1.20", "1.22.1"}, misses: []string{"1.19.9", "1.24"}},
+		{name: "inclusive upper", text: "<=2.4.58", matches: []string{"2.4.58", "2.4.6"}, misses: []string{"2.4.59"}},
+		{name: "greater than", text: ">8.9", matches: []string{"8.9p1", "9.0"}, misses: []string{"8.9.0"}},
+		{name: "long segments", text: ">=20250101000000", matches: []string{"20250101123045", "100000000000000"}, misses: []string{"9999999999", "2025010112304"}},
+		{name: "exact", text: "1.24", matches: []string{"1.24.0", "v1.24"}, misses: []string{"1.24.1"}},
+		{name: "exact with operator", text: "=1.24", matches: []string{"1.24"}},
+		{name: "empty", text: " "},
+		{name: "no version", text: "<", expectErr: true},
+		{name: "empty constraint", text: ">1.0,", expectErr: true},
+		{name: "unknown operator", text: "=<1.0", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraints, err := ParseRange(tt.text)
+			if tt.expectErr {
+				assert.ErrorIs(t, err, ErrInvalidRange)
+				return
+			}
+			require.NoError(t, err)
+			matchesAll := func(version string) bool {
+				for _, constraint := range constraints {
+					if !constraint.Matches(version) {
+						return false
+					}
+				}
+				return true
+			}
+			for _, version := range tt.matches {
+				assert.True(t, matchesAll(version), version)
+			}
+			for _, version := range tt.misses {
+				assert.False(t, matchesAll(version), version)
+			}
+		})
+	}
+}
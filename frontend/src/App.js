@@ -8,6 +8,23 @@ import DiffViewer from './components/DiffViewer';
 
 const API_BASE_URL = 'http://localhost:8080/api';
 
+// Listings are paginated, fetch every page by following the rel="next" Link header
+const fetchAllPages = async (url) => {
+  let items = [];
+  let next = url;
+  while (next) {
+    const response = await fetch(next);
+    if (!response.ok) {
+      throw new Error(`Request failed with status ${response.status}`);
+    }
+    items = items.concat(await response.json());
+    const link = response.headers.get('Link');
+    const match = link && link.match(/<([^>]+)>;\s*rel="next"/);
+    next = match ? new URL(match[1], url).toString() : null;
+  }
+  return items;
+};
+
 function App() {
   const [hosts, setHosts] = useState([]);
   const [selectedHost, setSelectedHost] = useState(null);
@@ -25,11 +42,8 @@ function App() {
 
   const fetchHosts = async () => {
     try {
-      const response = await fetch(`${API_BASE_URL}/host/all`);
-      if (response.ok) {
-        const hostsData = await response.json();
-        setHosts(hostsData);
-      }
+      const hostsData = await fetchAllPages(`${API_BASE_URL}/host/all`);
+      setHosts(hostsData);
     } catch (error) {
       console.error('Error fetching hosts:', error);
     }
@@ -49,11 +63,8 @@ function App() {
     setDiffContent(null);
     
     try {
-      const response = await fetch(`${API_BASE_URL}/host?ip=${host}`);
-      if (response.ok) {
-        const timestampsData = await response.json();
-        setTimestamps(timestampsData);
-      }
+      const timestampsData = await fetchAllPages(`${API_BASE_URL}/host?ip=${encodeURIComponent(host)}`);
+      setTimestamps(timestampsData);
     } catch (error) {
       console.error('Error fetching timestamps:', error);
     }